@@ -0,0 +1,33 @@
+package dynarag
+
+import (
+	"log/slog"
+)
+
+// AccessReport explains how access control shaped a retrieval, for audit logs
+type AccessReport struct {
+	Principals []string // the principals the chunks were checked against
+	Requested  int      // the number of chunks asked for
+	Withheld   int      // chunks among the Requested nearest that the caller may not see
+}
+
+// reportAccess fills the access report of the call, if it asked for one, and logs the
+// chunks that were withheld
+func reportAccess(queryCfg *queryConfig, requested int, withheld int) {
+	principals := queryCfg.principals()
+	if withheld > 0 {
+		slog.Info(
+			"Access control withheld restricted chunks",
+			"principals", principals,
+			"requested", requested,
+			"withheld", withheld,
+		)
+	}
+	if queryCfg.access != nil {
+		*queryCfg.access = AccessReport{
+			Principals: principals,
+			Requested:  requested,
+			Withheld:   withheld,
+		}
+	}
+}
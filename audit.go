@@ -0,0 +1,182 @@
+package dynarag
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+
+	"github.com/Predixus/DynaRAG/internal/store"
+	"github.com/Predixus/DynaRAG/types"
+)
+
+// AuditOperation names an operation recorded in the audit log
+type AuditOperation string
+
+const (
+	AuditChunk           AuditOperation = "chunk"
+	AuditIngest          AuditOperation = "ingest"
+	AuditImport          AuditOperation = "import"
+	AuditPurge           AuditOperation = "purge"
+	AuditDeleteDocument  AuditOperation = "delete_document"
+	AuditRenameDocument  AuditOperation = "rename_document"
+	AuditRestore         AuditOperation = "restore"
+	AuditEmptyTrash      AuditOperation = "empty_trash"
+	AuditVacuum          AuditOperation = "vacuum"
+	AuditPurgeCollection AuditOperation = "purge_collection"
+	AuditRetrieve        AuditOperation = "retrieve" // Similar, Query, QueryStream and Ask
+	AuditList            AuditOperation = "list"
+	AuditExport          AuditOperation = "export"
+)
+
+// ErrAuditChainBroken is returned by VerifyAuditLog when an entry has been altered or
+// removed
+var ErrAuditChainBroken = store.ErrAuditChainBroken
+
+// AuditEntry is a recorded operation
+type AuditEntry struct {
+	ID         int64
+	OccurredAt time.Time
+	Operation  AuditOperation
+	Principal  string // the caller, see ContextWithIdentity
+	Groups     []string
+	Collection string
+	FilePaths  []string // the documents added, deleted or retrieved
+	ChunkIDs   []int64  // the chunks added or retrieved
+	Query      string   // the text retrieved with
+	Filter     types.JSONMap
+	Hash       string // empty unless Config.AuditHashChain was set when it was recorded
+}
+
+// AuditFilter selects audit entries. Zero fields match every entry
+type AuditFilter struct {
+	Operation AuditOperation
+	Principal string
+	FilePath  string // only entries that touched this document
+	Since     time.Time
+	Until     time.Time
+	Limit     int // defaults to 1000
+}
+
+type identityKey struct{}
+
+// ContextWithIdentity returns a context carrying the caller of the operations it is passed
+// to, as recorded in the audit log
+func ContextWithIdentity(ctx context.Context, identity types.Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, identity)
+}
+
+// IdentityFromContext returns the caller carried by the context, if any
+func IdentityFromContext(ctx context.Context) (types.Identity, bool) {
+	identity, ok := ctx.Value(identityKey{}).(types.Identity)
+	return identity, ok
+}
+
+// audit records an operation in the audit log when Config.Audit is set. The caller comes
+// from the context and the collection from the handle, unless the entry names one.
+// Failures are logged rather than returned, as the operation has already taken place
+func (c *Client) audit(ctx context.Context, entry AuditEntry) {
+	if !c.config.Audit {
+		return
+	}
+
+	if identity, ok := IdentityFromContext(ctx); ok && entry.Principal == "" {
+		entry.Principal = identity.Principal
+		entry.Groups = identity.Groups
+	}
+	if postgres, ok := c.store.(*store.Postgres); ok && entry.Collection == "" {
+		entry.Collection = postgres.Scope().Collection
+	}
+
+	_, err := store.AppendAudit(ctx, c.config.PostgresConnStr, c.tenant, store.CreateAuditEntryParams{
+		Operation:  string(entry.Operation),
+		Principal:  entry.Principal,
+		Groups:     entry.Groups,
+		Collection: entry.Collection,
+		FilePaths:  entry.FilePaths,
+		ChunkIds:   entry.ChunkIDs,
+		Query:      entry.Query,
+		Filter:     entry.Filter,
+	}, c.config.AuditHashChain)
+	if err != nil {
+		slog.Error("Failed to record audit entry", "operation", entry.Operation, "error", err)
+	}
+}
+
+// auditRetrieval records the chunks a retrieval returned. Calls without an identity in
+// the context are attributed to the identity given by WithIdentity, if any
+func (c *Client) auditRetrieval(
+	ctx context.Context,
+	query string,
+	metadata *types.JSONMap,
+	queryCfg *queryConfig,
+	rows []store.FindTopKNNEmbeddingsRow,
+) {
+	entry := AuditEntry{Operation: AuditRetrieve, Query: query}
+	if _, ok := IdentityFromContext(ctx); !ok && queryCfg.identity != nil {
+		entry.Principal = queryCfg.identity.Principal
+		entry.Groups = queryCfg.identity.Groups
+	}
+	if metadata != nil {
+		entry.Filter = *metadata
+	}
+	for _, row := range rows {
+		entry.ChunkIDs = append(entry.ChunkIDs, row.ID)
+		if !slices.Contains(entry.FilePaths, row.FilePath) {
+			entry.FilePaths = append(entry.FilePaths, row.FilePath)
+		}
+	}
+	c.audit(ctx, entry)
+}
+
+// AuditLog returns the recorded operations of the tenant matching the filter, oldest
+// first. Operations are only recorded when Config.Audit is set
+func (c *Client) AuditLog(ctx context.Context, filter AuditFilter) ([]AuditEntry, error) {
+	if err := c.requirePostgres("audit log"); err != nil {
+		return nil, err
+	}
+
+	params := store.ListAuditLogParams{
+		Operation:  pgtype.Text{String: string(filter.Operation), Valid: filter.Operation != ""},
+		Principal:  pgtype.Text{String: filter.Principal, Valid: filter.Principal != ""},
+		FilePath:   pgtype.Text{String: filter.FilePath, Valid: filter.FilePath != ""},
+		Since:      pgtype.Timestamptz{Time: filter.Since, Valid: !filter.Since.IsZero()},
+		Until:      pgtype.Timestamptz{Time: filter.Until, Valid: !filter.Until.IsZero()},
+		MaxEntries: int32(filter.Limit),
+	}
+	rows, err := store.ListAudit(ctx, c.config.PostgresConnStr, c.tenant, params)
+	if err != nil {
+		slog.Error("Failed to read audit log", "error", err)
+		return nil, err
+	}
+
+	entries := make([]AuditEntry, len(rows))
+	for i, row := range rows {
+		entries[i] = AuditEntry{
+			ID:         row.ID,
+			OccurredAt: row.OccurredAt.Time,
+			Operation:  AuditOperation(row.Operation),
+			Principal:  row.Principal,
+			Groups:     row.Groups,
+			Collection: row.Collection,
+			FilePaths:  row.FilePaths,
+			ChunkIDs:   row.ChunkIds,
+			Query:      row.Query,
+			Filter:     row.Filter,
+			Hash:       row.Hash.String,
+		}
+	}
+	return entries, nil
+}
+
+// VerifyAuditLog recomputes the hash chain of the tenant's audit log and returns the
+// number of entries it covers. An entry that was altered, or removed from between two
+// others, fails with ErrAuditChainBroken
+func (c *Client) VerifyAuditLog(ctx context.Context) (int, error) {
+	if err := c.requirePostgres("verify audit log"); err != nil {
+		return 0, err
+	}
+	return store.VerifyAuditChain(ctx, c.config.PostgresConnStr, c.tenant)
+}
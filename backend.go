@@ -0,0 +1,67 @@
+package dynarag
+
+import (
+	"fmt"
+
+	"github.com/Predixus/DynaRAG/internal/store"
+)
+
+// Backend selects where chunks and their embeddings are stored
+type Backend string
+
+const (
+	// BackendPostgres stores chunks in Postgres with pgvector. It is the default
+	BackendPostgres Backend = "postgres"
+	// BackendMemory stores chunks in process, for tests and embedded use. Operations
+	// that need Postgres, such as sessions and usage tracking, return ErrUnsupported
+	BackendMemory Backend = "memory"
+)
+
+// ErrUnsupported is returned for operations the configured backend does not provide
+var ErrUnsupported = store.ErrUnsupported
+
+// MemoryConfig configures the BackendMemory store
+type MemoryConfig = store.MemoryConfig
+
+// MemoryIndex is the nearest neighbour index of the BackendMemory store
+type MemoryIndex = store.MemoryIndex
+
+const (
+	MemoryIndexFlat = store.MemoryIndexFlat
+	MemoryIndexHNSW = store.MemoryIndexHNSW
+)
+
+// newStore creates the store of the configured backend
+func newStore(cfg Config) (store.Store, error) {
+	switch cfg.Backend {
+	case BackendPostgres:
+		return store.NewPostgres(cfg.PostgresConnStr), nil
+	case BackendMemory:
+		return store.NewMemory(cfg.Memory)
+	default:
+		return nil, fmt.Errorf("unsupported backend: %s", cfg.Backend)
+	}
+}
+
+// requirePostgres fails operations that are only provided by the Postgres backend
+func (c *Client) requirePostgres(operation string) error {
+	if c.config.Backend != BackendPostgres {
+		return fmt.Errorf("%s: %w (backend %s)", operation, ErrUnsupported, c.config.Backend)
+	}
+	return nil
+}
+
+// Snapshot saves the BackendMemory store to MemoryConfig.SnapshotPath
+func (c *Client) Snapshot() error {
+	memory, ok := c.store.(*store.Memory)
+	if !ok {
+		return fmt.Errorf("snapshot: %w (backend %s)", ErrUnsupported, c.config.Backend)
+	}
+	return memory.Snapshot()
+}
+
+// Close releases the client. The BackendMemory store is snapshot first if a snapshot
+// path is configured
+func (c *Client) Close() error {
+	return c.store.Close()
+}
@@ -0,0 +1,115 @@
+package dynarag
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/Predixus/DynaRAG/internal/store"
+)
+
+// ChangeEvent is a change to a chunk of the collection, see Subscribe
+type ChangeEvent = store.Change
+
+// ChangeOperation is the kind of change a ChangeEvent reports
+type ChangeOperation = store.ChangeOperation
+
+const (
+	ChangeInsert    = store.ChangeInsert
+	ChangeDelete    = store.ChangeDelete
+	ChangeTrash     = store.ChangeTrash
+	ChangeRestore   = store.ChangeRestore
+	ChangeSupersede = store.ChangeSupersede
+	ChangeReconnect = store.ChangeReconnect
+)
+
+const (
+	// subscribeBuffer is the number of events held for a slow subscriber before the feed
+	// waits for it
+	subscribeBuffer = 64
+
+	minReconnectDelay = 500 * time.Millisecond
+	maxReconnectDelay = 30 * time.Second
+)
+
+// Subscribe follows the chunks of the collection as they are inserted, trashed, restored,
+// superseded by a newer version of their document and deleted, through Postgres
+// LISTEN/NOTIFY on the channel of the client's tenant. Events are sent once their
+// transaction commits. When the connection drops the feed reconnects with backoff and
+// sends a ChangeReconnect event, as changes made in between are lost. The channel is
+// closed once ctx is done
+func (c *Client) Subscribe(ctx context.Context) (<-chan ChangeEvent, error) {
+	if err := c.requirePostgres("subscribe"); err != nil {
+		return nil, err
+	}
+
+	scope := c.store.(*store.Postgres).Scope()
+	listener, err := store.ListenChanges(ctx, c.config.PostgresConnStr, scope.Tenant)
+	if err != nil {
+		slog.Error("Failed to listen for changes", "error", err)
+		return nil, err
+	}
+
+	events := make(chan ChangeEvent, subscribeBuffer)
+	go c.followChanges(ctx, listener, scope, events)
+	return events, nil
+}
+
+// followChanges sends the changes of the scope to events until ctx is done, reconnecting
+// whenever the listener fails. The changes of every collection of the tenant arrive on its
+// channel, so those of other collections are dropped here
+func (c *Client) followChanges(
+	ctx context.Context,
+	listener *store.ChangeListener,
+	scope store.Scope,
+	events chan<- ChangeEvent,
+) {
+	defer close(events)
+
+	for {
+		change, err := listener.Next(ctx)
+		if err != nil {
+			listener.Close(context.Background())
+			if ctx.Err() != nil {
+				return
+			}
+			slog.Warn("Lost the change feed, reconnecting", "error", err)
+
+			listener = c.relisten(ctx, scope.Tenant)
+			if listener == nil {
+				return
+			}
+			change = ChangeEvent{Operation: ChangeReconnect, TenantID: scope.Tenant, Collection: scope.Collection}
+		}
+
+		if change.TenantID != scope.Tenant || change.Collection != scope.Collection {
+			continue
+		}
+		select {
+		case events <- change:
+		case <-ctx.Done():
+			listener.Close(context.Background())
+			return
+		}
+	}
+}
+
+// relisten connects the change feed of a tenant again, doubling the delay between
+// attempts. It returns nil once ctx is done
+func (c *Client) relisten(ctx context.Context, tenant string) *store.ChangeListener {
+	delay := minReconnectDelay
+	for {
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return nil
+		}
+
+		listener, err := store.ListenChanges(ctx, c.config.PostgresConnStr, tenant)
+		if err == nil {
+			return listener
+		}
+		slog.Warn("Failed to reconnect the change feed", "retry_in", delay, "error", err)
+		delay = min(delay*2, maxReconnectDelay)
+	}
+}
@@ -0,0 +1,110 @@
+// Command dynarag runs DynaRAG tasks from the command line.
+//
+//	dynarag watch [flags] <dir>
+//
+// keeps a directory synced into a collection until interrupted. The database is given by
+// -postgres or the DYNARAG_POSTGRES environment variable
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	dr "github.com/Predixus/DynaRAG"
+	"github.com/Predixus/DynaRAG/sync"
+)
+
+// patterns collects the values of a repeatable flag
+type patterns []string
+
+func (p *patterns) String() string {
+	return strings.Join(*p, ",")
+}
+
+func (p *patterns) Set(value string) error {
+	*p = append(*p, value)
+	return nil
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	var err error
+	switch os.Args[1] {
+	case "watch":
+		err = watch(os.Args[2:])
+	default:
+		usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		slog.Error("Command failed", "command", os.Args[1], "error", err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: dynarag watch [flags] <dir>")
+}
+
+func watch(args []string) error {
+	var include, exclude patterns
+
+	flags := flag.NewFlagSet("watch", flag.ExitOnError)
+	connStr := flags.String("postgres", os.Getenv("DYNARAG_POSTGRES"), "Postgres connection string")
+	collection := flags.String("collection", dr.DefaultCollection, "collection to sync into")
+	interval := flags.Duration("interval", sync.DefaultInterval, "how often to scan for changes")
+	debounce := flags.Duration("debounce", sync.DefaultDebounce, "how long a file must be unchanged before it is synced")
+	chunkSize := flags.Int("chunk-size", 0, "maximum number of characters per chunk")
+	flags.Var(&include, "include", "only sync files matching this glob pattern (repeatable)")
+	flags.Var(&exclude, "exclude", "skip files and directories matching this glob pattern (repeatable)")
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		usage()
+		flags.PrintDefaults()
+		os.Exit(2)
+	}
+
+	client, err := dr.New(dr.Config{PostgresConnStr: *connStr})
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	if err := client.Initialise(); err != nil {
+		return err
+	}
+	if *collection != dr.DefaultCollection {
+		if client, err = client.Collection(*collection); err != nil {
+			return err
+		}
+	}
+
+	watcher, err := sync.NewWatcher(
+		client,
+		flags.Arg(0),
+		sync.WithInclude(include...),
+		sync.WithExclude(exclude...),
+		sync.WithInterval(*interval),
+		sync.WithDebounce(*debounce),
+		sync.WithChunkSize(*chunkSize),
+	)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	slog.Info("Watching directory", "root", flags.Arg(0), "collection", *collection)
+	return watcher.Run(ctx)
+}
@@ -0,0 +1,112 @@
+package dynarag
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/Predixus/DynaRAG/internal/store"
+)
+
+// DefaultCollection is the collection a Client works on unless scoped with Collection
+const DefaultCollection = store.DefaultCollection
+
+// ErrCollectionNotFound is returned for operations on a collection that does not exist
+var ErrCollectionNotFound = store.ErrCollectionNotFound
+
+// CollectionInfo describes a collection and its contents
+type CollectionInfo struct {
+	Name          string
+	DocumentCount int64
+	ChunkCount    int64
+	CreatedAt     time.Time
+}
+
+// Collection returns a handle scoped to the named collection. Its Chunk, Similar, Query,
+// Ask, ListChunks, PurgeChunks, GetStats, Export and Import only touch that collection.
+// The handle shares its configuration, templates and backend with c. The collection must
+// exist, see CreateCollection, by the time the handle is used
+func (c *Client) Collection(name string) (*Client, error) {
+	scoped, err := c.store.Collection(name)
+	if err != nil {
+		return nil, err
+	}
+
+	handle := *c
+	handle.store = scoped
+	return &handle, nil
+}
+
+// CreateCollection creates an empty collection
+func (c *Client) CreateCollection(ctx context.Context, name string) (*CollectionInfo, error) {
+	if err := c.requirePostgres("create collection"); err != nil {
+		return nil, err
+	}
+
+	collection, err := store.CreateCollection(ctx, c.config.PostgresConnStr, c.tenant, name)
+	if err != nil {
+		slog.Error("Failed to create collection", "collection", name, "error", err)
+		return nil, err
+	}
+	return &CollectionInfo{Name: collection.Name, CreatedAt: collection.CreatedAt.Time}, nil
+}
+
+// ListCollections lists every collection with its document and chunk counts
+func (c *Client) ListCollections(ctx context.Context) ([]CollectionInfo, error) {
+	if err := c.requirePostgres("list collections"); err != nil {
+		return nil, err
+	}
+
+	rows, err := store.ListCollections(ctx, c.config.PostgresConnStr, c.tenant)
+	if err != nil {
+		slog.Error("Failed to list collections", "error", err)
+		return nil, err
+	}
+
+	collections := make([]CollectionInfo, len(rows))
+	for i, row := range rows {
+		collections[i] = CollectionInfo{
+			Name:          row.Name,
+			DocumentCount: row.DocumentCount,
+			ChunkCount:    row.ChunkCount,
+			CreatedAt:     row.CreatedAt.Time,
+		}
+	}
+	return collections, nil
+}
+
+// RenameCollection renames a collection. Handles scoped to the old name stop finding it.
+// The default collection cannot be renamed
+func (c *Client) RenameCollection(ctx context.Context, name string, newName string) error {
+	if err := c.requirePostgres("rename collection"); err != nil {
+		return err
+	}
+
+	_, err := store.RenameCollection(ctx, c.config.PostgresConnStr, c.tenant, name, newName)
+	if err != nil {
+		slog.Error("Failed to rename collection", "collection", name, "error", err)
+		return err
+	}
+	return nil
+}
+
+// PurgeCollection permanently deletes a collection along with all of its documents and
+// chunks, including those in its trash. It bypasses the trash, so nothing can be restored.
+// The default collection cannot be purged, empty it with PurgeChunks instead
+func (c *Client) PurgeCollection(ctx context.Context, name string) (*store.DeletionStats, error) {
+	if err := c.requirePostgres("purge collection"); err != nil {
+		return nil, err
+	}
+
+	stats, err := store.PurgeCollection(ctx, c.config.PostgresConnStr, c.tenant, name)
+	if err != nil {
+		slog.Error("Failed to purge collection", "collection", name, "error", err)
+		return nil, err
+	}
+	c.audit(ctx, AuditEntry{
+		Operation:  AuditPurgeCollection,
+		Collection: name,
+		FilePaths:  stats.FilePaths,
+	})
+	return stats, nil
+}
@@ -0,0 +1,34 @@
+package dynarag
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/Predixus/DynaRAG/internal/store"
+)
+
+// ErrDocumentNotFound is returned for operations on a document that is not stored
+var ErrDocumentNotFound = store.ErrDocumentNotFound
+
+// DeleteDocument moves the chunks of one document of the collection, of every version, to
+// the trash, from where Restore can bring them back
+func (c *Client) DeleteDocument(ctx context.Context, filePath string) (*store.DeletionStats, error) {
+	stats, err := c.store.DeleteDocument(ctx, filePath)
+	if err != nil {
+		slog.Error("Failed to delete document", "file_path", filePath, "error", err)
+		return nil, err
+	}
+	c.audit(ctx, AuditEntry{Operation: AuditDeleteDocument, FilePaths: stats.FilePaths})
+	return stats, nil
+}
+
+// RenameDocument moves a document of the collection, with its chunks and versions, to
+// another file path. It fails if the new path is taken, including by a trashed document
+func (c *Client) RenameDocument(ctx context.Context, filePath string, newFilePath string) error {
+	if err := c.store.RenameDocument(ctx, filePath, newFilePath); err != nil {
+		slog.Error("Failed to rename document", "file_path", filePath, "new_file_path", newFilePath, "error", err)
+		return err
+	}
+	c.audit(ctx, AuditEntry{Operation: AuditRenameDocument, FilePaths: []string{filePath, newFilePath}})
+	return nil
+}
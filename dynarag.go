@@ -5,14 +5,19 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"log/slog"
 	"strconv"
+	"strings"
 	"sync"
+	"time"
 
 	_ "github.com/golang-migrate/migrate/v4/database/postgres"
 	_ "github.com/golang-migrate/migrate/v4/source/file"
+	"github.com/jackc/pgx/v5/pgtype"
 	_ "github.com/lib/pq"
 
+	"github.com/Predixus/DynaRAG/internal/grounding"
 	"github.com/Predixus/DynaRAG/internal/llm"
 	"github.com/Predixus/DynaRAG/internal/rag"
 	"github.com/Predixus/DynaRAG/internal/store"
@@ -24,25 +29,48 @@ import (
 
 var once sync.Once
 
+const defaultMaxPromptTokens = 2048
+
 func (c *Client) Chunk(
 	ctx context.Context,
 	chunk string,
 	filePath string,
 	embeddingText *string,
 	metadata *types.JSONMap,
+	opts ...ChunkOption,
 ) error {
-	_, err := store.AddEmbedding(
-		ctx,
-		c.config.PostgresConnStr,
-		filePath,
-		chunk,
-		embeddingText,
-		metadata,
-	)
+	chunkCfg := newChunkConfig(opts)
+
+	textToEmbed := chunk
+	if embeddingText != nil {
+		textToEmbed = *embeddingText
+	}
+	embedding, err := store.GetSingleEmbedding(ctx, textToEmbed)
+	if err != nil {
+		slog.Error("Could not embed chunk", "error", err)
+		return err
+	}
+
+	added, err := c.store.Add(ctx, store.AddParams{
+		FilePath:      filePath,
+		ChunkText:     chunk,
+		EmbeddingText: embeddingText,
+		Metadata:      metadata,
+		Embedding:     embedding,
+
+		AllowedPrincipals: chunkCfg.allowedPrincipals,
+		ExpiresAt:         chunkCfg.expiresAt,
+	})
 	if err != nil {
 		slog.Error("Could not process embedding", "error", err)
 		return err
 	}
+
+	c.audit(ctx, AuditEntry{
+		Operation: AuditChunk,
+		FilePaths: []string{filePath},
+		ChunkIDs:  []int64{added.ID},
+	})
 	return nil
 }
 
@@ -51,24 +79,66 @@ func (c *Client) Similar(
 	text string,
 	k int8,
 	metadata *types.JSONMap,
+	opts ...QueryOption,
 ) ([]store.FindTopKNNEmbeddingsRow, error) {
 	slog.Info("Gathering similar documents")
 
-	res, err := store.GetTopKEmbeddings(ctx, c.config.PostgresConnStr, text, k, metadata)
+	queryCfg := newQueryConfig(opts)
+	res, rewrites, err := c.retrieve(ctx, text, k, metadata, queryCfg)
 	if err != nil {
 		slog.Error("Could not get top K embeddings", "error", err)
 		return nil, err
 	}
+	if queryCfg.rewrites != nil {
+		*queryCfg.rewrites = rewrites
+	}
 	return res, nil
 }
 
+// QueryResult describes the outcome of a Query
+type QueryResult struct {
+	*llm.GenerationResult
+	Answer    string                          // the full text of the answer
+	Chunks    []store.FindTopKNNEmbeddingsRow // chunks retrieved for the query, in rank order
+	Citations []Citation                      // in-line citations of the answer, in order
+	Truncated []rag.Document                  // chunks cut at a sentence boundary to fit the prompt budget
+	Dropped   []rag.Document                  // chunks left out of the prompt as they did not fit the budget
+	Grounding *grounding.Report               // per sentence support of the answer, see WithGroundingCheck
+	Rewrites  []string                        // texts retrieved with in place of the query, see WithRewriter
+}
+
+// Citation is an in-line reference in the answer mapped back to the chunk it cites
+type Citation struct {
+	Text     string // the cited text
+	Ref      string // the reference of the chunk, e.g. "ref-0"
+	ChunkID  int64
+	FilePath string
+	Source   string // the file path with the anchor of the cited page or section, see IngestFile
+	Metadata types.JSONMap
+}
+
+// Query answers the query with the LLM, grounded on the k most similar chunks. The answer
+// is streamed to writer as it is generated, if writer is not nil, and returned in the
+// QueryResult along with the retrieved chunks and the citations of the answer
 func (c *Client) Query(
 	ctx context.Context,
 	query string,
 	k *int8,
 	metadata *types.JSONMap,
 	writer io.Writer,
-) error {
+	opts ...QueryOption,
+) (*QueryResult, error) {
+	return c.query(ctx, query, k, metadata, writer, newQueryConfig(opts))
+}
+
+func (c *Client) query(
+	ctx context.Context,
+	query string,
+	k *int8,
+	metadata *types.JSONMap,
+	writer io.Writer,
+	queryCfg *queryConfig,
+) (*QueryResult, error) {
 	slog.Info("Gathering similar documents")
 
 	topN := int8(10) // Default number of chunks to factor into the response
@@ -76,10 +146,10 @@ func (c *Client) Query(
 		topN = *k
 	}
 
-	res, err := store.GetTopKEmbeddings(ctx, c.config.PostgresConnStr, query, topN, metadata)
+	res, rewrites, err := c.retrieve(ctx, query, topN, metadata, queryCfg)
 	if err != nil {
 		slog.Error("Could not get top K embeddings", "error", err)
-		return err
+		return nil, err
 	}
 
 	var documents []rag.Document
@@ -87,31 +157,196 @@ func (c *Client) Query(
 	for ii, doc := range res {
 		documents = append(documents, rag.Document{
 			Index:   strconv.Itoa(ii),
-			Source:  doc.FilePath,
+			Source:  chunkSource(doc.FilePath, doc.Metadata),
 			Content: doc.ChunkText,
 		})
 	}
 
-	builder, err := rag.NewRAGMessageBuilder(documents, query)
+	counter, err := c.tokenCounter()
+	if err != nil {
+		return nil, err
+	}
+
+	ragOpts := append([]rag.Option{
+		rag.WithMaxTokens(c.config.MaxPromptTokens),
+		rag.WithTokenCounter(counter),
+		rag.WithTemplateManager(c.templates),
+	}, queryCfg.ragOptions()...)
+
+	builder, err := rag.NewRAGMessageBuilder(documents, query, ragOpts...)
 	if err != nil {
-		return fmt.Errorf("failed to create RAG message builder: %w", err)
+		return nil, fmt.Errorf("failed to create RAG message builder: %w", err)
 	}
 
-	systemPrompt, err := builder.BuildSystemPrompt()
+	messages, err := builder.BuildMessages()
 	if err != nil {
-		return fmt.Errorf("failed to build system prompt: %w", err)
+		return nil, fmt.Errorf("failed to build messages: %w", err)
 	}
 
-	messages := []llm.Message{systemPrompt}
+	packing := builder.Packing()
+	if len(packing.Dropped) > 0 || len(packing.Truncated) > 0 {
+		slog.Info(
+			"Chunks did not fit the prompt token budget",
+			"budget", packing.Budget,
+			"truncated", len(packing.Truncated),
+			"dropped", len(packing.Dropped),
+		)
+	}
 
-	llmClient, err := llm.NewClient(c.config.LLMProvider, c.config.LLMToken)
+	if queryCfg.onRetrieval != nil {
+		err := queryCfg.onRetrieval(RetrievalEvent{
+			Chunks:    res,
+			Rewrites:  rewrites,
+			Truncated: packing.Truncated,
+			Dropped:   packing.Dropped,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	llmOpts := append([]llm.Option{
+		llm.WithPrices(c.config.Prices),
+	}, queryCfg.llmOptions()...)
+
+	llmClient, err := llm.NewClient(c.config.LLMProvider, c.config.LLMToken, llmOpts...)
 	if err != nil {
-		return fmt.Errorf("failed to create LLM client: %w", err)
+		return nil, fmt.Errorf("failed to create LLM client: %w", err)
+	}
+
+	var answer strings.Builder
+	output := io.Writer(&answer)
+	if writer != nil {
+		output = io.MultiWriter(writer, &answer)
 	}
 
-	return llmClient.Generate(messages, writer)
+	result, err := llmClient.Generate(ctx, messages, output)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.config.TrackUsage {
+		c.recordUsage(ctx, result)
+	}
+
+	var groundingReport *grounding.Report
+	if queryCfg.grounding != nil {
+		groundingReport, err = c.checkGrounding(ctx, answer.String(), res, *queryCfg.grounding)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check grounding: %w", err)
+		}
+	}
+
+	citations := resolveCitations(answer.String(), res)
+	if unresolved := len(rag.ParseCitations(answer.String())) - len(citations); unresolved > 0 {
+		slog.Warn("Answer cites chunks that were not retrieved", "count", unresolved)
+	}
+
+	return &QueryResult{
+		GenerationResult: result,
+		Answer:           answer.String(),
+		Chunks:           res,
+		Citations:        citations,
+		Truncated:        packing.Truncated,
+		Dropped:          packing.Dropped,
+		Grounding:        groundingReport,
+		Rewrites:         rewrites,
+	}, nil
+}
+
+// resolveCitations parses the citations of an answer and maps them back to the chunks
+// they reference. Citations of chunks that were not retrieved are dropped
+func resolveCitations(answer string, chunks []store.FindTopKNNEmbeddingsRow) []Citation {
+	var citations []Citation
+	for _, citation := range rag.ParseCitations(answer) {
+		if resolved, ok := resolveCitation(citation, chunks); ok {
+			citations = append(citations, resolved)
+		}
+	}
+	return citations
 }
 
+// resolveCitation maps a citation back to the chunk it references, if it was retrieved
+func resolveCitation(citation rag.Citation, chunks []store.FindTopKNNEmbeddingsRow) (Citation, bool) {
+	index, err := strconv.Atoi(citation.Index)
+	if err != nil || index < 0 || index >= len(chunks) {
+		return Citation{}, false
+	}
+	chunk := chunks[index]
+	return Citation{
+		Text:     citation.Text,
+		Ref:      "ref-" + citation.Index,
+		ChunkID:  chunk.ID,
+		FilePath: chunk.FilePath,
+		Source:   chunkSource(chunk.FilePath, chunk.Metadata),
+		Metadata: chunk.Metadata,
+	}, true
+}
+
+// tokenCounter returns the token counter used to fit retrieved chunks into the prompt
+func (c *Client) tokenCounter() (rag.TokenCounter, error) {
+	if c.config.UseEmbeddingTokenizer {
+		embedder, err := store.Embedder()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get embedding tokenizer: %w", err)
+		}
+		return embedder, nil
+	}
+
+	estimator, err := llm.NewTokenEstimator(c.config.LLMProvider)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create token estimator: %w", err)
+	}
+	return estimator, nil
+}
+
+// recordUsage persists the usage of a generation. Failures are logged rather than
+// returned, as the response has already been streamed to the caller
+func (c *Client) recordUsage(ctx context.Context, result *llm.GenerationResult) {
+	params := store.CreateQueryUsageParams{
+		Provider:           string(result.Provider),
+		Model:              result.Model,
+		LatencyMs:          result.Latency.Milliseconds(),
+		TimeToFirstTokenMs: result.TimeToFirstToken.Milliseconds(),
+		FinishReason: pgtype.Text{
+			String: result.FinishReason,
+			Valid:  result.FinishReason != "",
+		},
+	}
+	if result.Usage != nil {
+		params.PromptTokens = int32(result.Usage.PromptTokens)
+		params.CompletionTokens = int32(result.Usage.CompletionTokens)
+		params.TotalTokens = int32(result.Usage.TotalTokens)
+	}
+	if result.Cost != nil {
+		params.Cost = pgtype.Float8{Float64: *result.Cost, Valid: true}
+	}
+
+	if _, err := store.RecordQueryUsage(ctx, c.config.PostgresConnStr, c.tenant, params); err != nil {
+		slog.Error("Failed to record query usage", "error", err)
+	}
+}
+
+// GetUsage returns the token usage and cost of the tenant's queries since the given time,
+// aggregated per provider and model. Usage is only recorded when Config.TrackUsage is set
+func (c *Client) GetUsage(
+	ctx context.Context,
+	since time.Time,
+) ([]store.GetUsageSummaryRow, error) {
+	if err := c.requirePostgres("usage"); err != nil {
+		return nil, err
+	}
+
+	usage, err := store.GetUsageSummary(ctx, c.config.PostgresConnStr, c.tenant, since)
+	if err != nil {
+		slog.Error("Failed to get query usage", "error", err)
+		return nil, err
+	}
+	return usage, nil
+}
+
+// PurgeChunks moves every chunk of the collection to the trash. Trashed chunks are left
+// out of all operations until brought back with Restore or removed with EmptyTrash
 func (c *Client) PurgeChunks(ctx context.Context, dryRun *bool) (*store.DeletionStats, error) {
 	doDryRun := false
 
@@ -119,18 +354,80 @@ func (c *Client) PurgeChunks(ctx context.Context, dryRun *bool) (*store.Deletion
 		doDryRun = *dryRun
 	}
 
-	stats, err := store.DeleteUserEmbeddings(ctx, c.config.PostgresConnStr, doDryRun)
+	stats, err := c.store.Delete(ctx, doDryRun)
 	if err != nil {
 		slog.Error("Failed to delete embeddings", "error", err)
 		return nil, err
 	}
+	if !doDryRun {
+		c.audit(ctx, AuditEntry{Operation: AuditPurge, FilePaths: stats.FilePaths})
+	}
+	return stats, nil
+}
+
+// Restore brings back the chunks of the collection trashed within the given duration, or
+// the whole trash if it is zero. With dryRun set it only reports what would be restored
+func (c *Client) Restore(
+	ctx context.Context,
+	within time.Duration,
+	dryRun *bool,
+) (*store.DeletionStats, error) {
+	doDryRun := dryRun != nil && *dryRun
+
+	stats, err := c.store.Restore(ctx, within, doDryRun)
+	if err != nil {
+		slog.Error("Failed to restore embeddings", "error", err)
+		return nil, err
+	}
+	if !doDryRun {
+		c.audit(ctx, AuditEntry{Operation: AuditRestore, FilePaths: stats.FilePaths})
+	}
+	return stats, nil
+}
+
+// EmptyTrash permanently deletes the chunks of the collection trashed at least olderThan
+// ago, or the whole trash if it is zero. With dryRun set it only reports what would be
+// deleted
+func (c *Client) EmptyTrash(
+	ctx context.Context,
+	olderThan time.Duration,
+	dryRun *bool,
+) (*store.DeletionStats, error) {
+	doDryRun := dryRun != nil && *dryRun
+
+	stats, err := c.store.EmptyTrash(ctx, olderThan, doDryRun)
+	if err != nil {
+		slog.Error("Failed to empty trash", "error", err)
+		return nil, err
+	}
+	if !doDryRun {
+		c.audit(ctx, AuditEntry{Operation: AuditEmptyTrash, FilePaths: stats.FilePaths})
+	}
+	return stats, nil
+}
+
+// Vacuum deletes every expired chunk of the tenant, across all of its collections, in
+// batches. Documents left without chunks are removed along with them
+func (c *Client) Vacuum(ctx context.Context) (*store.VacuumStats, error) {
+	stats, err := c.store.Vacuum(ctx, store.DefaultVacuumBatchSize)
+	if err != nil {
+		slog.Error("Failed to vacuum expired chunks", "error", err)
+		return stats, err
+	}
+	slog.Info(
+		"Vacuumed expired chunks",
+		"chunks", stats.EmbeddingCount,
+		"documents", stats.DocumentCount,
+		"batches", stats.Batches,
+	)
+	c.audit(ctx, AuditEntry{Operation: AuditVacuum, FilePaths: stats.FilePaths})
 	return stats, nil
 }
 
 func (c *Client) GetStats(
 	ctx context.Context,
 ) (*store.GetStatsRow, error) {
-	stats, err := store.GetStats(ctx, c.config.PostgresConnStr)
+	stats, err := c.store.Stats(ctx)
 	if err != nil {
 		slog.Error("Failed to get user stats", "error", err)
 		return nil, err
@@ -138,11 +435,18 @@ func (c *Client) GetStats(
 	return stats, nil
 }
 
+// ListChunks lists the stored chunks, newest first. Restricted chunks are only listed for
+// a caller given by WithIdentity that they allow
 func (c *Client) ListChunks(
 	ctx context.Context,
 	metadata *types.JSONMap,
+	opts ...QueryOption,
 ) ([]store.ListChunksRow, error) {
-	chunks, err := store.ListUserChunks(ctx, c.config.PostgresConnStr, metadata)
+	queryCfg := newQueryConfig(opts)
+	chunks, err := c.store.List(ctx, store.ListRequest{
+		Metadata:   metadata,
+		Principals: queryCfg.principals(),
+	})
 	if err != nil {
 
 		slog.Error("Failed to list user chunks", "error", err)
@@ -150,26 +454,104 @@ func (c *Client) ListChunks(
 
 		return noChunks, err
 	}
+
+	entry := AuditEntry{Operation: AuditList}
+	if metadata != nil {
+		entry.Filter = *metadata
+	}
+	c.audit(ctx, entry)
 	return chunks, nil
 }
 
 type Config struct {
+	// Backend selects where chunks are stored. Defaults to BackendPostgres
+	Backend         Backend
+	Memory          MemoryConfig // configures BackendMemory
 	PostgresConnStr string
 	LLMProvider     string
 	LLMToken        string
+	TrackUsage      bool             // persist the token usage of every Query
+	Prices          types.PriceTable // per model prices used for cost reporting
+
+	// MaxPromptTokens is the token budget of the prompt sent to the LLM. Retrieved chunks
+	// are packed in rank order until the budget is spent. Defaults to 2048
+	MaxPromptTokens int
+	// UseEmbeddingTokenizer counts prompt tokens with the embedding model's tokenizer
+	// instead of the LLM provider's estimate
+	UseEmbeddingTokenizer bool
+	// MaxHistoryTokens is the token budget of the session history passed to Ask. Older
+	// messages are folded into a summary. Defaults to 1024
+	MaxHistoryTokens int
+
+	// Search holds the default recall knobs of vector searches, see WithProbes and
+	// WithEfSearch
+	Search SearchParams
+
+	// EntailmentModel is the Huggingface name of an NLI cross-encoder in ONNX format. When
+	// set, WithGroundingCheck scores sentences by entailment rather than similarity alone
+	EntailmentModel string
+	// EntailmentSeparator joins premise and hypothesis for the entailment model. Defaults
+	// to " [SEP] "
+	EntailmentSeparator string
+
+	// Audit records who added, deleted or retrieved what in the audit log, see AuditLog.
+	// The caller is taken from the context, see ContextWithIdentity
+	Audit bool
+	// AuditHashChain chains every audit entry to the hash of the one before, so that
+	// tampering can be detected with VerifyAuditLog
+	AuditHashChain bool
 }
 
 type Client struct {
-	config Config
+	config    Config
+	store     store.Store
+	tenant    string
+	templates *rag.TemplateManager
+
+	entailment *entailment
 }
 
 func New(cfg Config) (*Client, error) {
-	if cfg.PostgresConnStr == "" {
+	if cfg.Backend == "" {
+		cfg.Backend = BackendPostgres
+	}
+
+	if cfg.Backend == BackendPostgres && cfg.PostgresConnStr == "" {
 		return nil, errors.New("postgres connection string is required")
 	}
 
+	if cfg.TrackUsage && cfg.Backend != BackendPostgres {
+		return nil, errors.New("usage tracking requires the postgres backend")
+	}
+
+	if cfg.Audit && cfg.Backend != BackendPostgres {
+		return nil, errors.New("audit logging requires the postgres backend")
+	}
+
+	if cfg.MaxPromptTokens == 0 {
+		cfg.MaxPromptTokens = defaultMaxPromptTokens
+	}
+
+	if cfg.MaxHistoryTokens == 0 {
+		cfg.MaxHistoryTokens = defaultMaxHistoryTokens
+	}
+
+	templates, err := rag.NewDefaultTemplateManager()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load prompt templates: %w", err)
+	}
+
+	backend, err := newStore(cfg)
+	if err != nil {
+		return nil, err
+	}
+
 	client := &Client{
-		config: cfg,
+		config:     cfg,
+		store:      backend,
+		tenant:     DefaultTenant,
+		templates:  templates,
+		entailment: &entailment{},
 	}
 
 	if err := client.Initialise(); err != nil {
@@ -179,7 +561,155 @@ func New(cfg Config) (*Client, error) {
 	return client, nil
 }
 
+// IndexKind is the type of vector index built by RebuildIndex
+type IndexKind = store.IndexKind
+
+const (
+	IndexHNSW    = store.IndexHNSW
+	IndexIVFFlat = store.IndexIVFFlat
+)
+
+// IndexParams holds the build parameters of RebuildIndex
+type IndexParams = store.IndexParams
+
+// SearchParams holds the recall knobs of a vector search
+type SearchParams = store.SearchParams
+
+// RebuildIndex replaces the vector index of each registered embedding model with one of
+// the given kind, using the operator class of the model's distance metric. HNSW defaults
+// to m = 16 and ef_construction = 64; IVFFlat computes its list count from the number of
+// stored chunks, so rebuild it once the bulk of the data is loaded. Row level security
+// limits that count to the default tenant, so set IndexParams.Lists on shared databases
+func (c *Client) RebuildIndex(
+	ctx context.Context,
+	kind IndexKind,
+	params IndexParams,
+) ([]store.IndexInfo, error) {
+	if err := c.requirePostgres("rebuild index"); err != nil {
+		return nil, err
+	}
+
+	indexes, err := store.RebuildIndex(ctx, c.config.PostgresConnStr, kind, params)
+	if err != nil {
+		slog.Error("Failed to rebuild index", "kind", kind, "error", err)
+		return nil, err
+	}
+	for _, info := range indexes {
+		slog.Info("Rebuilt index", "model", info.Model, "kind", info.Kind, "rows", info.Rows)
+	}
+	return indexes, nil
+}
+
+// DistanceMetric is the metric an embedding model's vectors are compared with
+type DistanceMetric = store.DistanceMetric
+
+const (
+	MetricCosine       = store.DistanceMetricCosine
+	MetricInnerProduct = store.DistanceMetricInnerProduct
+	MetricL2           = store.DistanceMetricL2
+)
+
+// RegisterEmbeddingModel sets the dimensions and distance metric of an embedding model.
+// Searches use the metric's operator and report similarities on its scale: 1 - d for
+// cosine, the inner product for MetricInnerProduct and 1 / (1 + d) for L2. The dimensions
+// must match those of the stored embeddings. Run RebuildIndex after changing the metric so
+// the index matches
+func (c *Client) RegisterEmbeddingModel(
+	ctx context.Context,
+	model string,
+	dimensions int,
+	metric DistanceMetric,
+) (*store.ModelRegistration, error) {
+	if err := c.requirePostgres("register embedding model"); err != nil {
+		return nil, err
+	}
+
+	registration, err := store.RegisterModel(
+		ctx,
+		c.config.PostgresConnStr,
+		store.EmbeddingModel(model),
+		dimensions,
+		metric,
+	)
+	if err != nil {
+		slog.Error("Failed to register embedding model", "model", model, "error", err)
+		return nil, err
+	}
+	return registration, nil
+}
+
+// Quantization is the representation the vector index of an embedding model is built over
+type Quantization = store.Quantization
+
+const (
+	QuantizationNone    = store.QuantizationNone
+	QuantizationHalfvec = store.QuantizationHalfvec
+	QuantizationBinary  = store.QuantizationBinary
+)
+
+// SetQuantization indexes an embedding model over half precision (halfvec) or binary
+// quantised (bit) vectors, cutting index size by 2x or 32x. Searches gather candidates
+// over the quantised index, Hamming distance for binary, and re-rank them exactly on the
+// full precision vectors kept in the table. Run RebuildIndex afterwards
+func (c *Client) SetQuantization(
+	ctx context.Context,
+	model string,
+	quantization Quantization,
+) (*store.ModelRegistration, error) {
+	if err := c.requirePostgres("set quantization"); err != nil {
+		return nil, err
+	}
+
+	registration, err := store.SetQuantization(
+		ctx,
+		c.config.PostgresConnStr,
+		store.EmbeddingModel(model),
+		quantization,
+	)
+	if err != nil {
+		slog.Error("Failed to set quantization", "model", model, "error", err)
+		return nil, err
+	}
+	return registration, nil
+}
+
+// EmbeddingModels lists the registered embedding models and their metrics
+func (c *Client) EmbeddingModels(ctx context.Context) ([]store.ModelRegistration, error) {
+	if err := c.requirePostgres("embedding models"); err != nil {
+		return nil, err
+	}
+
+	models, err := store.ListModels(ctx, c.config.PostgresConnStr)
+	if err != nil {
+		slog.Error("Failed to list embedding models", "error", err)
+		return nil, err
+	}
+	return models, nil
+}
+
+// RegisterTemplate adds a named prompt template that can be selected per Query with
+// WithTemplate. Templates are text/template documents rendered with the retrieved
+// documents (.Documents), the query (.Query), the response style (.ResponseStyle) and any
+// caller supplied variables (.Vars), and are validated against sample values on registration
+func (c *Client) RegisterTemplate(name string, content string) error {
+	return c.templates.RegisterTemplate(name, content)
+}
+
+// RegisterTemplateFile adds a named prompt template read from a file
+func (c *Client) RegisterTemplateFile(name string, path string) error {
+	return c.templates.RegisterTemplateFile(name, path)
+}
+
+// RegisterTemplatesFS adds every file in fsys matching pattern as a prompt template,
+// named after the file without its extension
+func (c *Client) RegisterTemplatesFS(fsys fs.FS, pattern string) error {
+	return c.templates.RegisterTemplatesFS(fsys, pattern)
+}
+
 // Initialise migrations and other necessary infrastructure for DynaRAG
 func (c *Client) Initialise() error {
+	if c.config.Backend != BackendPostgres {
+		return nil
+	}
 	return initMigrations(c.config.PostgresConnStr)
 }
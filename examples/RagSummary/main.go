@@ -29,7 +29,7 @@ func main() {
 
 	writer := os.Stdout
 	nDocs := int8(1)
-	err = client.Query(
+	result, err := client.Query(
 		context.Background(),
 		"What is the capital of England?",
 		&nDocs,
@@ -40,4 +40,13 @@ func main() {
 		slog.Error("Failed to execute query", "message", err)
 		return
 	}
+	slog.Info(
+		"Query complete",
+		"latency", result.Latency,
+		"time_to_first_token", result.TimeToFirstToken,
+		"usage", result.Usage,
+	)
+	for _, citation := range result.Citations {
+		slog.Info("Cited chunk", "text", citation.Text, "chunk", citation.ChunkID, "file", citation.FilePath)
+	}
 }
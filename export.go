@@ -0,0 +1,159 @@
+package dynarag
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"slices"
+
+	"github.com/Predixus/DynaRAG/internal/store"
+)
+
+// importBatchSize is the number of chunks embedded and stored together during an Import
+const importBatchSize = 256
+
+// ExportOptions configures an Export
+type ExportOptions struct {
+	// IncludeVectors writes the embedding of each chunk, so that an Import with the same
+	// model does not need to re-embed. Vectors make up most of the size of an export
+	IncludeVectors bool
+}
+
+// ImportStats describes the outcome of an Import
+type ImportStats struct {
+	Imported   int // chunks stored
+	ReEmbedded int // chunks embedded again as their vector was missing or from another model
+}
+
+// Record is a single line of an export
+type Record = store.Record
+
+// Export writes every stored chunk to w as JSON lines, one Record per line, in insertion
+// order. Chunks are streamed from the store, so exports of any size run in constant memory
+func (c *Client) Export(ctx context.Context, w io.Writer, opts ExportOptions) (int, error) {
+	buffered := bufio.NewWriter(w)
+	encoder := json.NewEncoder(buffered)
+
+	count := 0
+	err := c.store.Each(ctx, opts.IncludeVectors, func(record store.Record) error {
+		if err := encoder.Encode(record); err != nil {
+			return fmt.Errorf("failed to write record %d: %w", count+1, err)
+		}
+		count++
+		return nil
+	})
+	if err != nil {
+		slog.Error("Failed to export chunks", "exported", count, "error", err)
+		return count, err
+	}
+
+	if err := buffered.Flush(); err != nil {
+		return count, err
+	}
+	c.audit(ctx, AuditEntry{Operation: AuditExport})
+	return count, nil
+}
+
+// Import restores chunks written by Export. Chunks without a vector, or whose vector was
+// produced by a different model than the one in use, are embedded again from their
+// embedding text, or chunk text if there is none. Records are read and stored in batches,
+// so imports of any size run in constant memory. Batches stored before an error are kept
+func (c *Client) Import(ctx context.Context, r io.Reader) (*ImportStats, error) {
+	decoder := json.NewDecoder(bufio.NewReader(r))
+	stats := &ImportStats{}
+
+	batch := make([]store.Record, 0, importBatchSize)
+	for line := 1; ; line++ {
+		var record store.Record
+		err := decoder.Decode(&record)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return stats, fmt.Errorf("failed to read record %d: %w", line, err)
+		}
+
+		batch = append(batch, record)
+		if len(batch) == importBatchSize {
+			if err := c.importBatch(ctx, batch, stats); err != nil {
+				return stats, err
+			}
+			batch = batch[:0]
+		}
+	}
+
+	if err := c.importBatch(ctx, batch, stats); err != nil {
+		return stats, err
+	}
+	return stats, nil
+}
+
+// importBatch embeds the records of a batch that need it and stores the batch
+func (c *Client) importBatch(ctx context.Context, batch []store.Record, stats *ImportStats) error {
+	if len(batch) == 0 {
+		return nil
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	var (
+		texts   []string
+		missing []int
+	)
+	for i, record := range batch {
+		if len(record.Embedding) == 0 || record.ModelName != string(store.DefaultModelName) {
+			text := record.ChunkText
+			if record.EmbeddingText != nil {
+				text = *record.EmbeddingText
+			}
+			texts = append(texts, text)
+			missing = append(missing, i)
+		}
+	}
+
+	if len(texts) > 0 {
+		embedder, err := store.Embedder()
+		if err != nil {
+			return err
+		}
+		embeddings, err := embedder.GetEmbeddings(texts)
+		if err != nil {
+			return fmt.Errorf("failed to embed imported chunks: %w", err)
+		}
+		for j, i := range missing {
+			batch[i].Embedding = embeddings[j]
+		}
+	}
+
+	params := make([]store.AddParams, len(batch))
+	var filePaths []string
+	for i, record := range batch {
+		if !slices.Contains(filePaths, record.FilePath) {
+			filePaths = append(filePaths, record.FilePath)
+		}
+		params[i] = store.AddParams{
+			FilePath:      record.FilePath,
+			ChunkText:     record.ChunkText,
+			EmbeddingText: record.EmbeddingText,
+			Metadata:      record.Metadata,
+			Embedding:     record.Embedding,
+
+			AllowedPrincipals: record.AllowedPrincipals,
+			ExpiresAt:         record.ExpiresAt,
+		}
+	}
+
+	if err := c.store.AddMany(ctx, params); err != nil {
+		return fmt.Errorf("failed to store imported chunks: %w", err)
+	}
+	c.audit(ctx, AuditEntry{Operation: AuditImport, FilePaths: filePaths})
+
+	stats.Imported += len(batch)
+	stats.ReEmbedded += len(missing)
+	return nil
+}
@@ -0,0 +1,241 @@
+package dynarag
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"unicode/utf8"
+
+	"github.com/Predixus/DynaRAG/internal/gitrepo"
+	"github.com/Predixus/DynaRAG/internal/splitter"
+	"github.com/Predixus/DynaRAG/internal/store"
+	"github.com/Predixus/DynaRAG/types"
+)
+
+// The chunk metadata keys IngestGitRepo records
+const (
+	GitRepositoryKey = "git_repository" // the origin URL of the repository, see IngestGitRepo
+	GitCommitKey     = "git_commit"     // the commit the file was read at
+	GitPathKey       = "git_path"       // the path of the file in the repository
+)
+
+// maxGitFileSize is the size above which IngestGitRepo skips a file, as it is more likely
+// to be data than documentation or code
+const maxGitFileSize = 1 << 20
+
+// GitIngestStats reports what an IngestGitRepo changed
+type GitIngestStats struct {
+	Repository string // the origin URL of the repository, or its top level directory
+	Commit     string // the commit ingested
+	Previous   string // the commit the changes were taken from, empty if every file was read
+	Ingested   int    // files ingested as a new version of their document
+	Deleted    int    // documents deleted as their file was removed or renamed
+	Skipped    int    // binary and oversized files, and submodules
+}
+
+// IngestGitRepo ingests the files of a local git repository at a ref, such as a branch, tag
+// or commit SHA, into the collection. Files are read from the commit rather than the
+// working tree, split by type, and stored as a new version of the document at their path
+// in the repository, with the repository, commit and path in their metadata.
+//
+// The commit is recorded once every file is ingested, and later calls only process the
+// files changed between it and the new ref, deleting the documents of removed files. If
+// the recorded commit is gone, as after a force push, every file is read again. Ingest
+// each repository into its own collection, as documents are stored by their path in it.
+//
+// The repository is known by the URL of its origin remote, without credentials, so that
+// any clone of it carries on from the recorded commit. Repositories without an origin are
+// known by their top level directory
+func (c *Client) IngestGitRepo(
+	ctx context.Context,
+	path string,
+	ref string,
+	opts ...ChunkOption,
+) (*GitIngestStats, error) {
+	if err := c.requirePostgres("ingest git repository"); err != nil {
+		return nil, err
+	}
+
+	repo, err := gitrepo.Open(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	commit, err := repo.Resolve(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+
+	repository, err := repo.Origin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if repository == "" {
+		repository = repo.Root()
+	}
+
+	scope := c.store.(*store.Postgres).Scope()
+	previous, err := store.LastGitCommit(ctx, c.config.PostgresConnStr, scope, repository)
+	if err != nil {
+		slog.Error("Failed to read the last ingested commit", "repository", repository, "error", err)
+		return nil, err
+	}
+
+	stats := &GitIngestStats{Repository: repository, Commit: commit}
+	if previous == commit {
+		return stats, nil
+	}
+
+	var changes []gitrepo.Change
+	if previous != "" && repo.HasCommit(ctx, previous) {
+		stats.Previous = previous
+		changes, err = repo.Diff(ctx, previous, commit)
+	} else {
+		changes, err = c.gitRepoFiles(ctx, repo, repository, commit)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	blobs, err := repo.Blobs(ctx, maxGitFileSize)
+	if err != nil {
+		return nil, err
+	}
+	defer blobs.Close()
+
+	for _, change := range changes {
+		if err := ctx.Err(); err != nil {
+			return stats, err
+		}
+		if err := c.applyGitChange(ctx, blobs, repository, commit, change, stats, opts); err != nil {
+			return stats, err
+		}
+	}
+
+	if err := store.RecordGitCommit(ctx, c.config.PostgresConnStr, scope, repository, commit); err != nil {
+		slog.Error("Failed to record the ingested commit", "repository", repository, "error", err)
+		return stats, err
+	}
+	slog.Info(
+		"Ingested git repository",
+		"repository", repository,
+		"commit", commit,
+		"previous", stats.Previous,
+		"ingested", stats.Ingested,
+		"deleted", stats.Deleted,
+		"skipped", stats.Skipped,
+	)
+	return stats, nil
+}
+
+// gitRepoFiles returns every file of a commit as added, and every document stored from
+// the repository that is no longer in it as deleted
+func (c *Client) gitRepoFiles(
+	ctx context.Context,
+	repo *gitrepo.Repo,
+	repository string,
+	commit string,
+) ([]gitrepo.Change, error) {
+	files, err := repo.Files(ctx, commit)
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []gitrepo.Change
+	present := make(map[string]bool, len(files))
+	for _, file := range files {
+		present[file] = true
+		changes = append(changes, gitrepo.Change{Status: gitrepo.Added, Path: file})
+	}
+
+	rows, err := c.store.List(ctx, store.ListRequest{})
+	if err != nil {
+		return nil, err
+	}
+	// documents stored before repositories were known by their origin carry the directory
+	removed := make(map[string]bool)
+	for _, row := range rows {
+		stored := row.Metadata[GitRepositoryKey]
+		if stored != repository && stored != repo.Root() {
+			continue
+		}
+		if !present[row.FilePath] && !removed[row.FilePath] {
+			removed[row.FilePath] = true
+			changes = append(changes, gitrepo.Change{Status: gitrepo.Deleted, Path: row.FilePath})
+		}
+	}
+	return changes, nil
+}
+
+// applyGitChange deletes the document of a removed or renamed file and ingests the file
+// at its new content
+func (c *Client) applyGitChange(
+	ctx context.Context,
+	blobs *gitrepo.BlobReader,
+	repository string,
+	commit string,
+	change gitrepo.Change,
+	stats *GitIngestStats,
+	opts []ChunkOption,
+) error {
+	switch change.Status {
+	case gitrepo.Deleted:
+		return c.deleteGitDocument(ctx, change.Path, stats)
+	case gitrepo.Renamed:
+		if err := c.deleteGitDocument(ctx, change.OldPath, stats); err != nil {
+			return err
+		}
+	}
+
+	// Diff lists submodules along with files, though their commits cannot be read
+	content, err := blobs.Read(commit, change.Path)
+	if errors.Is(err, gitrepo.ErrNotFound) || errors.Is(err, gitrepo.ErrTooLarge) {
+		return c.skipGitFile(ctx, change, stats, err)
+	}
+	if err != nil {
+		return err
+	}
+	if !utf8.Valid(content) || bytes.IndexByte(content, 0) >= 0 {
+		return c.skipGitFile(ctx, change, stats, errors.New("binary file"))
+	}
+
+	chunks := splitter.ForPath(change.Path)(string(content), splitter.DefaultChunkSize)
+	metadata := types.JSONMap{
+		GitRepositoryKey: repository,
+		GitCommitKey:     commit,
+		GitPathKey:       change.Path,
+	}
+	if _, err := c.Ingest(ctx, change.Path, chunks, &metadata, opts...); err != nil {
+		return err
+	}
+	stats.Ingested++
+	return nil
+}
+
+// skipGitFile counts a file that is not ingested, deleting its document if the file was
+// modified, as it may have been text when last ingested
+func (c *Client) skipGitFile(
+	ctx context.Context,
+	change gitrepo.Change,
+	stats *GitIngestStats,
+	reason error,
+) error {
+	slog.Debug("Skipping file", "file_path", change.Path, "reason", reason)
+	stats.Skipped++
+	if change.Status == gitrepo.Modified {
+		return c.deleteGitDocument(ctx, change.Path, stats)
+	}
+	return nil
+}
+
+// deleteGitDocument deletes the document of a file, counting it if it was stored
+func (c *Client) deleteGitDocument(ctx context.Context, filePath string, stats *GitIngestStats) error {
+	deleted, err := c.DeleteDocument(ctx, filePath)
+	if err != nil {
+		return err
+	}
+	if deleted.EmbeddingCount > 0 {
+		stats.Deleted++
+	}
+	return nil
+}
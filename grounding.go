@@ -0,0 +1,91 @@
+package dynarag
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/Predixus/DynaRAG/internal/embed"
+	"github.com/Predixus/DynaRAG/internal/grounding"
+	"github.com/Predixus/DynaRAG/internal/store"
+)
+
+// checkGrounding scores each sentence of the answer against the vectors of the chunks
+// retrieved for it
+func (c *Client) checkGrounding(
+	ctx context.Context,
+	answer string,
+	chunks []store.FindTopKNNEmbeddingsRow,
+	threshold float64,
+) (*grounding.Report, error) {
+	embedder, err := store.Embedder()
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]int64, len(chunks))
+	for i, chunk := range chunks {
+		ids[i] = chunk.ID
+	}
+	vectors, err := c.store.Vectors(ctx, ids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get chunk vectors: %w", err)
+	}
+
+	sources := make([]grounding.Source, 0, len(chunks))
+	for _, chunk := range chunks {
+		if vector, ok := vectors[chunk.ID]; ok {
+			sources = append(sources, grounding.Source{
+				ChunkID: chunk.ID,
+				Text:    chunk.ChunkText,
+				Vector:  vector,
+			})
+		}
+	}
+
+	var opts []grounding.Option
+	if c.config.EntailmentModel != "" {
+		verifier, err := c.entailmentVerifier(embedder)
+		if err != nil {
+			return nil, err
+		}
+		entailmentThreshold := grounding.DefaultConfig().EntailmentThreshold
+		if threshold > 0 {
+			entailmentThreshold = threshold
+		}
+		opts = append(opts, grounding.WithVerifier(verifier, entailmentThreshold))
+	} else if threshold > 0 {
+		opts = append(opts, grounding.WithSimilarityThreshold(threshold))
+	}
+
+	return grounding.Check(answer, sources, embedder, opts...)
+}
+
+// entailment holds the lazily loaded entailment verifier, shared by a client and its
+// collection handles
+type entailment struct {
+	mu       sync.Mutex
+	verifier *embed.EntailmentVerifier
+}
+
+// entailmentVerifier lazily loads the entailment model on the embedder's session
+func (c *Client) entailmentVerifier(embedder *embed.Embedder) (*embed.EntailmentVerifier, error) {
+	c.entailment.mu.Lock()
+	defer c.entailment.mu.Unlock()
+
+	if c.entailment.verifier != nil {
+		return c.entailment.verifier, nil
+	}
+
+	separator := c.config.EntailmentSeparator
+	if separator == "" {
+		separator = embed.DefaultEntailmentSeparator
+	}
+
+	verifier, err := embedder.NewEntailmentVerifier(c.config.EntailmentModel, separator)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load entailment model: %w", err)
+	}
+	c.entailment.verifier = verifier
+	return verifier, nil
+}
@@ -0,0 +1,87 @@
+package embed
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/knights-analytics/hugot"
+	"github.com/knights-analytics/hugot/pipelines"
+)
+
+// EntailmentVerifier scores how strongly a premise entails a hypothesis using an NLI
+// cross-encoder. It runs on the ORT session of the Embedder it was created from, as only
+// one session may be active at a time
+type EntailmentVerifier struct {
+	embedder  *Embedder
+	pipeline  *pipelines.TextClassificationPipeline
+	separator string
+}
+
+// DefaultEntailmentSeparator joins the premise and hypothesis for BERT style tokenizers
+const DefaultEntailmentSeparator = " [SEP] "
+
+// NewEntailmentVerifier loads an NLI text classification model from Huggingface. The
+// premise and hypothesis are joined with separator before classification, which must be
+// the sentence pair separator of the model's tokenizer
+func (e *Embedder) NewEntailmentVerifier(
+	modelName string,
+	separator string,
+) (*EntailmentVerifier, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.session == nil {
+		return nil, fmt.Errorf("embedder has no active session")
+	}
+
+	modelPath, err := ensureModel(e.modelDir, modelName)
+	if err != nil {
+		return nil, err
+	}
+
+	pipeline, err := hugot.NewPipeline(e.session, hugot.TextClassificationConfig{
+		ModelPath: modelPath,
+		Name:      "entailment-" + modelName,
+		Options: []hugot.TextClassificationOption{
+			// score every label, normalised across labels
+			pipelines.WithSoftmax(),
+			pipelines.WithMultiLabel(),
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create entailment pipeline: %w", err)
+	}
+
+	return &EntailmentVerifier{
+		embedder:  e,
+		pipeline:  pipeline,
+		separator: separator,
+	}, nil
+}
+
+// Entailment returns the probability, between 0 and 1, that premise entails hypothesis
+func (v *EntailmentVerifier) Entailment(premise string, hypothesis string) (float64, error) {
+	v.embedder.mu.RLock()
+	defer v.embedder.mu.RUnlock()
+
+	result, err := v.pipeline.RunPipeline([]string{premise + v.separator + hypothesis})
+	if err != nil {
+		return 0, err
+	}
+	if len(result.ClassificationOutputs) != 1 {
+		return 0, fmt.Errorf("unexpected number of classification outputs")
+	}
+
+	return entailmentScore(result.ClassificationOutputs[0])
+}
+
+// entailmentScore returns the score of the entailment label. The label is matched in full,
+// as two label models name the other class not_entailment
+func entailmentScore(outputs []pipelines.ClassificationOutput) (float64, error) {
+	for _, output := range outputs {
+		if strings.EqualFold(output.Label, "entailment") {
+			return float64(output.Score), nil
+		}
+	}
+	return 0, fmt.Errorf("model has no entailment label")
+}
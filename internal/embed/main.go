@@ -1,12 +1,14 @@
 package embed
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
 	"sync"
 
+	"github.com/daulet/tokenizers"
 	"github.com/knights-analytics/hugot"
 	"github.com/knights-analytics/hugot/pipelines"
 )
@@ -22,10 +24,13 @@ type Option func(*EmbedderConfig)
 
 // Embedder handles text embedding operations
 type Embedder struct {
+	modelDir  string
 	modelPath string
 	pipeline  *pipelines.FeatureExtractionPipeline
 	session   *hugot.Session
-	mu        sync.RWMutex
+	// counter is the model's tokenizer without truncation, which counts every token
+	counter *tokenizers.Tokenizer
+	mu      sync.RWMutex
 }
 
 // DefaultConfig returns the default configuration
@@ -100,26 +105,9 @@ func newEmbedder(opts ...Option) (*Embedder, error) {
 		return nil, fmt.Errorf("failed to create ORT session: %w", err)
 	}
 
-	modelPath := filepath.Join(config.ModelDir, strings.Replace(config.ModelName, "/", "_", 1))
-	if err := os.MkdirAll(modelPath, 0775); err != nil {
-		return nil, fmt.Errorf("failed to create model directory: %w", err)
-	}
-
-	// Check if model exists, download if it doesn't
-	files, err := filepath.Glob(filepath.Join(modelPath, "*.onnx"))
+	modelPath, err := ensureModel(config.ModelDir, config.ModelName)
 	if err != nil {
-		return nil, fmt.Errorf("failed to check for existing model: %w", err)
-	}
-
-	if len(files) == 0 {
-		modelPath, err = hugot.DownloadModel(
-			config.ModelName,
-			config.ModelDir,
-			hugot.NewDownloadOptions(),
-		)
-		if err != nil {
-			return nil, fmt.Errorf("failed to download model: %w", err)
-		}
+		return nil, err
 	}
 
 	pipelineConfig := hugot.FeatureExtractionConfig{
@@ -132,13 +120,72 @@ func newEmbedder(opts ...Option) (*Embedder, error) {
 		return nil, fmt.Errorf("failed to create pipeline: %w", err)
 	}
 
+	counter, err := loadCounter(modelPath)
+	if err != nil {
+		session.Destroy()
+		return nil, fmt.Errorf("failed to load tokenizer: %w", err)
+	}
+
 	return &Embedder{
+		modelDir:  config.ModelDir,
 		modelPath: modelPath,
 		pipeline:  pipeline,
 		session:   session,
+		counter:   counter,
 	}, nil
 }
 
+// loadCounter loads the tokenizer of the model at modelPath with its truncation removed
+func loadCounter(modelPath string) (*tokenizers.Tokenizer, error) {
+	data, err := os.ReadFile(filepath.Join(modelPath, "tokenizer.json"))
+	if err != nil {
+		return nil, err
+	}
+	data, err = untruncated(data)
+	if err != nil {
+		return nil, err
+	}
+	return tokenizers.FromBytes(data)
+}
+
+// untruncated returns a tokenizer.json with its truncation turned off
+func untruncated(data []byte) ([]byte, error) {
+	var config map[string]json.RawMessage
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("invalid tokenizer.json: %w", err)
+	}
+	config["truncation"] = json.RawMessage("null")
+	return json.Marshal(config)
+}
+
+// ensureModel returns the local path of the model, downloading it from Huggingface if it
+// is not already present in modelDir
+func ensureModel(modelDir string, modelName string) (string, error) {
+	modelPath := filepath.Join(modelDir, strings.Replace(modelName, "/", "_", 1))
+	if err := os.MkdirAll(modelPath, 0775); err != nil {
+		return "", fmt.Errorf("failed to create model directory: %w", err)
+	}
+
+	// Check if model exists, download if it doesn't
+	files, err := filepath.Glob(filepath.Join(modelPath, "*.onnx"))
+	if err != nil {
+		return "", fmt.Errorf("failed to check for existing model: %w", err)
+	}
+
+	if len(files) == 0 {
+		modelPath, err = hugot.DownloadModel(
+			modelName,
+			modelDir,
+			hugot.NewDownloadOptions(),
+		)
+		if err != nil {
+			return "", fmt.Errorf("failed to download model: %w", err)
+		}
+	}
+
+	return modelPath, nil
+}
+
 func (e *Embedder) GetEmbeddings(texts []string) ([][]float32, error) {
 	e.mu.RLock()
 	defer e.mu.RUnlock()
@@ -151,10 +198,29 @@ func (e *Embedder) GetEmbeddings(texts []string) ([][]float32, error) {
 	return result.Embeddings, nil
 }
 
+// CountTokens returns the number of tokens the embedding model's tokenizer produces for
+// text, including special tokens. Text longer than the model takes is counted in full,
+// though the model only embeds its first tokens
+func (e *Embedder) CountTokens(text string) (int, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	if e.counter == nil {
+		return 0, fmt.Errorf("embedder has no tokenizer")
+	}
+	ids, _ := e.counter.Encode(text, true)
+	return len(ids), nil
+}
+
 func (e *Embedder) Close() error {
 	e.mu.Lock()
 	defer e.mu.Unlock()
 
+	if e.counter != nil {
+		e.counter.Close()
+		e.counter = nil
+	}
+
 	if e.session != nil {
 		return e.session.Destroy()
 	}
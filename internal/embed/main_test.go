@@ -5,6 +5,7 @@ import (
 	"path/filepath"
 	"testing"
 
+	"github.com/knights-analytics/hugot/pipelines"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -249,3 +250,26 @@ func TestEmbedderErrors(t *testing.T) {
 		assert.Error(t, err)
 	})
 }
+
+// TestUntruncated checks the counting tokenizer keeps every setting but truncation
+func TestUntruncated(t *testing.T) {
+	data, err := untruncated([]byte(`{"version":"1.0","truncation":{"max_length":128},"model":{"type":"WordPiece"}}`))
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"version":"1.0","truncation":null,"model":{"type":"WordPiece"}}`, string(data))
+
+	_, err = untruncated([]byte("not json"))
+	assert.Error(t, err)
+}
+
+// TestEntailmentScore checks the entailment label is told apart from not_entailment
+func TestEntailmentScore(t *testing.T) {
+	score, err := entailmentScore([]pipelines.ClassificationOutput{
+		{Label: "not_entailment", Score: 0.9},
+		{Label: "ENTAILMENT", Score: 0.1},
+	})
+	require.NoError(t, err)
+	assert.InDelta(t, 0.1, score, 1e-6)
+
+	_, err = entailmentScore([]pipelines.ClassificationOutput{{Label: "not_entailment", Score: 1}})
+	assert.Error(t, err)
+}
@@ -0,0 +1,261 @@
+// Package gitrepo reads the files and history of a local git repository through the git
+// command line plumbing
+package gitrepo
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// ErrNotFound is returned for a file that is not in the commit it was read from, and for
+// a submodule, whose commit is not in the repository
+var ErrNotFound = errors.New("file not found in commit")
+
+// ErrTooLarge is returned for a file larger than the BlobReader reads
+var ErrTooLarge = errors.New("file too large")
+
+// gitlinkMode is the mode ls-tree lists submodules with
+const gitlinkMode = "160000"
+
+// Status is the kind of change a Diff reports for a file
+type Status byte
+
+const (
+	Added    Status = 'A'
+	Modified Status = 'M'
+	Deleted  Status = 'D'
+	Renamed  Status = 'R'
+)
+
+// Change is a file that differs between two commits
+type Change struct {
+	Status  Status
+	Path    string
+	OldPath string // the path before a rename
+}
+
+// Repo is a local git repository
+type Repo struct {
+	root string
+}
+
+// Open returns the repository that the directory at path belongs to
+func Open(ctx context.Context, path string) (*Repo, error) {
+	out, err := git(ctx, path, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return nil, err
+	}
+	return &Repo{root: strings.TrimSpace(string(out))}, nil
+}
+
+// Root returns the top level directory of the working tree
+func (r *Repo) Root() string {
+	return r.root
+}
+
+// Origin returns the URL of the origin remote without the credentials it may hold, or an
+// empty string if the repository has no origin
+func (r *Repo) Origin(ctx context.Context) (string, error) {
+	out, err := git(ctx, r.root, "config", "--get", "remote.origin.url")
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	origin := strings.TrimSpace(string(out))
+	// scp-like addresses such as git@host:path are not URLs, and carry no password
+	if u, err := url.Parse(origin); err == nil && u.User != nil {
+		u.User = nil
+		origin = u.String()
+	}
+	return origin, nil
+}
+
+// Resolve returns the SHA of the commit a ref, such as a branch, tag or SHA, points to
+func (r *Repo) Resolve(ctx context.Context, ref string) (string, error) {
+	out, err := git(ctx, r.root, "rev-parse", "--verify", "--end-of-options", ref+"^{commit}")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// HasCommit reports whether the repository holds a commit, which it may not after its
+// history was rewritten
+func (r *Repo) HasCommit(ctx context.Context, sha string) bool {
+	_, err := git(ctx, r.root, "cat-file", "-e", sha+"^{commit}")
+	return err == nil
+}
+
+// Files returns the paths of the files in a commit. Submodules are left out
+func (r *Repo) Files(ctx context.Context, commit string) ([]string, error) {
+	out, err := git(ctx, r.root, "ls-tree", "-r", "-z", commit)
+	if err != nil {
+		return nil, err
+	}
+
+	// each entry is "<mode> <type> <object>\t<path>"
+	var files []string
+	for _, entry := range splitNul(out) {
+		info, path, ok := strings.Cut(entry, "\t")
+		mode, _, _ := strings.Cut(info, " ")
+		if !ok || mode == "" {
+			return nil, fmt.Errorf("malformed ls-tree output at %q", entry)
+		}
+		if mode != gitlinkMode {
+			files = append(files, path)
+		}
+	}
+	return files, nil
+}
+
+// Diff returns the files that changed from one commit to another. Copies are reported
+// as added files and type changes as modified ones
+func (r *Repo) Diff(ctx context.Context, from string, to string) ([]Change, error) {
+	out, err := git(ctx, r.root, "diff", "--name-status", "-z", "-M", "--no-ext-diff", from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := splitNul(out)
+	var changes []Change
+	for i := 0; i < len(fields); i++ {
+		status := fields[i]
+		if status == "" || i+1 >= len(fields) {
+			return nil, fmt.Errorf("malformed diff output at %q", status)
+		}
+		switch status[0] {
+		case 'R', 'C':
+			if i+2 >= len(fields) {
+				return nil, fmt.Errorf("malformed diff output at %q", status)
+			}
+			change := Change{Status: Renamed, OldPath: fields[i+1], Path: fields[i+2]}
+			if status[0] == 'C' {
+				change = Change{Status: Added, Path: fields[i+2]}
+			}
+			changes = append(changes, change)
+			i += 2
+		case 'A':
+			changes = append(changes, Change{Status: Added, Path: fields[i+1]})
+			i++
+		case 'D':
+			changes = append(changes, Change{Status: Deleted, Path: fields[i+1]})
+			i++
+		default: // M, T and U
+			changes = append(changes, Change{Status: Modified, Path: fields[i+1]})
+			i++
+		}
+	}
+	return changes, nil
+}
+
+// BlobReader reads the content of files at a commit over a single git cat-file process
+type BlobReader struct {
+	cmd     *exec.Cmd
+	stdin   io.WriteCloser
+	stdout  *bufio.Reader
+	maxSize int
+}
+
+// Blobs starts a BlobReader that reads files of up to maxSize bytes. It must be closed
+// once done
+func (r *Repo) Blobs(ctx context.Context, maxSize int) (*BlobReader, error) {
+	cmd := exec.CommandContext(ctx, "git", "-C", r.root, "cat-file", "--batch")
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	return &BlobReader{cmd: cmd, stdin: stdin, stdout: bufio.NewReader(stdout), maxSize: maxSize}, nil
+}
+
+// Read returns the content of the file at path in a commit. Files larger than the reader
+// reads are skipped with ErrTooLarge, and submodules with ErrNotFound
+func (b *BlobReader) Read(commit string, path string) ([]byte, error) {
+	if strings.ContainsAny(path, "\n") {
+		return nil, fmt.Errorf("unsupported file path %q", path)
+	}
+	if _, err := fmt.Fprintf(b.stdin, "%s:%s\n", commit, path); err != nil {
+		return nil, err
+	}
+
+	header, err := b.stdout.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	fields := strings.Fields(header)
+	if len(fields) == 2 && fields[1] == "missing" {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, path)
+	}
+	if len(fields) != 3 {
+		return nil, fmt.Errorf("unexpected cat-file header %q", header)
+	}
+	size, err := strconv.Atoi(fields[2])
+	if err != nil || size < 0 {
+		return nil, fmt.Errorf("unexpected cat-file header %q", header)
+	}
+
+	// the content is followed by a newline, which is read past along with the content of
+	// whatever is not returned
+	if fields[1] != "blob" || size > b.maxSize {
+		if _, err := io.CopyN(io.Discard, b.stdout, int64(size)+1); err != nil {
+			return nil, err
+		}
+		if fields[1] != "blob" {
+			return nil, fmt.Errorf("%w: %s is a %s", ErrNotFound, path, fields[1])
+		}
+		return nil, fmt.Errorf("%w: %s is %d bytes", ErrTooLarge, path, size)
+	}
+	content := make([]byte, size+1)
+	if _, err := io.ReadFull(b.stdout, content); err != nil {
+		return nil, err
+	}
+	return content[:size], nil
+}
+
+// Close stops the cat-file process
+func (b *BlobReader) Close() error {
+	b.stdin.Close()
+	return b.cmd.Wait()
+}
+
+// git runs a git command in dir and returns its output
+func git(ctx context.Context, dir string, args ...string) ([]byte, error) {
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "git", append([]string{"-C", dir}, args...)...)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return nil, fmt.Errorf("git %s: %w: %s", args[0], err, message)
+		}
+		return nil, fmt.Errorf("git %s: %w", args[0], err)
+	}
+	return out, nil
+}
+
+// splitNul splits NUL terminated output into its fields
+func splitNul(out []byte) []string {
+	fields := strings.Split(string(out), "\x00")
+	if len(fields) > 0 && fields[len(fields)-1] == "" {
+		fields = fields[:len(fields)-1]
+	}
+	return fields
+}
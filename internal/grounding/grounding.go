@@ -0,0 +1,243 @@
+package grounding
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/Predixus/DynaRAG/internal/utils"
+)
+
+// Embedder embeds texts into vectors comparable with the source vectors
+type Embedder interface {
+	GetEmbeddings(texts []string) ([][]float32, error)
+}
+
+// Verifier scores how strongly a premise entails a hypothesis, between 0 and 1
+type Verifier interface {
+	Entailment(premise string, hypothesis string) (float64, error)
+}
+
+// Source is a retrieved chunk the answer is expected to be grounded on
+type Source struct {
+	ChunkID int64
+	Text    string
+	Vector  []float32
+}
+
+// SentenceScore describes how well a single sentence of the answer is supported
+type SentenceScore struct {
+	Sentence   string
+	Similarity float64  // highest cosine similarity to any source
+	Entailment *float64 // highest entailment probability, if a Verifier was used
+	Support    float64  // the score compared against the threshold
+	ChunkID    int64    // the source that best supports the sentence
+	Supported  bool
+}
+
+// Report is the outcome of a grounding check
+type Report struct {
+	Sentences []SentenceScore
+	// Groundedness is the fraction of sentences that are supported, between 0 and 1
+	Groundedness float64
+}
+
+// Unsupported returns the sentences that are not supported by any source
+func (r *Report) Unsupported() []SentenceScore {
+	var unsupported []SentenceScore
+	for _, sentence := range r.Sentences {
+		if !sentence.Supported {
+			unsupported = append(unsupported, sentence)
+		}
+	}
+	return unsupported
+}
+
+// Config holds the configuration of a grounding check
+type Config struct {
+	// SimilarityThreshold is the cosine similarity above which a sentence is supported
+	// when no Verifier is set
+	SimilarityThreshold float64
+	// Verifier, if set, scores each sentence against its candidate sources
+	Verifier Verifier
+	// EntailmentThreshold is the entailment probability above which a sentence is
+	// supported when a Verifier is set
+	EntailmentThreshold float64
+	// Candidates is the number of most similar sources passed to the Verifier
+	Candidates int
+}
+
+// Option is a functional option for configuring a grounding check
+type Option func(*Config)
+
+// WithSimilarityThreshold sets the cosine similarity a sentence needs to be supported
+func WithSimilarityThreshold(threshold float64) Option {
+	return func(c *Config) {
+		c.SimilarityThreshold = threshold
+	}
+}
+
+// WithVerifier scores sentences with an entailment model, rather than similarity alone
+func WithVerifier(verifier Verifier, threshold float64) Option {
+	return func(c *Config) {
+		c.Verifier = verifier
+		c.EntailmentThreshold = threshold
+	}
+}
+
+// DefaultConfig returns the default configuration
+func DefaultConfig() Config {
+	return Config{
+		SimilarityThreshold: 0.6,
+		EntailmentThreshold: 0.5,
+		Candidates:          3,
+	}
+}
+
+var (
+	citationPattern   = regexp.MustCompile(`\[([^\[\]]+)\]\[#ref-[^\[\]\s]+\]`)
+	referencesPattern = regexp.MustCompile(`(?im)^\s*searched documents:`)
+)
+
+// Sentences returns the claims of an answer: its sentences, with the trailing list of
+// searched documents removed and in-line citations reduced to their text
+func Sentences(answer string) []string {
+	if loc := referencesPattern.FindStringIndex(answer); loc != nil {
+		answer = answer[:loc[0]]
+	}
+	answer = citationPattern.ReplaceAllString(answer, "$1")
+
+	var sentences []string
+	for _, sentence := range utils.SplitSentences(answer) {
+		// skip fragments with no words, such as markdown rules or list markers
+		if strings.IndexFunc(sentence, unicode.IsLetter) >= 0 {
+			sentences = append(sentences, sentence)
+		}
+	}
+	return sentences
+}
+
+// Check scores each sentence of the answer against the sources it should be grounded on
+func Check(
+	answer string,
+	sources []Source,
+	embedder Embedder,
+	opts ...Option,
+) (*Report, error) {
+	config := DefaultConfig()
+	for _, opt := range opts {
+		opt(&config)
+	}
+
+	report := &Report{}
+
+	sentences := Sentences(answer)
+	if len(sentences) == 0 {
+		return report, nil
+	}
+	if len(sources) == 0 {
+		for _, sentence := range sentences {
+			report.Sentences = append(report.Sentences, SentenceScore{Sentence: sentence})
+		}
+		return report, nil
+	}
+
+	vectors, err := embedder.GetEmbeddings(sentences)
+	if err != nil {
+		return nil, fmt.Errorf("failed to embed answer sentences: %w", err)
+	}
+	if len(vectors) != len(sentences) {
+		return nil, errors.New("embedder returned an unexpected number of vectors")
+	}
+
+	supported := 0
+	for i, sentence := range sentences {
+		score, err := scoreSentence(sentence, vectors[i], sources, config)
+		if err != nil {
+			return nil, err
+		}
+		if score.Supported {
+			supported++
+		}
+		report.Sentences = append(report.Sentences, score)
+	}
+	report.Groundedness = float64(supported) / float64(len(sentences))
+
+	return report, nil
+}
+
+func scoreSentence(
+	sentence string,
+	vector []float32,
+	sources []Source,
+	config Config,
+) (SentenceScore, error) {
+	similarities := make([]float64, len(sources))
+	for i, source := range sources {
+		similarities[i] = CosineSimilarity(vector, source.Vector)
+	}
+
+	ranked := rankDescending(similarities)
+	best := ranked[0]
+	score := SentenceScore{
+		Sentence:   sentence,
+		Similarity: similarities[best],
+		Support:    similarities[best],
+		ChunkID:    sources[best].ChunkID,
+	}
+
+	if config.Verifier == nil {
+		score.Supported = score.Support >= config.SimilarityThreshold
+		return score, nil
+	}
+
+	entailment := 0.0
+	for _, i := range ranked[:min(config.Candidates, len(ranked))] {
+		probability, err := config.Verifier.Entailment(sources[i].Text, sentence)
+		if err != nil {
+			return SentenceScore{}, fmt.Errorf("failed to verify sentence: %w", err)
+		}
+		if probability > entailment {
+			entailment = probability
+			score.ChunkID = sources[i].ChunkID
+		}
+	}
+	score.Entailment = &entailment
+	score.Support = entailment
+	score.Supported = entailment >= config.EntailmentThreshold
+	return score, nil
+}
+
+// CosineSimilarity returns the cosine similarity of two vectors, or 0 if they differ in
+// length or either has no magnitude
+func CosineSimilarity(a []float32, b []float32) float64 {
+	if len(a) != len(b) {
+		return 0
+	}
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
+
+// rankDescending returns the indices of values ordered from highest to lowest
+func rankDescending(values []float64) []int {
+	indices := make([]int, len(values))
+	for i := range indices {
+		indices[i] = i
+	}
+	sort.SliceStable(indices, func(i, j int) bool {
+		return values[indices[i]] > values[indices[j]]
+	})
+	return indices
+}
@@ -0,0 +1,134 @@
+package grounding
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// keywordEmbedder embeds text as a bag of known keywords, so similarity is predictable
+type keywordEmbedder struct {
+	keywords []string
+}
+
+func (e keywordEmbedder) GetEmbeddings(texts []string) ([][]float32, error) {
+	if len(texts) == 0 {
+		return nil, errors.New("no texts")
+	}
+	vectors := make([][]float32, len(texts))
+	for i, text := range texts {
+		vectors[i] = e.embed(text)
+	}
+	return vectors, nil
+}
+
+func (e keywordEmbedder) embed(text string) []float32 {
+	vector := make([]float32, len(e.keywords))
+	for i, keyword := range e.keywords {
+		if strings.Contains(strings.ToLower(text), keyword) {
+			vector[i] = 1
+		}
+	}
+	return vector
+}
+
+// fixedVerifier entails a hypothesis when the premise contains it
+type fixedVerifier struct{}
+
+func (fixedVerifier) Entailment(premise string, hypothesis string) (float64, error) {
+	if strings.Contains(premise, strings.TrimSuffix(hypothesis, ".")) {
+		return 0.9, nil
+	}
+	return 0.1, nil
+}
+
+func TestSentences(t *testing.T) {
+	answer := "The capital of England is [London][#ref-0]. It is large!\n\n" +
+		"Searched Documents:\n- #ref-0: ./test"
+
+	assert.Equal(
+		t,
+		[]string{"The capital of England is London.", "It is large!"},
+		Sentences(answer),
+	)
+}
+
+func TestCheck(t *testing.T) {
+	embedder := keywordEmbedder{keywords: []string{"london", "capital", "england", "paris", "france"}}
+	sources := []Source{
+		{ChunkID: 1, Text: "London is the capital of England", Vector: embedder.embed("london capital england")},
+		{ChunkID: 2, Text: "Rain is common in autumn", Vector: embedder.embed("")},
+	}
+
+	tests := []struct {
+		name             string
+		answer           string
+		opts             []Option
+		wantSupported    []bool
+		wantGroundedness float64
+	}{
+		{
+			name:             "supported by similarity",
+			answer:           "[London][#ref-0] is the capital of England.",
+			wantSupported:    []bool{true},
+			wantGroundedness: 1,
+		},
+		{
+			name:             "unsupported sentence is flagged",
+			answer:           "London is the capital of England. Paris is the capital of France.",
+			wantSupported:    []bool{true, false},
+			wantGroundedness: 0.5,
+		},
+		{
+			name:             "verifier decides support",
+			answer:           "London is the capital of England. The capital of England is large.",
+			opts:             []Option{WithVerifier(fixedVerifier{}, 0.5)},
+			wantSupported:    []bool{true, false},
+			wantGroundedness: 0.5,
+		},
+		{
+			name:             "empty answer",
+			answer:           "",
+			wantSupported:    nil,
+			wantGroundedness: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report, err := Check(tt.answer, sources, embedder, tt.opts...)
+			require.NoError(t, err)
+
+			var supported []bool
+			for _, sentence := range report.Sentences {
+				supported = append(supported, sentence.Supported)
+				if sentence.Supported {
+					assert.Equal(t, int64(1), sentence.ChunkID)
+				}
+			}
+			assert.Equal(t, tt.wantSupported, supported)
+			assert.InDelta(t, tt.wantGroundedness, report.Groundedness, 1e-9)
+			assert.Len(t, report.Unsupported(), len(tt.wantSupported)-countTrue(tt.wantSupported))
+		})
+	}
+}
+
+func TestCosineSimilarity(t *testing.T) {
+	assert.InDelta(t, 1.0, CosineSimilarity([]float32{1, 2}, []float32{2, 4}), 1e-9)
+	assert.InDelta(t, 0.0, CosineSimilarity([]float32{1, 0}, []float32{0, 1}), 1e-9)
+	assert.Equal(t, 0.0, CosineSimilarity([]float32{1}, []float32{1, 2}))
+	assert.Equal(t, 0.0, CosineSimilarity([]float32{0, 0}, []float32{1, 2}))
+}
+
+func countTrue(values []bool) int {
+	count := 0
+	for _, value := range values {
+		if value {
+			count++
+		}
+	}
+	return count
+}
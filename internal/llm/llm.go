@@ -3,12 +3,18 @@ package llm
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"math"
 	"net/http"
 	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/Predixus/DynaRAG/types"
 )
 
 // Provider represents supported LLM providers
@@ -30,6 +36,7 @@ type Config struct {
 	token       string
 	temperature float32
 	endpoint    string
+	prices      types.PriceTable
 }
 
 // Option is a function that modifies Config
@@ -38,6 +45,26 @@ type Option func(*Config)
 // ResponseParser interface that all streaming responses must implement
 type ResponseParser interface {
 	GetContent() string
+	GetFinishReason() string
+	GetUsage() *Usage
+}
+
+// Usage holds the token counts reported by the provider for a single generation
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+// GenerationResult describes the outcome of a call to Generate
+type GenerationResult struct {
+	Provider         Provider
+	Model            string
+	Usage            *Usage        // nil if the provider did not report usage
+	Cost             *float64      // nil if usage or the model price is unknown
+	Latency          time.Duration // from sending the request to the end of the stream
+	TimeToFirstToken time.Duration // zero if no content was streamed
+	FinishReason     string
 }
 
 // GroqStreamingChatCompletion describes a chunk from a stream
@@ -47,6 +74,15 @@ type GroqStreamingChatCompletion struct {
 	Created int64        `json:"created"`
 	Model   string       `json:"model"`
 	Choices []GroqChoice `json:"choices"`
+	Usage   *Usage       `json:"usage,omitempty"`
+	XGroq   *GroqExtra   `json:"x_groq,omitempty"`
+}
+
+// GroqExtra holds the groq specific fields of a chunk. Groq reports usage here on the
+// final chunk of a stream
+type GroqExtra struct {
+	ID    string `json:"id"`
+	Usage *Usage `json:"usage,omitempty"`
 }
 
 // GroqChoice lower level chunk structure to the groq api response
@@ -64,10 +100,11 @@ type LLMModel[T ResponseParser] struct {
 	token       string
 	temperature float32
 	endpoint    string
+	prices      types.PriceTable
 }
 
 type LLM interface {
-	Generate(messages []Message, writer io.Writer) error
+	Generate(ctx context.Context, messages []Message, writer io.Writer) (*GenerationResult, error)
 }
 
 const (
@@ -79,7 +116,11 @@ const (
 	RoleUser      Role = "user"
 	RoleAssistant Role = "assistant"
 
+	// DefaultCharsPerToken is a reasonable average for English text across most tokenizers
+	DefaultCharsPerToken = 4.0
+
 	// Default values
+	groqCharsPerToken   = 3.8 // Llama 3 tokenizer on English prose
 	defaultTemperature  = 0.2
 	defaultGroqModel    = "llama-3.3-70b-versatile"
 	defaultGroqEndpoint = "https://api.groq.com/openai/v1/chat/completions"
@@ -104,6 +145,13 @@ func WithEndpoint(endpoint string) Option {
 	}
 }
 
+// WithPrices sets the price table used to estimate the cost of each generation
+func WithPrices(prices types.PriceTable) Option {
+	return func(c *Config) {
+		c.prices = prices
+	}
+}
+
 // parseProvider validates and returns a Provider
 func parseProvider(s string) (Provider, error) {
 	provider := Provider(strings.ToLower(s))
@@ -131,6 +179,57 @@ func (g GroqStreamingChatCompletion) GetContent() string {
 	return ""
 }
 
+func (g GroqStreamingChatCompletion) GetFinishReason() string {
+	if len(g.Choices) > 0 {
+		return g.Choices[0].FinishReason
+	}
+	return ""
+}
+
+// GetUsage returns the usage block of the chunk. Groq places it under x_groq, while
+// OpenAI compatible endpoints place it at the top level when include_usage is set
+func (g GroqStreamingChatCompletion) GetUsage() *Usage {
+	if g.XGroq != nil && g.XGroq.Usage != nil {
+		return g.XGroq.Usage
+	}
+	return g.Usage
+}
+
+// TokenEstimator approximates the number of tokens in a text from its length, for use
+// where the provider's tokenizer is not available locally
+type TokenEstimator struct {
+	CharsPerToken float64
+}
+
+// NewTokenEstimator returns a TokenEstimator tuned to the models served by the provider
+func NewTokenEstimator(provider string) (TokenEstimator, error) {
+	p, err := parseProvider(provider)
+	if err != nil {
+		return TokenEstimator{}, fmt.Errorf("invalid provider: %w", err)
+	}
+
+	switch p {
+	case ProviderGroq:
+		return TokenEstimator{CharsPerToken: groqCharsPerToken}, nil
+	default:
+		return TokenEstimator{CharsPerToken: DefaultCharsPerToken}, nil
+	}
+}
+
+// CountTokens returns the estimated number of tokens in text
+func (e TokenEstimator) CountTokens(text string) (int, error) {
+	if e.CharsPerToken <= 0 {
+		return 0, errors.New("chars per token must be positive")
+	}
+	return int(math.Ceil(float64(utf8.RuneCountInString(text)) / e.CharsPerToken)), nil
+}
+
+// Cost estimates the cost of the usage given the price of the model
+func (u Usage) Cost(price types.ModelPrice) float64 {
+	return (float64(u.PromptTokens)*price.PromptPerMillion +
+		float64(u.CompletionTokens)*price.CompletionPerMillion) / 1e6
+}
+
 func (r Role) isValid() bool {
 	switch r {
 	case RoleSystem, RoleUser, RoleAssistant:
@@ -181,15 +280,20 @@ func NewClient(provider string, token string, opts ...Option) (LLM, error) {
 			token:       config.token,
 			endpoint:    config.endpoint,
 			temperature: config.temperature,
+			prices:      config.prices,
 		}, nil
 	default:
 		return nil, fmt.Errorf("unsupported provider: %s", provider)
 	}
 }
 
-func (l *LLMModel[T]) Generate(messages []Message, writer io.Writer) error {
+func (l *LLMModel[T]) Generate(
+	ctx context.Context,
+	messages []Message,
+	writer io.Writer,
+) (*GenerationResult, error) {
 	if len(messages) == 0 {
-		return errors.New("Messages cannot be empty.")
+		return nil, errors.New("Messages cannot be empty.")
 	}
 
 	// so far this seems common across all the LLM providers.
@@ -200,34 +304,44 @@ func (l *LLMModel[T]) Generate(messages []Message, writer io.Writer) error {
 		"model":       l.model,
 		"temperature": l.temperature,
 		"stream":      true,
+		"stream_options": map[string]interface{}{
+			"include_usage": true,
+		},
 	}
 
 	jsonData, err := json.Marshal(payload)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	req, err := http.NewRequest(
+	req, err := http.NewRequestWithContext(
+		ctx,
 		"POST",
 		l.endpoint,
 		bytes.NewBuffer(jsonData),
 	)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Authorization", "Bearer "+l.token)
 
+	result := &GenerationResult{
+		Provider: l.provider,
+		Model:    l.model,
+	}
+	start := time.Now()
+
 	client := &http.Client{}
 	resp, err := client.Do(req)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("groq request failed with status: %d", resp.StatusCode)
+		return nil, fmt.Errorf("%s request failed with status: %d", l.provider, resp.StatusCode)
 	}
 
 	reader := bufio.NewReader(resp.Body)
@@ -237,7 +351,7 @@ func (l *LLMModel[T]) Generate(messages []Message, writer io.Writer) error {
 			if err == io.EOF {
 				break
 			}
-			return fmt.Errorf("error reading stream: %v", err)
+			return nil, fmt.Errorf("error reading stream: %w", err)
 		}
 
 		line = strings.TrimSpace(line)
@@ -256,15 +370,32 @@ func (l *LLMModel[T]) Generate(messages []Message, writer io.Writer) error {
 
 		var chunk T
 		if err := json.Unmarshal([]byte(line), &chunk); err != nil {
-			return fmt.Errorf("error parsing chunk: %v", err)
+			return nil, fmt.Errorf("error parsing chunk: %v", err)
+		}
+
+		if usage := chunk.GetUsage(); usage != nil {
+			result.Usage = usage
+		}
+		if reason := chunk.GetFinishReason(); reason != "" {
+			result.FinishReason = reason
 		}
 
 		if content := chunk.GetContent(); content != "" {
+			if result.TimeToFirstToken == 0 {
+				result.TimeToFirstToken = time.Since(start)
+			}
 			if _, err := writer.Write([]byte(content)); err != nil {
-				return fmt.Errorf("error writing to output: %v", err)
+				return nil, fmt.Errorf("error writing to output: %w", err)
 			}
 		}
 	}
 
-	return nil
+	result.Latency = time.Since(start)
+
+	if price, ok := l.prices[l.model]; ok && result.Usage != nil {
+		cost := result.Usage.Cost(price)
+		result.Cost = &cost
+	}
+
+	return result, nil
 }
@@ -2,8 +2,15 @@ package llm
 
 import (
 	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"testing"
+	"time"
+
+	"github.com/Predixus/DynaRAG/types"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -116,20 +123,138 @@ func TestGenerate(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			var buf bytes.Buffer
-			err := client.Generate(tt.messages, &buf)
+			result, err := client.Generate(context.Background(), tt.messages, &buf)
 
 			if tt.wantErr {
 				assert.Error(t, err)
+				assert.Nil(t, result)
 				assert.Empty(t, buf.String())
 				return
 			}
 
 			assert.NoError(t, err)
 			assert.NotEmpty(t, buf.String())
+			require.NotNil(t, result.Usage)
+			assert.Greater(t, result.Usage.TotalTokens, 0)
 		})
 	}
 }
 
+func TestGenerateUsage(t *testing.T) {
+	tests := []struct {
+		name      string
+		chunks    []string
+		wantUsage *Usage
+		wantCost  *float64
+	}{
+		{
+			name: "groq usage in x_groq",
+			chunks: []string{
+				`{"id":"1","choices":[{"index":0,"delta":{"role":"assistant","content":"Hello"},"finish_reason":null}]}`,
+				`{"id":"1","choices":[{"index":0,"delta":{"content":" world"},"finish_reason":null}]}`,
+				`{"id":"1","choices":[{"index":0,"delta":{},"finish_reason":"stop"}],"x_groq":{"id":"req_1","usage":{"prompt_tokens":10,"completion_tokens":2,"total_tokens":12}}}`,
+			},
+			wantUsage: &Usage{PromptTokens: 10, CompletionTokens: 2, TotalTokens: 12},
+			wantCost:  func() *float64 { c := (10*1.0 + 2*2.0) / 1e6; return &c }(),
+		},
+		{
+			name: "openai style usage chunk",
+			chunks: []string{
+				`{"id":"1","choices":[{"index":0,"delta":{"content":"Hello"},"finish_reason":null}]}`,
+				`{"id":"1","choices":[{"index":0,"delta":{"content":" world"},"finish_reason":"stop"}]}`,
+				`{"id":"1","choices":[],"usage":{"prompt_tokens":7,"completion_tokens":2,"total_tokens":9}}`,
+			},
+			wantUsage: &Usage{PromptTokens: 7, CompletionTokens: 2, TotalTokens: 9},
+			wantCost:  func() *float64 { c := (7*1.0 + 2*2.0) / 1e6; return &c }(),
+		},
+		{
+			name: "no usage reported",
+			chunks: []string{
+				`{"id":"1","choices":[{"index":0,"delta":{"content":"Hello world"},"finish_reason":"stop"}]}`,
+			},
+			wantUsage: nil,
+			wantCost:  nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				for _, chunk := range tt.chunks {
+					fmt.Fprintf(w, "data: %s\n\n", chunk)
+				}
+				fmt.Fprint(w, "data: [DONE]\n\n")
+			}))
+			defer server.Close()
+
+			client, err := NewClient(
+				"groq",
+				"test-token",
+				WithModel("test-model"),
+				WithEndpoint(server.URL),
+				WithPrices(types.PriceTable{
+					"test-model": {PromptPerMillion: 1.0, CompletionPerMillion: 2.0},
+				}),
+			)
+			require.NoError(t, err)
+
+			var buf bytes.Buffer
+			result, err := client.Generate(
+				context.Background(),
+				[]Message{{Role: RoleUser, Content: "Say hello"}},
+				&buf,
+			)
+			require.NoError(t, err)
+
+			assert.Equal(t, "Hello world", buf.String())
+			assert.Equal(t, "stop", result.FinishReason)
+			assert.Equal(t, "test-model", result.Model)
+			assert.Equal(t, tt.wantUsage, result.Usage)
+			if tt.wantCost == nil {
+				assert.Nil(t, result.Cost)
+			} else {
+				require.NotNil(t, result.Cost)
+				assert.InDelta(t, *tt.wantCost, *result.Cost, 1e-12)
+			}
+			assert.Greater(t, result.TimeToFirstToken, time.Duration(0))
+			assert.GreaterOrEqual(t, result.Latency, result.TimeToFirstToken)
+		})
+	}
+}
+
+// cancelWriter cancels a context once anything is written to it
+type cancelWriter struct {
+	bytes.Buffer
+	cancel context.CancelFunc
+}
+
+func (w *cancelWriter) Write(p []byte) (int, error) {
+	defer w.cancel()
+	return w.Buffer.Write(p)
+}
+
+// TestGenerateCancelled checks a cancelled context stops a stream the server keeps open
+func TestGenerateCancelled(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "data: %s\n\n", `{"id":"1","choices":[{"index":0,"delta":{"content":"Hello"},"finish_reason":null}]}`)
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	client, err := NewClient("groq", "test-token", WithEndpoint(server.URL))
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	writer := &cancelWriter{cancel: cancel}
+
+	result, err := client.Generate(ctx, []Message{{Role: RoleUser, Content: "Say hello"}}, writer)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Nil(t, result)
+	assert.Equal(t, "Hello", writer.String())
+}
+
 func TestConfigOptions(t *testing.T) {
 	config := &Config{
 		provider:    ProviderGroq,
@@ -174,3 +299,19 @@ func TestConfigOptions(t *testing.T) {
 		})
 	}
 }
+
+func TestTokenEstimator(t *testing.T) {
+	estimator, err := NewTokenEstimator("groq")
+	require.NoError(t, err)
+	assert.Equal(t, groqCharsPerToken, estimator.CharsPerToken)
+
+	_, err = NewTokenEstimator("invalid")
+	assert.Error(t, err)
+
+	tokens, err := TokenEstimator{CharsPerToken: 4}.CountTokens("abcdefghi")
+	require.NoError(t, err)
+	assert.Equal(t, 3, tokens)
+
+	_, err = TokenEstimator{}.CountTokens("abc")
+	assert.Error(t, err)
+}
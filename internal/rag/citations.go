@@ -0,0 +1,114 @@
+package rag
+
+import "regexp"
+
+// Citation is an in-line reference in an answer, written in the
+// [relevant text][#ref-{chunk-index}] form the default template asks for
+type Citation struct {
+	Text  string // the cited text
+	Index string // the index of the cited Document
+}
+
+var citationPattern = regexp.MustCompile(`\[([^\[\]]+)\]\[#ref-([^\[\]\s]+)\]`)
+
+// ParseCitations returns the in-line citations of an answer, in the order they appear
+func ParseCitations(answer string) []Citation {
+	var citations []Citation
+	for _, match := range citationPattern.FindAllStringSubmatch(answer, -1) {
+		citations = append(citations, Citation{
+			Text:  match[1],
+			Index: match[2],
+		})
+	}
+	return citations
+}
+
+// The states of a CitationScanner
+const (
+	scanOutside   = iota // outside any citation
+	scanText             // within the [relevant text]
+	scanTextEnd          // after the ] closing the text
+	scanRefPrefix        // within the [#ref- before the index
+	scanIndex            // within the chunk index
+)
+
+const refPrefix = "#ref-"
+
+// CitationScanner finds the in-line citations of an answer as it is streamed, matching
+// what ParseCitations finds in the whole answer. Each byte is read once, however the
+// answer is split, so a citation may span several writes
+type CitationScanner struct {
+	state int
+	text  []byte
+	ref   []byte // the part of the [#ref-{index}] read so far
+}
+
+// Write scans the next part of the answer, returning the citations it completes
+func (s *CitationScanner) Write(p []byte) []Citation {
+	var citations []Citation
+	for _, b := range p {
+		if citation, ok := s.scan(b); ok {
+			citations = append(citations, citation)
+		}
+	}
+	return citations
+}
+
+func (s *CitationScanner) scan(b byte) (Citation, bool) {
+	switch s.state {
+	case scanText:
+		switch b {
+		case '[':
+			s.text = s.text[:0]
+		case ']':
+			if len(s.text) == 0 {
+				s.state = scanOutside
+			} else {
+				s.state = scanTextEnd
+			}
+		default:
+			s.text = append(s.text, b)
+		}
+	case scanTextEnd:
+		if b == '[' {
+			s.state, s.ref = scanRefPrefix, s.ref[:0]
+		} else {
+			s.state = scanOutside
+		}
+	case scanRefPrefix:
+		if b != refPrefix[len(s.ref)] {
+			return s.retext(b)
+		}
+		s.ref = append(s.ref, b)
+		if len(s.ref) == len(refPrefix) {
+			s.state = scanIndex
+		}
+	case scanIndex:
+		switch {
+		case b == ']' && len(s.ref) > len(refPrefix):
+			s.state = scanOutside
+			return Citation{Text: string(s.text), Index: string(s.ref[len(refPrefix):])}, true
+		case b == '[' || b == ']' || isSpace(b):
+			return s.retext(b)
+		default:
+			s.ref = append(s.ref, b)
+		}
+	default:
+		if b == '[' {
+			s.state, s.text = scanText, s.text[:0]
+		}
+	}
+	return Citation{}, false
+}
+
+// retext handles a reference that turned out not to be one. The bracket opening it may
+// instead open the text of the next citation, so what followed it is read again as text
+func (s *CitationScanner) retext(b byte) (Citation, bool) {
+	s.state, s.text = scanText, append(s.text[:0], s.ref...)
+	return s.scan(b)
+}
+
+// isSpace reports whether b is whitespace as matched by \s
+func isSpace(b byte) bool {
+	return b == ' ' || b == '\t' || b == '\n' || b == '\f' || b == '\r'
+}
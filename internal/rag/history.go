@@ -0,0 +1,70 @@
+package rag
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/Predixus/DynaRAG/internal/llm"
+)
+
+const summarySystemPrompt = `You maintain the memory of a conversation between a user and an
+assistant. Merge the existing summary with the new messages into a single concise summary that
+keeps every fact, name, decision and open question needed to continue the conversation.
+Reply with the summary only.`
+
+// SummaryPrompt returns the system prompt and the user prompt asking the LLM to fold messages
+// into the existing summary of a conversation
+func SummaryPrompt(summary string, messages []llm.Message) (string, string) {
+	var prompt strings.Builder
+	if summary != "" {
+		prompt.WriteString("Existing summary:\n")
+		prompt.WriteString(summary)
+		prompt.WriteString("\n\n")
+	}
+	prompt.WriteString("New messages:\n")
+	for _, message := range messages {
+		prompt.WriteString(string(message.Role))
+		prompt.WriteString(": ")
+		prompt.WriteString(message.Content)
+		prompt.WriteString("\n")
+	}
+	return summarySystemPrompt, prompt.String()
+}
+
+// SummaryMessage wraps the summary of the earlier conversation as a message that precedes
+// the remaining history
+func SummaryMessage(summary string) llm.Message {
+	return llm.Message{
+		Role:    llm.RoleSystem,
+		Content: "Summary of the earlier conversation:\n" + summary,
+	}
+}
+
+// SplitHistory splits the history, oldest first, into the older messages that do not fit
+// the token budget and the most recent messages that do. Messages are kept whole, so the
+// split never falls inside a message. A budget of zero or less keeps everything
+func SplitHistory(
+	history []llm.Message,
+	budget int,
+	counter TokenCounter,
+) ([]llm.Message, []llm.Message, error) {
+	if counter == nil {
+		return nil, nil, errors.New("a token counter is required to split history")
+	}
+	if budget <= 0 {
+		return nil, history, nil
+	}
+
+	used := 0
+	for i := len(history) - 1; i >= 0; i-- {
+		tokens, err := counter.CountTokens(history[i].Content)
+		if err != nil {
+			return nil, nil, err
+		}
+		if used+tokens > budget {
+			return history[:i+1], history[i+1:], nil
+		}
+		used += tokens
+	}
+	return nil, history, nil
+}
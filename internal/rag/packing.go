@@ -0,0 +1,151 @@
+package rag
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/Predixus/DynaRAG/internal/utils"
+)
+
+// TokenCounter counts the tokens in a piece of text
+type TokenCounter interface {
+	CountTokens(text string) (int, error)
+}
+
+// PackingReport describes how the retrieved documents were fit into the token budget
+type PackingReport struct {
+	Budget    int        // maximum number of tokens in the rendered prompt
+	Tokens    int        // number of tokens in the rendered prompt
+	Included  []Document // documents placed in the prompt, in rank order
+	Truncated []Document // included documents whose content was cut at a sentence boundary
+	Dropped   []Document // documents that did not fit in the budget
+}
+
+// packDocuments fits as many of the highest ranked documents as the budget allows. The
+// documents are assumed to be ordered by rank. The first document that does not fit is
+// truncated at a sentence boundary where possible, and every document after it is dropped.
+//
+// render returns the prompt for a given set of documents, and is used to measure the
+// fixed cost of the template and the per-document overhead of its formatting
+func packDocuments(
+	documents []Document,
+	budget int,
+	counter TokenCounter,
+	render func([]Document) (string, error),
+) (*PackingReport, error) {
+	if counter == nil {
+		return nil, errors.New("a token counter is required to pack documents")
+	}
+
+	report := &PackingReport{Budget: budget}
+
+	if budget <= 0 {
+		report.Included = documents
+		return report, report.measure(counter, render)
+	}
+
+	base, err := countRendered(counter, render, nil)
+	if err != nil {
+		return nil, err
+	}
+	withEmpty, err := countRendered(counter, render, []Document{{}})
+	if err != nil {
+		return nil, err
+	}
+	perDocument := max(withEmpty-base, 0)
+
+	remaining := budget - base
+	for i, doc := range documents {
+		overhead, err := countAll(counter, doc.Index, doc.Source)
+		if err != nil {
+			return nil, err
+		}
+		overhead += perDocument
+
+		content, err := counter.CountTokens(doc.Content)
+		if err != nil {
+			return nil, fmt.Errorf("failed to count tokens: %w", err)
+		}
+
+		if overhead+content <= remaining {
+			report.Included = append(report.Included, doc)
+			remaining -= overhead + content
+			continue
+		}
+
+		rest := documents[i+1:]
+		truncated, err := truncateToTokens(doc.Content, remaining-overhead, counter)
+		if err != nil {
+			return nil, err
+		}
+		if truncated != "" {
+			report.Truncated = append(report.Truncated, doc)
+			doc.Content = truncated
+			report.Included = append(report.Included, doc)
+		} else {
+			rest = documents[i:]
+		}
+		report.Dropped = append(report.Dropped, rest...)
+		break
+	}
+
+	return report, report.measure(counter, render)
+}
+
+// measure records the size of the final prompt
+func (r *PackingReport) measure(
+	counter TokenCounter,
+	render func([]Document) (string, error),
+) error {
+	tokens, err := countRendered(counter, render, r.Included)
+	if err != nil {
+		return err
+	}
+	r.Tokens = tokens
+	return nil
+}
+
+// truncateToTokens returns the longest prefix of text that ends on a sentence boundary
+// and fits within maxTokens. An empty string is returned if no sentence fits
+func truncateToTokens(text string, maxTokens int, counter TokenCounter) (string, error) {
+	if maxTokens <= 0 {
+		return "", nil
+	}
+
+	truncated := ""
+	for _, end := range utils.SentenceBoundaries(text) {
+		tokens, err := counter.CountTokens(text[:end])
+		if err != nil {
+			return "", fmt.Errorf("failed to count tokens: %w", err)
+		}
+		if tokens > maxTokens {
+			break
+		}
+		truncated = text[:end]
+	}
+	return truncated, nil
+}
+
+func countRendered(
+	counter TokenCounter,
+	render func([]Document) (string, error),
+	documents []Document,
+) (int, error) {
+	prompt, err := render(documents)
+	if err != nil {
+		return 0, err
+	}
+	return countAll(counter, prompt)
+}
+
+func countAll(counter TokenCounter, texts ...string) (int, error) {
+	total := 0
+	for _, text := range texts {
+		tokens, err := counter.CountTokens(text)
+		if err != nil {
+			return 0, fmt.Errorf("failed to count tokens: %w", err)
+		}
+		total += tokens
+	}
+	return total, nil
+}
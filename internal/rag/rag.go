@@ -4,6 +4,11 @@ import (
 	"bytes"
 	_ "embed"
 	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+	"sync"
 	"text/template"
 
 	"github.com/Predixus/DynaRAG/internal/llm"
@@ -18,11 +23,17 @@ type Document struct {
 
 // RAGConfig holds the configuration for RAG system prompts
 type RAGConfig struct {
-	Documents     []Document // Changed from documents to Documents
-	MaxTokens     int        // Changed from maxTokens to MaxTokens
-	Temperature   float32    // Changed from temperature to Temperature
-	ResponseStyle string     // Changed from responseStyle to ResponseStyle
-	Query         string     // Changed from query to Query
+	Documents     []Document     // Changed from documents to Documents
+	MaxTokens     int            // Token budget of the prompt. Zero or less disables packing
+	Temperature   float32        // Changed from temperature to Temperature
+	ResponseStyle string         // Changed from responseStyle to ResponseStyle
+	Query         string         // Changed from query to Query
+	TokenCounter  TokenCounter   // Counts tokens when packing documents into MaxTokens
+	Template      string         // Name of the template that renders the system prompt
+	Vars          map[string]any // Extra variables supplied by the caller
+	History       []llm.Message  // Earlier turns of the conversation, placed before the query
+
+	templateManager *TemplateManager
 }
 
 // Option is a function type that modifies RAGConfig
@@ -42,6 +53,42 @@ func WithTemperature(temp float32) Option {
 	}
 }
 
+// WithTokenCounter sets the token counter used to fit documents into MaxTokens
+func WithTokenCounter(counter TokenCounter) Option {
+	return func(c *RAGConfig) {
+		c.TokenCounter = counter
+	}
+}
+
+// WithTemplate selects the registered template used to render the system prompt
+func WithTemplate(name string) Option {
+	return func(c *RAGConfig) {
+		c.Template = name
+	}
+}
+
+// WithVars sets extra variables made available to templates as .Vars
+func WithVars(vars map[string]any) Option {
+	return func(c *RAGConfig) {
+		c.Vars = vars
+	}
+}
+
+// WithHistory places earlier turns of a conversation between the system prompt and the query
+func WithHistory(history []llm.Message) Option {
+	return func(c *RAGConfig) {
+		c.History = history
+	}
+}
+
+// WithTemplateManager renders prompts with the templates of an existing manager, rather
+// than one holding only the built-in templates
+func WithTemplateManager(tm *TemplateManager) Option {
+	return func(c *RAGConfig) {
+		c.templateManager = tm
+	}
+}
+
 // WithResponseStyle sets the response style for the RAG configuration
 func WithResponseStyle(style string) Option {
 	return func(c *RAGConfig) {
@@ -55,15 +102,45 @@ func defaultConfig() *RAGConfig {
 		MaxTokens:     2048,
 		Temperature:   0.2,
 		ResponseStyle: "concise and factual",
+		TokenCounter:  llm.TokenEstimator{CharsPerToken: llm.DefaultCharsPerToken},
+		Template:      DefaultTemplate,
 	}
 }
 
-//go:embed rag_prompt_with_initial_query.txt
+// SampleConfig returns a RAGConfig populated with example values, used to validate
+// templates when they are registered
+func SampleConfig() RAGConfig {
+	config := *defaultConfig()
+	config.Query = "What is the capital of England?"
+	config.Documents = []Document{
+		{Index: "0", Source: "./geography.txt", Content: "London is the capital of England."},
+		{Index: "1", Source: "./history.txt", Content: "London was founded by the Romans."},
+	}
+	config.Vars = map[string]any{}
+	return config
+}
+
+// Names of the built-in templates
+const (
+	// DefaultTemplate renders the system message of a chat completion. The query is sent
+	// separately as a user message
+	DefaultTemplate = "default_rag"
+	// Llama3CompletionTemplate renders the whole conversation, including the query, with
+	// raw Llama 3 special tokens. Only use it with completion style endpoints that do not
+	// apply a chat template of their own
+	Llama3CompletionTemplate = "llama3_completion"
+)
+
+//go:embed rag_system_prompt.txt
 var defaultRAGTemplate string
 
+//go:embed rag_prompt_with_initial_query.txt
+var llama3CompletionTemplate string
+
 // TemplateManager handles the loading and execution of prompt templates
 type TemplateManager struct {
 	templates map[string]*template.Template
+	mu        sync.RWMutex
 }
 
 // NewTemplateManager creates a new template manager
@@ -73,19 +150,75 @@ func NewTemplateManager() *TemplateManager {
 	}
 }
 
-// RegisterTemplate adds a new template to the manager
+// NewDefaultTemplateManager creates a template manager holding the built-in templates
+func NewDefaultTemplateManager() (*TemplateManager, error) {
+	tm := NewTemplateManager()
+	if err := tm.RegisterTemplate(DefaultTemplate, defaultRAGTemplate); err != nil {
+		return nil, fmt.Errorf("failed to register default template: %w", err)
+	}
+	if err := tm.RegisterTemplate(Llama3CompletionTemplate, llama3CompletionTemplate); err != nil {
+		return nil, fmt.Errorf("failed to register completion template: %w", err)
+	}
+	return tm, nil
+}
+
+// RegisterTemplate adds a new template to the manager. The template is rendered against
+// SampleConfig so that references to unknown fields are caught at registration
 func (tm *TemplateManager) RegisterTemplate(name, templateContent string) error {
 	tmpl, err := template.New(name).Parse(templateContent)
 	if err != nil {
 		return fmt.Errorf("failed to parse template %s: %v", name, err)
 	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, SampleConfig()); err != nil {
+		return fmt.Errorf("template %s is invalid: %v", name, err)
+	}
+
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
 	tm.templates[name] = tmpl
 	return nil
 }
 
+// RegisterTemplateFile adds a template read from a file
+func (tm *TemplateManager) RegisterTemplateFile(name, filePath string) error {
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to read template %s: %v", name, err)
+	}
+	return tm.RegisterTemplate(name, string(content))
+}
+
+// RegisterTemplatesFS adds every file in fsys matching pattern as a template. Each
+// template is named after its file, without the extension
+func (tm *TemplateManager) RegisterTemplatesFS(fsys fs.FS, pattern string) error {
+	paths, err := fs.Glob(fsys, pattern)
+	if err != nil {
+		return fmt.Errorf("invalid template pattern %s: %v", pattern, err)
+	}
+	if len(paths) == 0 {
+		return fmt.Errorf("no templates match %s", pattern)
+	}
+
+	for _, p := range paths {
+		content, err := fs.ReadFile(fsys, p)
+		if err != nil {
+			return fmt.Errorf("failed to read template %s: %v", p, err)
+		}
+		name := strings.TrimSuffix(path.Base(p), path.Ext(p))
+		if err := tm.RegisterTemplate(name, string(content)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // ExecuteTemplate renders a template with the given configuration
 func (tm *TemplateManager) ExecuteTemplate(name string, config RAGConfig) (string, error) {
+	tm.mu.RLock()
 	tmpl, exists := tm.templates[name]
+	tm.mu.RUnlock()
 	if !exists {
 		return "", fmt.Errorf("template %s not found", name)
 	}
@@ -102,6 +235,8 @@ func (tm *TemplateManager) ExecuteTemplate(name string, config RAGConfig) (strin
 type RAGMessageBuilder struct {
 	templateManager *TemplateManager
 	config          *RAGConfig
+	documents       []Document // retrieved documents, before packing
+	packing         *PackingReport
 }
 
 // NewRAGMessageBuilder creates a new RAG message builder
@@ -118,20 +253,71 @@ func NewRAGMessageBuilder(
 		opt(config)
 	}
 
-	tm := NewTemplateManager()
-	if err := tm.RegisterTemplate("default_rag", defaultRAGTemplate); err != nil {
-		return nil, fmt.Errorf("failed to register default template: %w", err)
+	tm := config.templateManager
+	if tm == nil {
+		var err error
+		tm, err = NewDefaultTemplateManager()
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	return &RAGMessageBuilder{
 		templateManager: tm,
 		config:          config,
+		documents:       documents,
 	}, nil
 }
 
-// BuildSystemPrompt generates the system prompt with the provided documents
+// pack fits the documents into the token budget of the prompt produced by render.
+// Packing only happens once per builder
+func (rb *RAGMessageBuilder) pack(render func(RAGConfig) (string, error)) error {
+	if rb.packing != nil {
+		return nil
+	}
+
+	report, err := packDocuments(
+		rb.documents,
+		rb.config.MaxTokens,
+		rb.config.TokenCounter,
+		func(documents []Document) (string, error) {
+			config := *rb.config
+			config.Documents = documents
+			return render(config)
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to pack documents: %w", err)
+	}
+
+	rb.packing = report
+	rb.config.Documents = report.Included
+	return nil
+}
+
+// Packing reports which documents were included, truncated or dropped to fit the prompt
+// into the token budget. It is nil until a prompt has been built
+func (rb *RAGMessageBuilder) Packing() *PackingReport {
+	return rb.packing
+}
+
+// renderChat renders the system message followed by the query, as the model will see them
+func (rb *RAGMessageBuilder) renderChat(config RAGConfig) (string, error) {
+	systemPrompt, err := rb.templateManager.ExecuteTemplate(config.Template, config)
+	if err != nil {
+		return "", err
+	}
+	return systemPrompt + "\n" + config.Query, nil
+}
+
+// BuildSystemPrompt generates the system prompt with the provided documents. The query
+// is not part of the system prompt, see BuildMessages
 func (rb *RAGMessageBuilder) BuildSystemPrompt() (llm.Message, error) {
-	systemPrompt, err := rb.templateManager.ExecuteTemplate("default_rag", *rb.config)
+	if err := rb.pack(rb.renderChat); err != nil {
+		return llm.Message{}, err
+	}
+
+	systemPrompt, err := rb.templateManager.ExecuteTemplate(rb.config.Template, *rb.config)
 	if err != nil {
 		return llm.Message{}, fmt.Errorf("failed to build system prompt: %v", err)
 	}
@@ -141,3 +327,39 @@ func (rb *RAGMessageBuilder) BuildSystemPrompt() (llm.Message, error) {
 		Content: systemPrompt,
 	}, nil
 }
+
+// BuildMessages generates the messages of a chat completion: a system message holding the
+// instructions and retrieved documents, then the conversation history if any, followed by
+// a user message holding the query
+func (rb *RAGMessageBuilder) BuildMessages() ([]llm.Message, error) {
+	systemPrompt, err := rb.BuildSystemPrompt()
+	if err != nil {
+		return nil, err
+	}
+
+	messages := make([]llm.Message, 0, len(rb.config.History)+2)
+	messages = append(messages, systemPrompt)
+	messages = append(messages, rb.config.History...)
+	messages = append(messages, llm.Message{
+		Role:    llm.RoleUser,
+		Content: rb.config.Query,
+	})
+	return messages, nil
+}
+
+// BuildCompletionPrompt generates a single raw prompt with Llama 3 special tokens, for
+// completion style endpoints that do not apply a chat template
+func (rb *RAGMessageBuilder) BuildCompletionPrompt() (string, error) {
+	render := func(config RAGConfig) (string, error) {
+		return rb.templateManager.ExecuteTemplate(Llama3CompletionTemplate, config)
+	}
+	if err := rb.pack(render); err != nil {
+		return "", err
+	}
+
+	prompt, err := render(*rb.config)
+	if err != nil {
+		return "", fmt.Errorf("failed to build completion prompt: %v", err)
+	}
+	return prompt, nil
+}
@@ -3,6 +3,11 @@ package rag
 import (
 	"strings"
 	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Predixus/DynaRAG/internal/llm"
 )
 
 func TestRAGSystemPromptGeneration(t *testing.T) {
@@ -38,24 +43,35 @@ func TestRAGSystemPromptGeneration(t *testing.T) {
 		t.Fatalf("Failed to create RAG message builder: %v", err)
 	}
 
-	// Test system prompt generation
-	systemMsg, err := builder.BuildSystemPrompt()
+	// Test message generation
+	messages, err := builder.BuildMessages()
 	if err != nil {
-		t.Fatalf("Failed to build system prompt: %v", err)
+		t.Fatalf("Failed to build messages: %v", err)
 	}
 
-	// Verify system prompt contains key template sections
-	expectedParts := []string{
+	if len(messages) != 2 {
+		t.Fatalf("Expected a system and a user message, got %d messages", len(messages))
+	}
+	systemMsg, userMsg := messages[0], messages[1]
+
+	if systemMsg.Role != llm.RoleSystem {
+		t.Errorf("Expected first message to be a system message, got %q", systemMsg.Role)
+	}
+	if userMsg.Role != llm.RoleUser || userMsg.Content != userQuery {
+		t.Errorf("Expected second message to be the user query, got %+v", userMsg)
+	}
+
+	// The chat form must not contain model specific tokens, nor the query
+	unexpectedParts := []string{
 		"<|begin_of_text|>",
-		"<|start_header_id|>system<|end_header_id|>",
-		"<|start_header_id|>user<|end_header_id|>",
+		"<|start_header_id|>",
+		"<|end_of_text|>",
 		userQuery,
-		"<|start_header_id|>assistant<|end_header_id|>",
 	}
 
-	for _, part := range expectedParts {
-		if !strings.Contains(systemMsg.Content, part) {
-			t.Errorf("System prompt missing expected part: %q", part)
+	for _, part := range unexpectedParts {
+		if strings.Contains(systemMsg.Content, part) {
+			t.Errorf("System prompt contains unexpected part: %q", part)
 		}
 	}
 
@@ -68,6 +84,44 @@ func TestRAGSystemPromptGeneration(t *testing.T) {
 	}
 }
 
+func TestRAGCompletionPrompt(t *testing.T) {
+	documents := []Document{
+		{
+			Index:   "1",
+			Source:  "networking.txt",
+			Content: "TCP is a connection-oriented protocol.",
+		},
+	}
+
+	userQuery := "What is TCP?"
+
+	builder, err := NewRAGMessageBuilder(documents, userQuery)
+	if err != nil {
+		t.Fatalf("Failed to create RAG message builder: %v", err)
+	}
+
+	prompt, err := builder.BuildCompletionPrompt()
+	if err != nil {
+		t.Fatalf("Failed to build completion prompt: %v", err)
+	}
+
+	// Verify the raw prompt contains the Llama 3 special tokens and the query
+	expectedParts := []string{
+		"<|begin_of_text|>",
+		"<|start_header_id|>system<|end_header_id|>",
+		"<|start_header_id|>user<|end_header_id|>",
+		userQuery,
+		"<|start_header_id|>assistant<|end_header_id|>",
+		"TCP is a connection-oriented protocol.",
+	}
+
+	for _, part := range expectedParts {
+		if !strings.Contains(prompt, part) {
+			t.Errorf("Completion prompt missing expected part: %q", part)
+		}
+	}
+}
+
 func TestRAGTemplateCustomization(t *testing.T) {
 	// Test custom template
 	customTemplate := `Custom RAG Template
@@ -157,8 +211,6 @@ func TestRAGMarkdownReferences(t *testing.T) {
 
 	// Verify template sections are present
 	expectedParts := []string{
-		"<|begin_of_text|>",
-		"<|start_header_id|>system<|end_header_id|>",
 		"Chunk Index:",
 		"Chunk Content",
 		"[relevant text][#ref-{chunk-index}]", // Example citation format
@@ -172,3 +224,408 @@ func TestRAGMarkdownReferences(t *testing.T) {
 		}
 	}
 }
+
+// wordCounter counts whitespace separated words, making budgets easy to reason about
+type wordCounter struct{}
+
+func (wordCounter) CountTokens(text string) (int, error) {
+	return len(strings.Fields(text)), nil
+}
+
+func TestRAGTokenBudget(t *testing.T) {
+	documents := []Document{
+		{Index: "0", Source: "a.txt", Content: "One two three. Four five six."},
+		{Index: "1", Source: "b.txt", Content: "Seven eight nine. Ten eleven twelve. Thirteen fourteen."},
+		{Index: "2", Source: "c.txt", Content: "Fifteen sixteen seventeen."},
+	}
+
+	// measure the size of the prompt with no documents, so the budgets below are
+	// expressed relative to the template itself
+	empty, err := NewRAGMessageBuilder(nil, "query", WithTokenCounter(wordCounter{}))
+	if err != nil {
+		t.Fatalf("Failed to create RAG message builder: %v", err)
+	}
+	if _, err := empty.BuildSystemPrompt(); err != nil {
+		t.Fatalf("Failed to build system prompt: %v", err)
+	}
+	base := empty.Packing().Tokens
+
+	perDocument, err := packDocuments(
+		[]Document{{}},
+		0,
+		wordCounter{},
+		func(docs []Document) (string, error) {
+			config := *empty.config
+			config.Documents = docs
+			return empty.renderChat(config)
+		},
+	)
+	if err != nil {
+		t.Fatalf("Failed to measure document overhead: %v", err)
+	}
+	overhead := perDocument.Tokens - base + 2 // plus index and source words
+
+	tests := []struct {
+		name          string
+		budget        int
+		wantIncluded  []string
+		wantTruncated []string
+		wantDropped   []string
+		wantContent   string // content of the last included document
+	}{
+		{
+			name:         "everything fits",
+			budget:       base + 3*overhead + 17,
+			wantIncluded: []string{"0", "1", "2"},
+		},
+		{
+			name:          "last included document truncated at a sentence",
+			budget:        base + 2*overhead + 6 + 6,
+			wantIncluded:  []string{"0", "1"},
+			wantTruncated: []string{"1"},
+			wantDropped:   []string{"2"},
+			wantContent:   "Seven eight nine. Ten eleven twelve.",
+		},
+		{
+			name:         "no sentence fits",
+			budget:       base + 2*overhead + 6 + 2,
+			wantIncluded: []string{"0"},
+			wantDropped:  []string{"1", "2"},
+			wantContent:  "One two three. Four five six.",
+		},
+		{
+			name:         "packing disabled",
+			budget:       0,
+			wantIncluded: []string{"0", "1", "2"},
+		},
+	}
+
+	indices := func(docs []Document) []string {
+		var out []string
+		for _, doc := range docs {
+			out = append(out, doc.Index)
+		}
+		return out
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			builder, err := NewRAGMessageBuilder(
+				documents,
+				"query",
+				WithMaxTokens(tt.budget),
+				WithTokenCounter(wordCounter{}),
+			)
+			if err != nil {
+				t.Fatalf("Failed to create RAG message builder: %v", err)
+			}
+			if _, err := builder.BuildSystemPrompt(); err != nil {
+				t.Fatalf("Failed to build system prompt: %v", err)
+			}
+
+			report := builder.Packing()
+			assert.Equal(t, tt.wantIncluded, indices(report.Included))
+			assert.Equal(t, tt.wantTruncated, indices(report.Truncated))
+			assert.Equal(t, tt.wantDropped, indices(report.Dropped))
+			if tt.budget > 0 {
+				assert.LessOrEqual(t, report.Tokens, tt.budget)
+			}
+			if tt.wantContent != "" {
+				assert.Equal(t, tt.wantContent, report.Included[len(report.Included)-1].Content)
+			}
+		})
+	}
+}
+
+func TestRAGTemplateRegistration(t *testing.T) {
+	tests := []struct {
+		name     string
+		register func(tm *TemplateManager) error
+		wantErr  bool
+	}{
+		{
+			name: "valid template",
+			register: func(tm *TemplateManager) error {
+				return tm.RegisterTemplate("valid", "{{range .Documents}}{{.Content}}{{end}}")
+			},
+		},
+		{
+			name: "unparseable template",
+			register: func(tm *TemplateManager) error {
+				return tm.RegisterTemplate("broken", "{{range .Documents}}")
+			},
+			wantErr: true,
+		},
+		{
+			name: "unknown field",
+			register: func(tm *TemplateManager) error {
+				return tm.RegisterTemplate("unknown", "{{.NotAField}}")
+			},
+			wantErr: true,
+		},
+		{
+			name: "templates from fs",
+			register: func(tm *TemplateManager) error {
+				return tm.RegisterTemplatesFS(fstest.MapFS{
+					"prompts/legal.tmpl":   {Data: []byte("Legal: {{.ResponseStyle}}")},
+					"prompts/support.tmpl": {Data: []byte("Support: {{.Vars.product}}")},
+				}, "prompts/*.tmpl")
+			},
+		},
+		{
+			name: "no templates match",
+			register: func(tm *TemplateManager) error {
+				return tm.RegisterTemplatesFS(fstest.MapFS{}, "prompts/*.tmpl")
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.register(NewTemplateManager())
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestRAGSelectTemplate(t *testing.T) {
+	tm, err := NewDefaultTemplateManager()
+	if err != nil {
+		t.Fatalf("Failed to create template manager: %v", err)
+	}
+	err = tm.RegisterTemplatesFS(fstest.MapFS{
+		"support.tmpl": {Data: []byte("Answer questions about {{.Vars.product}} in a {{.ResponseStyle}} tone.")},
+	}, "*.tmpl")
+	if err != nil {
+		t.Fatalf("Failed to register template: %v", err)
+	}
+
+	builder, err := NewRAGMessageBuilder(
+		nil,
+		"How do I reset my password?",
+		WithTemplateManager(tm),
+		WithTemplate("support"),
+		WithVars(map[string]any{"product": "DynaRAG"}),
+		WithResponseStyle("friendly"),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create RAG message builder: %v", err)
+	}
+
+	messages, err := builder.BuildMessages()
+	if err != nil {
+		t.Fatalf("Failed to build messages: %v", err)
+	}
+
+	assert.Equal(t, "Answer questions about DynaRAG in a friendly tone.", messages[0].Content)
+	assert.Equal(t, "How do I reset my password?", messages[1].Content)
+
+	builder, err = NewRAGMessageBuilder(nil, "query", WithTemplateManager(tm), WithTemplate("missing"))
+	if err != nil {
+		t.Fatalf("Failed to create RAG message builder: %v", err)
+	}
+	_, err = builder.BuildMessages()
+	assert.Error(t, err)
+}
+
+func TestParseCitations(t *testing.T) {
+	tests := []struct {
+		name     string
+		answer   string
+		expected []Citation
+	}{
+		{
+			name:   "multiple citations",
+			answer: "According to [the data][#ref-1], this is important. [Another source][#ref-2] confirms this.",
+			expected: []Citation{
+				{Text: "the data", Index: "1"},
+				{Text: "Another source", Index: "2"},
+			},
+		},
+		{
+			name:     "searched documents section is not a citation",
+			answer:   "Nothing cited.\n\nSearched Documents:\n- #ref-1: Document 1 Source",
+			expected: nil,
+		},
+		{
+			name:     "plain markdown links are ignored",
+			answer:   "See [the docs](https://example.com) and [London][#ref-0].",
+			expected: []Citation{{Text: "London", Index: "0"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, ParseCitations(tt.answer))
+		})
+	}
+}
+
+// TestCitationScanner checks the scanner finds what ParseCitations does however the
+// answer is split into writes
+func TestCitationScanner(t *testing.T) {
+	answers := []string{
+		"According to [the data][#ref-1], this is important. [Another source][#ref-2] confirms this.",
+		"See [the docs](https://example.com) and [London][#ref-0].",
+		"Nothing cited.\n\nSearched Documents:\n- #ref-1: Document 1 Source",
+		"[a][b][#ref-1] [x][#rex][#ref-2] [y][#ref-3 4][#ref-5] [z][#ref-][#ref-6]",
+		"[][#ref-1] [[nested]][#ref-2] [multi\nline][#ref-10]] [open][#ref-7",
+	}
+
+	for _, answer := range answers {
+		expected := ParseCitations(answer)
+		for _, size := range []int{1, 2, 3, 7, len(answer)} {
+			var scanner CitationScanner
+			var citations []Citation
+			for start := 0; start < len(answer); start += size {
+				end := min(start+size, len(answer))
+				citations = append(citations, scanner.Write([]byte(answer[start:end]))...)
+			}
+			assert.Equal(t, expected, citations, "%q in writes of %d", answer, size)
+		}
+	}
+}
+
+func TestParseQueries(t *testing.T) {
+	tests := []struct {
+		name     string
+		reply    string
+		n        int
+		expected []string
+	}{
+		{
+			name:     "plain lines",
+			reply:    "What is TCP?\nHow does TCP work?\n",
+			n:        3,
+			expected: []string{"What is TCP?", "How does TCP work?"},
+		},
+		{
+			name:     "list markers and quotes are stripped",
+			reply:    "1. \"What is TCP?\"\n\n2) How does TCP work?\n- Why use TCP?",
+			n:        3,
+			expected: []string{"What is TCP?", "How does TCP work?", "Why use TCP?"},
+		},
+		{
+			name:     "limited to n",
+			reply:    "a\nb\nc",
+			n:        2,
+			expected: []string{"a", "b"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, ParseQueries(tt.reply, tt.n))
+		})
+	}
+}
+
+func TestReciprocalRankFusion(t *testing.T) {
+	key := func(id int64) int64 { return id }
+
+	tests := []struct {
+		name     string
+		lists    [][]int64
+		k        int
+		expected []int64
+	}{
+		{
+			name:     "single list keeps its order",
+			lists:    [][]int64{{3, 1, 2}},
+			k:        3,
+			expected: []int64{3, 1, 2},
+		},
+		{
+			name:     "items in several lists rank first",
+			lists:    [][]int64{{1, 2, 3}, {4, 3, 5}},
+			k:        3,
+			expected: []int64{3, 1, 4},
+		},
+		{
+			name:     "ties keep first occurrence order",
+			lists:    [][]int64{{1, 2}, {3, 4}},
+			k:        4,
+			expected: []int64{1, 3, 2, 4},
+		},
+		{
+			name:     "empty lists",
+			lists:    nil,
+			k:        3,
+			expected: []int64{},
+		},
+		{
+			name:     "negative k",
+			lists:    [][]int64{{1, 2}},
+			k:        -1,
+			expected: []int64{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, ReciprocalRankFusion(tt.lists, key, tt.k))
+		})
+	}
+}
+
+func TestSplitHistory(t *testing.T) {
+	history := []llm.Message{
+		{Role: llm.RoleUser, Content: "one two three"},
+		{Role: llm.RoleAssistant, Content: "four five"},
+		{Role: llm.RoleUser, Content: "six"},
+		{Role: llm.RoleAssistant, Content: "seven eight"},
+	}
+
+	tests := []struct {
+		name   string
+		budget int
+		older  int
+		recent int
+	}{
+		{name: "everything fits", budget: 100, older: 0, recent: 4},
+		{name: "budget disabled", budget: 0, older: 0, recent: 4},
+		{name: "oldest dropped", budget: 5, older: 1, recent: 3},
+		{name: "split is on a message boundary", budget: 4, older: 2, recent: 2},
+		{name: "nothing fits", budget: 1, older: 4, recent: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			older, recent, err := SplitHistory(history, tt.budget, wordCounter{})
+			if err != nil {
+				t.Fatalf("Failed to split history: %v", err)
+			}
+			assert.Len(t, older, tt.older)
+			assert.Len(t, recent, tt.recent)
+			assert.Equal(t, history, append(append([]llm.Message{}, older...), recent...))
+		})
+	}
+}
+
+func TestRAGHistoryMessages(t *testing.T) {
+	history := []llm.Message{
+		SummaryMessage("The user asked about TCP."),
+		{Role: llm.RoleUser, Content: "What is TCP?"},
+		{Role: llm.RoleAssistant, Content: "A transport protocol."},
+	}
+
+	builder, err := NewRAGMessageBuilder(nil, "And UDP?", WithHistory(history))
+	if err != nil {
+		t.Fatalf("Failed to create RAG message builder: %v", err)
+	}
+
+	messages, err := builder.BuildMessages()
+	if err != nil {
+		t.Fatalf("Failed to build messages: %v", err)
+	}
+
+	assert.Len(t, messages, 5)
+	assert.Equal(t, llm.RoleSystem, messages[0].Role)
+	assert.Equal(t, history, messages[1:4])
+	assert.Equal(t, llm.Message{Role: llm.RoleUser, Content: "And UDP?"}, messages[4])
+}
@@ -0,0 +1,92 @@
+package rag
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// RRFConstant dampens the weight of top ranks in Reciprocal Rank Fusion
+const RRFConstant = 60
+
+const multiQuerySystemPrompt = `You rewrite search queries for a document retrieval system.
+Write %d alternative versions of the user's question that use different wording and
+perspectives while keeping its meaning. Reply with one question per line and nothing else.`
+
+const hydeSystemPrompt = `You write passages for a document retrieval system. Write a short,
+factual passage that answers the user's question as a reference document would. Do not
+mention the question and do not add any preamble.`
+
+// MultiQueryPrompt returns the system prompt asking for n paraphrases of the query
+func MultiQueryPrompt(n int) string {
+	return fmt.Sprintf(multiQuerySystemPrompt, n)
+}
+
+// HyDEPrompt returns the system prompt asking for a hypothetical answer to the query
+func HyDEPrompt() string {
+	return hydeSystemPrompt
+}
+
+var listMarker = regexp.MustCompile(`^\s*(?:[-*•]|\d+[.)])\s*`)
+
+// ParseQueries splits an LLM reply into at most n queries, one per line, stripping list
+// markers, surrounding quotes and blank lines
+func ParseQueries(reply string, n int) []string {
+	var queries []string
+	for _, line := range strings.Split(reply, "\n") {
+		line = listMarker.ReplaceAllString(line, "")
+		line = strings.Trim(strings.TrimSpace(line), `"'`)
+		if line == "" {
+			continue
+		}
+		queries = append(queries, line)
+		if len(queries) == n {
+			break
+		}
+	}
+	return queries
+}
+
+// ReciprocalRankFusion merges ranked lists into a single ranking of at most k items. Each
+// item scores the sum of 1/(RRFConstant+rank) over the lists it appears in; items are
+// identified by key and the first occurrence is kept. A k below one yields no items
+func ReciprocalRankFusion[T any](lists [][]T, key func(T) int64, k int) []T {
+	if k <= 0 {
+		return []T{}
+	}
+
+	type fused struct {
+		item  T
+		score float64
+		order int
+	}
+
+	byKey := make(map[int64]*fused)
+	var items []*fused
+	for _, list := range lists {
+		for rank, item := range list {
+			score := 1 / float64(RRFConstant+rank+1)
+			if f, ok := byKey[key(item)]; ok {
+				f.score += score
+				continue
+			}
+			f := &fused{item: item, score: score, order: len(items)}
+			byKey[key(item)] = f
+			items = append(items, f)
+		}
+	}
+
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].score > items[j].score
+	})
+
+	result := make([]T, 0, min(k, len(items)))
+	for _, f := range items {
+		if len(result) == k {
+			break
+		}
+		result = append(result, f.item)
+	}
+	return result
+}
@@ -0,0 +1,190 @@
+// Package splitter breaks documents into chunks of bounded size for embedding
+package splitter
+
+import (
+	"path"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/Predixus/DynaRAG/internal/utils"
+)
+
+// DefaultChunkSize is the number of runes a chunk holds at most unless another size is
+// given
+const DefaultChunkSize = 1000
+
+// level is one way of breaking text into smaller pieces, and the separator that joins
+// them back together
+type level struct {
+	split     func(string) []string
+	separator string
+}
+
+// levels break text into paragraphs, then sentences, then words
+var levels = []level{
+	{split: paragraphs, separator: "\n\n"},
+	{split: utils.SplitSentences, separator: " "},
+	{split: strings.Fields, separator: " "},
+}
+
+// Text splits text into chunks of at most size runes. Paragraphs are packed together while
+// they fit; a longer paragraph is split between sentences, a longer sentence between words
+// and a longer word wherever the size runs out
+func Text(text string, size int) []string {
+	if size <= 0 {
+		size = DefaultChunkSize
+	}
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	return split(strings.TrimSpace(text), size, 0)
+}
+
+// split breaks text at the given level and packs the pieces into chunks of at most size
+// runes, going down a level for pieces that are too long
+func split(text string, size int, depth int) []string {
+	if text == "" {
+		return nil
+	}
+	if utf8.RuneCountInString(text) <= size {
+		return []string{text}
+	}
+	if depth == len(levels) {
+		return cut(text, size)
+	}
+
+	var parts []string
+	for _, piece := range levels[depth].split(text) {
+		parts = append(parts, split(piece, size, depth+1)...)
+	}
+	return pack(parts, levels[depth].separator, size)
+}
+
+// paragraphs splits text at blank lines into its trimmed, non-empty paragraphs
+func paragraphs(text string) []string {
+	var pieces []string
+	for _, paragraph := range strings.Split(text, "\n\n") {
+		if paragraph = strings.TrimSpace(paragraph); paragraph != "" {
+			pieces = append(pieces, paragraph)
+		}
+	}
+	return pieces
+}
+
+// cut splits text into pieces of size runes
+func cut(text string, size int) []string {
+	var pieces []string
+	runes := []rune(text)
+	for start := 0; start < len(runes); start += size {
+		pieces = append(pieces, string(runes[start:min(start+size, len(runes))]))
+	}
+	return pieces
+}
+
+// Func splits text into chunks of at most size runes
+type Func func(text string, size int) []string
+
+// codeExtensions are the file extensions split as source code
+var codeExtensions = map[string]bool{
+	".c": true, ".cc": true, ".cpp": true, ".cs": true, ".go": true, ".h": true, ".hpp": true,
+	".java": true, ".js": true, ".jsx": true, ".kt": true, ".php": true, ".py": true, ".rb": true,
+	".rs": true, ".scala": true, ".sh": true, ".sql": true, ".swift": true, ".ts": true, ".tsx": true,
+}
+
+// ForPath returns the splitter suited to a file by its extension: Markdown for Markdown
+// files, Code for source code and Text for everything else
+func ForPath(filePath string) Func {
+	ext := strings.ToLower(path.Ext(filePath))
+	switch {
+	case ext == ".md" || ext == ".markdown":
+		return Markdown
+	case codeExtensions[ext]:
+		return Code
+	default:
+		return Text
+	}
+}
+
+// Markdown splits a Markdown document into its sections, each starting at a heading, and
+// splits sections longer than size as Text. Headings inside fenced code blocks are left
+// alone
+func Markdown(text string, size int) []string {
+	if size <= 0 {
+		size = DefaultChunkSize
+	}
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+
+	var (
+		chunks  []string
+		section []string
+		fenced  bool
+	)
+	flush := func() {
+		chunks = append(chunks, Text(strings.Join(section, "\n"), size)...)
+		section = section[:0]
+	}
+	for _, line := range strings.Split(text, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			fenced = !fenced
+		}
+		if !fenced && strings.HasPrefix(line, "#") && len(section) > 0 {
+			flush()
+		}
+		section = append(section, line)
+	}
+	flush()
+	return chunks
+}
+
+// Code splits source code between top level blocks, the runs of lines separated by blank
+// lines, and packs the blocks into chunks of at most size runes. Line breaks and
+// indentation are kept; blocks longer than size are split between lines
+func Code(text string, size int) []string {
+	if size <= 0 {
+		size = DefaultChunkSize
+	}
+	text = strings.Trim(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+
+	var units []string
+	for _, block := range strings.Split(text, "\n\n") {
+		if strings.TrimSpace(block) == "" {
+			continue
+		}
+		if utf8.RuneCountInString(block) <= size {
+			units = append(units, block)
+			continue
+		}
+		var lines []string
+		for _, line := range strings.Split(block, "\n") {
+			lines = append(lines, cut(line, size)...)
+		}
+		units = append(units, pack(lines, "\n", size)...)
+	}
+	return pack(units, "\n\n", size)
+}
+
+// pack joins pieces of at most size runes into chunks of at most size runes
+func pack(pieces []string, separator string, size int) []string {
+	var (
+		chunks  []string
+		current strings.Builder
+		length  int
+	)
+	for _, piece := range pieces {
+		pieceLength := utf8.RuneCountInString(piece)
+		if length > 0 && length+len(separator)+pieceLength > size {
+			chunks = append(chunks, current.String())
+			current.Reset()
+			length = 0
+		}
+		if length > 0 {
+			current.WriteString(separator)
+			length += len(separator)
+		}
+		current.WriteString(piece)
+		length += pieceLength
+	}
+	if length > 0 {
+		chunks = append(chunks, current.String())
+	}
+	return chunks
+}
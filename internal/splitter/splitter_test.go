@@ -0,0 +1,112 @@
+package splitter
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestText checks paragraphs are packed while they fit and split ever finer when not
+func TestText(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		size     int
+		expected []string
+	}{
+		{
+			name:     "short text is one chunk",
+			text:     "  A single paragraph.\n",
+			size:     100,
+			expected: []string{"A single paragraph."},
+		},
+		{
+			name:     "empty text has no chunks",
+			text:     " \n\n ",
+			size:     100,
+			expected: nil,
+		},
+		{
+			name:     "paragraphs are packed",
+			text:     "First one.\r\n\r\nSecond one.\n\n\n\nThird paragraph here.",
+			size:     24,
+			expected: []string{"First one.\n\nSecond one.", "Third paragraph here."},
+		},
+		{
+			name:     "long paragraphs split between sentences",
+			text:     "TCP is reliable. TLS is secure. UDP is neither.",
+			size:     32,
+			expected: []string{"TCP is reliable. TLS is secure.", "UDP is neither."},
+		},
+		{
+			name:     "long sentences split between words",
+			text:     "alpha beta gamma delta",
+			size:     11,
+			expected: []string{"alpha beta", "gamma delta"},
+		},
+		{
+			name:     "long words are cut",
+			text:     "ééééé",
+			size:     2,
+			expected: []string{"éé", "éé", "é"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, Text(tt.text, tt.size))
+		})
+	}
+}
+
+// TestTextSize checks no chunk exceeds the size
+func TestTextSize(t *testing.T) {
+	text := strings.Repeat("Chunks are bounded. Words stay whole.\n\n", 50)
+	for _, chunk := range Text(text, 64) {
+		assert.LessOrEqual(t, utf8.RuneCountInString(chunk), 64)
+	}
+	assert.Len(t, Text(text, 0), 2)
+}
+
+// TestMarkdown checks documents are split at headings, but not inside code fences
+func TestMarkdown(t *testing.T) {
+	text := "# Intro\nWelcome.\n\n## Setup\nRun it.\n```sh\n# not a heading\nmake\n```\n## Usage\nCall it."
+	expected := []string{
+		"# Intro\nWelcome.",
+		"## Setup\nRun it.\n```sh\n# not a heading\nmake\n```",
+		"## Usage\nCall it.",
+	}
+	assert.Equal(t, expected, Markdown(text, 100))
+}
+
+// TestCode checks blocks are packed whole and long blocks split between lines
+func TestCode(t *testing.T) {
+	text := "package main\n\nfunc a() {\n\treturn\n}\n\nfunc b() {\n\tx := 1\n\ty := 2\n\treturn\n}\n"
+	expected := []string{
+		"package main\n\nfunc a() {\n\treturn\n}",
+		"func b() {\n\tx := 1\n\ty := 2\n\treturn",
+		"}",
+	}
+	assert.Equal(t, expected, Code(text, 34))
+}
+
+// TestForPath checks splitters are chosen by extension
+func TestForPath(t *testing.T) {
+	tests := []struct {
+		filePath string
+		expected Func
+	}{
+		{filePath: "docs/README.md", expected: Markdown},
+		{filePath: "main.GO", expected: Code},
+		{filePath: "notes.txt", expected: Text},
+		{filePath: "Makefile", expected: Text},
+	}
+	for _, tt := range tests {
+		t.Run(tt.filePath, func(t *testing.T) {
+			assert.Equal(t, reflect.ValueOf(tt.expected).Pointer(), reflect.ValueOf(ForPath(tt.filePath)).Pointer())
+		})
+	}
+}
@@ -0,0 +1,197 @@
+package store
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+
+	"github.com/Predixus/DynaRAG/types"
+)
+
+// ErrAuditChainBroken is returned when an audit entry does not match the hash it was
+// chained with
+var ErrAuditChainBroken = errors.New("audit log hash chain is broken")
+
+// DefaultAuditLimit is the number of audit entries read when no limit is given
+const DefaultAuditLimit = 1000
+
+// lockAuditChain serialises the appends to the hash chain of the transaction's tenant
+const lockAuditChain = `SELECT pg_advisory_xact_lock(hashtext('dynarag_audit:' || dynarag_tenant()))`
+
+// auditPayload is the canonical form of an audit entry that its hash covers. Empty lists
+// and filters are left out, as they read back from Postgres as NULL or empty alike
+type auditPayload struct {
+	OccurredAt string        `json:"occurred_at"`
+	Operation  string        `json:"operation"`
+	Principal  string        `json:"principal"`
+	Groups     []string      `json:"groups,omitempty"`
+	Collection string        `json:"collection"`
+	FilePaths  []string      `json:"file_paths,omitempty"`
+	ChunkIds   []int64       `json:"chunk_ids,omitempty"`
+	Query      string        `json:"query"`
+	Filter     types.JSONMap `json:"filter,omitempty"`
+}
+
+// auditHash returns the hash of an audit entry chained to the hash of the entry before
+func auditHash(prevHash string, entry CreateAuditEntryParams) (string, error) {
+	payload, err := json.Marshal(auditPayload{
+		OccurredAt: entry.OccurredAt.Time.UTC().Format(time.RFC3339Nano),
+		Operation:  entry.Operation,
+		Principal:  entry.Principal,
+		Groups:     entry.Groups,
+		Collection: entry.Collection,
+		FilePaths:  entry.FilePaths,
+		ChunkIds:   entry.ChunkIds,
+		Query:      entry.Query,
+		Filter:     entry.Filter,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(append([]byte(prevHash+"\n"), payload...))
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// AppendAudit appends an entry to the audit log of a tenant. With chain set the entry is
+// hashed together with the hash of the last chained entry, so that altering or removing
+// an entry breaks every hash after it
+func AppendAudit(
+	ctx context.Context,
+	postgresConnStr string,
+	tenant string,
+	params CreateAuditEntryParams,
+	chain bool,
+) (*AuditLog, error) {
+	// Postgres keeps microseconds, and the hash must cover what is read back
+	if !params.OccurredAt.Valid {
+		params.OccurredAt = pgtype.Timestamptz{
+			Time:  time.Now().Truncate(time.Microsecond),
+			Valid: true,
+		}
+	}
+	if params.Filter == nil {
+		params.Filter = types.JSONMap{}
+	}
+
+	conn, err := pgx.Connect(ctx, postgresConnStr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close(ctx)
+
+	tx, err := beginTenant(ctx, conn, tenant)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	q := New(tx)
+
+	if chain {
+		if _, err := tx.Exec(ctx, lockAuditChain); err != nil {
+			return nil, err
+		}
+		prevHash, err := q.GetLastAuditHash(ctx)
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			return nil, err
+		}
+		hash, err := auditHash(prevHash.String, params)
+		if err != nil {
+			return nil, err
+		}
+		params.PrevHash = prevHash
+		params.Hash = pgtype.Text{String: hash, Valid: true}
+	}
+
+	entry, err := q.CreateAuditEntry(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+	return &entry, tx.Commit(ctx)
+}
+
+// ListAudit returns the audit entries of a tenant matching the filter, oldest first
+func ListAudit(
+	ctx context.Context,
+	postgresConnStr string,
+	tenant string,
+	params ListAuditLogParams,
+) ([]AuditLog, error) {
+	if params.MaxEntries <= 0 {
+		params.MaxEntries = DefaultAuditLimit
+	}
+
+	conn, err := pgx.Connect(ctx, postgresConnStr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close(ctx)
+
+	tx, err := beginTenant(ctx, conn, tenant)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	entries, err := New(tx).ListAuditLog(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+	return entries, tx.Commit(ctx)
+}
+
+// VerifyAuditChain recomputes the hash chain of a tenant's audit log and returns the
+// number of chained entries. The first entry that does not match its hash, or does not
+// follow the entry before it, is reported with ErrAuditChainBroken
+func VerifyAuditChain(ctx context.Context, postgresConnStr string, tenant string) (int, error) {
+	conn, err := pgx.Connect(ctx, postgresConnStr)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close(ctx)
+
+	tx, err := beginTenant(ctx, conn, tenant)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	entries, err := New(tx).ListAuditChain(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	prevHash := ""
+	for _, entry := range entries {
+		if entry.PrevHash.String != prevHash {
+			return 0, fmt.Errorf("%w: entry %d does not follow the entry before it", ErrAuditChainBroken, entry.ID)
+		}
+		hash, err := auditHash(prevHash, CreateAuditEntryParams{
+			OccurredAt: entry.OccurredAt,
+			Operation:  entry.Operation,
+			Principal:  entry.Principal,
+			Groups:     entry.Groups,
+			Collection: entry.Collection,
+			FilePaths:  entry.FilePaths,
+			ChunkIds:   entry.ChunkIds,
+			Query:      entry.Query,
+			Filter:     entry.Filter,
+		})
+		if err != nil {
+			return 0, err
+		}
+		if hash != entry.Hash.String {
+			return 0, fmt.Errorf("%w: entry %d has been altered", ErrAuditChainBroken, entry.ID)
+		}
+		prevHash = hash
+	}
+	return len(entries), tx.Commit(ctx)
+}
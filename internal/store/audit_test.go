@@ -0,0 +1,68 @@
+package store
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Predixus/DynaRAG/types"
+)
+
+func TestAuditHash(t *testing.T) {
+	entry := CreateAuditEntryParams{
+		OccurredAt: pgtype.Timestamptz{Time: time.Date(2024, 5, 1, 12, 0, 0, 1000, time.UTC), Valid: true},
+		Operation:  "retrieve",
+		Principal:  "alice",
+		Collection: DefaultCollection,
+		FilePaths:  []string{"a.txt"},
+		ChunkIds:   []int64{1, 2},
+		Query:      "what is in a?",
+		Filter:     types.JSONMap{"source": "wiki"},
+	}
+	hash, err := auditHash("", entry)
+	require.NoError(t, err)
+
+	again, err := auditHash("", entry)
+	require.NoError(t, err)
+	assert.Equal(t, hash, again)
+
+	// Postgres reads empty arrays and filters back as NULL or {}
+	bare := entry
+	bare.Groups, bare.Filter = []string{}, types.JSONMap{}
+	withNil := entry
+	withNil.Groups, withNil.Filter = nil, nil
+	bareHash, err := auditHash("", bare)
+	require.NoError(t, err)
+	nilHash, err := auditHash("", withNil)
+	require.NoError(t, err)
+	assert.Equal(t, bareHash, nilHash)
+
+	tests := []struct {
+		name     string
+		prevHash string
+		change   func(*CreateAuditEntryParams)
+	}{
+		{name: "previous hash", prevHash: "abc", change: func(*CreateAuditEntryParams) {}},
+		{name: "principal", change: func(e *CreateAuditEntryParams) { e.Principal = "mallory" }},
+		{name: "chunk ids", change: func(e *CreateAuditEntryParams) { e.ChunkIds = []int64{1} }},
+		{name: "filter", change: func(e *CreateAuditEntryParams) { e.Filter = types.JSONMap{"source": "web"} }},
+		{
+			name: "time",
+			change: func(e *CreateAuditEntryParams) {
+				e.OccurredAt.Time = e.OccurredAt.Time.Add(time.Microsecond)
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			changed := entry
+			tt.change(&changed)
+			got, err := auditHash(tt.prevHash, changed)
+			require.NoError(t, err)
+			assert.NotEqual(t, hash, got)
+		})
+	}
+}
@@ -0,0 +1,102 @@
+package store
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"log/slog"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// changesChannelPrefix starts the notification channels the triggers publish chunk
+// changes on, one for each tenant
+const changesChannelPrefix = "dynarag_changes_"
+
+// ChangesChannel returns the notification channel the changes of a tenant are published
+// on, as named by dynarag_changes_channel
+func ChangesChannel(tenant string) string {
+	if tenant == "" {
+		tenant = DefaultTenant
+	}
+	sum := md5.Sum([]byte(tenant))
+	return changesChannelPrefix + hex.EncodeToString(sum[:])
+}
+
+// ChangeOperation is the kind of change made to a chunk
+type ChangeOperation string
+
+const (
+	ChangeInsert  ChangeOperation = "insert"
+	ChangeDelete  ChangeOperation = "delete"
+	ChangeTrash   ChangeOperation = "trash"
+	ChangeRestore ChangeOperation = "restore"
+	// ChangeSupersede is sent for each chunk of a version closed by a newer ingest of its
+	// document. The chunk is kept for searches of the past
+	ChangeSupersede ChangeOperation = "supersede"
+	// ChangeReconnect is sent after the feed reconnected. Changes made while it was down
+	// are lost, so followers should reload what they hold
+	ChangeReconnect ChangeOperation = "reconnect"
+)
+
+// Change is a change to a chunk, as published by the notify_embedding_change trigger
+type Change struct {
+	Operation  ChangeOperation `json:"operation"`
+	ChunkID    int64           `json:"chunk_id"`
+	DocumentID int64           `json:"document_id"`
+	FilePath   string          `json:"file_path"`  // empty when the document was deleted with the chunk
+	Collection string          `json:"collection"` // empty when the document was deleted with the chunk
+	TenantID   string          `json:"tenant_id"`
+}
+
+// ChangeListener receives the chunk changes of one tenant over a dedicated connection
+type ChangeListener struct {
+	conn    *pgx.Conn
+	channel string
+}
+
+// ListenChanges connects to the database and starts listening for the chunk changes of a
+// tenant
+func ListenChanges(
+	ctx context.Context,
+	postgresConnStr string,
+	tenant string,
+) (*ChangeListener, error) {
+	conn, err := pgx.Connect(ctx, postgresConnStr)
+	if err != nil {
+		return nil, err
+	}
+	channel := ChangesChannel(tenant)
+	if _, err := conn.Exec(ctx, "LISTEN "+pgx.Identifier{channel}.Sanitize()); err != nil {
+		conn.Close(ctx)
+		return nil, err
+	}
+	return &ChangeListener{conn: conn, channel: channel}, nil
+}
+
+// Next waits for the next change. Notifications that cannot be decoded are skipped. An
+// error means the connection is lost or the context is done
+func (l *ChangeListener) Next(ctx context.Context) (Change, error) {
+	for {
+		notification, err := l.conn.WaitForNotification(ctx)
+		if err != nil {
+			return Change{}, err
+		}
+		if notification.Channel != l.channel {
+			continue
+		}
+
+		var change Change
+		if err := json.Unmarshal([]byte(notification.Payload), &change); err != nil {
+			slog.Warn("Skipping malformed change notification", "payload", notification.Payload, "error", err)
+			continue
+		}
+		return change, nil
+	}
+}
+
+// Close stops listening and closes the connection
+func (l *ChangeListener) Close(ctx context.Context) error {
+	return l.conn.Close(ctx)
+}
@@ -0,0 +1,79 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListenChanges(t *testing.T) {
+	connStr := os.Getenv("DYNARAG_TEST_POSTGRES")
+	if connStr == "" {
+		t.Skip("DYNARAG_TEST_POSTGRES not set")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	scope := Scope{Tenant: fmt.Sprintf("changes-%d", time.Now().UnixNano()), Collection: DefaultCollection}
+	other := Scope{Tenant: scope.Tenant + "-other", Collection: DefaultCollection}
+
+	listener, err := ListenChanges(ctx, connStr, scope.Tenant)
+	require.NoError(t, err)
+	defer listener.Close(ctx)
+
+	vector := make([]float32, 384)
+	vector[0] = 1
+
+	// the changes of another tenant are published on its own channel
+	_, err = AddEmbeddingVector(ctx, connStr, other, AddParams{
+		FilePath:  "other.txt",
+		ChunkText: "unheard chunk",
+		Embedding: vector,
+	})
+	require.NoError(t, err)
+
+	first, err := IngestDocument(ctx, connStr, scope, "feed.txt", []AddParams{
+		{ChunkText: "followed chunk", Embedding: vector},
+	})
+	require.NoError(t, err)
+	_, err = IngestDocument(ctx, connStr, scope, "feed.txt", []AddParams{
+		{ChunkText: "newer chunk", Embedding: vector},
+	})
+	require.NoError(t, err)
+	_, err = DeleteUserEmbeddings(ctx, connStr, scope, false)
+	require.NoError(t, err)
+	_, err = EmptyUserTrash(ctx, connStr, scope, 0, false)
+	require.NoError(t, err)
+
+	// the chunks of both versions are trashed and deleted in no particular order, so the
+	// operations are gathered for each chunk
+	operations := make(map[int64][]ChangeOperation)
+	var chunks []int64
+	for count := 0; count < 7; count++ {
+		change, err := listener.Next(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, scope.Tenant, change.TenantID)
+		assert.Equal(t, first.DocumentID, change.DocumentID)
+		assert.Equal(t, "feed.txt", change.FilePath)
+		assert.Equal(t, DefaultCollection, change.Collection)
+		if _, ok := operations[change.ChunkID]; !ok {
+			chunks = append(chunks, change.ChunkID)
+		}
+		operations[change.ChunkID] = append(operations[change.ChunkID], change.Operation)
+	}
+	require.Len(t, chunks, 2)
+	assert.Equal(t, []ChangeOperation{ChangeInsert, ChangeSupersede, ChangeTrash, ChangeDelete}, operations[chunks[0]])
+	assert.Equal(t, []ChangeOperation{ChangeInsert, ChangeTrash, ChangeDelete}, operations[chunks[1]])
+}
+
+func TestChangesChannel(t *testing.T) {
+	// as dynarag_changes_channel names it in Postgres
+	assert.Equal(t, "dynarag_changes_c21f969b5f03d33d43e04f8f136e7682", ChangesChannel(DefaultTenant))
+	assert.Equal(t, ChangesChannel(DefaultTenant), ChangesChannel(""))
+	assert.NotEqual(t, ChangesChannel("a"), ChangesChannel("b"))
+}
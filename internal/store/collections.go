@@ -0,0 +1,194 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// DefaultCollection is the collection chunks are stored in unless another is chosen. It
+// holds every chunk stored before collections were introduced
+const DefaultCollection = "default"
+
+// ErrCollectionNotFound is returned for operations on a collection that does not exist
+var ErrCollectionNotFound = errors.New("collection not found")
+
+// collectionID resolves the ID of a collection of the transaction's tenant by name. The
+// default collection of a tenant is created on first use
+func collectionID(ctx context.Context, q *Queries, name string) (int64, error) {
+	collection, err := q.GetCollectionByName(ctx, name)
+	if errors.Is(err, pgx.ErrNoRows) && name == DefaultCollection {
+		collection, err = q.EnsureCollection(ctx, name)
+	}
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, fmt.Errorf("%w: %s", ErrCollectionNotFound, name)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return collection.ID, nil
+}
+
+// CreateCollection creates an empty collection of a tenant
+func CreateCollection(
+	ctx context.Context,
+	postgresConnStr string,
+	tenant string,
+	name string,
+) (*Collection, error) {
+	if name == "" {
+		return nil, errors.New("collection name is required")
+	}
+
+	conn, err := pgx.Connect(ctx, postgresConnStr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close(ctx)
+
+	tx, err := beginTenant(ctx, conn, tenant)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	q := New(tx)
+
+	collection, err := q.CreateCollection(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return &collection, tx.Commit(ctx)
+}
+
+// ListCollections returns every collection of a tenant with its document and chunk counts
+func ListCollections(
+	ctx context.Context,
+	postgresConnStr string,
+	tenant string,
+) ([]ListCollectionsRow, error) {
+	conn, err := pgx.Connect(ctx, postgresConnStr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close(ctx)
+
+	tx, err := beginTenant(ctx, conn, tenant)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	q := New(tx)
+
+	collections, err := q.ListCollections(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return collections, tx.Commit(ctx)
+}
+
+// RenameCollection renames a collection of a tenant. The default collection cannot be
+// renamed
+func RenameCollection(
+	ctx context.Context,
+	postgresConnStr string,
+	tenant string,
+	name string,
+	newName string,
+) (*Collection, error) {
+	if name == DefaultCollection {
+		return nil, errors.New("the default collection cannot be renamed")
+	}
+	if newName == "" {
+		return nil, errors.New("collection name is required")
+	}
+
+	conn, err := pgx.Connect(ctx, postgresConnStr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close(ctx)
+
+	tx, err := beginTenant(ctx, conn, tenant)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	q := New(tx)
+
+	collection, err := q.RenameCollection(ctx, RenameCollectionParams{
+		NewName: newName,
+		Name:    name,
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("%w: %s", ErrCollectionNotFound, name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &collection, tx.Commit(ctx)
+}
+
+// PurgeCollection permanently deletes a collection of a tenant along with its documents and
+// chunks, trashed or not. Unlike DeleteUserEmbeddings it bypasses the trash, so nothing can be
+// restored. The chunks are deleted before the collection so the change feed still carries
+// their file path and collection. The default collection cannot be purged
+func PurgeCollection(
+	ctx context.Context,
+	postgresConnStr string,
+	tenant string,
+	name string,
+) (*DeletionStats, error) {
+	if name == DefaultCollection {
+		return nil, errors.New("the default collection cannot be purged")
+	}
+
+	conn, err := pgx.Connect(ctx, postgresConnStr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close(ctx)
+
+	tx, err := beginTenant(ctx, conn, tenant)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	q := New(tx)
+
+	collection, err := q.GetCollectionByName(ctx, name)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("%w: %s", ErrCollectionNotFound, name)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := q.DeleteCollectionEmbeddings(ctx, collection.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &DeletionStats{EmbeddingCount: int64(len(rows))}
+	documents := make(map[int64]string)
+	for _, row := range rows {
+		stats.TotalBytes += int64(row.ChunkSize)
+		documents[row.DocumentID.Int64] = row.FilePath
+	}
+	stats.DocumentCount = int64(len(documents))
+	for _, filePath := range documents {
+		stats.FilePaths = append(stats.FilePaths, filePath)
+	}
+	sort.Strings(stats.FilePaths)
+
+	if _, err := q.DeleteCollection(ctx, name); err != nil {
+		return nil, err
+	}
+	return stats, tx.Commit(ctx)
+}
@@ -0,0 +1,114 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ErrDocumentNotFound is returned for operations on a document that is not stored
+var ErrDocumentNotFound = errors.New("document not found")
+
+// TrashUserDocument moves the chunks of one document of a collection to the trash, from
+// where RestoreUserEmbeddings can bring them back until the trash is emptied
+func TrashUserDocument(
+	ctx context.Context,
+	postgresConnStr string,
+	scope Scope,
+	filePath string,
+) (*DeletionStats, error) {
+	conn, err := pgx.Connect(ctx, postgresConnStr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close(ctx)
+
+	tx, err := beginTenant(ctx, conn, scope.Tenant)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	q := New(tx)
+
+	collectionID, err := collectionID(ctx, q, scope.Collection)
+	if err != nil {
+		return nil, err
+	}
+
+	row, err := q.TrashDocument(ctx, TrashDocumentParams{
+		CollectionID: collectionID,
+		FilePath:     filePath,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &DeletionStats{
+		EmbeddingCount: row.EmbeddingCount,
+		DocumentCount:  row.DocumentCount,
+		TotalBytes:     row.TotalBytes,
+		FilePaths:      []string{},
+	}
+	if row.EmbeddingCount > 0 {
+		stats.FilePaths = append(stats.FilePaths, filePath)
+	}
+	return stats, tx.Commit(ctx)
+}
+
+// RenameUserDocument moves a document of a collection, with all of its chunks and
+// versions, to another file path. The new path must not be taken, even by a document in
+// the trash
+func RenameUserDocument(
+	ctx context.Context,
+	postgresConnStr string,
+	scope Scope,
+	filePath string,
+	newFilePath string,
+) error {
+	if newFilePath == "" {
+		return errors.New("file path is required")
+	}
+
+	conn, err := pgx.Connect(ctx, postgresConnStr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close(ctx)
+
+	tx, err := beginTenant(ctx, conn, scope.Tenant)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	q := New(tx)
+
+	collectionID, err := collectionID(ctx, q, scope.Collection)
+	if err != nil {
+		return err
+	}
+
+	renamed, err := q.RenameDocument(ctx, RenameDocumentParams{
+		NewFilePath:  newFilePath,
+		CollectionID: collectionID,
+		FilePath:     filePath,
+	})
+	if err != nil {
+		return err
+	}
+	if renamed == 0 {
+		return fmt.Errorf("%w: %s", ErrDocumentNotFound, filePath)
+	}
+	return tx.Commit(ctx)
+}
+
+func (p *Postgres) DeleteDocument(ctx context.Context, filePath string) (*DeletionStats, error) {
+	return TrashUserDocument(ctx, p.connStr, p.scope, filePath)
+}
+
+func (p *Postgres) RenameDocument(ctx context.Context, filePath string, newFilePath string) error {
+	return RenameUserDocument(ctx, p.connStr, p.scope, filePath, newFilePath)
+}
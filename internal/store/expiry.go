@@ -0,0 +1,130 @@
+package store
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// DefaultVacuumBatchSize is the number of expired chunks Vacuum removes per transaction
+const DefaultVacuumBatchSize = 500
+
+// VacuumStats reports what a vacuum removed
+type VacuumStats struct {
+	EmbeddingCount int64    // Number of expired chunks removed
+	DocumentCount  int64    // Number of documents removed as their last chunk expired
+	TotalBytes     int64    // Total size of the removed chunk texts
+	FilePaths      []string // File paths of the documents that lost chunks
+	Batches        int      // Number of transactions the removal took
+}
+
+// timestamptz converts an optional time to its column value
+func timestamptz(t *time.Time) pgtype.Timestamptz {
+	if t == nil {
+		return pgtype.Timestamptz{}
+	}
+	return pgtype.Timestamptz{Time: *t, Valid: true}
+}
+
+// VacuumExpired deletes the expired chunks of a tenant, across all of its collections.
+// Each batch of up to batchSize chunks is removed in its own transaction to keep locks
+// short, and documents left without chunks are removed by the delete_empty_documents
+// trigger. On error the stats cover the batches committed so far
+func VacuumExpired(
+	ctx context.Context,
+	postgresConnStr string,
+	tenant string,
+	batchSize int,
+) (*VacuumStats, error) {
+	if batchSize <= 0 {
+		batchSize = DefaultVacuumBatchSize
+	}
+
+	conn, err := pgx.Connect(ctx, postgresConnStr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close(ctx)
+
+	stats := &VacuumStats{}
+	filePaths := make(map[string]struct{})
+	defer func() {
+		for filePath := range filePaths {
+			stats.FilePaths = append(stats.FilePaths, filePath)
+		}
+		sort.Strings(stats.FilePaths)
+	}()
+
+	for {
+		removed, err := vacuumBatch(ctx, conn, tenant, batchSize, stats, filePaths)
+		if err != nil {
+			return stats, err
+		}
+		if removed < batchSize {
+			return stats, nil
+		}
+		if err := ctx.Err(); err != nil {
+			return stats, err
+		}
+	}
+}
+
+// vacuumBatch removes one batch of expired chunks and adds it to stats, returning the
+// number of chunks removed
+func vacuumBatch(
+	ctx context.Context,
+	conn *pgx.Conn,
+	tenant string,
+	batchSize int,
+	stats *VacuumStats,
+	filePaths map[string]struct{},
+) (int, error) {
+	tx, err := beginTenant(ctx, conn, tenant)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	q := New(tx)
+
+	rows, err := q.DeleteExpiredEmbeddings(ctx, int32(batchSize))
+	if err != nil {
+		return 0, err
+	}
+	if len(rows) == 0 {
+		return 0, tx.Commit(ctx)
+	}
+
+	var bytes int64
+	documents := make(map[int64]string)
+	for _, row := range rows {
+		bytes += int64(row.ChunkSize)
+		documents[row.DocumentID.Int64] = row.FilePath
+	}
+	documentIDs := make([]int64, 0, len(documents))
+	for id := range documents {
+		documentIDs = append(documentIDs, id)
+	}
+
+	// the trigger has already removed the documents this batch emptied
+	remaining, err := q.CountExistingDocuments(ctx, documentIDs)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, err
+	}
+
+	stats.Batches++
+	stats.EmbeddingCount += int64(len(rows))
+	stats.DocumentCount += int64(len(documentIDs)) - remaining
+	stats.TotalBytes += bytes
+	for _, filePath := range documents {
+		filePaths[filePath] = struct{}{}
+	}
+	return len(rows), nil
+}
@@ -0,0 +1,219 @@
+package store
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/pgvector/pgvector-go"
+
+	"github.com/Predixus/DynaRAG/types"
+)
+
+// Record is the portable form of a stored chunk, as written by exports
+type Record struct {
+	FilePath      string         `json:"file_path"`
+	ChunkText     string         `json:"chunk_text"`
+	EmbeddingText *string        `json:"embedding_text,omitempty"`
+	Metadata      *types.JSONMap `json:"metadata,omitempty"` // nil for chunks stored without metadata
+	ModelName     string         `json:"model_name"`
+	Embedding     []float32      `json:"embedding,omitempty"`
+	// AllowedPrincipals restricts the chunk to these principals, nil for open chunks
+	AllowedPrincipals []string `json:"allowed_principals,omitempty"`
+	// ExpiresAt is when the chunk expires, nil for chunks kept until deleted
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+const eachEmbedding = `
+SELECT 
+    d.file_path,
+    e.chunk_text,
+    e.embedding_text,
+    e.metadata,
+    e.metadata_hash,
+    e.model_name,
+    e.allowed_principals,
+    e.expires_at
+FROM embeddings e
+JOIN documents d ON d.id = e.document_id
+JOIN document_versions v ON v.id = e.version_id
+WHERE d.collection_id = $1
+  AND (e.expires_at IS NULL OR e.expires_at > now())
+  AND e.deleted_at IS NULL
+  AND v.valid_to IS NULL
+ORDER BY e.id
+`
+
+const eachEmbeddingWithVector = `
+SELECT 
+    d.file_path,
+    e.chunk_text,
+    e.embedding_text,
+    e.metadata,
+    e.metadata_hash,
+    e.model_name,
+    e.allowed_principals,
+    e.expires_at,
+    e.embedding
+FROM embeddings e
+JOIN documents d ON d.id = e.document_id
+JOIN document_versions v ON v.id = e.version_id
+WHERE d.collection_id = $1
+  AND (e.expires_at IS NULL OR e.expires_at > now())
+  AND e.deleted_at IS NULL
+  AND v.valid_to IS NULL
+ORDER BY e.id
+`
+
+// EachRecord calls fn with every unexpired chunk of a collection in insertion order. Rows
+// are streamed from the database, so the corpus is never held in memory. Vectors are only
+// read if withVectors is set
+func EachRecord(
+	ctx context.Context,
+	postgresConnStr string,
+	scope Scope,
+	withVectors bool,
+	fn func(Record) error,
+) error {
+	conn, err := pgx.Connect(ctx, postgresConnStr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close(ctx)
+
+	tx, err := beginTenant(ctx, conn, scope.Tenant)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	collectionID, err := collectionID(ctx, New(tx), scope.Collection)
+	if err != nil {
+		return err
+	}
+
+	query := eachEmbedding
+	if withVectors {
+		query = eachEmbeddingWithVector
+	}
+
+	rows, err := tx.Query(ctx, query, collectionID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			record        Record
+			embeddingText *string
+			metadata      types.JSONMap
+			metadataHash  *string
+			modelName     EmbeddingModel
+			vector        pgvector.Vector
+		)
+		dest := []interface{}{
+			&record.FilePath,
+			&record.ChunkText,
+			&embeddingText,
+			&metadata,
+			&metadataHash,
+			&modelName,
+			&record.AllowedPrincipals,
+			&record.ExpiresAt,
+		}
+		if withVectors {
+			dest = append(dest, &vector)
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return err
+		}
+
+		record.EmbeddingText = embeddingText
+		record.ModelName = string(modelName)
+		if metadataHash != nil && *metadataHash != "" {
+			record.Metadata = &metadata
+		}
+		if withVectors {
+			record.Embedding = vector.Slice()
+		}
+
+		if err := fn(record); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+func (p *Postgres) AddMany(ctx context.Context, params []AddParams) error {
+	_, err := AddEmbeddingVectors(ctx, p.connStr, p.scope, params)
+	return err
+}
+
+func (p *Postgres) Each(ctx context.Context, withVectors bool, fn func(Record) error) error {
+	return EachRecord(ctx, p.connStr, p.scope, withVectors, fn)
+}
+
+func (m *Memory) AddMany(ctx context.Context, params []AddParams) error {
+	for _, p := range params {
+		if _, err := m.Add(ctx, p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *Memory) Each(ctx context.Context, withVectors bool, fn func(Record) error) error {
+	m.mu.RLock()
+	ids := make([]int64, 0, len(m.embeddings))
+	for id := range m.embeddings {
+		ids = append(ids, id)
+	}
+	m.mu.RUnlock()
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	now := time.Now()
+	for _, id := range ids {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		m.mu.RLock()
+		embedding, ok := m.embeddings[id]
+		var record Record
+		// chunks deleted since the IDs were gathered, trashed, expired or of past versions
+		// are skipped
+		ok = ok && m.liveAt(embedding, now)
+		if ok {
+			record = Record{
+				FilePath:      m.documents[embedding.DocumentID].FilePath,
+				ChunkText:     embedding.ChunkText,
+				EmbeddingText: embedding.EmbeddingText,
+				ModelName:     string(DefaultModelName),
+
+				AllowedPrincipals: embedding.AllowedPrincipals,
+				ExpiresAt:         embedding.ExpiresAt,
+			}
+			if embedding.MetadataHash != "" {
+				metadata := embedding.metadata()
+				record.Metadata = &metadata
+			}
+			if withVectors {
+				record.Embedding = append([]float32(nil), embedding.Vector...)
+			}
+		}
+		m.mu.RUnlock()
+
+		if !ok {
+			continue
+		}
+		if err := fn(record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package store
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// LastGitCommit returns the commit a repository was last ingested into a collection at, or
+// an empty string if it never was
+func LastGitCommit(
+	ctx context.Context,
+	postgresConnStr string,
+	scope Scope,
+	repository string,
+) (string, error) {
+	conn, err := pgx.Connect(ctx, postgresConnStr)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close(ctx)
+
+	tx, err := beginTenant(ctx, conn, scope.Tenant)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback(ctx)
+
+	q := New(tx)
+
+	collectionID, err := collectionID(ctx, q, scope.Collection)
+	if err != nil {
+		return "", err
+	}
+
+	ingest, err := q.GetGitIngest(ctx, GetGitIngestParams{
+		CollectionID: collectionID,
+		Repository:   repository,
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", tx.Commit(ctx)
+	}
+	if err != nil {
+		return "", err
+	}
+	return ingest.CommitSha, tx.Commit(ctx)
+}
+
+// RecordGitCommit records the commit a repository was ingested into a collection at
+func RecordGitCommit(
+	ctx context.Context,
+	postgresConnStr string,
+	scope Scope,
+	repository string,
+	commit string,
+) error {
+	conn, err := pgx.Connect(ctx, postgresConnStr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close(ctx)
+
+	tx, err := beginTenant(ctx, conn, scope.Tenant)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	q := New(tx)
+
+	collectionID, err := collectionID(ctx, q, scope.Collection)
+	if err != nil {
+		return err
+	}
+
+	_, err = q.UpsertGitIngest(ctx, UpsertGitIngestParams{
+		CollectionID: collectionID,
+		Repository:   repository,
+		CommitSha:    commit,
+	})
+	if err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
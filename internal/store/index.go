@@ -0,0 +1,337 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// IndexKind is the type of approximate nearest neighbour index on the embeddings
+type IndexKind string
+
+const (
+	IndexHNSW    IndexKind = "hnsw"
+	IndexIVFFlat IndexKind = "ivfflat"
+)
+
+const (
+	DefaultHNSWM              = 16
+	DefaultHNSWEfConstruction = 64
+
+	defaultEfSearch = 40 // the pgvector default of hnsw.ef_search
+)
+
+// IndexParams holds the build parameters of an index. Zero values use the pgvector
+// defaults for HNSW, and a list count computed from the number of rows for IVFFlat
+type IndexParams struct {
+	M              int // HNSW: maximum connections per layer
+	EfConstruction int // HNSW: size of the candidate list while building
+	Lists          int // IVFFlat: number of inverted lists
+}
+
+// IndexInfo describes an index that was built
+type IndexInfo struct {
+	Name         string
+	Model        EmbeddingModel
+	Metric       DistanceMetric
+	Quantization Quantization
+	Kind         IndexKind
+	Params       IndexParams
+	Rows         int64 // estimated rows of the embeddings table at build time, across tenants
+	Definition   string
+}
+
+// SearchParams are the recall knobs of a single search. Zero values keep the server
+// settings
+type SearchParams struct {
+	Probes     int // IVFFlat: number of lists probed, ivfflat.probes
+	EfSearch   int // HNSW: size of the candidate list while searching, hnsw.ef_search
+	Oversample int // quantised indexes: candidates re-ranked per result
+}
+
+// IVFFlatLists returns the list count pgvector recommends for a table of the given size:
+// rows / 1000 up to a million rows, and the square root of rows beyond that
+func IVFFlatLists(rows int64) int {
+	if rows <= 1_000_000 {
+		return max(int(rows/1000), 1)
+	}
+	return int(math.Sqrt(float64(rows)))
+}
+
+// indexName returns the name of the vector index of a model
+func indexName(model EmbeddingModel) string {
+	slug := strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToLower(r)
+		}
+		return '_'
+	}, string(model))
+	return "embeddings_embedding_" + slug + "_idx"
+}
+
+// indexDefinition returns the CREATE INDEX statement of the partial vector index of a
+// model, over the representation of its quantization and with the operator class of its
+// metric
+func indexDefinition(
+	name string,
+	model ModelRegistration,
+	kind IndexKind,
+	params IndexParams,
+) (string, error) {
+	plan := searchPlan{
+		Metric:       model.Metric,
+		Quantization: model.Quantization,
+		Dimensions:   int(model.Dimensions),
+	}
+	column, _, _, opclass, err := plan.candidates("embedding")
+	if err != nil {
+		return "", err
+	}
+
+	var with string
+	switch kind {
+	case IndexHNSW:
+		with = fmt.Sprintf("m = %d, ef_construction = %d", params.M, params.EfConstruction)
+	case IndexIVFFlat:
+		with = fmt.Sprintf("lists = %d", params.Lists)
+	default:
+		return "", fmt.Errorf("unsupported index kind: %s", kind)
+	}
+
+	return fmt.Sprintf(
+		"CREATE INDEX CONCURRENTLY %s ON embeddings USING %s ((%s) %s) WITH (%s) WHERE model_name = '%s'",
+		name, kind, column, opclass, with, strings.ReplaceAll(string(model.ModelName), "'", "''"),
+	), nil
+}
+
+// resolveIndexParams fills in the defaults of the build parameters and validates them
+func resolveIndexParams(kind IndexKind, params IndexParams, rows int64) (IndexParams, error) {
+	switch kind {
+	case IndexHNSW:
+		if params.M == 0 {
+			params.M = DefaultHNSWM
+		}
+		if params.EfConstruction == 0 {
+			params.EfConstruction = DefaultHNSWEfConstruction
+		}
+		if params.M < 2 || params.EfConstruction < 2*params.M {
+			return params, errors.New("hnsw needs m >= 2 and ef_construction >= 2 * m")
+		}
+	case IndexIVFFlat:
+		if params.Lists == 0 {
+			params.Lists = IVFFlatLists(rows)
+		}
+		if params.Lists < 1 {
+			return params, errors.New("ivfflat needs at least one list")
+		}
+	default:
+		return params, fmt.Errorf("unsupported index kind: %s", kind)
+	}
+	return params, nil
+}
+
+// RebuildIndex replaces the vector index of every registered model. Each model has a
+// partial index using the operator class of its distance metric. New indexes are built
+// concurrently alongside the old ones, which keep serving searches, and are swapped in
+// once complete
+func RebuildIndex(
+	ctx context.Context,
+	postgresConnStr string,
+	kind IndexKind,
+	params IndexParams,
+) ([]IndexInfo, error) {
+	conn, err := pgx.Connect(ctx, postgresConnStr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close(ctx)
+
+	q := New(conn)
+
+	models, err := q.ListModelRegistrations(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var built []IndexInfo
+	for _, model := range models {
+		info, err := rebuildModelIndex(ctx, conn, model, kind, params)
+		if err != nil {
+			return built, fmt.Errorf("failed to rebuild index of %s: %w", model.ModelName, err)
+		}
+		built = append(built, *info)
+	}
+	return built, nil
+}
+
+func rebuildModelIndex(
+	ctx context.Context,
+	conn *pgx.Conn,
+	model ModelRegistration,
+	kind IndexKind,
+	params IndexParams,
+) (*IndexInfo, error) {
+	rows, err := estimateRows(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+
+	params, err = resolveIndexParams(kind, params, rows)
+	if err != nil {
+		return nil, err
+	}
+
+	name := indexName(model.ModelName)
+	building := name + "_rebuild"
+
+	definition, err := indexDefinition(building, model, kind, params)
+	if err != nil {
+		return nil, err
+	}
+
+	// a failed concurrent build leaves an invalid index behind
+	if _, err := conn.Exec(ctx, "DROP INDEX IF EXISTS "+building); err != nil {
+		return nil, err
+	}
+	if _, err := conn.Exec(ctx, definition); err != nil {
+		return nil, fmt.Errorf("failed to build %s index: %w", kind, err)
+	}
+
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, "DROP INDEX IF EXISTS "+name); err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(ctx, fmt.Sprintf("ALTER INDEX %s RENAME TO %s", building, name)); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	return &IndexInfo{
+		Name:         name,
+		Model:        model.ModelName,
+		Metric:       model.Metric,
+		Quantization: model.Quantization,
+		Kind:         kind,
+		Params:       params,
+		Rows:         rows,
+		Definition:   definition,
+	}, nil
+}
+
+// estimateRows returns the planner's estimate of the rows in the embeddings table. A
+// COUNT(*) would only see the rows of one tenant under row level security, while the index
+// covers every tenant. A table that was never analysed is analysed first
+func estimateRows(ctx context.Context, conn *pgx.Conn) (int64, error) {
+	const query = "SELECT reltuples::bigint FROM pg_class WHERE oid = 'embeddings'::regclass"
+
+	var rows int64
+	if err := conn.QueryRow(ctx, query).Scan(&rows); err != nil {
+		return 0, err
+	}
+	if rows >= 0 {
+		return rows, nil
+	}
+
+	if _, err := conn.Exec(ctx, "ANALYZE embeddings"); err != nil {
+		return 0, err
+	}
+	if err := conn.QueryRow(ctx, query).Scan(&rows); err != nil {
+		return 0, err
+	}
+	return max(rows, 0), nil
+}
+
+// extensionVersion caches the pgvector version of a database. It is read by the first
+// search of a store and shared by the stores derived from it
+type extensionVersion struct {
+	mu      sync.Mutex
+	version string
+}
+
+// get returns the pgvector version, reading it within tx unless it is cached. A nil cache
+// reads it every time
+func (v *extensionVersion) get(ctx context.Context, tx pgx.Tx) (string, error) {
+	if v != nil {
+		v.mu.Lock()
+		defer v.mu.Unlock()
+		if v.version != "" {
+			return v.version, nil
+		}
+	}
+
+	var version string
+	err := tx.QueryRow(ctx, "SELECT extversion FROM pg_extension WHERE extname = 'vector'").Scan(&version)
+	if err != nil {
+		return "", fmt.Errorf("failed to read the pgvector version: %w", err)
+	}
+	if v != nil {
+		v.version = version
+	}
+	return version, nil
+}
+
+// applyFilteredScan makes the index scan of a search find the nearest rows its filters
+// keep, rather than filtering the nearest rows it finds. An HNSW scan stops at ef_search
+// rows and an IVFFlat scan at the rows of its probed lists, so a filter that keeps few of
+// them would shorten the top k. pgvector 0.8 scans on until the limit is met, the IVFFlat
+// rows in relaxed order, so callers sort the rows by distance. Every search filters on
+// tenant, collection, version and expiry, so older versions always scan the table instead
+func applyFilteredScan(ctx context.Context, tx pgx.Tx, vectorVersion *extensionVersion) error {
+	version, err := vectorVersion.get(ctx, tx)
+	if err != nil {
+		return err
+	}
+
+	statements := []string{"SET LOCAL enable_indexscan = off"}
+	if versionAtLeast(version, 0, 8) {
+		statements = []string{
+			"SET LOCAL hnsw.iterative_scan = strict_order",
+			"SET LOCAL ivfflat.iterative_scan = relaxed_order",
+		}
+	}
+	for _, statement := range statements {
+		if _, err := tx.Exec(ctx, statement); err != nil {
+			return fmt.Errorf("failed to enable filtered scans: %w", err)
+		}
+	}
+	return nil
+}
+
+// versionAtLeast reports whether an extension version such as "0.8.0" is at least
+// major.minor
+func versionAtLeast(version string, major, minor int) bool {
+	var gotMajor, gotMinor int
+	if _, err := fmt.Sscanf(version, "%d.%d", &gotMajor, &gotMinor); err != nil {
+		return false
+	}
+	return gotMajor > major || (gotMajor == major && gotMinor >= minor)
+}
+
+// applySearchParams sets the recall knobs for the rest of the transaction
+func applySearchParams(ctx context.Context, tx pgx.Tx, params SearchParams) error {
+	if params.Probes > 0 {
+		if _, err := tx.Exec(ctx, fmt.Sprintf("SET LOCAL ivfflat.probes = %d", params.Probes)); err != nil {
+			return fmt.Errorf("failed to set ivfflat.probes: %w", err)
+		}
+	}
+	if params.EfSearch > 0 {
+		if _, err := tx.Exec(ctx, fmt.Sprintf("SET LOCAL hnsw.ef_search = %d", params.EfSearch)); err != nil {
+			return fmt.Errorf("failed to set hnsw.ef_search: %w", err)
+		}
+	}
+	return nil
+}
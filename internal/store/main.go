@@ -3,7 +3,9 @@ package store
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"log/slog"
+	"sort"
 	"sync"
 
 	"github.com/jackc/pgx/v5"
@@ -37,9 +39,19 @@ func GetSingleEmbedding(ctx context.Context, text string) ([]float32, error) {
 	return embeddings[0], nil
 }
 
+// Embedder returns the embedding model, which also provides its tokenizer for counting
+// tokens
+func Embedder() (*embed.Embedder, error) {
+	if embedder == nil {
+		return nil, errors.New("embedder is not initialised")
+	}
+	return embedder, nil
+}
+
 func AddEmbedding(
 	ctx context.Context,
 	postgresConnStr string,
+	scope Scope,
 	filePath string,
 	chunkText string,
 	embeddingText *string, // using nil for default behavior
@@ -54,13 +66,44 @@ func AddEmbedding(
 		return nil, err
 	}
 
+	return AddEmbeddingVector(ctx, postgresConnStr, scope, AddParams{
+		FilePath:      filePath,
+		ChunkText:     chunkText,
+		EmbeddingText: embeddingText,
+		Metadata:      metadata,
+		Embedding:     embedding,
+	})
+}
+
+// AddEmbeddingVector stores a chunk with an already computed embedding
+func AddEmbeddingVector(
+	ctx context.Context,
+	postgresConnStr string,
+	scope Scope,
+	params AddParams,
+) (*Embedding, error) {
+	embeddings, err := AddEmbeddingVectors(ctx, postgresConnStr, scope, []AddParams{params})
+	if err != nil {
+		return nil, err
+	}
+	return &embeddings[0], nil
+}
+
+// AddEmbeddingVectors stores chunks with already computed embeddings in a single
+// transaction
+func AddEmbeddingVectors(
+	ctx context.Context,
+	postgresConnStr string,
+	scope Scope,
+	params []AddParams,
+) ([]Embedding, error) {
 	conn, err := pgx.Connect(ctx, postgresConnStr)
 	if err != nil {
 		return nil, err
 	}
 	defer conn.Close(ctx)
 
-	tx, err := conn.Begin(ctx)
+	tx, err := beginTenant(ctx, conn, scope.Tenant)
 	if err != nil {
 		return nil, err
 	}
@@ -68,7 +111,50 @@ func AddEmbedding(
 
 	q := New(tx)
 
-	doc, err := q.CreateDocument(ctx, filePath)
+	collectionID, err := collectionID(ctx, q, scope.Collection)
+	if err != nil {
+		return nil, err
+	}
+
+	embeddings := make([]Embedding, 0, len(params))
+	for _, p := range params {
+		embedding, err := addEmbedding(ctx, q, collectionID, p)
+		if err != nil {
+			return nil, err
+		}
+		embeddings = append(embeddings, *embedding)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	return embeddings, nil
+}
+
+// addEmbedding stores a chunk and its document in a collection with the given queries
+func addEmbedding(
+	ctx context.Context,
+	q *Queries,
+	collectionID int64,
+	params AddParams,
+) (*Embedding, error) {
+	filePath := params.FilePath
+	chunkText := params.ChunkText
+	embeddingText := params.EmbeddingText
+	metadata := params.Metadata
+	embedding := params.Embedding
+
+	doc, err := q.CreateDocument(ctx, CreateDocumentParams{
+		CollectionID: collectionID,
+		FilePath:     filePath,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// chunks join the current version of the document, the first is opened on demand
+	version, err := q.OpenDocumentVersion(ctx, doc.ID)
 	if err != nil {
 		return nil, err
 	}
@@ -94,7 +180,7 @@ func AddEmbedding(
 
 	embeddingRecord, err := q.CreateEmbedding(ctx, CreateEmbeddingParams{
 		DocumentID:   pgtype.Int8{Int64: doc.ID, Valid: true},
-		ModelName:    "all-MiniLM-L6-v2",
+		ModelName:    DefaultModelName,
 		ChunkText:    chunkText,
 		Embedding:    pgvector.NewVector(embedding),
 		Metadata:     *metadata,
@@ -108,37 +194,92 @@ func AddEmbedding(
 			}(),
 			Valid: embeddingText != nil,
 		},
+		AllowedPrincipals: params.AllowedPrincipals,
+		ExpiresAt:         timestamptz(params.ExpiresAt),
+		VersionID:         pgtype.Int8{Int64: version.ID, Valid: true},
 	})
 	if err != nil {
 		return nil, err
 	}
 
-	if err := tx.Commit(ctx); err != nil {
-		return nil, err
-	}
-
 	return &embeddingRecord, nil
 }
 
 func GetTopKEmbeddings(
 	ctx context.Context,
 	postgresConnStr string,
+	scope Scope,
 	text string,
 	k int8,
 	metadata *types.JSONMap,
+	search SearchParams,
 ) ([]FindTopKNNEmbeddingsRow, error) {
 	embedding, err := GetSingleEmbedding(ctx, text)
 	if err != nil {
 		return nil, err
 	}
 
+	return GetTopKEmbeddingsByVector(ctx, postgresConnStr, scope, SearchRequest{
+		Embedding: embedding,
+		K:         k,
+		Metadata:  metadata,
+		Params:    search,
+	})
+}
+
+// GetTopKEmbeddingsByVector returns the request.K chunks of a collection nearest to an
+// already computed embedding, among those the principals of the request may retrieve. The
+// search runs in its own transaction so that the recall knobs only apply to it
+func GetTopKEmbeddingsByVector(
+	ctx context.Context,
+	postgresConnStr string,
+	scope Scope,
+	request SearchRequest,
+) ([]FindTopKNNEmbeddingsRow, error) {
+	return searchEmbeddings(ctx, postgresConnStr, scope, request, nil)
+}
+
+// searchEmbeddings runs GetTopKEmbeddingsByVector, with the pgvector version cached in
+// vectorVersion when it is not nil
+func searchEmbeddings(
+	ctx context.Context,
+	postgresConnStr string,
+	scope Scope,
+	request SearchRequest,
+	vectorVersion *extensionVersion,
+) ([]FindTopKNNEmbeddingsRow, error) {
+	k := request.K
+	metadata := request.Metadata
+	search := request.Params
+
 	conn, err := pgx.Connect(ctx, postgresConnStr)
 	if err != nil {
 		return nil, err
 	}
 	defer conn.Close(ctx)
 
-	q := New(conn)
+	tx, err := beginTenant(ctx, conn, scope.Tenant)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	q := New(tx)
+
+	collectionID, err := collectionID(ctx, q, scope.Collection)
+	if err != nil {
+		return nil, err
+	}
+
+	plan, err := modelPlan(ctx, q, DefaultModelName, search)
+	if err != nil {
+		return nil, err
+	}
+
+	// an HNSW scan returns at most ef_search rows, which must cover the candidates
+	if plan.Quantization != QuantizationNone && search.EfSearch == 0 {
+		search.EfSearch = max(int(plan.candidateCount(int32(k))), defaultEfSearch)
+	}
 
 	// calculate metadatahash
 	var metadataHashPtr *string
@@ -154,9 +295,17 @@ func GetTopKEmbeddings(
 		}
 	}
 
-	return q.FindTopKNNEmbeddings(ctx, FindTopKNNEmbeddingsParams{
-		QueryEmbedding: pgvector.NewVector(embedding),
-		ModelName:      "all-MiniLM-L6-v2",
+	if err := applySearchParams(ctx, tx, search); err != nil {
+		return nil, err
+	}
+	if err := applyFilteredScan(ctx, tx, vectorVersion); err != nil {
+		return nil, err
+	}
+
+	params := FindTopKNNEmbeddingsParams{
+		QueryEmbedding: pgvector.NewVector(request.Embedding),
+		ModelName:      DefaultModelName,
+		CollectionID:   collectionID,
 		K:              int32(k),
 		MetadataHash: pgtype.Text{
 			Valid: metadataHashPtr != nil,
@@ -167,7 +316,59 @@ func GetTopKEmbeddings(
 				return ""
 			}(),
 		},
-	})
+		Principals: request.Principals,
+		AsOf:       timestamptz(request.AsOf),
+	}
+
+	rows, err := q.FindTopKNNEmbeddings(ctx, plan, params)
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(rows, func(i, j int) bool { return rows[i].Distance < rows[j].Distance })
+
+	if request.Withheld != nil {
+		withheld, err := q.CountWithheldNeighbours(ctx, plan, params)
+		if err != nil {
+			return nil, err
+		}
+		*request.Withheld = int(withheld)
+	}
+
+	return rows, tx.Commit(ctx)
+}
+
+// GetEmbeddingVectors returns the stored vectors of the given embeddings of a tenant,
+// keyed by ID
+func GetEmbeddingVectors(
+	ctx context.Context,
+	postgresConnStr string,
+	tenant string,
+	ids []int64,
+) (map[int64][]float32, error) {
+	conn, err := pgx.Connect(ctx, postgresConnStr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close(ctx)
+
+	tx, err := beginTenant(ctx, conn, tenant)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	q := New(tx)
+
+	rows, err := q.GetEmbeddingVectors(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	vectors := make(map[int64][]float32, len(rows))
+	for _, row := range rows {
+		vectors[row.ID] = row.Embedding.Slice()
+	}
+	return vectors, tx.Commit(ctx)
 }
 
 // DeletionStats provides information about what would be/was deleted
@@ -178,11 +379,15 @@ type DeletionStats struct {
 	FilePaths      []string // List of file paths that would be affected
 }
 
-// DeleteUserEmbeddings deletes all embeddings and documents for a given user
+// DeleteUserEmbeddings moves all embeddings and documents of a collection to the trash,
+// from where RestoreUserEmbeddings can bring them back until the trash is emptied
+// The stats count the chunks searches would return; chunks of superseded versions and
+// expired chunks are trashed alongside without being counted
 // If dryRun is true, returns what would be deleted without actually deleting
 func DeleteUserEmbeddings(
 	ctx context.Context,
 	postgresConnStr string,
+	scope Scope,
 	dryRun bool,
 ) (*DeletionStats, error) {
 	conn, err := pgx.Connect(ctx, postgresConnStr)
@@ -191,7 +396,7 @@ func DeleteUserEmbeddings(
 	}
 	defer conn.Close(ctx)
 
-	tx, err := conn.Begin(ctx)
+	tx, err := beginTenant(ctx, conn, scope.Tenant)
 	if err != nil {
 		return nil, err
 	}
@@ -199,14 +404,19 @@ func DeleteUserEmbeddings(
 
 	q := New(tx)
 
+	collectionID, err := collectionID(ctx, q, scope.Collection)
+	if err != nil {
+		return nil, err
+	}
+
 	// Get statistics first
-	stats, err := q.GetStorageStats(ctx)
+	stats, err := q.GetStorageStats(ctx, collectionID)
 	if err != nil {
 		return nil, err
 	}
 
 	// Get affected file paths
-	docs, err := q.ListDocuments(ctx)
+	docs, err := q.ListDocuments(ctx, collectionID)
 	if err != nil {
 		return nil, err
 	}
@@ -229,7 +439,7 @@ func DeleteUserEmbeddings(
 	}
 
 	// Actually perform the deletion
-	err = q.DeleteEmbeddings(ctx)
+	err = q.TrashEmbeddings(ctx, collectionID)
 	if err != nil {
 		return nil, err
 	}
@@ -242,27 +452,44 @@ func DeleteUserEmbeddings(
 	return deletionStats, nil
 }
 
-func GetStats(ctx context.Context, postgresConnStr string) (*GetStatsRow, error) {
+func GetStats(
+	ctx context.Context,
+	postgresConnStr string,
+	scope Scope,
+) (*GetStatsRow, error) {
 	conn, err := pgx.Connect(ctx, postgresConnStr)
 	if err != nil {
 		return nil, err
 	}
 	defer conn.Close(ctx)
 
-	q := New(conn)
+	tx, err := beginTenant(ctx, conn, scope.Tenant)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	q := New(tx)
+
+	collectionID, err := collectionID(ctx, q, scope.Collection)
+	if err != nil {
+		return nil, err
+	}
 
-	stats, err := q.GetStats(ctx)
+	stats, err := q.GetStats(ctx, collectionID)
 	if err != nil {
 		return nil, err
 	}
 
-	return &stats, nil
+	return &stats, tx.Commit(ctx)
 }
 
 func ListUserChunks(
 	ctx context.Context,
 	postgresConnStr string,
+	scope Scope,
 	metadata *types.JSONMap,
+	principals []string,
 ) ([]ListChunksRow, error) {
 	conn, err := pgx.Connect(ctx, postgresConnStr)
 	if err != nil {
@@ -270,7 +497,18 @@ func ListUserChunks(
 	}
 	defer conn.Close(ctx)
 
-	q := New(conn)
+	tx, err := beginTenant(ctx, conn, scope.Tenant)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	q := New(tx)
+
+	collectionID, err := collectionID(ctx, q, scope.Collection)
+	if err != nil {
+		return nil, err
+	}
 
 	// calculate metadatahash
 	var metadataHashPtr *string
@@ -285,18 +523,21 @@ func ListUserChunks(
 			return nil, err
 		}
 	}
-	// Get all chunks for the user
-	chunks, err := q.ListChunks(ctx, pgtype.Text{String: func() string {
-		if metadataHashPtr != nil {
-			return *metadataHashPtr
-		}
-		return ""
-	}(), Valid: metadataHashPtr != nil},
-	)
+	// Get all chunks of the collection
+	chunks, err := q.ListChunks(ctx, ListChunksParams{
+		CollectionID: collectionID,
+		Principals:   principals,
+		MetadataHash: pgtype.Text{String: func() string {
+			if metadataHashPtr != nil {
+				return *metadataHashPtr
+			}
+			return ""
+		}(), Valid: metadataHashPtr != nil},
+	})
 	if err != nil {
 		slog.Error("Error when listing user chunks", "error", err)
 		return nil, err
 	}
 
-	return chunks, nil
+	return chunks, tx.Commit(ctx)
 }
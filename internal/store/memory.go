@@ -0,0 +1,799 @@
+package store
+
+import (
+	"context"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/pgvector/pgvector-go"
+
+	"github.com/Predixus/DynaRAG/internal/utils"
+	"github.com/Predixus/DynaRAG/internal/vecindex"
+	"github.com/Predixus/DynaRAG/types"
+)
+
+// MemoryIndex is the nearest neighbour index of the in-memory store
+type MemoryIndex string
+
+const (
+	MemoryIndexFlat MemoryIndex = "flat" // exact, brute force search
+	MemoryIndexHNSW MemoryIndex = "hnsw" // approximate graph search
+)
+
+// snapshotVersion is bumped whenever the snapshot layout changes
+const snapshotVersion = 1
+
+// MemoryConfig holds the configuration of the in-memory store
+type MemoryConfig struct {
+	Index MemoryIndex // defaults to MemoryIndexFlat
+	// SnapshotPath is the file the store is loaded from when it exists, and saved to by
+	// Snapshot and Close. Empty keeps the store in memory only
+	SnapshotPath string
+}
+
+// Memory is an in-process Store, for tests and embedded use. Searches compare vectors by
+// cosine distance, like the default Postgres model
+type Memory struct {
+	mu     sync.RWMutex
+	config MemoryConfig
+	index  vecindex.Index
+
+	documents  map[int64]*memoryDocument
+	paths      map[string]int64
+	embeddings map[int64]*memoryEmbedding
+	nextID     int64
+}
+
+type memoryDocument struct {
+	ID        int64
+	FilePath  string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	DeletedAt *time.Time      // set while the document is in the trash
+	Versions  []memoryVersion // in order, the last current unless closed by an ingest
+}
+
+// memoryVersion is a version of a document, current while ValidTo is nil
+type memoryVersion struct {
+	Version   int32
+	ValidFrom time.Time
+	ValidTo   *time.Time
+}
+
+type memoryEmbedding struct {
+	ID            int64
+	DocumentID    int64
+	Vector        []float32
+	ChunkText     string
+	EmbeddingText *string
+	Metadata      []byte // JSON, as gob cannot encode arbitrary interface values
+	MetadataHash  string
+	CreatedAt     time.Time
+	// AllowedPrincipals restricts the chunk to these principals. Nil leaves it open
+	AllowedPrincipals []string
+	// ExpiresAt is when the chunk expires. Nil keeps it until deleted
+	ExpiresAt *time.Time
+	DeletedAt *time.Time // set while the chunk is in the trash
+	Version   int32      // the version of its document the chunk belongs to
+}
+
+type memorySnapshot struct {
+	Version    int
+	NextID     int64
+	Documents  []memoryDocument
+	Embeddings []memoryEmbedding
+}
+
+// NewMemory creates an in-memory store, loading its snapshot if one exists
+func NewMemory(config MemoryConfig) (*Memory, error) {
+	if config.Index == "" {
+		config.Index = MemoryIndexFlat
+	}
+
+	m := &Memory{config: config}
+	if err := m.reset(); err != nil {
+		return nil, err
+	}
+
+	if config.SnapshotPath != "" {
+		if err := m.load(config.SnapshotPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("failed to load snapshot: %w", err)
+		}
+	}
+	return m, nil
+}
+
+// reset empties the store
+func (m *Memory) reset() error {
+	switch m.config.Index {
+	case MemoryIndexFlat:
+		m.index = vecindex.NewFlat()
+	case MemoryIndexHNSW:
+		m.index = vecindex.NewHNSW()
+	default:
+		return fmt.Errorf("unsupported memory index: %s", m.config.Index)
+	}
+	m.documents = make(map[int64]*memoryDocument)
+	m.paths = make(map[string]int64)
+	m.embeddings = make(map[int64]*memoryEmbedding)
+	return nil
+}
+
+// Add stores a chunk in the current version of its document, opening the first version
+// of a new document
+func (m *Memory) Add(ctx context.Context, params AddParams) (*Embedding, error) {
+	embedding, metadata, err := newMemoryEmbedding(params)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	document := m.document(params.FilePath, now)
+	m.insert(embedding, document, document.currentVersion(now), now)
+	return embedding.record(metadata), nil
+}
+
+// Ingest stores the chunks of a file as a new version of its document. The current
+// version is closed, keeping its chunks for searches of the past, as in Postgres
+func (m *Memory) Ingest(
+	ctx context.Context,
+	filePath string,
+	params []AddParams,
+) (*DocumentVersion, error) {
+	embeddings := make([]*memoryEmbedding, len(params))
+	for i, p := range params {
+		embedding, _, err := newMemoryEmbedding(p)
+		if err != nil {
+			return nil, err
+		}
+		embeddings[i] = embedding
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// the old version ends where the new one begins
+	now := time.Now()
+	document := m.document(filePath, now)
+	if n := len(document.Versions); n > 0 && document.Versions[n-1].ValidTo == nil {
+		document.Versions[n-1].ValidTo = &now
+	}
+	version := document.currentVersion(now)
+	for _, embedding := range embeddings {
+		m.insert(embedding, document, version, now)
+	}
+
+	return &DocumentVersion{
+		DocumentID: document.ID,
+		Version:    version,
+		ValidFrom:  pgtype.Timestamptz{Time: now, Valid: true},
+	}, nil
+}
+
+// newMemoryEmbedding prepares a chunk for storing, returning it with its metadata
+func newMemoryEmbedding(params AddParams) (*memoryEmbedding, types.JSONMap, error) {
+	metadata := types.JSONMap{}
+	if params.Metadata != nil {
+		metadata = *params.Metadata
+	}
+	metadataJSON, err := json.Marshal(metadata)
+	if err != nil {
+		return nil, nil, err
+	}
+	// chunks without metadata match no filter, as in Postgres
+	metadataHash := ""
+	if params.Metadata != nil {
+		metadataHash, err = utils.CalculateMetadataHash(metadataJSON)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return &memoryEmbedding{
+		Vector:        append([]float32(nil), params.Embedding...),
+		ChunkText:     params.ChunkText,
+		EmbeddingText: params.EmbeddingText,
+		Metadata:      metadataJSON,
+		MetadataHash:  metadataHash,
+
+		AllowedPrincipals: append([]string(nil), params.AllowedPrincipals...),
+		ExpiresAt:         params.ExpiresAt,
+	}, metadata, nil
+}
+
+// document returns the document at a file path, creating it if there is none and taking
+// it out of the trash if it is there, as CreateDocument does in Postgres
+func (m *Memory) document(filePath string, now time.Time) *memoryDocument {
+	if documentID, ok := m.paths[filePath]; ok {
+		document := m.documents[documentID]
+		document.UpdatedAt = now
+		document.DeletedAt = nil
+		return document
+	}
+
+	m.nextID++
+	document := &memoryDocument{
+		ID:        m.nextID,
+		FilePath:  filePath,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	m.documents[document.ID] = document
+	m.paths[filePath] = document.ID
+	return document
+}
+
+// insert stores a prepared chunk in a version of a document
+func (m *Memory) insert(
+	embedding *memoryEmbedding,
+	document *memoryDocument,
+	version int32,
+	now time.Time,
+) {
+	m.nextID++
+	embedding.ID = m.nextID
+	embedding.DocumentID = document.ID
+	embedding.Version = version
+	embedding.CreatedAt = now
+	m.embeddings[embedding.ID] = embedding
+	m.index.Add(embedding.ID, embedding.Vector)
+}
+
+// currentVersion returns the number of the current version of a document, opening the
+// next one if it has none
+func (d *memoryDocument) currentVersion(now time.Time) int32 {
+	if n := len(d.Versions); n > 0 && d.Versions[n-1].ValidTo == nil {
+		return d.Versions[n-1].Version
+	}
+	version := int32(len(d.Versions) + 1)
+	d.Versions = append(d.Versions, memoryVersion{Version: version, ValidFrom: now})
+	return version
+}
+
+// validAt reports whether a version of the document was current at a moment
+func (d *memoryDocument) validAt(version int32, at time.Time) bool {
+	if version < 1 || int(version) > len(d.Versions) {
+		return false
+	}
+	v := d.Versions[version-1]
+	return !v.ValidFrom.After(at) && (v.ValidTo == nil || v.ValidTo.After(at))
+}
+
+func (e *memoryEmbedding) record(metadata types.JSONMap) *Embedding {
+	record := &Embedding{
+		ID:           e.ID,
+		DocumentID:   pgtype.Int8{Int64: e.DocumentID, Valid: true},
+		ModelName:    DefaultModelName,
+		Embedding:    pgvector.NewVector(e.Vector),
+		ChunkText:    e.ChunkText,
+		ChunkSize:    int32(utf8.RuneCountInString(e.ChunkText)),
+		CreatedAt:    pgtype.Timestamptz{Time: e.CreatedAt, Valid: true},
+		Metadata:     metadata,
+		MetadataHash: pgtype.Text{String: e.MetadataHash, Valid: true},
+
+		AllowedPrincipals: e.AllowedPrincipals,
+		ExpiresAt:         timestamptz(e.ExpiresAt),
+	}
+	if e.EmbeddingText != nil {
+		record.EmbeddingText = pgtype.Text{String: *e.EmbeddingText, Valid: true}
+	}
+	return record
+}
+
+func (e *memoryEmbedding) metadata() types.JSONMap {
+	metadata := types.JSONMap{}
+	if err := json.Unmarshal(e.Metadata, &metadata); err != nil {
+		return types.JSONMap{}
+	}
+	return metadata
+}
+
+// filter returns the search filter matching chunks with exactly the given metadata
+func (m *Memory) filter(metadata *types.JSONMap) (vecindex.Filter, error) {
+	if metadata == nil {
+		return nil, nil
+	}
+	metadataJSON, err := json.Marshal(metadata)
+	if err != nil {
+		return nil, err
+	}
+	hash, err := utils.CalculateMetadataHash(metadataJSON)
+	if err != nil {
+		return nil, err
+	}
+	return func(id int64) bool {
+		return m.embeddings[id].MetadataHash == hash
+	}, nil
+}
+
+// allowed reports whether a chunk is open to every caller or allows one of the principals
+func (e *memoryEmbedding) allowed(principals []string) bool {
+	if e.AllowedPrincipals == nil {
+		return true
+	}
+	for _, allowed := range e.AllowedPrincipals {
+		if slices.Contains(principals, allowed) {
+			return true
+		}
+	}
+	return false
+}
+
+// expired reports whether a chunk has expired by now
+func (e *memoryEmbedding) expired(now time.Time) bool {
+	return e.ExpiresAt != nil && !e.ExpiresAt.After(now)
+}
+
+// liveAt reports whether a chunk was part of the corpus at a moment: stored by then,
+// neither trashed nor expired, and of the version of its document current then
+func (m *Memory) liveAt(e *memoryEmbedding, at time.Time) bool {
+	if e.CreatedAt.After(at) || (e.DeletedAt != nil && !e.DeletedAt.After(at)) || e.expired(at) {
+		return false
+	}
+	return m.documents[e.DocumentID].validAt(e.Version, at)
+}
+
+// liveFilter narrows a filter to the chunks that were part of the corpus at a moment
+func (m *Memory) liveFilter(filter vecindex.Filter, at time.Time) vecindex.Filter {
+	return func(id int64) bool {
+		if filter != nil && !filter(id) {
+			return false
+		}
+		return m.liveAt(m.embeddings[id], at)
+	}
+}
+
+// accessFilter narrows a filter to the chunks the principals may retrieve
+func (m *Memory) accessFilter(filter vecindex.Filter, principals []string) vecindex.Filter {
+	return func(id int64) bool {
+		if filter != nil && !filter(id) {
+			return false
+		}
+		return m.embeddings[id].allowed(principals)
+	}
+}
+
+func (m *Memory) Search(
+	ctx context.Context,
+	request SearchRequest,
+) ([]FindTopKNNEmbeddingsRow, error) {
+	at := time.Now()
+	if request.AsOf != nil {
+		at = *request.AsOf
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	filter, err := m.filter(request.Metadata)
+	if err != nil {
+		return nil, err
+	}
+	filter = m.liveFilter(filter, at)
+
+	if request.Withheld != nil {
+		*request.Withheld = 0
+		for _, result := range m.index.Search(request.Embedding, int(request.K), filter) {
+			if !m.embeddings[result.ID].allowed(request.Principals) {
+				*request.Withheld++
+			}
+		}
+	}
+
+	results := m.index.Search(
+		request.Embedding,
+		int(request.K),
+		m.accessFilter(filter, request.Principals),
+	)
+	rows := make([]FindTopKNNEmbeddingsRow, len(results))
+	for i, result := range results {
+		embedding := m.embeddings[result.ID]
+		rows[i] = FindTopKNNEmbeddingsRow{
+			ID:         embedding.ID,
+			DocumentID: pgtype.Int8{Int64: embedding.DocumentID, Valid: true},
+			ChunkText:  embedding.ChunkText,
+			ChunkSize:  int32(utf8.RuneCountInString(embedding.ChunkText)),
+			FilePath:   m.documents[embedding.DocumentID].FilePath,
+			Metadata:   embedding.metadata(),
+			Distance:   result.Distance,
+			Similarity: 1 - result.Distance,
+		}
+	}
+	return rows, nil
+}
+
+func (m *Memory) List(ctx context.Context, request ListRequest) ([]ListChunksRow, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	filter, err := m.filter(request.Metadata)
+	if err != nil {
+		return nil, err
+	}
+	filter = m.accessFilter(m.liveFilter(filter, time.Now()), request.Principals)
+
+	var rows []ListChunksRow
+	for id, embedding := range m.embeddings {
+		if !filter(id) {
+			continue
+		}
+		rows = append(rows, ListChunksRow{
+			ID:         embedding.ID,
+			ChunkText:  embedding.ChunkText,
+			Metadata:   embedding.metadata(),
+			ChunkSize:  int32(utf8.RuneCountInString(embedding.ChunkText)),
+			ModelName:  DefaultModelName,
+			CreatedAt:  pgtype.Timestamptz{Time: embedding.CreatedAt, Valid: true},
+			FilePath:   m.documents[embedding.DocumentID].FilePath,
+			DocumentID: embedding.DocumentID,
+
+			AllowedPrincipals: embedding.AllowedPrincipals,
+			ExpiresAt:         timestamptz(embedding.ExpiresAt),
+		})
+	}
+
+	sort.Slice(rows, func(i, j int) bool {
+		if !rows[i].CreatedAt.Time.Equal(rows[j].CreatedAt.Time) {
+			return rows[i].CreatedAt.Time.After(rows[j].CreatedAt.Time)
+		}
+		return rows[i].ID > rows[j].ID
+	})
+	return rows, nil
+}
+
+// selectEmbeddings returns the chunks matching a predicate with the stats of removing them
+func (m *Memory) selectEmbeddings(
+	match func(*memoryEmbedding) bool,
+) ([]*memoryEmbedding, *DeletionStats) {
+	var selected []*memoryEmbedding
+	stats := &DeletionStats{FilePaths: []string{}}
+	documents := make(map[int64]struct{})
+	for _, embedding := range m.embeddings {
+		if !match(embedding) {
+			continue
+		}
+		selected = append(selected, embedding)
+		stats.TotalBytes += int64(utf8.RuneCountInString(embedding.ChunkText))
+		if _, ok := documents[embedding.DocumentID]; !ok {
+			documents[embedding.DocumentID] = struct{}{}
+			stats.FilePaths = append(stats.FilePaths, m.documents[embedding.DocumentID].FilePath)
+		}
+	}
+	sort.Strings(stats.FilePaths)
+	stats.EmbeddingCount = int64(len(selected))
+	stats.DocumentCount = int64(len(documents))
+	return selected, stats
+}
+
+func (m *Memory) Delete(ctx context.Context, dryRun bool) (*DeletionStats, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	selected, trashed := m.selectEmbeddings(func(e *memoryEmbedding) bool {
+		return e.DeletedAt == nil
+	})
+	// count what searches would return, as the Postgres store does, but list every
+	// document the trash touches
+	_, stats := m.selectEmbeddings(func(e *memoryEmbedding) bool {
+		return m.liveAt(e, now)
+	})
+	stats.FilePaths = trashed.FilePaths
+	if dryRun {
+		return stats, nil
+	}
+
+	for _, embedding := range selected {
+		embedding.DeletedAt = &now
+		m.documents[embedding.DocumentID].DeletedAt = &now
+	}
+	return stats, nil
+}
+
+func (m *Memory) DeleteDocument(ctx context.Context, filePath string) (*DeletionStats, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	documentID, ok := m.paths[filePath]
+	if !ok {
+		return &DeletionStats{FilePaths: []string{}}, nil
+	}
+	selected, stats := m.selectEmbeddings(func(e *memoryEmbedding) bool {
+		return e.DocumentID == documentID && e.DeletedAt == nil
+	})
+
+	now := time.Now()
+	for _, embedding := range selected {
+		embedding.DeletedAt = &now
+		m.documents[documentID].DeletedAt = &now
+	}
+	return stats, nil
+}
+
+func (m *Memory) RenameDocument(ctx context.Context, filePath string, newFilePath string) error {
+	if newFilePath == "" {
+		return errors.New("file path is required")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	documentID, ok := m.paths[filePath]
+	if !ok || m.documents[documentID].DeletedAt != nil {
+		return fmt.Errorf("%w: %s", ErrDocumentNotFound, filePath)
+	}
+	if _, taken := m.paths[newFilePath]; taken {
+		return fmt.Errorf("file path %s is taken", newFilePath)
+	}
+
+	document := m.documents[documentID]
+	document.FilePath = newFilePath
+	document.UpdatedAt = time.Now()
+	delete(m.paths, filePath)
+	m.paths[newFilePath] = documentID
+	return nil
+}
+
+func (m *Memory) Restore(
+	ctx context.Context,
+	within time.Duration,
+	dryRun bool,
+) (*DeletionStats, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	selected, stats := m.selectEmbeddings(func(e *memoryEmbedding) bool {
+		return e.DeletedAt != nil && (within <= 0 || now.Sub(*e.DeletedAt) <= within)
+	})
+	if dryRun {
+		return stats, nil
+	}
+
+	for _, embedding := range selected {
+		embedding.DeletedAt = nil
+		m.documents[embedding.DocumentID].DeletedAt = nil
+	}
+	return stats, nil
+}
+
+// EmptyTrash removes the trashed chunks, and the documents left without chunks, as the
+// Postgres trigger does
+func (m *Memory) EmptyTrash(
+	ctx context.Context,
+	olderThan time.Duration,
+	dryRun bool,
+) (*DeletionStats, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	selected, stats := m.selectEmbeddings(func(e *memoryEmbedding) bool {
+		return e.DeletedAt != nil && (olderThan <= 0 || now.Sub(*e.DeletedAt) >= olderThan)
+	})
+	if dryRun {
+		return stats, nil
+	}
+
+	for _, embedding := range selected {
+		delete(m.embeddings, embedding.ID)
+		m.index.Remove(embedding.ID)
+	}
+	m.removeEmptyDocuments()
+	return stats, nil
+}
+
+// removeEmptyDocuments removes the documents that no longer have any chunks
+func (m *Memory) removeEmptyDocuments() {
+	remaining := make(map[int64]bool, len(m.documents))
+	for _, embedding := range m.embeddings {
+		remaining[embedding.DocumentID] = true
+	}
+	for id, document := range m.documents {
+		if !remaining[id] {
+			delete(m.paths, document.FilePath)
+			delete(m.documents, id)
+		}
+	}
+}
+
+func (m *Memory) Stats(ctx context.Context) (*GetStatsRow, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	now := time.Now()
+	stats := &GetStatsRow{}
+	var totalBytes int64
+	for _, embedding := range m.embeddings {
+		if m.liveAt(embedding, now) {
+			stats.ChunkCount++
+			totalBytes += int64(utf8.RuneCountInString(embedding.ChunkText))
+		}
+	}
+	for _, document := range m.documents {
+		if document.DeletedAt == nil {
+			stats.DocumentCount++
+		}
+	}
+	stats.TotalBytes = totalBytes
+	return stats, nil
+}
+
+// Vacuum removes the expired chunks, and the documents left without chunks, as the
+// Postgres trigger does. The store is small enough to vacuum in a single batch
+func (m *Memory) Vacuum(ctx context.Context, batchSize int) (*VacuumStats, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	stats := &VacuumStats{}
+	affected := make(map[int64]struct{})
+	for id, embedding := range m.embeddings {
+		if !embedding.expired(now) {
+			continue
+		}
+		stats.EmbeddingCount++
+		stats.TotalBytes += int64(utf8.RuneCountInString(embedding.ChunkText))
+		affected[embedding.DocumentID] = struct{}{}
+		delete(m.embeddings, id)
+		m.index.Remove(id)
+	}
+	if stats.EmbeddingCount == 0 {
+		return stats, nil
+	}
+	stats.Batches = 1
+
+	remaining := make(map[int64]bool, len(affected))
+	for _, embedding := range m.embeddings {
+		remaining[embedding.DocumentID] = true
+	}
+	for documentID := range affected {
+		document := m.documents[documentID]
+		stats.FilePaths = append(stats.FilePaths, document.FilePath)
+		if !remaining[documentID] {
+			stats.DocumentCount++
+			delete(m.paths, document.FilePath)
+			delete(m.documents, documentID)
+		}
+	}
+	sort.Strings(stats.FilePaths)
+	return stats, nil
+}
+
+func (m *Memory) Vectors(ctx context.Context, ids []int64) (map[int64][]float32, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	vectors := make(map[int64][]float32, len(ids))
+	for _, id := range ids {
+		if embedding, ok := m.embeddings[id]; ok && embedding.DeletedAt == nil {
+			vectors[id] = append([]float32(nil), embedding.Vector...)
+		}
+	}
+	return vectors, nil
+}
+
+// Snapshot saves the store to its snapshot path. The file is replaced atomically, so a
+// failed snapshot leaves the previous one intact
+func (m *Memory) Snapshot() error {
+	if m.config.SnapshotPath == "" {
+		return errors.New("no snapshot path configured")
+	}
+
+	m.mu.RLock()
+	snapshot := memorySnapshot{
+		Version:    snapshotVersion,
+		NextID:     m.nextID,
+		Documents:  make([]memoryDocument, 0, len(m.documents)),
+		Embeddings: make([]memoryEmbedding, 0, len(m.embeddings)),
+	}
+	for _, document := range m.documents {
+		snapshot.Documents = append(snapshot.Documents, *document)
+	}
+	for _, embedding := range m.embeddings {
+		snapshot.Embeddings = append(snapshot.Embeddings, *embedding)
+	}
+	m.mu.RUnlock()
+
+	// insertion order keeps HNSW graphs reproducible across loads
+	sort.Slice(snapshot.Embeddings, func(i, j int) bool {
+		return snapshot.Embeddings[i].ID < snapshot.Embeddings[j].ID
+	})
+
+	tmp, err := os.CreateTemp(filepath.Dir(m.config.SnapshotPath), ".dynarag-snapshot-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := gob.NewEncoder(tmp).Encode(snapshot); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), m.config.SnapshotPath)
+}
+
+// load replaces the contents of the store with a snapshot
+func (m *Memory) load(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var snapshot memorySnapshot
+	if err := gob.NewDecoder(file).Decode(&snapshot); err != nil {
+		return err
+	}
+	if snapshot.Version != snapshotVersion {
+		return fmt.Errorf("unsupported snapshot version %d", snapshot.Version)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.reset(); err != nil {
+		return err
+	}
+	m.nextID = snapshot.NextID
+	for i := range snapshot.Documents {
+		document := snapshot.Documents[i]
+		// snapshots taken before document versions hold a single version of each
+		if len(document.Versions) == 0 {
+			document.Versions = []memoryVersion{{Version: 1, ValidFrom: document.CreatedAt}}
+		}
+		m.documents[document.ID] = &document
+		m.paths[document.FilePath] = document.ID
+	}
+	for i := range snapshot.Embeddings {
+		embedding := snapshot.Embeddings[i]
+		if embedding.Version == 0 {
+			embedding.Version = 1
+		}
+		m.embeddings[embedding.ID] = &embedding
+		m.index.Add(embedding.ID, embedding.Vector)
+	}
+	return nil
+}
+
+// Collection returns the store itself for the default collection. The memory backend
+// holds a single corpus, so other collections are unsupported
+func (m *Memory) Collection(name string) (Store, error) {
+	if name != DefaultCollection {
+		return nil, fmt.Errorf("collection %q: %w", name, ErrUnsupported)
+	}
+	return m, nil
+}
+
+// Tenant returns the store itself for the default tenant. The memory backend holds a
+// single corpus, so other tenants are unsupported
+func (m *Memory) Tenant(id string) (Store, error) {
+	if id != DefaultTenant {
+		return nil, fmt.Errorf("tenant %q: %w", id, ErrUnsupported)
+	}
+	return m, nil
+}
+
+// Close saves a snapshot if a snapshot path is configured
+func (m *Memory) Close() error {
+	if m.config.SnapshotPath == "" {
+		return nil
+	}
+	return m.Snapshot()
+}
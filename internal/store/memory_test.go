@@ -0,0 +1,361 @@
+package store
+
+import (
+	"context"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Predixus/DynaRAG/types"
+)
+
+func TestMemoryStore(t *testing.T) {
+	ctx := context.Background()
+
+	for _, index := range []MemoryIndex{MemoryIndexFlat, MemoryIndexHNSW} {
+		t.Run(string(index), func(t *testing.T) {
+			snapshot := filepath.Join(t.TempDir(), "store.snapshot")
+			memory, err := NewMemory(MemoryConfig{Index: index, SnapshotPath: snapshot})
+			require.NoError(t, err)
+
+			tagged := types.JSONMap{"lang": "en"}
+			chunks := []AddParams{
+				{FilePath: "a.txt", ChunkText: "north", Embedding: []float32{0, 1}, Metadata: &tagged},
+				{FilePath: "a.txt", ChunkText: "east", Embedding: []float32{1, 0}},
+				{FilePath: "b.txt", ChunkText: "north east", Embedding: []float32{1, 1}, Metadata: &tagged},
+			}
+			for _, chunk := range chunks {
+				_, err := memory.Add(ctx, chunk)
+				require.NoError(t, err)
+			}
+
+			rows, err := memory.Search(ctx, SearchRequest{Embedding: []float32{0.1, 1}, K: 2})
+			require.NoError(t, err)
+			require.Len(t, rows, 2)
+			assert.Equal(t, "north", rows[0].ChunkText)
+			assert.Equal(t, "north east", rows[1].ChunkText)
+			assert.Greater(t, rows[0].Similarity, rows[1].Similarity)
+
+			rows, err = memory.Search(ctx, SearchRequest{Embedding: []float32{1, 0}, K: 3, Metadata: &tagged})
+			require.NoError(t, err)
+			assert.Len(t, rows, 2)
+
+			listed, err := memory.List(ctx, ListRequest{})
+			require.NoError(t, err)
+			assert.Len(t, listed, 3)
+
+			stats, err := memory.Stats(ctx)
+			require.NoError(t, err)
+			assert.Equal(t, int64(2), stats.DocumentCount)
+			assert.Equal(t, int64(3), stats.ChunkCount)
+			assert.Equal(t, int64(19), stats.TotalBytes)
+
+			require.NoError(t, memory.Close())
+
+			reloaded, err := NewMemory(MemoryConfig{Index: index, SnapshotPath: snapshot})
+			require.NoError(t, err)
+			rows, err = reloaded.Search(ctx, SearchRequest{Embedding: []float32{1, 0}, K: 1})
+			require.NoError(t, err)
+			require.Len(t, rows, 1)
+			assert.Equal(t, "east", rows[0].ChunkText)
+			assert.Equal(t, "a.txt", rows[0].FilePath)
+
+			deleted, err := reloaded.Delete(ctx, true)
+			require.NoError(t, err)
+			assert.Equal(t, int64(3), deleted.EmbeddingCount)
+			assert.Equal(t, []string{"a.txt", "b.txt"}, deleted.FilePaths)
+
+			_, err = reloaded.Delete(ctx, false)
+			require.NoError(t, err)
+			stats, err = reloaded.Stats(ctx)
+			require.NoError(t, err)
+			assert.Equal(t, int64(0), stats.ChunkCount)
+		})
+	}
+}
+
+func TestMemoryStoreAccessControl(t *testing.T) {
+	ctx := context.Background()
+
+	memory, err := NewMemory(MemoryConfig{})
+	require.NoError(t, err)
+
+	chunks := []AddParams{
+		{FilePath: "hr.txt", ChunkText: "salaries", Embedding: []float32{1, 0}, AllowedPrincipals: []string{"group:hr"}},
+		{FilePath: "legal.txt", ChunkText: "contracts", Embedding: []float32{1, 0.1}, AllowedPrincipals: []string{"group:legal", "user:ada"}},
+		{FilePath: "handbook.txt", ChunkText: "holidays", Embedding: []float32{1, 0.2}},
+		{FilePath: "handbook.txt", ChunkText: "parking", Embedding: []float32{0, 1}},
+	}
+	for _, chunk := range chunks {
+		_, err := memory.Add(ctx, chunk)
+		require.NoError(t, err)
+	}
+
+	tests := []struct {
+		name       string
+		principals []string
+		want       []string
+		withheld   int
+	}{
+		{name: "anonymous", principals: nil, want: []string{"holidays", "parking"}, withheld: 2},
+		{name: "hr group", principals: []string{"user:bob", "group:hr"}, want: []string{"salaries", "holidays"}, withheld: 1},
+		{name: "named user", principals: []string{"user:ada"}, want: []string{"contracts", "holidays"}, withheld: 1},
+		{name: "both groups", principals: []string{"group:hr", "group:legal"}, want: []string{"salaries", "contracts"}, withheld: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var withheld int
+			rows, err := memory.Search(ctx, SearchRequest{
+				Embedding:  []float32{1, 0},
+				K:          2,
+				Principals: tt.principals,
+				Withheld:   &withheld,
+			})
+			require.NoError(t, err)
+
+			texts := make([]string, len(rows))
+			for i, row := range rows {
+				texts[i] = row.ChunkText
+			}
+			assert.Equal(t, tt.want, texts)
+			assert.Equal(t, tt.withheld, withheld)
+
+			listed, err := memory.List(ctx, ListRequest{Principals: tt.principals})
+			require.NoError(t, err)
+			assert.Len(t, listed, 4-countRestricted(chunks, tt.principals))
+		})
+	}
+}
+
+// countRestricted counts the chunks the principals may not see
+func countRestricted(chunks []AddParams, principals []string) int {
+	restricted := 0
+	for _, chunk := range chunks {
+		embedding := memoryEmbedding{AllowedPrincipals: chunk.AllowedPrincipals}
+		if !embedding.allowed(principals) {
+			restricted++
+		}
+	}
+	return restricted
+}
+
+func TestMemoryStoreExpiry(t *testing.T) {
+	ctx := context.Background()
+
+	memory, err := NewMemory(MemoryConfig{})
+	require.NoError(t, err)
+
+	past, future := time.Now().Add(-time.Minute), time.Now().Add(time.Hour)
+	chunks := []AddParams{
+		{FilePath: "incident.txt", ChunkText: "outage", Embedding: []float32{1, 0}, ExpiresAt: &past},
+		{FilePath: "daily.txt", ChunkText: "standup", Embedding: []float32{1, 0.1}, ExpiresAt: &past},
+		{FilePath: "daily.txt", ChunkText: "retro", Embedding: []float32{1, 0.2}, ExpiresAt: &future},
+		{FilePath: "handbook.txt", ChunkText: "holidays", Embedding: []float32{0, 1}},
+	}
+	for _, chunk := range chunks {
+		_, err := memory.Add(ctx, chunk)
+		require.NoError(t, err)
+	}
+
+	rows, err := memory.Search(ctx, SearchRequest{Embedding: []float32{1, 0}, K: 4})
+	require.NoError(t, err)
+	texts := make([]string, len(rows))
+	for i, row := range rows {
+		texts[i] = row.ChunkText
+	}
+	assert.Equal(t, []string{"retro", "holidays"}, texts)
+
+	listed, err := memory.List(ctx, ListRequest{})
+	require.NoError(t, err)
+	assert.Len(t, listed, 2)
+
+	live, err := memory.Stats(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), live.ChunkCount)
+	assert.Equal(t, int64(len("retro")+len("holidays")), live.TotalBytes)
+
+	stats, err := memory.Vacuum(ctx, DefaultVacuumBatchSize)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), stats.EmbeddingCount)
+	assert.Equal(t, int64(1), stats.DocumentCount)
+	assert.Equal(t, int64(len("outage")+len("standup")), stats.TotalBytes)
+	assert.Equal(t, []string{"daily.txt", "incident.txt"}, stats.FilePaths)
+
+	remaining, err := memory.Stats(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), remaining.ChunkCount)
+	assert.Equal(t, int64(2), remaining.DocumentCount)
+
+	stats, err = memory.Vacuum(ctx, DefaultVacuumBatchSize)
+	require.NoError(t, err)
+	assert.Zero(t, stats.EmbeddingCount)
+}
+
+func TestMemoryStoreTrash(t *testing.T) {
+	ctx := context.Background()
+
+	memory, err := NewMemory(MemoryConfig{})
+	require.NoError(t, err)
+
+	chunks := []AddParams{
+		{FilePath: "a.txt", ChunkText: "north", Embedding: []float32{0, 1}},
+		{FilePath: "b.txt", ChunkText: "east", Embedding: []float32{1, 0}},
+	}
+	for _, chunk := range chunks {
+		_, err := memory.Add(ctx, chunk)
+		require.NoError(t, err)
+	}
+
+	_, err = memory.Delete(ctx, false)
+	require.NoError(t, err)
+
+	rows, err := memory.Search(ctx, SearchRequest{Embedding: []float32{1, 0}, K: 2})
+	require.NoError(t, err)
+	assert.Empty(t, rows)
+
+	restorable, err := memory.Restore(ctx, time.Hour, true)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), restorable.EmbeddingCount)
+	assert.Equal(t, []string{"a.txt", "b.txt"}, restorable.FilePaths)
+
+	expired, err := memory.EmptyTrash(ctx, time.Hour, true)
+	require.NoError(t, err)
+	assert.Zero(t, expired.EmbeddingCount)
+
+	restored, err := memory.Restore(ctx, 0, false)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), restored.EmbeddingCount)
+
+	stats, err := memory.Stats(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), stats.ChunkCount)
+	assert.Equal(t, int64(2), stats.DocumentCount)
+
+	// a chunk added after the purge keeps its document out of the trash
+	_, err = memory.Delete(ctx, false)
+	require.NoError(t, err)
+	_, err = memory.Add(ctx, AddParams{FilePath: "a.txt", ChunkText: "south", Embedding: []float32{0, -1}})
+	require.NoError(t, err)
+
+	emptied, err := memory.EmptyTrash(ctx, 0, false)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), emptied.EmbeddingCount)
+	assert.Equal(t, int64(9), emptied.TotalBytes)
+
+	stats, err = memory.Stats(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), stats.ChunkCount)
+	assert.Equal(t, int64(1), stats.DocumentCount)
+
+	restored, err = memory.Restore(ctx, 0, false)
+	require.NoError(t, err)
+	assert.Zero(t, restored.EmbeddingCount)
+}
+
+func TestMemoryStoreDocuments(t *testing.T) {
+	ctx := context.Background()
+
+	memory, err := NewMemory(MemoryConfig{})
+	require.NoError(t, err)
+
+	chunks := []AddParams{
+		{FilePath: "a.txt", ChunkText: "north", Embedding: []float32{0, 1}},
+		{FilePath: "a.txt", ChunkText: "west", Embedding: []float32{-1, 0}},
+		{FilePath: "b.txt", ChunkText: "east", Embedding: []float32{1, 0}},
+	}
+	for _, chunk := range chunks {
+		_, err := memory.Add(ctx, chunk)
+		require.NoError(t, err)
+	}
+
+	require.NoError(t, memory.RenameDocument(ctx, "a.txt", "c.txt"))
+	assert.ErrorIs(t, memory.RenameDocument(ctx, "a.txt", "d.txt"), ErrDocumentNotFound)
+	assert.Error(t, memory.RenameDocument(ctx, "c.txt", "b.txt"))
+
+	deleted, err := memory.DeleteDocument(ctx, "c.txt")
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), deleted.EmbeddingCount)
+	assert.Equal(t, []string{"c.txt"}, deleted.FilePaths)
+
+	rows, err := memory.List(ctx, ListRequest{})
+	require.NoError(t, err)
+	require.Len(t, rows, 1)
+	assert.Equal(t, "b.txt", rows[0].FilePath)
+
+	restored, err := memory.Restore(ctx, 0, false)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"c.txt"}, restored.FilePaths)
+}
+
+func TestMemoryStoreVersions(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "store.snapshot")
+
+	memory, err := NewMemory(MemoryConfig{SnapshotPath: path})
+	require.NoError(t, err)
+
+	before := time.Now()
+	first, err := memory.Ingest(ctx, "a.txt", []AddParams{
+		{ChunkText: "north", Embedding: []float32{0, 1}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), first.Version)
+
+	between := time.Now()
+	second, err := memory.Ingest(ctx, "a.txt", []AddParams{
+		{ChunkText: "east", Embedding: []float32{1, 0}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, first.DocumentID, second.DocumentID)
+	assert.Equal(t, int32(2), second.Version)
+
+	// chunks added later join the current version
+	_, err = memory.Add(ctx, AddParams{FilePath: "a.txt", ChunkText: "west", Embedding: []float32{-1, 0}})
+	require.NoError(t, err)
+
+	search := func(asOf *time.Time) []string {
+		t.Helper()
+		rows, err := memory.Search(ctx, SearchRequest{Embedding: []float32{0, 1}, K: 10, AsOf: asOf})
+		require.NoError(t, err)
+		var texts []string
+		for _, row := range rows {
+			texts = append(texts, row.ChunkText)
+		}
+		slices.Sort(texts)
+		return texts
+	}
+	assert.Equal(t, []string{"east", "west"}, search(nil))
+	assert.Equal(t, []string{"north"}, search(&between))
+	assert.Empty(t, search(&before))
+
+	rows, err := memory.List(ctx, ListRequest{})
+	require.NoError(t, err)
+	assert.Len(t, rows, 2)
+
+	// the stats and the trash only count the current version
+	stats, err := memory.Stats(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), stats.ChunkCount)
+	trashed, err := memory.Delete(ctx, true)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), trashed.EmbeddingCount)
+	assert.Equal(t, int64(len("east")+len("west")), trashed.TotalBytes)
+
+	// versions survive a snapshot
+	require.NoError(t, memory.Close())
+	memory, err = NewMemory(MemoryConfig{SnapshotPath: path})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"north"}, search(&between))
+
+	// chunks trashed after a moment are still found in a search of it
+	afterSecond := time.Now()
+	_, err = memory.DeleteDocument(ctx, "a.txt")
+	require.NoError(t, err)
+	assert.Empty(t, search(nil))
+	assert.Equal(t, []string{"north"}, search(&between))
+	assert.Equal(t, []string{"east", "west"}, search(&afterSecond))
+}
@@ -13,6 +13,49 @@ import (
 	"github.com/pgvector/pgvector-go"
 )
 
+type DistanceMetric string
+
+const (
+	DistanceMetricCosine       DistanceMetric = "cosine"
+	DistanceMetricInnerProduct DistanceMetric = "inner_product"
+	DistanceMetricL2           DistanceMetric = "l2"
+)
+
+func (e *DistanceMetric) Scan(src interface{}) error {
+	switch s := src.(type) {
+	case []byte:
+		*e = DistanceMetric(s)
+	case string:
+		*e = DistanceMetric(s)
+	default:
+		return fmt.Errorf("unsupported scan type for DistanceMetric: %T", src)
+	}
+	return nil
+}
+
+type NullDistanceMetric struct {
+	DistanceMetric DistanceMetric
+	Valid          bool // Valid is true if DistanceMetric is not NULL
+}
+
+// Scan implements the Scanner interface.
+func (ns *NullDistanceMetric) Scan(value interface{}) error {
+	if value == nil {
+		ns.DistanceMetric, ns.Valid = "", false
+		return nil
+	}
+	ns.Valid = true
+	return ns.DistanceMetric.Scan(value)
+}
+
+// Value implements the driver Valuer interface.
+func (ns NullDistanceMetric) Value() (driver.Value, error) {
+	if !ns.Valid {
+		return nil, nil
+	}
+	return string(ns.DistanceMetric), nil
+}
+
 type EmbeddingModel string
 
 const (
@@ -56,23 +99,160 @@ func (ns NullEmbeddingModel) Value() (driver.Value, error) {
 	return string(ns.EmbeddingModel), nil
 }
 
+type Quantization string
+
+const (
+	QuantizationNone    Quantization = "none"
+	QuantizationHalfvec Quantization = "halfvec"
+	QuantizationBinary  Quantization = "binary"
+)
+
+func (e *Quantization) Scan(src interface{}) error {
+	switch s := src.(type) {
+	case []byte:
+		*e = Quantization(s)
+	case string:
+		*e = Quantization(s)
+	default:
+		return fmt.Errorf("unsupported scan type for Quantization: %T", src)
+	}
+	return nil
+}
+
+type NullQuantization struct {
+	Quantization Quantization
+	Valid        bool // Valid is true if Quantization is not NULL
+}
+
+// Scan implements the Scanner interface.
+func (ns *NullQuantization) Scan(value interface{}) error {
+	if value == nil {
+		ns.Quantization, ns.Valid = "", false
+		return nil
+	}
+	ns.Valid = true
+	return ns.Quantization.Scan(value)
+}
+
+// Value implements the driver Valuer interface.
+func (ns NullQuantization) Value() (driver.Value, error) {
+	if !ns.Valid {
+		return nil, nil
+	}
+	return string(ns.Quantization), nil
+}
+
+type AuditLog struct {
+	ID         int64
+	OccurredAt pgtype.Timestamptz
+	Operation  string
+	Principal  string
+	Groups     []string
+	Collection string
+	FilePaths  []string
+	ChunkIds   []int64
+	Query      string
+	Filter     types.JSONMap
+	PrevHash   pgtype.Text
+	Hash       pgtype.Text
+	TenantID   string
+}
+
+type Collection struct {
+	ID        int64
+	Name      string
+	CreatedAt pgtype.Timestamptz
+	UpdatedAt pgtype.Timestamptz
+	TenantID  string
+}
+
 type Document struct {
 	ID             int64
 	FilePath       string
 	TotalChunkSize pgtype.Int8
 	CreatedAt      pgtype.Timestamptz
 	UpdatedAt      pgtype.Timestamptz
+	CollectionID   int64
+	TenantID       string
+	DeletedAt      pgtype.Timestamptz
+}
+
+type DocumentVersion struct {
+	ID         int64
+	DocumentID int64
+	Version    int32
+	ValidFrom  pgtype.Timestamptz
+	ValidTo    pgtype.Timestamptz
+	TenantID   string
 }
 
 type Embedding struct {
-	ID            int64
-	DocumentID    pgtype.Int8
-	ModelName     EmbeddingModel
-	Embedding     pgvector.Vector
-	ChunkText     string
-	ChunkSize     int32
-	CreatedAt     pgtype.Timestamptz
-	Metadata      types.JSONMap
-	MetadataHash  pgtype.Text
-	EmbeddingText pgtype.Text
+	ID                int64
+	DocumentID        pgtype.Int8
+	ModelName         EmbeddingModel
+	Embedding         pgvector.Vector
+	ChunkText         string
+	ChunkSize         int32
+	CreatedAt         pgtype.Timestamptz
+	Metadata          types.JSONMap
+	MetadataHash      pgtype.Text
+	EmbeddingText     pgtype.Text
+	TenantID          string
+	AllowedPrincipals []string
+	ExpiresAt         pgtype.Timestamptz
+	DeletedAt         pgtype.Timestamptz
+	VersionID         pgtype.Int8
+}
+
+type GitIngest struct {
+	ID           int64
+	CollectionID int64
+	Repository   string
+	CommitSha    string
+	IngestedAt   pgtype.Timestamptz
+	TenantID     string
+}
+
+type Message struct {
+	ID        int64
+	SessionID int64
+	Role      string
+	Content   string
+	ChunkIds  []int64
+	CreatedAt pgtype.Timestamptz
+	TenantID  string
+}
+
+type ModelRegistration struct {
+	ModelName    EmbeddingModel
+	Dimensions   int32
+	Metric       DistanceMetric
+	CreatedAt    pgtype.Timestamptz
+	UpdatedAt    pgtype.Timestamptz
+	Quantization Quantization
+}
+
+type QueryUsage struct {
+	ID                 int64
+	Provider           string
+	Model              string
+	PromptTokens       int32
+	CompletionTokens   int32
+	TotalTokens        int32
+	LatencyMs          int64
+	TimeToFirstTokenMs int64
+	FinishReason       pgtype.Text
+	Cost               pgtype.Float8
+	CreatedAt          pgtype.Timestamptz
+	TenantID           string
+}
+
+type Session struct {
+	ID              int64
+	Title           pgtype.Text
+	Summary         pgtype.Text
+	SummarisedUntil int64
+	CreatedAt       pgtype.Timestamptz
+	UpdatedAt       pgtype.Timestamptz
+	TenantID        string
 }
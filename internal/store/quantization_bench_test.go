@@ -0,0 +1,217 @@
+package store
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/pgvector/pgvector-go"
+)
+
+const (
+	benchK       = 10
+	benchQueries = 50
+	benchDocPath = "dynarag-quantization-bench"
+)
+
+// BenchmarkQuantizedSearch compares the latency and recall@10 of searches over full
+// precision, halfvec and binary indexes. Recall is measured against an exact search with
+// index scans disabled, using stored vectors as queries.
+//
+// It needs a scratch database with the migrations applied, given by
+// DYNARAG_BENCH_POSTGRES. Set DYNARAG_BENCH_ROWS to top the corpus up with random unit
+// vectors, which are removed afterwards. The index of the default model is rebuilt for
+// each mode and restored at the end
+func BenchmarkQuantizedSearch(b *testing.B) {
+	connStr := os.Getenv("DYNARAG_BENCH_POSTGRES")
+	if connStr == "" {
+		b.Skip("DYNARAG_BENCH_POSTGRES not set")
+	}
+	ctx := context.Background()
+
+	conn, err := pgx.Connect(ctx, connStr)
+	if err != nil {
+		b.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close(ctx)
+
+	original, err := New(conn).GetModelRegistration(ctx, DefaultModelName)
+	if err != nil {
+		b.Fatalf("Failed to get model registration: %v", err)
+	}
+
+	if rows := os.Getenv("DYNARAG_BENCH_ROWS"); rows != "" {
+		n, err := strconv.Atoi(rows)
+		if err != nil {
+			b.Fatalf("Invalid DYNARAG_BENCH_ROWS: %v", err)
+		}
+		seedBenchVectors(b, ctx, conn, n, int(original.Dimensions))
+		defer func() {
+			if _, err := conn.Exec(ctx, "DELETE FROM documents WHERE file_path = $1", benchDocPath); err != nil {
+				b.Errorf("Failed to remove benchmark vectors: %v", err)
+			}
+		}()
+	}
+
+	queries := sampleBenchQueries(b, ctx, conn)
+	truth := make([]map[int64]bool, len(queries))
+	for i, query := range queries {
+		truth[i] = exactNeighbours(b, ctx, conn, query)
+	}
+
+	defer func() {
+		if _, err := SetQuantization(ctx, connStr, DefaultModelName, original.Quantization); err != nil {
+			b.Errorf("Failed to restore quantization: %v", err)
+		}
+		if _, err := RebuildIndex(ctx, connStr, IndexHNSW, IndexParams{}); err != nil {
+			b.Errorf("Failed to restore index: %v", err)
+		}
+	}()
+
+	for _, mode := range []Quantization{QuantizationNone, QuantizationHalfvec, QuantizationBinary} {
+		if _, err := SetQuantization(ctx, connStr, DefaultModelName, mode); err != nil {
+			b.Fatalf("Failed to set quantization %s: %v", mode, err)
+		}
+		start := time.Now()
+		if _, err := RebuildIndex(ctx, connStr, IndexHNSW, IndexParams{}); err != nil {
+			b.Fatalf("Failed to build %s index: %v", mode, err)
+		}
+		build := time.Since(start)
+
+		b.Run(string(mode), func(b *testing.B) {
+			hits, total := 0, 0
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				q := i % len(queries)
+				rows, err := GetTopKEmbeddingsByVector(ctx, connStr, DefaultScope, SearchRequest{
+					Embedding: queries[q],
+					K:         benchK,
+				})
+				if err != nil {
+					b.Fatalf("Search failed: %v", err)
+				}
+				for _, row := range rows {
+					if truth[q][row.ID] {
+						hits++
+					}
+				}
+				total += len(truth[q])
+			}
+			b.StopTimer()
+			b.ReportMetric(float64(hits)/float64(max(total, 1)), "recall@10")
+			b.ReportMetric(build.Seconds(), "index-build-s")
+		})
+	}
+}
+
+func seedBenchVectors(b *testing.B, ctx context.Context, conn *pgx.Conn, n int, dims int) {
+	b.Helper()
+
+	var documentID int64
+	err := conn.QueryRow(
+		ctx,
+		`INSERT INTO documents (collection_id, file_path)
+		SELECT id, $2 FROM collections WHERE name = $1
+		RETURNING id`,
+		DefaultCollection,
+		benchDocPath,
+	).Scan(&documentID)
+	if err != nil {
+		b.Fatalf("Failed to create benchmark document: %v", err)
+	}
+
+	rng := rand.New(rand.NewSource(1))
+	rows := make([][]interface{}, n)
+	for i := range rows {
+		vector := make([]float32, dims)
+		var norm float64
+		for j := range vector {
+			vector[j] = float32(rng.NormFloat64())
+			norm += float64(vector[j] * vector[j])
+		}
+		for j := range vector {
+			vector[j] /= float32(math.Sqrt(norm))
+		}
+		rows[i] = []interface{}{documentID, DefaultModelName, pgvector.NewVector(vector), "bench", 5}
+	}
+
+	_, err = conn.CopyFrom(
+		ctx,
+		pgx.Identifier{"embeddings"},
+		[]string{"document_id", "model_name", "embedding", "chunk_text", "chunk_size"},
+		pgx.CopyFromRows(rows),
+	)
+	if err != nil {
+		b.Fatalf("Failed to seed benchmark vectors: %v", err)
+	}
+}
+
+func sampleBenchQueries(b *testing.B, ctx context.Context, conn *pgx.Conn) [][]float32 {
+	b.Helper()
+
+	rows, err := conn.Query(
+		ctx,
+		"SELECT embedding FROM embeddings WHERE model_name = $1 ORDER BY random() LIMIT $2",
+		DefaultModelName,
+		benchQueries,
+	)
+	if err != nil {
+		b.Fatalf("Failed to sample queries: %v", err)
+	}
+	defer rows.Close()
+
+	var queries [][]float32
+	for rows.Next() {
+		var vector pgvector.Vector
+		if err := rows.Scan(&vector); err != nil {
+			b.Fatalf("Failed to scan query: %v", err)
+		}
+		queries = append(queries, vector.Slice())
+	}
+	if len(queries) == 0 {
+		b.Skip("no embeddings to benchmark, set DYNARAG_BENCH_ROWS")
+	}
+	return queries
+}
+
+// exactNeighbours returns the IDs of the true nearest neighbours of the query
+func exactNeighbours(b *testing.B, ctx context.Context, conn *pgx.Conn, query []float32) map[int64]bool {
+	b.Helper()
+
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		b.Fatalf("Failed to begin: %v", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, "SET LOCAL enable_indexscan = off"); err != nil {
+		b.Fatalf("Failed to disable index scans: %v", err)
+	}
+
+	q := New(tx)
+	plan, err := modelPlan(ctx, q, DefaultModelName, SearchParams{})
+	if err != nil {
+		b.Fatalf("Failed to plan search: %v", err)
+	}
+	plan.Quantization = QuantizationNone
+
+	rows, err := q.FindTopKNNEmbeddings(ctx, plan, FindTopKNNEmbeddingsParams{
+		QueryEmbedding: pgvector.NewVector(query),
+		ModelName:      DefaultModelName,
+		K:              benchK,
+	})
+	if err != nil {
+		b.Fatalf("Exact search failed: %v", err)
+	}
+
+	ids := make(map[int64]bool, len(rows))
+	for _, row := range rows {
+		ids[row.ID] = true
+	}
+	return ids
+}
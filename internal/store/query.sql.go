@@ -13,16 +13,118 @@ import (
 	"github.com/pgvector/pgvector-go"
 )
 
+const countExistingDocuments = `-- name: CountExistingDocuments :one
+SELECT COUNT(*) FROM documents
+WHERE id = ANY($1::bigint[])
+`
+
+func (q *Queries) CountExistingDocuments(ctx context.Context, ids []int64) (int64, error) {
+	row := q.db.QueryRow(ctx, countExistingDocuments, ids)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const createAuditEntry = `-- name: CreateAuditEntry :one
+INSERT INTO audit_log (
+    occurred_at,
+    operation,
+    principal,
+    groups,
+    collection,
+    file_paths,
+    chunk_ids,
+    query,
+    filter,
+    prev_hash,
+    hash
+) VALUES (
+    $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11
+)
+RETURNING id, occurred_at, operation, principal, groups, collection, file_paths, chunk_ids, query, filter, prev_hash, hash, tenant_id
+`
+
+type CreateAuditEntryParams struct {
+	OccurredAt pgtype.Timestamptz
+	Operation  string
+	Principal  string
+	Groups     []string
+	Collection string
+	FilePaths  []string
+	ChunkIds   []int64
+	Query      string
+	Filter     types.JSONMap
+	PrevHash   pgtype.Text
+	Hash       pgtype.Text
+}
+
+func (q *Queries) CreateAuditEntry(ctx context.Context, arg CreateAuditEntryParams) (AuditLog, error) {
+	row := q.db.QueryRow(ctx, createAuditEntry,
+		arg.OccurredAt,
+		arg.Operation,
+		arg.Principal,
+		arg.Groups,
+		arg.Collection,
+		arg.FilePaths,
+		arg.ChunkIds,
+		arg.Query,
+		arg.Filter,
+		arg.PrevHash,
+		arg.Hash,
+	)
+	var i AuditLog
+	err := row.Scan(
+		&i.ID,
+		&i.OccurredAt,
+		&i.Operation,
+		&i.Principal,
+		&i.Groups,
+		&i.Collection,
+		&i.FilePaths,
+		&i.ChunkIds,
+		&i.Query,
+		&i.Filter,
+		&i.PrevHash,
+		&i.Hash,
+		&i.TenantID,
+	)
+	return i, err
+}
+
+const createCollection = `-- name: CreateCollection :one
+INSERT INTO collections (name) VALUES ($1)
+RETURNING id, name, created_at, updated_at, tenant_id
+`
+
+func (q *Queries) CreateCollection(ctx context.Context, name string) (Collection, error) {
+	row := q.db.QueryRow(ctx, createCollection, name)
+	var i Collection
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.TenantID,
+	)
+	return i, err
+}
+
 const createDocument = `-- name: CreateDocument :one
-INSERT INTO documents (file_path)
-VALUES ($1)
-ON CONFLICT (file_path) DO UPDATE 
-SET updated_at = CURRENT_TIMESTAMP
-RETURNING id, file_path, total_chunk_size, created_at, updated_at
+INSERT INTO documents (collection_id, file_path)
+VALUES ($1, $2)
+ON CONFLICT (collection_id, file_path) DO UPDATE 
+SET updated_at = CURRENT_TIMESTAMP,
+    deleted_at = NULL
+RETURNING id, file_path, total_chunk_size, created_at, updated_at, collection_id, tenant_id, deleted_at
 `
 
-func (q *Queries) CreateDocument(ctx context.Context, filePath string) (Document, error) {
-	row := q.db.QueryRow(ctx, createDocument, filePath)
+type CreateDocumentParams struct {
+	CollectionID int64
+	FilePath     string
+}
+
+func (q *Queries) CreateDocument(ctx context.Context, arg CreateDocumentParams) (Document, error) {
+	row := q.db.QueryRow(ctx, createDocument, arg.CollectionID, arg.FilePath)
 	var i Document
 	err := row.Scan(
 		&i.ID,
@@ -30,6 +132,9 @@ func (q *Queries) CreateDocument(ctx context.Context, filePath string) (Document
 		&i.TotalChunkSize,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.CollectionID,
+		&i.TenantID,
+		&i.DeletedAt,
 	)
 	return i, err
 }
@@ -44,21 +149,27 @@ INSERT INTO embeddings (
     created_at,
     metadata,
     metadata_hash,
-    embedding_text
+    embedding_text,
+    allowed_principals,
+    expires_at,
+    version_id
 ) VALUES (
-    $1, $2, $3, $4, length($4), DEFAULT, $5, $6, $7
+    $1, $2, $3, $4, length($4), DEFAULT, $5, $6, $7, $8, $9, $10
 )
-RETURNING id, document_id, model_name, embedding, chunk_text, chunk_size, created_at, metadata, metadata_hash, embedding_text
+RETURNING id, document_id, model_name, embedding, chunk_text, chunk_size, created_at, metadata, metadata_hash, embedding_text, tenant_id, allowed_principals, expires_at, deleted_at, version_id
 `
 
 type CreateEmbeddingParams struct {
-	DocumentID    pgtype.Int8
-	ModelName     EmbeddingModel
-	Embedding     pgvector.Vector
-	ChunkText     string
-	Metadata      types.JSONMap
-	MetadataHash  pgtype.Text
-	EmbeddingText pgtype.Text
+	DocumentID        pgtype.Int8
+	ModelName         EmbeddingModel
+	Embedding         pgvector.Vector
+	ChunkText         string
+	Metadata          types.JSONMap
+	MetadataHash      pgtype.Text
+	EmbeddingText     pgtype.Text
+	AllowedPrincipals []string
+	ExpiresAt         pgtype.Timestamptz
+	VersionID         pgtype.Int8
 }
 
 func (q *Queries) CreateEmbedding(ctx context.Context, arg CreateEmbeddingParams) (Embedding, error) {
@@ -70,6 +181,9 @@ func (q *Queries) CreateEmbedding(ctx context.Context, arg CreateEmbeddingParams
 		arg.Metadata,
 		arg.MetadataHash,
 		arg.EmbeddingText,
+		arg.AllowedPrincipals,
+		arg.ExpiresAt,
+		arg.VersionID,
 	)
 	var i Embedding
 	err := row.Scan(
@@ -83,10 +197,241 @@ func (q *Queries) CreateEmbedding(ctx context.Context, arg CreateEmbeddingParams
 		&i.Metadata,
 		&i.MetadataHash,
 		&i.EmbeddingText,
+		&i.TenantID,
+		&i.AllowedPrincipals,
+		&i.ExpiresAt,
+		&i.DeletedAt,
+		&i.VersionID,
+	)
+	return i, err
+}
+
+const closeDocumentVersion = `-- name: CloseDocumentVersion :exec
+UPDATE document_versions
+SET valid_to = now()
+WHERE document_id = $1
+  AND valid_to IS NULL
+`
+
+func (q *Queries) CloseDocumentVersion(ctx context.Context, documentID int64) error {
+	_, err := q.db.Exec(ctx, closeDocumentVersion, documentID)
+	return err
+}
+
+const createMessage = `-- name: CreateMessage :one
+INSERT INTO messages (
+    session_id,
+    role,
+    content,
+    chunk_ids
+) VALUES (
+    $1, $2, $3, $4
+)
+RETURNING id, session_id, role, content, chunk_ids, created_at, tenant_id
+`
+
+type CreateMessageParams struct {
+	SessionID int64
+	Role      string
+	Content   string
+	ChunkIds  []int64
+}
+
+func (q *Queries) CreateMessage(ctx context.Context, arg CreateMessageParams) (Message, error) {
+	row := q.db.QueryRow(ctx, createMessage,
+		arg.SessionID,
+		arg.Role,
+		arg.Content,
+		arg.ChunkIds,
+	)
+	var i Message
+	err := row.Scan(
+		&i.ID,
+		&i.SessionID,
+		&i.Role,
+		&i.Content,
+		&i.ChunkIds,
+		&i.CreatedAt,
+		&i.TenantID,
+	)
+	return i, err
+}
+
+const createQueryUsage = `-- name: CreateQueryUsage :one
+INSERT INTO query_usage (
+    provider,
+    model,
+    prompt_tokens,
+    completion_tokens,
+    total_tokens,
+    latency_ms,
+    time_to_first_token_ms,
+    finish_reason,
+    cost
+) VALUES (
+    $1, $2, $3, $4, $5, $6, $7, $8, $9
+)
+RETURNING id, provider, model, prompt_tokens, completion_tokens, total_tokens, latency_ms, time_to_first_token_ms, finish_reason, cost, created_at, tenant_id
+`
+
+type CreateQueryUsageParams struct {
+	Provider           string
+	Model              string
+	PromptTokens       int32
+	CompletionTokens   int32
+	TotalTokens        int32
+	LatencyMs          int64
+	TimeToFirstTokenMs int64
+	FinishReason       pgtype.Text
+	Cost               pgtype.Float8
+}
+
+func (q *Queries) CreateQueryUsage(ctx context.Context, arg CreateQueryUsageParams) (QueryUsage, error) {
+	row := q.db.QueryRow(ctx, createQueryUsage,
+		arg.Provider,
+		arg.Model,
+		arg.PromptTokens,
+		arg.CompletionTokens,
+		arg.TotalTokens,
+		arg.LatencyMs,
+		arg.TimeToFirstTokenMs,
+		arg.FinishReason,
+		arg.Cost,
+	)
+	var i QueryUsage
+	err := row.Scan(
+		&i.ID,
+		&i.Provider,
+		&i.Model,
+		&i.PromptTokens,
+		&i.CompletionTokens,
+		&i.TotalTokens,
+		&i.LatencyMs,
+		&i.TimeToFirstTokenMs,
+		&i.FinishReason,
+		&i.Cost,
+		&i.CreatedAt,
+		&i.TenantID,
+	)
+	return i, err
+}
+
+const createSession = `-- name: CreateSession :one
+INSERT INTO sessions (title) VALUES ($1)
+RETURNING id, title, summary, summarised_until, created_at, updated_at, tenant_id
+`
+
+func (q *Queries) CreateSession(ctx context.Context, title pgtype.Text) (Session, error) {
+	row := q.db.QueryRow(ctx, createSession, title)
+	var i Session
+	err := row.Scan(
+		&i.ID,
+		&i.Title,
+		&i.Summary,
+		&i.SummarisedUntil,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.TenantID,
 	)
 	return i, err
 }
 
+const deleteCollection = `-- name: DeleteCollection :execrows
+DELETE FROM collections WHERE name = $1 AND tenant_id = dynarag_tenant()
+`
+
+func (q *Queries) DeleteCollection(ctx context.Context, name string) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteCollection, name)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const deleteCollectionEmbeddings = `-- name: DeleteCollectionEmbeddings :many
+DELETE FROM embeddings e
+USING documents d
+WHERE d.id = e.document_id
+  AND d.collection_id = $1
+RETURNING e.document_id, e.chunk_size, d.file_path
+`
+
+type DeleteCollectionEmbeddingsRow struct {
+	DocumentID pgtype.Int8
+	ChunkSize  int32
+	FilePath   string
+}
+
+func (q *Queries) DeleteCollectionEmbeddings(ctx context.Context, collectionID int64) ([]DeleteCollectionEmbeddingsRow, error) {
+	rows, err := q.db.Query(ctx, deleteCollectionEmbeddings, collectionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []DeleteCollectionEmbeddingsRow
+	for rows.Next() {
+		var i DeleteCollectionEmbeddingsRow
+		if err := rows.Scan(
+			&i.DocumentID,
+			&i.ChunkSize,
+			&i.FilePath,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const deleteExpiredEmbeddings = `-- name: DeleteExpiredEmbeddings :many
+DELETE FROM embeddings e
+USING documents d
+WHERE d.id = e.document_id
+  AND e.id IN (
+    SELECT x.id FROM embeddings x
+    WHERE x.expires_at <= now()
+    ORDER BY x.expires_at
+    LIMIT $1
+    FOR UPDATE SKIP LOCKED
+  )
+RETURNING e.id, e.document_id, e.chunk_size, d.file_path
+`
+
+type DeleteExpiredEmbeddingsRow struct {
+	ID         int64
+	DocumentID pgtype.Int8
+	ChunkSize  int32
+	FilePath   string
+}
+
+func (q *Queries) DeleteExpiredEmbeddings(ctx context.Context, batchSize int32) ([]DeleteExpiredEmbeddingsRow, error) {
+	rows, err := q.db.Query(ctx, deleteExpiredEmbeddings, batchSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []DeleteExpiredEmbeddingsRow
+	for rows.Next() {
+		var i DeleteExpiredEmbeddingsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.DocumentID,
+			&i.ChunkSize,
+			&i.FilePath,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const deleteDocument = `-- name: DeleteDocument :exec
 DELETE FROM documents
 WHERE id = $1
@@ -97,13 +442,24 @@ func (q *Queries) DeleteDocument(ctx context.Context, id int64) error {
 	return err
 }
 
-const deleteEmbeddings = `-- name: DeleteEmbeddings :exec
-DELETE FROM embeddings
+const ensureCollection = `-- name: EnsureCollection :one
+INSERT INTO collections (name) VALUES ($1)
+ON CONFLICT (tenant_id, name) DO UPDATE
+SET updated_at = collections.updated_at
+RETURNING id, name, created_at, updated_at, tenant_id
 `
 
-func (q *Queries) DeleteEmbeddings(ctx context.Context) error {
-	_, err := q.db.Exec(ctx, deleteEmbeddings)
-	return err
+func (q *Queries) EnsureCollection(ctx context.Context, name string) (Collection, error) {
+	row := q.db.QueryRow(ctx, ensureCollection, name)
+	var i Collection
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.TenantID,
+	)
+	return i, err
 }
 
 const findSimilarEmbeddingsInDocument = `-- name: FindSimilarEmbeddingsInDocument :many
@@ -122,6 +478,7 @@ WITH similarity_scores AS (
       AND e.model_name = $4
       AND 1 - (e.embedding <=> $2::vector) > $5
       AND ($6::text IS NULL OR $6::text = e.metadata_hash)
+      AND e.deleted_at IS NULL
 )
 SELECT id, document_id, chunk_text, chunk_size, metadata, file_path, similarity
 FROM similarity_scores
@@ -183,78 +540,25 @@ func (q *Queries) FindSimilarEmbeddingsInDocument(ctx context.Context, arg FindS
 	return items, nil
 }
 
-const findTopKNNEmbeddings = `-- name: FindTopKNNEmbeddings :many
-SELECT 
-    e.id,
-    e.document_id,
-    e.chunk_text,
-    e.chunk_size,
-    d.file_path,
-    e.metadata,
-    (e.embedding <=> $1::vector)::float8 as distance,
-    (1 - (e.embedding <=> $1::vector))::float8 as similarity
-FROM embeddings e
-JOIN documents d ON d.id = e.document_id
-WHERE e.model_name = $2
-  AND ($3::text IS NULL OR $3::text = e.metadata_hash)
-ORDER BY e.embedding <=> $1::vector ASC
-LIMIT $4
+const getCollectionByName = `-- name: GetCollectionByName :one
+SELECT id, name, created_at, updated_at, tenant_id FROM collections WHERE name = $1 AND tenant_id = dynarag_tenant() LIMIT 1
 `
 
-type FindTopKNNEmbeddingsParams struct {
-	QueryEmbedding pgvector.Vector
-	ModelName      EmbeddingModel
-	MetadataHash   pgtype.Text
-	K              int32
-}
-
-type FindTopKNNEmbeddingsRow struct {
-	ID         int64
-	DocumentID pgtype.Int8
-	ChunkText  string
-	ChunkSize  int32
-	FilePath   string
-	Metadata   types.JSONMap
-	Distance   float64
-	Similarity float64
-}
-
-func (q *Queries) FindTopKNNEmbeddings(ctx context.Context, arg FindTopKNNEmbeddingsParams) ([]FindTopKNNEmbeddingsRow, error) {
-	rows, err := q.db.Query(ctx, findTopKNNEmbeddings,
-		arg.QueryEmbedding,
-		arg.ModelName,
-		arg.MetadataHash,
-		arg.K,
+func (q *Queries) GetCollectionByName(ctx context.Context, name string) (Collection, error) {
+	row := q.db.QueryRow(ctx, getCollectionByName, name)
+	var i Collection
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.TenantID,
 	)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-	var items []FindTopKNNEmbeddingsRow
-	for rows.Next() {
-		var i FindTopKNNEmbeddingsRow
-		if err := rows.Scan(
-			&i.ID,
-			&i.DocumentID,
-			&i.ChunkText,
-			&i.ChunkSize,
-			&i.FilePath,
-			&i.Metadata,
-			&i.Distance,
-			&i.Similarity,
-		); err != nil {
-			return nil, err
-		}
-		items = append(items, i)
-	}
-	if err := rows.Err(); err != nil {
-		return nil, err
-	}
-	return items, nil
+	return i, err
 }
 
 const getDocument = `-- name: GetDocument :one
-SELECT id, file_path, total_chunk_size, created_at, updated_at FROM documents WHERE id = $1 LIMIT 1
+SELECT id, file_path, total_chunk_size, created_at, updated_at, collection_id, tenant_id, deleted_at FROM documents WHERE id = $1 AND deleted_at IS NULL LIMIT 1
 `
 
 func (q *Queries) GetDocument(ctx context.Context, id int64) (Document, error) {
@@ -266,14 +570,19 @@ func (q *Queries) GetDocument(ctx context.Context, id int64) (Document, error) {
 		&i.TotalChunkSize,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.CollectionID,
+		&i.TenantID,
+		&i.DeletedAt,
 	)
 	return i, err
 }
 
 const getEmbedding = `-- name: GetEmbedding :one
-SELECT e.id, e.document_id, e.model_name, e.embedding, e.chunk_text, e.chunk_size, e.created_at, e.metadata, e.metadata_hash, e.embedding_text FROM embeddings e
+SELECT e.id, e.document_id, e.model_name, e.embedding, e.chunk_text, e.chunk_size, e.created_at, e.metadata, e.metadata_hash, e.embedding_text, e.tenant_id, e.allowed_principals, e.expires_at, e.deleted_at, e.version_id FROM embeddings e
 JOIN documents d ON d.id = e.document_id
-WHERE e.id = $1 LIMIT 1
+WHERE e.id = $1
+  AND e.deleted_at IS NULL
+LIMIT 1
 `
 
 func (q *Queries) GetEmbedding(ctx context.Context, id int64) (Embedding, error) {
@@ -290,6 +599,131 @@ func (q *Queries) GetEmbedding(ctx context.Context, id int64) (Embedding, error)
 		&i.Metadata,
 		&i.MetadataHash,
 		&i.EmbeddingText,
+		&i.TenantID,
+		&i.AllowedPrincipals,
+		&i.ExpiresAt,
+		&i.DeletedAt,
+		&i.VersionID,
+	)
+	return i, err
+}
+
+const getEmbeddingDimensions = `-- name: GetEmbeddingDimensions :one
+SELECT atttypmod::integer AS dimensions
+FROM pg_attribute
+WHERE attrelid = 'embeddings'::regclass AND attname = 'embedding'
+`
+
+func (q *Queries) GetEmbeddingDimensions(ctx context.Context) (int32, error) {
+	row := q.db.QueryRow(ctx, getEmbeddingDimensions)
+	var dimensions int32
+	err := row.Scan(&dimensions)
+	return dimensions, err
+}
+
+const getEmbeddingVectors = `-- name: GetEmbeddingVectors :many
+SELECT id, embedding FROM embeddings
+WHERE id = ANY($1::bigint[])
+  AND deleted_at IS NULL
+`
+
+type GetEmbeddingVectorsRow struct {
+	ID        int64
+	Embedding pgvector.Vector
+}
+
+func (q *Queries) GetEmbeddingVectors(ctx context.Context, ids []int64) ([]GetEmbeddingVectorsRow, error) {
+	rows, err := q.db.Query(ctx, getEmbeddingVectors, ids)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetEmbeddingVectorsRow
+	for rows.Next() {
+		var i GetEmbeddingVectorsRow
+		if err := rows.Scan(&i.ID, &i.Embedding); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getGitIngest = `-- name: GetGitIngest :one
+SELECT id, collection_id, repository, commit_sha, ingested_at, tenant_id FROM git_ingests
+WHERE collection_id = $1
+  AND repository = $2
+`
+
+type GetGitIngestParams struct {
+	CollectionID int64
+	Repository   string
+}
+
+func (q *Queries) GetGitIngest(ctx context.Context, arg GetGitIngestParams) (GitIngest, error) {
+	row := q.db.QueryRow(ctx, getGitIngest, arg.CollectionID, arg.Repository)
+	var i GitIngest
+	err := row.Scan(
+		&i.ID,
+		&i.CollectionID,
+		&i.Repository,
+		&i.CommitSha,
+		&i.IngestedAt,
+		&i.TenantID,
+	)
+	return i, err
+}
+
+const getLastAuditHash = `-- name: GetLastAuditHash :one
+SELECT hash FROM audit_log
+WHERE hash IS NOT NULL
+ORDER BY id DESC
+LIMIT 1
+`
+
+func (q *Queries) GetLastAuditHash(ctx context.Context) (pgtype.Text, error) {
+	row := q.db.QueryRow(ctx, getLastAuditHash)
+	var hash pgtype.Text
+	err := row.Scan(&hash)
+	return hash, err
+}
+
+const getModelRegistration = `-- name: GetModelRegistration :one
+SELECT model_name, dimensions, metric, created_at, updated_at, quantization FROM model_registrations WHERE model_name = $1 LIMIT 1
+`
+
+func (q *Queries) GetModelRegistration(ctx context.Context, modelName EmbeddingModel) (ModelRegistration, error) {
+	row := q.db.QueryRow(ctx, getModelRegistration, modelName)
+	var i ModelRegistration
+	err := row.Scan(
+		&i.ModelName,
+		&i.Dimensions,
+		&i.Metric,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Quantization,
+	)
+	return i, err
+}
+
+const getSession = `-- name: GetSession :one
+SELECT id, title, summary, summarised_until, created_at, updated_at, tenant_id FROM sessions WHERE id = $1 LIMIT 1
+`
+
+func (q *Queries) GetSession(ctx context.Context, id int64) (Session, error) {
+	row := q.db.QueryRow(ctx, getSession, id)
+	var i Session
+	err := row.Scan(
+		&i.ID,
+		&i.Title,
+		&i.Summary,
+		&i.SummarisedUntil,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.TenantID,
 	)
 	return i, err
 }
@@ -300,7 +734,13 @@ SELECT
     COUNT(e.id) as chunk_count,
     COALESCE(SUM(e.chunk_size), 0) as total_bytes
 FROM documents d
-LEFT JOIN embeddings e ON e.document_id = d.id
+LEFT JOIN (
+    embeddings e JOIN document_versions v ON v.id = e.version_id AND v.valid_to IS NULL
+) ON e.document_id = d.id
+    AND e.deleted_at IS NULL
+    AND (e.expires_at IS NULL OR e.expires_at > now())
+WHERE d.collection_id = $1
+  AND d.deleted_at IS NULL
 `
 
 type GetStatsRow struct {
@@ -309,8 +749,8 @@ type GetStatsRow struct {
 	TotalBytes    interface{}
 }
 
-func (q *Queries) GetStats(ctx context.Context) (GetStatsRow, error) {
-	row := q.db.QueryRow(ctx, getStats)
+func (q *Queries) GetStats(ctx context.Context, collectionID int64) (GetStatsRow, error) {
+	row := q.db.QueryRow(ctx, getStats, collectionID)
 	var i GetStatsRow
 	err := row.Scan(&i.DocumentCount, &i.ChunkCount, &i.TotalBytes)
 	return i, err
@@ -322,7 +762,12 @@ SELECT
     SUM(e.chunk_size) as total_bytes,
     COUNT(DISTINCT d.id) as document_count
 FROM embeddings e
-LEFT JOIN documents d ON e.document_id = d.id
+JOIN documents d ON e.document_id = d.id
+JOIN document_versions v ON v.id = e.version_id
+WHERE d.collection_id = $1
+  AND e.deleted_at IS NULL
+  AND (e.expires_at IS NULL OR e.expires_at > now())
+  AND v.valid_to IS NULL
 `
 
 type GetStorageStatsRow struct {
@@ -331,42 +776,251 @@ type GetStorageStatsRow struct {
 	DocumentCount  int64
 }
 
-func (q *Queries) GetStorageStats(ctx context.Context) (GetStorageStatsRow, error) {
-	row := q.db.QueryRow(ctx, getStorageStats)
+func (q *Queries) GetStorageStats(ctx context.Context, collectionID int64) (GetStorageStatsRow, error) {
+	row := q.db.QueryRow(ctx, getStorageStats, collectionID)
 	var i GetStorageStatsRow
 	err := row.Scan(&i.EmbeddingCount, &i.TotalBytes, &i.DocumentCount)
 	return i, err
 }
 
-const listChunks = `-- name: ListChunks :many
+const getTrashStats = `-- name: GetTrashStats :one
 SELECT 
-    e.id,
-    e.chunk_text,
-    e.metadata,
-    e.chunk_size,
-    e.model_name,
-    e.created_at,
-    d.file_path,
-    d.id as document_id
-FROM embeddings e
+    COUNT(e.id) as embedding_count,
+    COALESCE(SUM(e.chunk_size), 0)::bigint as total_bytes,
+    COUNT(DISTINCT d.id) as document_count
+FROM embeddings e
+JOIN documents d ON e.document_id = d.id
+WHERE d.collection_id = $1
+  AND e.deleted_at IS NOT NULL
+  AND ($2::interval IS NULL OR e.deleted_at >= now() - $2::interval)
+  AND ($3::interval IS NULL OR e.deleted_at <= now() - $3::interval)
+`
+
+type GetTrashStatsParams struct {
+	CollectionID int64
+	Within       pgtype.Interval
+	OlderThan    pgtype.Interval
+}
+
+type GetTrashStatsRow struct {
+	EmbeddingCount int64
+	TotalBytes     int64
+	DocumentCount  int64
+}
+
+func (q *Queries) GetTrashStats(ctx context.Context, arg GetTrashStatsParams) (GetTrashStatsRow, error) {
+	row := q.db.QueryRow(ctx, getTrashStats, arg.CollectionID, arg.Within, arg.OlderThan)
+	var i GetTrashStatsRow
+	err := row.Scan(&i.EmbeddingCount, &i.TotalBytes, &i.DocumentCount)
+	return i, err
+}
+
+const getUsageSummary = `-- name: GetUsageSummary :many
+SELECT 
+    provider,
+    model,
+    COUNT(id) as query_count,
+    COALESCE(SUM(prompt_tokens), 0)::bigint as prompt_tokens,
+    COALESCE(SUM(completion_tokens), 0)::bigint as completion_tokens,
+    COALESCE(SUM(total_tokens), 0)::bigint as total_tokens,
+    COALESCE(AVG(latency_ms), 0)::float8 as avg_latency_ms,
+    COALESCE(AVG(time_to_first_token_ms), 0)::float8 as avg_time_to_first_token_ms,
+    COALESCE(SUM(cost), 0)::float8 as total_cost
+FROM query_usage
+WHERE created_at >= $1
+  AND tenant_id = dynarag_tenant()
+GROUP BY provider, model
+ORDER BY provider, model
+`
+
+type GetUsageSummaryRow struct {
+	Provider              string
+	Model                 string
+	QueryCount            int64
+	PromptTokens          int64
+	CompletionTokens      int64
+	TotalTokens           int64
+	AvgLatencyMs          float64
+	AvgTimeToFirstTokenMs float64
+	TotalCost             float64
+}
+
+func (q *Queries) GetUsageSummary(ctx context.Context, since pgtype.Timestamptz) ([]GetUsageSummaryRow, error) {
+	rows, err := q.db.Query(ctx, getUsageSummary, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetUsageSummaryRow
+	for rows.Next() {
+		var i GetUsageSummaryRow
+		if err := rows.Scan(
+			&i.Provider,
+			&i.Model,
+			&i.QueryCount,
+			&i.PromptTokens,
+			&i.CompletionTokens,
+			&i.TotalTokens,
+			&i.AvgLatencyMs,
+			&i.AvgTimeToFirstTokenMs,
+			&i.TotalCost,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listAuditChain = `-- name: ListAuditChain :many
+SELECT id, occurred_at, operation, principal, groups, collection, file_paths, chunk_ids, query, filter, prev_hash, hash, tenant_id FROM audit_log
+WHERE hash IS NOT NULL
+ORDER BY id
+`
+
+func (q *Queries) ListAuditChain(ctx context.Context) ([]AuditLog, error) {
+	rows, err := q.db.Query(ctx, listAuditChain)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []AuditLog
+	for rows.Next() {
+		var i AuditLog
+		if err := rows.Scan(
+			&i.ID,
+			&i.OccurredAt,
+			&i.Operation,
+			&i.Principal,
+			&i.Groups,
+			&i.Collection,
+			&i.FilePaths,
+			&i.ChunkIds,
+			&i.Query,
+			&i.Filter,
+			&i.PrevHash,
+			&i.Hash,
+			&i.TenantID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listAuditLog = `-- name: ListAuditLog :many
+SELECT id, occurred_at, operation, principal, groups, collection, file_paths, chunk_ids, query, filter, prev_hash, hash, tenant_id FROM audit_log
+WHERE ($1::text IS NULL OR operation = $1::text)
+  AND ($2::text IS NULL OR principal = $2::text)
+  AND ($3::text IS NULL OR $3::text = ANY(file_paths))
+  AND ($4::timestamptz IS NULL OR occurred_at >= $4::timestamptz)
+  AND ($5::timestamptz IS NULL OR occurred_at < $5::timestamptz)
+ORDER BY id
+LIMIT $6
+`
+
+type ListAuditLogParams struct {
+	Operation  pgtype.Text
+	Principal  pgtype.Text
+	FilePath   pgtype.Text
+	Since      pgtype.Timestamptz
+	Until      pgtype.Timestamptz
+	MaxEntries int32
+}
+
+func (q *Queries) ListAuditLog(ctx context.Context, arg ListAuditLogParams) ([]AuditLog, error) {
+	rows, err := q.db.Query(ctx, listAuditLog,
+		arg.Operation,
+		arg.Principal,
+		arg.FilePath,
+		arg.Since,
+		arg.Until,
+		arg.MaxEntries,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []AuditLog
+	for rows.Next() {
+		var i AuditLog
+		if err := rows.Scan(
+			&i.ID,
+			&i.OccurredAt,
+			&i.Operation,
+			&i.Principal,
+			&i.Groups,
+			&i.Collection,
+			&i.FilePaths,
+			&i.ChunkIds,
+			&i.Query,
+			&i.Filter,
+			&i.PrevHash,
+			&i.Hash,
+			&i.TenantID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listChunks = `-- name: ListChunks :many
+SELECT 
+    e.id,
+    e.chunk_text,
+    e.metadata,
+    e.chunk_size,
+    e.model_name,
+    e.created_at,
+    d.file_path,
+    d.id as document_id,
+    e.allowed_principals,
+    e.expires_at
+FROM embeddings e
 JOIN documents d ON d.id = e.document_id
-WHERE ($1::text IS NULL OR e.metadata_hash = $1::text)
+JOIN document_versions v ON v.id = e.version_id
+WHERE d.collection_id = $1
+  AND ($2::text IS NULL OR e.metadata_hash = $2::text)
+  AND (e.allowed_principals IS NULL OR e.allowed_principals && $3::text[])
+  AND (e.expires_at IS NULL OR e.expires_at > now())
+  AND e.deleted_at IS NULL
+  AND v.valid_to IS NULL
 ORDER BY e.created_at DESC
 `
 
+type ListChunksParams struct {
+	CollectionID int64
+	MetadataHash pgtype.Text
+	Principals   []string
+}
+
 type ListChunksRow struct {
-	ID         int64
-	ChunkText  string
-	Metadata   types.JSONMap
-	ChunkSize  int32
-	ModelName  EmbeddingModel
-	CreatedAt  pgtype.Timestamptz
-	FilePath   string
-	DocumentID int64
+	ID                int64
+	ChunkText         string
+	Metadata          types.JSONMap
+	ChunkSize         int32
+	ModelName         EmbeddingModel
+	CreatedAt         pgtype.Timestamptz
+	FilePath          string
+	DocumentID        int64
+	AllowedPrincipals []string
+	ExpiresAt         pgtype.Timestamptz
 }
 
-func (q *Queries) ListChunks(ctx context.Context, metadataHash pgtype.Text) ([]ListChunksRow, error) {
-	rows, err := q.db.Query(ctx, listChunks, metadataHash)
+func (q *Queries) ListChunks(ctx context.Context, arg ListChunksParams) ([]ListChunksRow, error) {
+	rows, err := q.db.Query(ctx, listChunks, arg.CollectionID, arg.MetadataHash, arg.Principals)
 	if err != nil {
 		return nil, err
 	}
@@ -383,6 +1037,61 @@ func (q *Queries) ListChunks(ctx context.Context, metadataHash pgtype.Text) ([]L
 			&i.CreatedAt,
 			&i.FilePath,
 			&i.DocumentID,
+			&i.AllowedPrincipals,
+			&i.ExpiresAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listCollections = `-- name: ListCollections :many
+SELECT 
+    c.id,
+    c.name,
+    c.created_at,
+    COUNT(DISTINCT d.id) as document_count,
+    COUNT(e.id) as chunk_count
+FROM collections c
+LEFT JOIN documents d ON d.collection_id = c.id AND d.deleted_at IS NULL
+LEFT JOIN (
+    embeddings e JOIN document_versions v ON v.id = e.version_id AND v.valid_to IS NULL
+) ON e.document_id = d.id
+    AND e.deleted_at IS NULL
+    AND (e.expires_at IS NULL OR e.expires_at > now())
+WHERE c.tenant_id = dynarag_tenant()
+GROUP BY c.id
+ORDER BY c.name
+`
+
+type ListCollectionsRow struct {
+	ID            int64
+	Name          string
+	CreatedAt     pgtype.Timestamptz
+	DocumentCount int64
+	ChunkCount    int64
+}
+
+func (q *Queries) ListCollections(ctx context.Context) ([]ListCollectionsRow, error) {
+	rows, err := q.db.Query(ctx, listCollections)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListCollectionsRow
+	for rows.Next() {
+		var i ListCollectionsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.CreatedAt,
+			&i.DocumentCount,
+			&i.ChunkCount,
 		); err != nil {
 			return nil, err
 		}
@@ -395,9 +1104,10 @@ func (q *Queries) ListChunks(ctx context.Context, metadataHash pgtype.Text) ([]L
 }
 
 const listDocumentEmbeddings = `-- name: ListDocumentEmbeddings :many
-SELECT e.id, e.document_id, e.model_name, e.embedding, e.chunk_text, e.chunk_size, e.created_at, e.metadata, e.metadata_hash, e.embedding_text FROM embeddings e
+SELECT e.id, e.document_id, e.model_name, e.embedding, e.chunk_text, e.chunk_size, e.created_at, e.metadata, e.metadata_hash, e.embedding_text, e.tenant_id, e.allowed_principals, e.expires_at, e.deleted_at, e.version_id FROM embeddings e
 JOIN documents d ON d.id = e.document_id
 WHERE e.document_id = $1
+  AND e.deleted_at IS NULL
   AND ($2::text IS NULL OR $2::text = e.metadata_hash)
 `
 
@@ -426,6 +1136,11 @@ func (q *Queries) ListDocumentEmbeddings(ctx context.Context, arg ListDocumentEm
 			&i.Metadata,
 			&i.MetadataHash,
 			&i.EmbeddingText,
+			&i.TenantID,
+			&i.AllowedPrincipals,
+			&i.ExpiresAt,
+			&i.DeletedAt,
+			&i.VersionID,
 		); err != nil {
 			return nil, err
 		}
@@ -438,11 +1153,14 @@ func (q *Queries) ListDocumentEmbeddings(ctx context.Context, arg ListDocumentEm
 }
 
 const listDocuments = `-- name: ListDocuments :many
-SELECT id, file_path, total_chunk_size, created_at, updated_at FROM documents ORDER BY created_at DESC
+SELECT id, file_path, total_chunk_size, created_at, updated_at, collection_id, tenant_id, deleted_at FROM documents
+WHERE collection_id = $1
+  AND deleted_at IS NULL
+ORDER BY created_at DESC
 `
 
-func (q *Queries) ListDocuments(ctx context.Context) ([]Document, error) {
-	rows, err := q.db.Query(ctx, listDocuments)
+func (q *Queries) ListDocuments(ctx context.Context, collectionID int64) ([]Document, error) {
+	rows, err := q.db.Query(ctx, listDocuments, collectionID)
 	if err != nil {
 		return nil, err
 	}
@@ -456,6 +1174,40 @@ func (q *Queries) ListDocuments(ctx context.Context) ([]Document, error) {
 			&i.TotalChunkSize,
 			&i.CreatedAt,
 			&i.UpdatedAt,
+			&i.CollectionID,
+			&i.TenantID,
+			&i.DeletedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listModelRegistrations = `-- name: ListModelRegistrations :many
+SELECT model_name, dimensions, metric, created_at, updated_at, quantization FROM model_registrations ORDER BY model_name
+`
+
+func (q *Queries) ListModelRegistrations(ctx context.Context) ([]ModelRegistration, error) {
+	rows, err := q.db.Query(ctx, listModelRegistrations)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ModelRegistration
+	for rows.Next() {
+		var i ModelRegistration
+		if err := rows.Scan(
+			&i.ModelName,
+			&i.Dimensions,
+			&i.Metric,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Quantization,
 		); err != nil {
 			return nil, err
 		}
@@ -466,3 +1218,390 @@ func (q *Queries) ListDocuments(ctx context.Context) ([]Document, error) {
 	}
 	return items, nil
 }
+
+const listSessionMessages = `-- name: ListSessionMessages :many
+SELECT id, session_id, role, content, chunk_ids, created_at, tenant_id FROM messages
+WHERE session_id = $1
+  AND id > $2
+ORDER BY id ASC
+`
+
+type ListSessionMessagesParams struct {
+	SessionID int64
+	AfterID   int64
+}
+
+func (q *Queries) ListSessionMessages(ctx context.Context, arg ListSessionMessagesParams) ([]Message, error) {
+	rows, err := q.db.Query(ctx, listSessionMessages, arg.SessionID, arg.AfterID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Message
+	for rows.Next() {
+		var i Message
+		if err := rows.Scan(
+			&i.ID,
+			&i.SessionID,
+			&i.Role,
+			&i.Content,
+			&i.ChunkIds,
+			&i.CreatedAt,
+			&i.TenantID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listTrashedFilePaths = `-- name: ListTrashedFilePaths :many
+SELECT DISTINCT d.file_path
+FROM embeddings e
+JOIN documents d ON e.document_id = d.id
+WHERE d.collection_id = $1
+  AND e.deleted_at IS NOT NULL
+  AND ($2::interval IS NULL OR e.deleted_at >= now() - $2::interval)
+  AND ($3::interval IS NULL OR e.deleted_at <= now() - $3::interval)
+ORDER BY d.file_path
+`
+
+type ListTrashedFilePathsParams struct {
+	CollectionID int64
+	Within       pgtype.Interval
+	OlderThan    pgtype.Interval
+}
+
+func (q *Queries) ListTrashedFilePaths(ctx context.Context, arg ListTrashedFilePathsParams) ([]string, error) {
+	rows, err := q.db.Query(ctx, listTrashedFilePaths, arg.CollectionID, arg.Within, arg.OlderThan)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []string
+	for rows.Next() {
+		var file_path string
+		if err := rows.Scan(&file_path); err != nil {
+			return nil, err
+		}
+		items = append(items, file_path)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const openDocumentVersion = `-- name: OpenDocumentVersion :one
+INSERT INTO document_versions (document_id, version)
+VALUES (
+    $1,
+    (SELECT COALESCE(MAX(version), 0) + 1 FROM document_versions WHERE document_id = $1)
+)
+ON CONFLICT (document_id) WHERE valid_to IS NULL DO UPDATE
+SET valid_to = NULL
+RETURNING id, document_id, version, valid_from, valid_to, tenant_id
+`
+
+// OpenDocumentVersion returns the current version of a document, opening the next one if
+// it has none
+func (q *Queries) OpenDocumentVersion(ctx context.Context, documentID int64) (DocumentVersion, error) {
+	row := q.db.QueryRow(ctx, openDocumentVersion, documentID)
+	var i DocumentVersion
+	err := row.Scan(
+		&i.ID,
+		&i.DocumentID,
+		&i.Version,
+		&i.ValidFrom,
+		&i.ValidTo,
+		&i.TenantID,
+	)
+	return i, err
+}
+
+const purgeTrash = `-- name: PurgeTrash :exec
+DELETE FROM embeddings e
+USING documents d
+WHERE d.id = e.document_id
+  AND d.collection_id = $1
+  AND e.deleted_at IS NOT NULL
+  AND ($2::interval IS NULL OR e.deleted_at >= now() - $2::interval)
+  AND ($3::interval IS NULL OR e.deleted_at <= now() - $3::interval)
+`
+
+type PurgeTrashParams struct {
+	CollectionID int64
+	Within       pgtype.Interval
+	OlderThan    pgtype.Interval
+}
+
+func (q *Queries) PurgeTrash(ctx context.Context, arg PurgeTrashParams) error {
+	_, err := q.db.Exec(ctx, purgeTrash, arg.CollectionID, arg.Within, arg.OlderThan)
+	return err
+}
+
+const renameCollection = `-- name: RenameCollection :one
+UPDATE collections
+SET name = $1,
+    updated_at = CURRENT_TIMESTAMP
+WHERE name = $2
+  AND tenant_id = dynarag_tenant()
+RETURNING id, name, created_at, updated_at, tenant_id
+`
+
+type RenameCollectionParams struct {
+	NewName string
+	Name    string
+}
+
+func (q *Queries) RenameCollection(ctx context.Context, arg RenameCollectionParams) (Collection, error) {
+	row := q.db.QueryRow(ctx, renameCollection, arg.NewName, arg.Name)
+	var i Collection
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.TenantID,
+	)
+	return i, err
+}
+
+const renameDocument = `-- name: RenameDocument :execrows
+UPDATE documents
+SET file_path = $1,
+    updated_at = CURRENT_TIMESTAMP
+WHERE collection_id = $2
+  AND file_path = $3
+  AND deleted_at IS NULL
+`
+
+type RenameDocumentParams struct {
+	NewFilePath  string
+	CollectionID int64
+	FilePath     string
+}
+
+func (q *Queries) RenameDocument(ctx context.Context, arg RenameDocumentParams) (int64, error) {
+	result, err := q.db.Exec(ctx, renameDocument, arg.NewFilePath, arg.CollectionID, arg.FilePath)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const restoreEmbeddings = `-- name: RestoreEmbeddings :exec
+WITH restored AS (
+    UPDATE embeddings e
+    SET deleted_at = NULL
+    FROM documents d
+    WHERE d.id = e.document_id
+      AND d.collection_id = $1
+      AND e.deleted_at IS NOT NULL
+      AND ($2::interval IS NULL OR e.deleted_at >= now() - $2::interval)
+      AND ($3::interval IS NULL OR e.deleted_at <= now() - $3::interval)
+    RETURNING e.document_id
+)
+UPDATE documents
+SET deleted_at = NULL
+WHERE id IN (SELECT document_id FROM restored)
+`
+
+type RestoreEmbeddingsParams struct {
+	CollectionID int64
+	Within       pgtype.Interval
+	OlderThan    pgtype.Interval
+}
+
+func (q *Queries) RestoreEmbeddings(ctx context.Context, arg RestoreEmbeddingsParams) error {
+	_, err := q.db.Exec(ctx, restoreEmbeddings, arg.CollectionID, arg.Within, arg.OlderThan)
+	return err
+}
+
+const touchSession = `-- name: TouchSession :exec
+UPDATE sessions
+SET updated_at = CURRENT_TIMESTAMP
+WHERE id = $1
+`
+
+func (q *Queries) TouchSession(ctx context.Context, id int64) error {
+	_, err := q.db.Exec(ctx, touchSession, id)
+	return err
+}
+
+const trashDocument = `-- name: TrashDocument :one
+WITH trashed AS (
+    UPDATE embeddings e
+    SET deleted_at = now()
+    FROM documents d
+    WHERE d.id = e.document_id
+      AND d.collection_id = $1
+      AND d.file_path = $2
+      AND e.deleted_at IS NULL
+    RETURNING e.document_id, e.chunk_size
+), trashed_documents AS (
+    UPDATE documents
+    SET deleted_at = now()
+    WHERE id IN (SELECT document_id FROM trashed)
+      AND deleted_at IS NULL
+    RETURNING id
+)
+SELECT
+    (SELECT COUNT(*) FROM trashed) AS embedding_count,
+    (SELECT COALESCE(SUM(chunk_size), 0) FROM trashed)::bigint AS total_bytes,
+    (SELECT COUNT(*) FROM trashed_documents) AS document_count
+`
+
+type TrashDocumentParams struct {
+	CollectionID int64
+	FilePath     string
+}
+
+type TrashDocumentRow struct {
+	EmbeddingCount int64
+	TotalBytes     int64
+	DocumentCount  int64
+}
+
+// TrashDocument moves the chunks of one document, of every version, to the trash
+func (q *Queries) TrashDocument(ctx context.Context, arg TrashDocumentParams) (TrashDocumentRow, error) {
+	row := q.db.QueryRow(ctx, trashDocument, arg.CollectionID, arg.FilePath)
+	var i TrashDocumentRow
+	err := row.Scan(&i.EmbeddingCount, &i.TotalBytes, &i.DocumentCount)
+	return i, err
+}
+
+const trashEmbeddings = `-- name: TrashEmbeddings :exec
+WITH trashed AS (
+    UPDATE embeddings e
+    SET deleted_at = now()
+    FROM documents d
+    WHERE d.id = e.document_id
+      AND d.collection_id = $1
+      AND e.deleted_at IS NULL
+    RETURNING e.document_id
+)
+UPDATE documents
+SET deleted_at = now()
+WHERE id IN (SELECT document_id FROM trashed)
+  AND deleted_at IS NULL
+`
+
+func (q *Queries) TrashEmbeddings(ctx context.Context, collectionID int64) error {
+	_, err := q.db.Exec(ctx, trashEmbeddings, collectionID)
+	return err
+}
+
+const updateModelQuantization = `-- name: UpdateModelQuantization :one
+UPDATE model_registrations
+SET quantization = $2,
+    updated_at = CURRENT_TIMESTAMP
+WHERE model_name = $1
+RETURNING model_name, dimensions, metric, created_at, updated_at, quantization
+`
+
+type UpdateModelQuantizationParams struct {
+	ModelName    EmbeddingModel
+	Quantization Quantization
+}
+
+func (q *Queries) UpdateModelQuantization(ctx context.Context, arg UpdateModelQuantizationParams) (ModelRegistration, error) {
+	row := q.db.QueryRow(ctx, updateModelQuantization, arg.ModelName, arg.Quantization)
+	var i ModelRegistration
+	err := row.Scan(
+		&i.ModelName,
+		&i.Dimensions,
+		&i.Metric,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Quantization,
+	)
+	return i, err
+}
+
+const updateSessionSummary = `-- name: UpdateSessionSummary :exec
+UPDATE sessions
+SET summary = $2,
+    summarised_until = $3,
+    updated_at = CURRENT_TIMESTAMP
+WHERE id = $1
+`
+
+type UpdateSessionSummaryParams struct {
+	ID              int64
+	Summary         pgtype.Text
+	SummarisedUntil int64
+}
+
+func (q *Queries) UpdateSessionSummary(ctx context.Context, arg UpdateSessionSummaryParams) error {
+	_, err := q.db.Exec(ctx, updateSessionSummary, arg.ID, arg.Summary, arg.SummarisedUntil)
+	return err
+}
+
+const upsertGitIngest = `-- name: UpsertGitIngest :one
+INSERT INTO git_ingests (collection_id, repository, commit_sha)
+VALUES ($1, $2, $3)
+ON CONFLICT (collection_id, repository) DO UPDATE
+SET commit_sha = EXCLUDED.commit_sha,
+    ingested_at = now()
+RETURNING id, collection_id, repository, commit_sha, ingested_at, tenant_id
+`
+
+type UpsertGitIngestParams struct {
+	CollectionID int64
+	Repository   string
+	CommitSha    string
+}
+
+func (q *Queries) UpsertGitIngest(ctx context.Context, arg UpsertGitIngestParams) (GitIngest, error) {
+	row := q.db.QueryRow(ctx, upsertGitIngest, arg.CollectionID, arg.Repository, arg.CommitSha)
+	var i GitIngest
+	err := row.Scan(
+		&i.ID,
+		&i.CollectionID,
+		&i.Repository,
+		&i.CommitSha,
+		&i.IngestedAt,
+		&i.TenantID,
+	)
+	return i, err
+}
+
+const upsertModelRegistration = `-- name: UpsertModelRegistration :one
+INSERT INTO model_registrations (
+    model_name,
+    dimensions,
+    metric
+) VALUES (
+    $1, $2, $3
+)
+ON CONFLICT (model_name) DO UPDATE
+SET dimensions = EXCLUDED.dimensions,
+    metric = EXCLUDED.metric,
+    updated_at = CURRENT_TIMESTAMP
+RETURNING model_name, dimensions, metric, created_at, updated_at, quantization
+`
+
+type UpsertModelRegistrationParams struct {
+	ModelName  EmbeddingModel
+	Dimensions int32
+	Metric     DistanceMetric
+}
+
+func (q *Queries) UpsertModelRegistration(ctx context.Context, arg UpsertModelRegistrationParams) (ModelRegistration, error) {
+	row := q.db.QueryRow(ctx, upsertModelRegistration, arg.ModelName, arg.Dimensions, arg.Metric)
+	var i ModelRegistration
+	err := row.Scan(
+		&i.ModelName,
+		&i.Dimensions,
+		&i.Metric,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Quantization,
+	)
+	return i, err
+}
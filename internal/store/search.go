@@ -0,0 +1,451 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/pgvector/pgvector-go"
+
+	"github.com/Predixus/DynaRAG/types"
+)
+
+// DefaultModelName is the embedding model the chunks are embedded with
+const DefaultModelName = EmbeddingModelAllMiniLML6V2
+
+// FindTopKNNEmbeddings is written by hand rather than generated from query.sql, as the
+// distance operator depends on the metric of the model and SQL cannot take an operator as
+// a parameter. The operator must match the operator class of the model's index for the
+// index to be used
+const findTopKNNEmbeddings = `-- name: FindTopKNNEmbeddings :many
+SELECT 
+    e.id,
+    e.document_id,
+    e.chunk_text,
+    e.chunk_size,
+    d.file_path,
+    e.metadata,
+    (e.embedding %[1]s $1::vector)::float8 as distance,
+    (%[2]s)::float8 as similarity
+FROM embeddings e
+JOIN documents d ON d.id = e.document_id
+JOIN document_versions v ON v.id = e.version_id
+WHERE e.model_name = $2
+  AND ($3::text IS NULL OR $3::text = e.metadata_hash)
+  AND d.collection_id = $5
+  AND (e.allowed_principals IS NULL OR e.allowed_principals && $6::text[])
+  AND (e.expires_at IS NULL OR e.expires_at > COALESCE($7::timestamptz, now()))
+  AND (e.deleted_at IS NULL OR e.deleted_at > COALESCE($7::timestamptz, now()))
+  AND e.created_at <= COALESCE($7::timestamptz, now())
+  AND v.valid_from <= COALESCE($7::timestamptz, now())
+  AND (v.valid_to IS NULL OR v.valid_to > COALESCE($7::timestamptz, now()))
+ORDER BY e.embedding %[1]s $1::vector ASC
+LIMIT $4
+`
+
+// findTopKNNEmbeddingsQuantized gathers $8 candidates over the quantised index of the
+// model, then re-ranks them on the full precision vectors
+const findTopKNNEmbeddingsQuantized = `-- name: FindTopKNNEmbeddingsQuantized :many
+WITH candidates AS (
+    SELECT e.id
+    FROM embeddings e
+    JOIN documents d ON d.id = e.document_id
+    JOIN document_versions v ON v.id = e.version_id
+    WHERE e.model_name = $2
+      AND ($3::text IS NULL OR $3::text = e.metadata_hash)
+      AND d.collection_id = $5
+      AND (e.allowed_principals IS NULL OR e.allowed_principals && $6::text[])
+      AND (e.expires_at IS NULL OR e.expires_at > COALESCE($7::timestamptz, now()))
+      AND (e.deleted_at IS NULL OR e.deleted_at > COALESCE($7::timestamptz, now()))
+      AND e.created_at <= COALESCE($7::timestamptz, now())
+      AND v.valid_from <= COALESCE($7::timestamptz, now())
+      AND (v.valid_to IS NULL OR v.valid_to > COALESCE($7::timestamptz, now()))
+    ORDER BY %[3]s %[4]s %[5]s
+    LIMIT $8
+)
+SELECT 
+    e.id,
+    e.document_id,
+    e.chunk_text,
+    e.chunk_size,
+    d.file_path,
+    e.metadata,
+    (e.embedding %[1]s $1::vector)::float8 as distance,
+    (%[2]s)::float8 as similarity
+FROM candidates c
+JOIN embeddings e ON e.id = c.id
+JOIN documents d ON d.id = e.document_id
+ORDER BY e.embedding %[1]s $1::vector ASC
+LIMIT $4
+`
+
+// countWithheldNeighbours counts the chunks among the $4 nearest, ignoring access control,
+// that the principals $6 may not retrieve. It ranks on the full precision vectors, so it
+// scans the table for quantised models
+const countWithheldNeighbours = `-- name: CountWithheldNeighbours :one
+SELECT COUNT(*) FILTER (
+    WHERE NOT (n.allowed_principals IS NULL OR n.allowed_principals && $6::text[])
+)
+FROM (
+    SELECT e.allowed_principals
+    FROM embeddings e
+    JOIN documents d ON d.id = e.document_id
+    JOIN document_versions v ON v.id = e.version_id
+    WHERE e.model_name = $2
+      AND ($3::text IS NULL OR $3::text = e.metadata_hash)
+      AND d.collection_id = $5
+      AND (e.expires_at IS NULL OR e.expires_at > COALESCE($7::timestamptz, now()))
+      AND (e.deleted_at IS NULL OR e.deleted_at > COALESCE($7::timestamptz, now()))
+      AND e.created_at <= COALESCE($7::timestamptz, now())
+      AND v.valid_from <= COALESCE($7::timestamptz, now())
+      AND (v.valid_to IS NULL OR v.valid_to > COALESCE($7::timestamptz, now()))
+    ORDER BY e.embedding %[1]s $1::vector ASC
+    LIMIT $4
+) n
+`
+
+const (
+	DefaultHalfvecOversample = 2
+	DefaultBinaryOversample  = 10
+)
+
+// searchPlan describes how the nearest neighbours of a model are found
+type searchPlan struct {
+	Metric       DistanceMetric
+	Quantization Quantization
+	Dimensions   int
+	Oversample   int // candidates gathered per result by quantised searches
+}
+
+// candidates returns the indexed expression over the column ref that the candidates of
+// the search are ordered by, the matching expression of the query vector, the operator
+// comparing them and the operator class of the index
+func (p searchPlan) candidates(ref string) (column, query, operator, opclass string, err error) {
+	switch p.Quantization {
+	case QuantizationNone, "":
+		operator, err = p.Metric.operator()
+		if err != nil {
+			return "", "", "", "", err
+		}
+		opclass, err = p.Metric.opclass()
+		return ref, "$1::vector", operator, opclass, err
+	case QuantizationHalfvec:
+		operator, err = p.Metric.operator()
+		if err != nil {
+			return "", "", "", "", err
+		}
+		opclass, err = p.Metric.opclass()
+		return fmt.Sprintf("%s::halfvec(%d)", ref, p.Dimensions),
+			fmt.Sprintf("$1::vector::halfvec(%d)", p.Dimensions),
+			operator,
+			"half" + opclass,
+			err
+	case QuantizationBinary:
+		return fmt.Sprintf("binary_quantize(%s)::bit(%d)", ref, p.Dimensions),
+			fmt.Sprintf("binary_quantize($1::vector)::bit(%d)", p.Dimensions),
+			"<~>",
+			"bit_hamming_ops",
+			nil
+	default:
+		return "", "", "", "", fmt.Errorf("unsupported quantization: %s", p.Quantization)
+	}
+}
+
+// query returns the search query of the plan
+func (p searchPlan) query() (string, error) {
+	operator, err := p.Metric.operator()
+	if err != nil {
+		return "", err
+	}
+	similarity, err := p.Metric.similarity("e.embedding " + operator + " $1::vector")
+	if err != nil {
+		return "", err
+	}
+
+	if p.Quantization == QuantizationNone || p.Quantization == "" {
+		return fmt.Sprintf(findTopKNNEmbeddings, operator, similarity), nil
+	}
+
+	column, query, candidateOperator, _, err := p.candidates("e.embedding")
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf(
+		findTopKNNEmbeddingsQuantized,
+		operator,
+		similarity,
+		column,
+		candidateOperator,
+		query,
+	), nil
+}
+
+// candidateCount returns the number of candidates a quantised search gathers for k results
+func (p searchPlan) candidateCount(k int32) int32 {
+	oversample := p.Oversample
+	if oversample <= 0 {
+		oversample = DefaultHalfvecOversample
+		if p.Quantization == QuantizationBinary {
+			oversample = DefaultBinaryOversample
+		}
+	}
+	return k * int32(oversample)
+}
+
+type FindTopKNNEmbeddingsParams struct {
+	QueryEmbedding pgvector.Vector
+	ModelName      EmbeddingModel
+	MetadataHash   pgtype.Text
+	K              int32
+	CollectionID   int64
+	Principals     []string // callers allowed to retrieve restricted chunks
+	// AsOf is the moment whose document versions are searched, now if not set
+	AsOf pgtype.Timestamptz
+}
+
+type FindTopKNNEmbeddingsRow struct {
+	ID         int64
+	DocumentID pgtype.Int8
+	ChunkText  string
+	ChunkSize  int32
+	FilePath   string
+	Metadata   types.JSONMap
+	Distance   float64 // the raw output of the metric's operator, lower is nearer
+	Similarity float64 // higher is more similar, see DistanceMetric.similarity
+}
+
+// operator returns the pgvector distance operator of the metric
+func (m DistanceMetric) operator() (string, error) {
+	switch m {
+	case DistanceMetricCosine:
+		return "<=>", nil
+	case DistanceMetricInnerProduct:
+		return "<#>", nil
+	case DistanceMetricL2:
+		return "<->", nil
+	default:
+		return "", fmt.Errorf("unsupported distance metric: %s", m)
+	}
+}
+
+// opclass returns the pgvector index operator class of the metric
+func (m DistanceMetric) opclass() (string, error) {
+	switch m {
+	case DistanceMetricCosine:
+		return "vector_cosine_ops", nil
+	case DistanceMetricInnerProduct:
+		return "vector_ip_ops", nil
+	case DistanceMetricL2:
+		return "vector_l2_ops", nil
+	default:
+		return "", fmt.Errorf("unsupported distance metric: %s", m)
+	}
+}
+
+// similarity converts a distance expression of the metric to a similarity, where higher
+// is more similar: 1 - d for cosine, the inner product itself (<#> returns its negation)
+// and 1 / (1 + d) for L2
+func (m DistanceMetric) similarity(distance string) (string, error) {
+	switch m {
+	case DistanceMetricCosine:
+		return "1 - (" + distance + ")", nil
+	case DistanceMetricInnerProduct:
+		return "(" + distance + ") * -1", nil
+	case DistanceMetricL2:
+		return "1 / (1 + (" + distance + "))", nil
+	default:
+		return "", fmt.Errorf("unsupported distance metric: %s", m)
+	}
+}
+
+func (q *Queries) FindTopKNNEmbeddings(
+	ctx context.Context,
+	plan searchPlan,
+	arg FindTopKNNEmbeddingsParams,
+) ([]FindTopKNNEmbeddingsRow, error) {
+	query, err := plan.query()
+	if err != nil {
+		return nil, err
+	}
+
+	args := []interface{}{
+		arg.QueryEmbedding,
+		arg.ModelName,
+		arg.MetadataHash,
+		arg.K,
+		arg.CollectionID,
+		arg.Principals,
+		arg.AsOf,
+	}
+	if plan.Quantization != QuantizationNone && plan.Quantization != "" {
+		args = append(args, plan.candidateCount(arg.K))
+	}
+
+	rows, err := q.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []FindTopKNNEmbeddingsRow
+	for rows.Next() {
+		var i FindTopKNNEmbeddingsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.DocumentID,
+			&i.ChunkText,
+			&i.ChunkSize,
+			&i.FilePath,
+			&i.Metadata,
+			&i.Distance,
+			&i.Similarity,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// CountWithheldNeighbours counts the chunks among the K nearest that the principals of
+// the search may not retrieve
+func (q *Queries) CountWithheldNeighbours(
+	ctx context.Context,
+	plan searchPlan,
+	arg FindTopKNNEmbeddingsParams,
+) (int64, error) {
+	operator, err := plan.Metric.operator()
+	if err != nil {
+		return 0, err
+	}
+
+	var withheld int64
+	err = q.db.QueryRow(
+		ctx,
+		fmt.Sprintf(countWithheldNeighbours, operator),
+		arg.QueryEmbedding,
+		arg.ModelName,
+		arg.MetadataHash,
+		arg.K,
+		arg.CollectionID,
+		arg.Principals,
+		arg.AsOf,
+	).Scan(&withheld)
+	return withheld, err
+}
+
+// modelPlan returns the search plan of the model from its registration, falling back to
+// an exact cosine search for unregistered models
+func modelPlan(
+	ctx context.Context,
+	q *Queries,
+	model EmbeddingModel,
+	search SearchParams,
+) (searchPlan, error) {
+	registration, err := q.GetModelRegistration(ctx, model)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return searchPlan{Metric: DistanceMetricCosine, Quantization: QuantizationNone}, nil
+	}
+	if err != nil {
+		return searchPlan{}, err
+	}
+	return searchPlan{
+		Metric:       registration.Metric,
+		Quantization: registration.Quantization,
+		Dimensions:   int(registration.Dimensions),
+		Oversample:   search.Oversample,
+	}, nil
+}
+
+// RegisterModel sets the dimensions and distance metric of an embedding model. The
+// dimensions must match those of the embeddings column. Indexes built before a change of
+// metric use the wrong operator class until RebuildIndex is run
+func RegisterModel(
+	ctx context.Context,
+	postgresConnStr string,
+	model EmbeddingModel,
+	dimensions int,
+	metric DistanceMetric,
+) (*ModelRegistration, error) {
+	if _, err := metric.operator(); err != nil {
+		return nil, err
+	}
+	if dimensions <= 0 {
+		return nil, errors.New("dimensions must be positive")
+	}
+
+	conn, err := pgx.Connect(ctx, postgresConnStr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close(ctx)
+
+	q := New(conn)
+
+	// embeddings are stored in one vector column, whose dimensions every model must share
+	column, err := q.GetEmbeddingDimensions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if dimensions != int(column) {
+		return nil, fmt.Errorf("embeddings hold %d dimensions, not %d", column, dimensions)
+	}
+
+	registration, err := q.UpsertModelRegistration(ctx, UpsertModelRegistrationParams{
+		ModelName:  model,
+		Dimensions: int32(dimensions),
+		Metric:     metric,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &registration, nil
+}
+
+// ListModels returns the registered embedding models
+func ListModels(ctx context.Context, postgresConnStr string) ([]ModelRegistration, error) {
+	conn, err := pgx.Connect(ctx, postgresConnStr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close(ctx)
+
+	q := New(conn)
+
+	return q.ListModelRegistrations(ctx)
+}
+
+// SetQuantization sets the representation the vector index of a model is built over.
+// Indexes built before the change do not match the new searches until RebuildIndex is run
+func SetQuantization(
+	ctx context.Context,
+	postgresConnStr string,
+	model EmbeddingModel,
+	quantization Quantization,
+) (*ModelRegistration, error) {
+	plan := searchPlan{Metric: DistanceMetricCosine, Quantization: quantization}
+	if _, _, _, _, err := plan.candidates("embedding"); err != nil {
+		return nil, err
+	}
+
+	conn, err := pgx.Connect(ctx, postgresConnStr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close(ctx)
+
+	q := New(conn)
+
+	registration, err := q.UpdateModelQuantization(ctx, UpdateModelQuantizationParams{
+		ModelName:    model,
+		Quantization: quantization,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &registration, nil
+}
@@ -0,0 +1,69 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestSearchRestrictedNeighbours checks that a caller who may see few chunks still gets
+// the full top k when most of the nearest chunks are restricted, and more than an HNSW
+// scan returns before filtering
+func TestSearchRestrictedNeighbours(t *testing.T) {
+	connStr := os.Getenv("DYNARAG_TEST_POSTGRES")
+	if connStr == "" {
+		t.Skip("DYNARAG_TEST_POSTGRES not set")
+	}
+	ctx := context.Background()
+
+	scope := Scope{Tenant: fmt.Sprintf("acl-%d", time.Now().UnixNano()), Collection: DefaultCollection}
+	t.Cleanup(func() {
+		if _, err := DeleteUserEmbeddings(ctx, connStr, scope, false); err != nil {
+			t.Errorf("Failed to remove chunks: %v", err)
+		}
+		if _, err := EmptyUserTrash(ctx, connStr, scope, 0, false); err != nil {
+			t.Errorf("Failed to empty the trash: %v", err)
+		}
+	})
+
+	vector := func(offset float32) []float32 {
+		v := make([]float32, 384)
+		v[0], v[1] = 1, offset
+		return v
+	}
+
+	// the 300 nearest chunks are for hr only, the 60 beyond them for everyone
+	var params []AddParams
+	for i := 0; i < 300; i++ {
+		params = append(params, AddParams{
+			ChunkText:         fmt.Sprintf("restricted %d", i),
+			Embedding:         vector(float32(i) * 0.001),
+			AllowedPrincipals: []string{"group:hr"},
+		})
+	}
+	for i := 0; i < 60; i++ {
+		params = append(params, AddParams{
+			ChunkText: fmt.Sprintf("public %d", i),
+			Embedding: vector(1 + float32(i)*0.01),
+		})
+	}
+	_, err := IngestDocument(ctx, connStr, scope, "handbook.txt", params)
+	require.NoError(t, err)
+
+	rows, err := GetTopKEmbeddingsByVector(ctx, connStr, scope, SearchRequest{
+		Embedding:  vector(0),
+		K:          50,
+		Params:     SearchParams{EfSearch: 10},
+		Principals: []string{"user:alice", "group:eng"},
+	})
+	require.NoError(t, err)
+	require.Len(t, rows, 50)
+	for i, row := range rows {
+		assert.Equal(t, fmt.Sprintf("public %d", i), row.ChunkText)
+	}
+}
@@ -0,0 +1,198 @@
+package store
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// CreateSession starts a new conversation session of a tenant. An empty title is stored
+// as NULL
+func CreateSession(
+	ctx context.Context,
+	postgresConnStr string,
+	tenant string,
+	title string,
+) (*Session, error) {
+	conn, err := pgx.Connect(ctx, postgresConnStr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close(ctx)
+
+	tx, err := beginTenant(ctx, conn, tenant)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	q := New(tx)
+
+	session, err := q.CreateSession(ctx, pgtype.Text{String: title, Valid: title != ""})
+	if err != nil {
+		return nil, err
+	}
+	return &session, tx.Commit(ctx)
+}
+
+// GetSession returns a session of a tenant by ID
+func GetSession(
+	ctx context.Context,
+	postgresConnStr string,
+	tenant string,
+	id int64,
+) (*Session, error) {
+	conn, err := pgx.Connect(ctx, postgresConnStr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close(ctx)
+
+	tx, err := beginTenant(ctx, conn, tenant)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	q := New(tx)
+
+	session, err := q.GetSession(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return &session, tx.Commit(ctx)
+}
+
+// ListSessionMessages returns the messages of a session with an ID greater than afterID,
+// oldest first
+func ListSessionMessages(
+	ctx context.Context,
+	postgresConnStr string,
+	tenant string,
+	sessionID int64,
+	afterID int64,
+) ([]Message, error) {
+	conn, err := pgx.Connect(ctx, postgresConnStr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close(ctx)
+
+	tx, err := beginTenant(ctx, conn, tenant)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	q := New(tx)
+
+	messages, err := q.ListSessionMessages(ctx, ListSessionMessagesParams{
+		SessionID: sessionID,
+		AfterID:   afterID,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return messages, tx.Commit(ctx)
+}
+
+// AddSessionTurn persists a question and its answer, along with the IDs of the chunks
+// retrieved to answer it, in a single transaction. The session must belong to the tenant
+func AddSessionTurn(
+	ctx context.Context,
+	postgresConnStr string,
+	tenant string,
+	sessionID int64,
+	question string,
+	answer string,
+	chunkIDs []int64,
+) ([]Message, error) {
+	conn, err := pgx.Connect(ctx, postgresConnStr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close(ctx)
+
+	tx, err := beginTenant(ctx, conn, tenant)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	q := New(tx)
+
+	// foreign keys are checked past row level security, so the session is looked up first
+	if _, err := q.GetSession(ctx, sessionID); err != nil {
+		return nil, err
+	}
+
+	if chunkIDs == nil {
+		chunkIDs = []int64{}
+	}
+
+	userMessage, err := q.CreateMessage(ctx, CreateMessageParams{
+		SessionID: sessionID,
+		Role:      "user",
+		Content:   question,
+		ChunkIds:  []int64{},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	assistantMessage, err := q.CreateMessage(ctx, CreateMessageParams{
+		SessionID: sessionID,
+		Role:      "assistant",
+		Content:   answer,
+		ChunkIds:  chunkIDs,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := q.TouchSession(ctx, sessionID); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	return []Message{userMessage, assistantMessage}, nil
+}
+
+// UpdateSessionSummary replaces the rolling summary of a session, which covers every
+// message up to and including summarisedUntil
+func UpdateSessionSummary(
+	ctx context.Context,
+	postgresConnStr string,
+	tenant string,
+	sessionID int64,
+	summary string,
+	summarisedUntil int64,
+) error {
+	conn, err := pgx.Connect(ctx, postgresConnStr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close(ctx)
+
+	tx, err := beginTenant(ctx, conn, tenant)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	q := New(tx)
+
+	err = q.UpdateSessionSummary(ctx, UpdateSessionSummaryParams{
+		ID:              sessionID,
+		Summary:         pgtype.Text{String: summary, Valid: summary != ""},
+		SummarisedUntil: summarisedUntil,
+	})
+	if err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
@@ -0,0 +1,202 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Predixus/DynaRAG/types"
+)
+
+// ErrUnsupported is returned by backends for operations they do not implement
+var ErrUnsupported = errors.New("operation not supported by this store backend")
+
+// Store persists chunks with their embeddings and searches them by similarity
+type Store interface {
+	// Add stores a chunk and its embedding under its file path
+	Add(ctx context.Context, params AddParams) (*Embedding, error)
+	// AddMany stores a batch of chunks, atomically where the backend allows
+	AddMany(ctx context.Context, params []AddParams) error
+	// Ingest replaces the current version of a document with a new version holding the
+	// given chunks. The chunks of earlier versions are kept for searches AsOf the past
+	Ingest(ctx context.Context, filePath string, params []AddParams) (*DocumentVersion, error)
+	// Each calls fn with every stored chunk in insertion order, without loading them all
+	// at once. Vectors are only included if withVectors is set
+	Each(ctx context.Context, withVectors bool, fn func(Record) error) error
+	// Search returns the chunks nearest to an embedding, nearest first
+	Search(ctx context.Context, request SearchRequest) ([]FindTopKNNEmbeddingsRow, error)
+	// List returns the stored chunks the request may see, newest first
+	List(ctx context.Context, request ListRequest) ([]ListChunksRow, error)
+	// Delete moves every chunk of the collection to the trash, hiding it from all other
+	// operations. If dryRun is true nothing is removed
+	Delete(ctx context.Context, dryRun bool) (*DeletionStats, error)
+	// DeleteDocument moves the chunks of one document to the trash
+	DeleteDocument(ctx context.Context, filePath string) (*DeletionStats, error)
+	// RenameDocument moves a document, with its chunks, to another file path
+	RenameDocument(ctx context.Context, filePath string, newFilePath string) error
+	// Restore brings back the chunks trashed within the given duration, or all of them if
+	// it is zero. If dryRun is true nothing is restored
+	Restore(ctx context.Context, within time.Duration, dryRun bool) (*DeletionStats, error)
+	// EmptyTrash permanently removes the chunks trashed at least olderThan ago, or all of
+	// them if it is zero. If dryRun is true nothing is removed
+	EmptyTrash(ctx context.Context, olderThan time.Duration, dryRun bool) (*DeletionStats, error)
+	// Stats counts the stored documents, chunks and bytes
+	Stats(ctx context.Context) (*GetStatsRow, error)
+	// Vacuum removes the expired chunks of every collection of the tenant, batchSize at a
+	// time
+	Vacuum(ctx context.Context, batchSize int) (*VacuumStats, error)
+	// Vectors returns the embeddings of the given chunks, keyed by ID
+	Vectors(ctx context.Context, ids []int64) (map[int64][]float32, error)
+	// Collection returns a view of the store scoped to the named collection. Chunks of
+	// other collections are invisible to it
+	Collection(name string) (Store, error)
+	// Tenant returns a view of the store scoped to the default collection of a tenant.
+	// Chunks of other tenants are invisible to it
+	Tenant(id string) (Store, error)
+	// Close releases the store, persisting it first if the backend supports it
+	Close() error
+}
+
+// AddParams describes a chunk to store
+type AddParams struct {
+	FilePath      string
+	ChunkText     string
+	EmbeddingText *string // the text that was embedded, if not the chunk text
+	Metadata      *types.JSONMap
+	Embedding     []float32
+	// AllowedPrincipals restricts the chunk to callers holding one of these principals.
+	// Nil leaves it open to every caller
+	AllowedPrincipals []string
+	// ExpiresAt is when the chunk stops being retrievable, after which Vacuum removes it.
+	// Nil keeps it until deleted
+	ExpiresAt *time.Time
+}
+
+// SearchRequest describes a nearest neighbour search
+type SearchRequest struct {
+	Embedding []float32
+	K         int8
+	Metadata  *types.JSONMap // only chunks with exactly this metadata match, if set
+	Params    SearchParams
+	// Principals are the user and groups of the caller. Restricted chunks are only
+	// considered if they allow one of them, before the K nearest are taken
+	Principals []string
+	// AsOf searches the document versions that were current at that moment, along with
+	// the chunks they held then, instead of the current ones, if set
+	AsOf *time.Time
+	// Withheld receives the number of the K nearest chunks, ignoring access control, that
+	// the principals may not retrieve, if set. Counting costs a second search
+	Withheld *int
+}
+
+// ListRequest describes a listing of stored chunks
+type ListRequest struct {
+	Metadata   *types.JSONMap // only chunks with exactly this metadata match, if set
+	Principals []string       // restricted chunks are only listed if they allow one of these
+}
+
+// Postgres is the pgvector backed Store
+type Postgres struct {
+	connStr       string
+	scope         Scope
+	vectorVersion *extensionVersion // shared with the stores derived from this one
+}
+
+// NewPostgres creates a Store over the default collection of the default tenant of the
+// database at connStr
+func NewPostgres(connStr string) *Postgres {
+	return &Postgres{connStr: connStr, scope: DefaultScope, vectorVersion: &extensionVersion{}}
+}
+
+// ConnStr returns the connection string of the database
+func (p *Postgres) ConnStr() string {
+	return p.connStr
+}
+
+// Collection returns a Store over another collection of the same database. The
+// collection is looked up by each operation, so it may be created afterwards
+func (p *Postgres) Collection(name string) (Store, error) {
+	if name == "" {
+		return nil, errors.New("collection name is required")
+	}
+	return &Postgres{
+		connStr:       p.connStr,
+		scope:         Scope{Tenant: p.scope.Tenant, Collection: name},
+		vectorVersion: p.vectorVersion,
+	}, nil
+}
+
+// Tenant returns a Store over the default collection of a tenant of the same database.
+// Every transaction of the store acts for the tenant, so row level security keeps the
+// rows of other tenants out of reach
+func (p *Postgres) Tenant(id string) (Store, error) {
+	if id == "" {
+		return nil, errors.New("tenant id is required")
+	}
+	return &Postgres{
+		connStr:       p.connStr,
+		scope:         Scope{Tenant: id, Collection: DefaultCollection},
+		vectorVersion: p.vectorVersion,
+	}, nil
+}
+
+// TenantID returns the tenant the store acts for
+func (p *Postgres) TenantID() string {
+	return p.scope.Tenant
+}
+
+// Scope returns the tenant and collection the store acts on
+func (p *Postgres) Scope() Scope {
+	return p.scope
+}
+
+func (p *Postgres) Add(ctx context.Context, params AddParams) (*Embedding, error) {
+	return AddEmbeddingVector(ctx, p.connStr, p.scope, params)
+}
+
+func (p *Postgres) Search(
+	ctx context.Context,
+	request SearchRequest,
+) ([]FindTopKNNEmbeddingsRow, error) {
+	return searchEmbeddings(ctx, p.connStr, p.scope, request, p.vectorVersion)
+}
+
+func (p *Postgres) List(ctx context.Context, request ListRequest) ([]ListChunksRow, error) {
+	return ListUserChunks(ctx, p.connStr, p.scope, request.Metadata, request.Principals)
+}
+
+func (p *Postgres) Delete(ctx context.Context, dryRun bool) (*DeletionStats, error) {
+	return DeleteUserEmbeddings(ctx, p.connStr, p.scope, dryRun)
+}
+
+func (p *Postgres) Restore(
+	ctx context.Context,
+	within time.Duration,
+	dryRun bool,
+) (*DeletionStats, error) {
+	return RestoreUserEmbeddings(ctx, p.connStr, p.scope, within, dryRun)
+}
+
+func (p *Postgres) EmptyTrash(
+	ctx context.Context,
+	olderThan time.Duration,
+	dryRun bool,
+) (*DeletionStats, error) {
+	return EmptyUserTrash(ctx, p.connStr, p.scope, olderThan, dryRun)
+}
+
+func (p *Postgres) Stats(ctx context.Context) (*GetStatsRow, error) {
+	return GetStats(ctx, p.connStr, p.scope)
+}
+
+func (p *Postgres) Vacuum(ctx context.Context, batchSize int) (*VacuumStats, error) {
+	return VacuumExpired(ctx, p.connStr, p.scope.Tenant, batchSize)
+}
+
+func (p *Postgres) Vectors(ctx context.Context, ids []int64) (map[int64][]float32, error) {
+	return GetEmbeddingVectors(ctx, p.connStr, p.scope.Tenant, ids)
+}
+
+func (p *Postgres) Close() error {
+	return nil
+}
@@ -0,0 +1,78 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// DefaultTenant owns the rows written by transactions that act for no particular tenant,
+// including every row stored before tenants were introduced
+const DefaultTenant = "default"
+
+// Scope selects the rows a store operation works on: those of a tenant, enforced by row
+// level security, within one of the tenant's collections
+type Scope struct {
+	Tenant     string
+	Collection string
+}
+
+// DefaultScope is the default collection of the default tenant
+var DefaultScope = Scope{Tenant: DefaultTenant, Collection: DefaultCollection}
+
+// ErrRowSecurityBypassed is returned when tenants are used over a connection whose role is
+// a superuser or has BYPASSRLS, as row level security would not isolate them
+var ErrRowSecurityBypassed = errors.New("database role bypasses row level security")
+
+// CheckRowSecurity fails with ErrRowSecurityBypassed if the role of the connection is not
+// subject to row level security
+func CheckRowSecurity(ctx context.Context, postgresConnStr string) error {
+	conn, err := pgx.Connect(ctx, postgresConnStr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close(ctx)
+
+	var (
+		role   string
+		bypass bool
+	)
+	err = conn.QueryRow(
+		ctx,
+		"SELECT rolname, rolsuper OR rolbypassrls FROM pg_roles WHERE rolname = current_user",
+	).Scan(&role, &bypass)
+	if err != nil {
+		return err
+	}
+	if bypass {
+		return fmt.Errorf("%w: %s", ErrRowSecurityBypassed, role)
+	}
+	return nil
+}
+
+// bindTenant makes the rest of the transaction act for a tenant. Row level security then
+// hides the rows of every other tenant and rejects writes on their behalf, whatever the
+// queries that follow ask for. The setting is transaction local, so it cannot leak to
+// another transaction on the same connection
+func bindTenant(ctx context.Context, tx pgx.Tx, tenant string) error {
+	if tenant == "" {
+		tenant = DefaultTenant
+	}
+	_, err := tx.Exec(ctx, "SELECT set_config('app.tenant_id', $1, true)", tenant)
+	return err
+}
+
+// beginTenant opens a transaction on conn that acts for a tenant
+func beginTenant(ctx context.Context, conn *pgx.Conn, tenant string) (pgx.Tx, error) {
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := bindTenant(ctx, tx, tenant); err != nil {
+		tx.Rollback(ctx)
+		return nil, err
+	}
+	return tx, nil
+}
@@ -0,0 +1,218 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/pgvector/pgvector-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// tenantTestDatabase returns the scratch database of the tenant isolation tests, given by
+// DYNARAG_TEST_POSTGRES with the migrations applied. The tests connect as an ordinary
+// role, as superusers and BYPASSRLS roles are not subject to row level security
+func tenantTestDatabase(t *testing.T) string {
+	t.Helper()
+
+	connStr := os.Getenv("DYNARAG_TEST_POSTGRES")
+	if connStr == "" {
+		t.Skip("DYNARAG_TEST_POSTGRES not set")
+	}
+
+	err := CheckRowSecurity(context.Background(), connStr)
+	if errors.Is(err, ErrRowSecurityBypassed) {
+		t.Skip("DYNARAG_TEST_POSTGRES connects as a role that bypasses row level security")
+	}
+	require.NoError(t, err)
+	return connStr
+}
+
+// seedTenants stores a chunk for each tenant under the same file path, all with the same
+// vector, and removes them when the test ends
+func seedTenants(t *testing.T, connStr string, tenants []string) []float32 {
+	t.Helper()
+	ctx := context.Background()
+
+	vector := make([]float32, 384)
+	vector[0] = 1
+
+	for _, tenant := range tenants {
+		scope := Scope{Tenant: tenant, Collection: DefaultCollection}
+		_, err := AddEmbeddingVector(ctx, connStr, scope, AddParams{
+			FilePath:  "shared.txt",
+			ChunkText: "secret of " + tenant,
+			Embedding: vector,
+		})
+		require.NoError(t, err)
+
+		t.Cleanup(func() {
+			if _, err := DeleteUserEmbeddings(ctx, connStr, scope, false); err != nil {
+				t.Errorf("Failed to remove chunks of %s: %v", tenant, err)
+			}
+			if _, err := EmptyUserTrash(ctx, connStr, scope, 0, false); err != nil {
+				t.Errorf("Failed to empty the trash of %s: %v", tenant, err)
+			}
+		})
+	}
+	return vector
+}
+
+func TestTenantIsolation(t *testing.T) {
+	connStr := tenantTestDatabase(t)
+	ctx := context.Background()
+
+	suffix := time.Now().UnixNano()
+	tenants := []string{fmt.Sprintf("alpha-%d", suffix), fmt.Sprintf("beta-%d", suffix)}
+	vector := seedTenants(t, connStr, tenants)
+
+	for _, tenant := range tenants {
+		t.Run(tenant, func(t *testing.T) {
+			scope := Scope{Tenant: tenant, Collection: DefaultCollection}
+
+			rows, err := GetTopKEmbeddingsByVector(ctx, connStr, scope, SearchRequest{
+				Embedding: vector,
+				K:         10,
+			})
+			require.NoError(t, err)
+			require.Len(t, rows, 1)
+			assert.Equal(t, "secret of "+tenant, rows[0].ChunkText)
+
+			chunks, err := ListUserChunks(ctx, connStr, scope, nil, nil)
+			require.NoError(t, err)
+			require.Len(t, chunks, 1)
+			assert.Equal(t, "secret of "+tenant, chunks[0].ChunkText)
+
+			stats, err := GetStats(ctx, connStr, scope)
+			require.NoError(t, err)
+			assert.Equal(t, int64(1), stats.ChunkCount)
+		})
+	}
+}
+
+// TestTenantIsolationBypassesQueryFilters runs the search and listing queries with the
+// collection of one tenant while acting for another, as a bug passing the wrong ID would,
+// and checks that row level security still hides every row
+func TestTenantIsolationBypassesQueryFilters(t *testing.T) {
+	connStr := tenantTestDatabase(t)
+	ctx := context.Background()
+
+	suffix := time.Now().UnixNano()
+	owner, intruder := fmt.Sprintf("owner-%d", suffix), fmt.Sprintf("intruder-%d", suffix)
+	vector := seedTenants(t, connStr, []string{owner})
+
+	conn, err := pgx.Connect(ctx, connStr)
+	require.NoError(t, err)
+	defer conn.Close(ctx)
+
+	tx, err := beginTenant(ctx, conn, owner)
+	require.NoError(t, err)
+	ownerCollection, err := collectionID(ctx, New(tx), DefaultCollection)
+	require.NoError(t, err)
+	require.NoError(t, tx.Rollback(ctx))
+
+	tests := []struct {
+		name   string
+		tenant string
+		want   int
+	}{
+		{name: "owner", tenant: owner, want: 1},
+		{name: "other tenant", tenant: intruder, want: 0},
+		{name: "default tenant", tenant: DefaultTenant, want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tx, err := beginTenant(ctx, conn, tt.tenant)
+			require.NoError(t, err)
+			defer tx.Rollback(ctx)
+
+			q := New(tx)
+
+			plan, err := modelPlan(ctx, q, DefaultModelName, SearchParams{})
+			require.NoError(t, err)
+			rows, err := q.FindTopKNNEmbeddings(ctx, plan, FindTopKNNEmbeddingsParams{
+				QueryEmbedding: pgvector.NewVector(vector),
+				ModelName:      DefaultModelName,
+				CollectionID:   ownerCollection,
+				K:              10,
+			})
+			require.NoError(t, err)
+			assert.Len(t, rows, tt.want)
+
+			chunks, err := q.ListChunks(ctx, ListChunksParams{
+				CollectionID: ownerCollection,
+				MetadataHash: pgtype.Text{},
+			})
+			require.NoError(t, err)
+			assert.Len(t, chunks, tt.want)
+
+			var visible int
+			err = tx.QueryRow(
+				ctx,
+				"SELECT COUNT(*) FROM documents WHERE collection_id = $1",
+				ownerCollection,
+			).Scan(&visible)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, visible)
+		})
+	}
+}
+
+// TestTenantCannotWriteForAnother checks that row level security rejects rows written on
+// behalf of a tenant other than the one the transaction acts for
+func TestTenantCannotWriteForAnother(t *testing.T) {
+	connStr := tenantTestDatabase(t)
+	ctx := context.Background()
+
+	conn, err := pgx.Connect(ctx, connStr)
+	require.NoError(t, err)
+	defer conn.Close(ctx)
+
+	tx, err := beginTenant(ctx, conn, fmt.Sprintf("writer-%d", time.Now().UnixNano()))
+	require.NoError(t, err)
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(
+		ctx,
+		"INSERT INTO collections (name, tenant_id) VALUES ('stolen', $1)",
+		DefaultTenant,
+	)
+	assert.Error(t, err)
+}
+
+func TestTenantUsageIsolation(t *testing.T) {
+	connStr := tenantTestDatabase(t)
+	ctx := context.Background()
+
+	suffix := time.Now().UnixNano()
+	alpha, beta := fmt.Sprintf("alpha-%d", suffix), fmt.Sprintf("beta-%d", suffix)
+	since := time.Now().Add(-time.Minute)
+	model := fmt.Sprintf("model-%d", suffix)
+
+	_, err := RecordQueryUsage(ctx, connStr, alpha, CreateQueryUsageParams{
+		Provider:    "test",
+		Model:       model,
+		TotalTokens: 42,
+	})
+	require.NoError(t, err)
+
+	usage := func(tenant string) int64 {
+		rows, err := GetUsageSummary(ctx, connStr, tenant, since)
+		require.NoError(t, err)
+		var total int64
+		for _, row := range rows {
+			if row.Model == model {
+				total += row.TotalTokens
+			}
+		}
+		return total
+	}
+	assert.Equal(t, int64(42), usage(alpha))
+	assert.Zero(t, usage(beta))
+}
@@ -0,0 +1,150 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// interval converts a duration to its column value. Zero or negative durations are NULL,
+// which the trash queries read as no bound
+func interval(d time.Duration) pgtype.Interval {
+	if d <= 0 {
+		return pgtype.Interval{}
+	}
+	return pgtype.Interval{Microseconds: d.Microseconds(), Valid: true}
+}
+
+// trashWindow selects the trashed chunks of a collection by when they were deleted
+type trashWindow struct {
+	collectionID int64
+	within       time.Duration // deleted at most this long ago, if positive
+	olderThan    time.Duration // deleted at least this long ago, if positive
+}
+
+// trashStats reports the trashed chunks in a window
+func trashStats(ctx context.Context, q *Queries, window trashWindow) (*DeletionStats, error) {
+	stats, err := q.GetTrashStats(ctx, GetTrashStatsParams{
+		CollectionID: window.collectionID,
+		Within:       interval(window.within),
+		OlderThan:    interval(window.olderThan),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	filePaths, err := q.ListTrashedFilePaths(ctx, ListTrashedFilePathsParams{
+		CollectionID: window.collectionID,
+		Within:       interval(window.within),
+		OlderThan:    interval(window.olderThan),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &DeletionStats{
+		EmbeddingCount: stats.EmbeddingCount,
+		DocumentCount:  stats.DocumentCount,
+		TotalBytes:     stats.TotalBytes,
+		FilePaths:      filePaths,
+	}, nil
+}
+
+// RestoreUserEmbeddings brings back the chunks of a collection that were moved to the trash
+// within the given duration, or all of them if it is zero, along with their documents.
+// If dryRun is true, returns what would be restored without restoring it
+func RestoreUserEmbeddings(
+	ctx context.Context,
+	postgresConnStr string,
+	scope Scope,
+	within time.Duration,
+	dryRun bool,
+) (*DeletionStats, error) {
+	conn, err := pgx.Connect(ctx, postgresConnStr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close(ctx)
+
+	tx, err := beginTenant(ctx, conn, scope.Tenant)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	q := New(tx)
+
+	collectionID, err := collectionID(ctx, q, scope.Collection)
+	if err != nil {
+		return nil, err
+	}
+
+	window := trashWindow{collectionID: collectionID, within: within}
+	stats, err := trashStats(ctx, q, window)
+	if err != nil {
+		return nil, err
+	}
+	if dryRun {
+		return stats, nil
+	}
+
+	err = q.RestoreEmbeddings(ctx, RestoreEmbeddingsParams{
+		CollectionID: collectionID,
+		Within:       interval(within),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return stats, tx.Commit(ctx)
+}
+
+// EmptyUserTrash permanently deletes the chunks of a collection that were moved to the
+// trash at least olderThan ago, or all of them if it is zero. Documents left without
+// chunks are removed by the delete_empty_documents trigger.
+// If dryRun is true, returns what would be deleted without actually deleting
+func EmptyUserTrash(
+	ctx context.Context,
+	postgresConnStr string,
+	scope Scope,
+	olderThan time.Duration,
+	dryRun bool,
+) (*DeletionStats, error) {
+	conn, err := pgx.Connect(ctx, postgresConnStr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close(ctx)
+
+	tx, err := beginTenant(ctx, conn, scope.Tenant)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	q := New(tx)
+
+	collectionID, err := collectionID(ctx, q, scope.Collection)
+	if err != nil {
+		return nil, err
+	}
+
+	window := trashWindow{collectionID: collectionID, olderThan: olderThan}
+	stats, err := trashStats(ctx, q, window)
+	if err != nil {
+		return nil, err
+	}
+	if dryRun {
+		return stats, nil
+	}
+
+	err = q.PurgeTrash(ctx, PurgeTrashParams{
+		CollectionID: collectionID,
+		OlderThan:    interval(olderThan),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return stats, tx.Commit(ctx)
+}
@@ -0,0 +1,64 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// RecordQueryUsage persists the token usage, latency and cost of a single query of a
+// tenant
+func RecordQueryUsage(
+	ctx context.Context,
+	postgresConnStr string,
+	tenant string,
+	params CreateQueryUsageParams,
+) (*QueryUsage, error) {
+	conn, err := pgx.Connect(ctx, postgresConnStr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close(ctx)
+
+	tx, err := beginTenant(ctx, conn, tenant)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	q := New(tx)
+
+	usage, err := q.CreateQueryUsage(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+
+	return &usage, tx.Commit(ctx)
+}
+
+// GetUsageSummary aggregates the recorded query usage of a tenant per provider and model
+// since the given time
+func GetUsageSummary(
+	ctx context.Context,
+	postgresConnStr string,
+	tenant string,
+	since time.Time,
+) ([]GetUsageSummaryRow, error) {
+	conn, err := pgx.Connect(ctx, postgresConnStr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close(ctx)
+
+	tx, err := beginTenant(ctx, conn, tenant)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	q := New(tx)
+
+	return q.GetUsageSummary(ctx, pgtype.Timestamptz{Time: since, Valid: true})
+}
@@ -0,0 +1,74 @@
+package store
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// IngestDocument stores the chunks of a file as a new version of its document in a
+// collection. The current version is closed, keeping its chunks for searches of the past,
+// and the new version becomes current once the transaction commits
+func IngestDocument(
+	ctx context.Context,
+	postgresConnStr string,
+	scope Scope,
+	filePath string,
+	params []AddParams,
+) (*DocumentVersion, error) {
+	conn, err := pgx.Connect(ctx, postgresConnStr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close(ctx)
+
+	tx, err := beginTenant(ctx, conn, scope.Tenant)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	q := New(tx)
+
+	collectionID, err := collectionID(ctx, q, scope.Collection)
+	if err != nil {
+		return nil, err
+	}
+
+	doc, err := q.CreateDocument(ctx, CreateDocumentParams{
+		CollectionID: collectionID,
+		FilePath:     filePath,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// the old version ends where the new one begins, both at the start of the transaction
+	if err := q.CloseDocumentVersion(ctx, doc.ID); err != nil {
+		return nil, err
+	}
+	version, err := q.OpenDocumentVersion(ctx, doc.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, p := range params {
+		p.FilePath = filePath
+		if _, err := addEmbedding(ctx, q, collectionID, p); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return &version, nil
+}
+
+func (p *Postgres) Ingest(
+	ctx context.Context,
+	filePath string,
+	params []AddParams,
+) (*DocumentVersion, error) {
+	return IngestDocument(ctx, p.connStr, p.scope, filePath, params)
+}
@@ -0,0 +1,121 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIngestDocumentVersions(t *testing.T) {
+	connStr := os.Getenv("DYNARAG_TEST_POSTGRES")
+	if connStr == "" {
+		t.Skip("DYNARAG_TEST_POSTGRES not set")
+	}
+	ctx := context.Background()
+
+	scope := Scope{Tenant: fmt.Sprintf("versions-%d", time.Now().UnixNano()), Collection: DefaultCollection}
+	t.Cleanup(func() {
+		if _, err := DeleteUserEmbeddings(ctx, connStr, scope, false); err != nil {
+			t.Errorf("Failed to remove chunks: %v", err)
+		}
+		if _, err := EmptyUserTrash(ctx, connStr, scope, 0, false); err != nil {
+			t.Errorf("Failed to empty the trash: %v", err)
+		}
+	})
+
+	vector := make([]float32, 384)
+	vector[0] = 1
+
+	first, err := IngestDocument(ctx, connStr, scope, "policy.txt", []AddParams{
+		{ChunkText: "refunds within 30 days", Embedding: vector},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), first.Version)
+
+	// the moments compared with valid_from are read from the database, whose clock may
+	// differ from this one
+	before := first.ValidFrom.Time.Add(-time.Second)
+	between := databaseNow(t, connStr)
+	time.Sleep(10 * time.Millisecond)
+
+	second, err := IngestDocument(ctx, connStr, scope, "policy.txt", []AddParams{
+		{ChunkText: "refunds within 14 days", Embedding: vector},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), second.Version)
+
+	tests := []struct {
+		name string
+		asOf *time.Time
+		want []string
+	}{
+		{name: "current", asOf: nil, want: []string{"refunds within 14 days"}},
+		{name: "first version", asOf: &between, want: []string{"refunds within 30 days"}},
+		{name: "before ingest", asOf: &before, want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows, err := GetTopKEmbeddingsByVector(ctx, connStr, scope, SearchRequest{
+				Embedding: vector,
+				K:         10,
+				AsOf:      tt.asOf,
+			})
+			require.NoError(t, err)
+
+			var texts []string
+			for _, row := range rows {
+				texts = append(texts, row.ChunkText)
+			}
+			assert.Equal(t, tt.want, texts)
+		})
+	}
+
+	chunks, err := ListUserChunks(ctx, connStr, scope, nil, nil)
+	require.NoError(t, err)
+	require.Len(t, chunks, 1)
+	assert.Equal(t, "refunds within 14 days", chunks[0].ChunkText)
+
+	// trashing the document later leaves the corpus as it was before unchanged
+	afterSecond := databaseNow(t, connStr)
+	_, err = TrashUserDocument(ctx, connStr, scope, "policy.txt")
+	require.NoError(t, err)
+
+	for asOf, want := range map[*time.Time][]string{
+		nil:          nil,
+		&between:     {"refunds within 30 days"},
+		&afterSecond: {"refunds within 14 days"},
+	} {
+		rows, err := GetTopKEmbeddingsByVector(ctx, connStr, scope, SearchRequest{
+			Embedding: vector,
+			K:         10,
+			AsOf:      asOf,
+		})
+		require.NoError(t, err)
+
+		var texts []string
+		for _, row := range rows {
+			texts = append(texts, row.ChunkText)
+		}
+		assert.Equal(t, want, texts, "as of %v", asOf)
+	}
+}
+
+// databaseNow returns the current time of the database
+func databaseNow(t *testing.T, connStr string) time.Time {
+	t.Helper()
+	ctx := context.Background()
+
+	conn, err := pgx.Connect(ctx, connStr)
+	require.NoError(t, err)
+	defer conn.Close(ctx)
+
+	var now time.Time
+	require.NoError(t, conn.QueryRow(ctx, "SELECT now()").Scan(&now))
+	return now
+}
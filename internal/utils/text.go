@@ -0,0 +1,42 @@
+package utils
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// SentenceBoundaries returns the byte offsets at which each sentence in text ends. A
+// sentence ends at a terminator (. ! ?) followed by whitespace, or at a blank line. The
+// final offset is always len(text) for non-empty text
+func SentenceBoundaries(text string) []int {
+	var boundaries []int
+	// walked by byte offset, as invalid bytes decode to a rune of a different length
+	for offset := 0; offset < len(text); {
+		r, size := utf8.DecodeRuneInString(text[offset:])
+		offset += size
+		next, _ := utf8.DecodeRuneInString(text[offset:])
+		switch {
+		case offset == len(text):
+			boundaries = append(boundaries, offset)
+		case (r == '.' || r == '!' || r == '?') && unicode.IsSpace(next):
+			boundaries = append(boundaries, offset)
+		case r == '\n' && next == '\n':
+			boundaries = append(boundaries, offset)
+		}
+	}
+	return boundaries
+}
+
+// SplitSentences splits text into its trimmed, non-empty sentences
+func SplitSentences(text string) []string {
+	var sentences []string
+	start := 0
+	for _, end := range SentenceBoundaries(text) {
+		if sentence := strings.TrimSpace(text[start:end]); sentence != "" {
+			sentences = append(sentences, sentence)
+		}
+		start = end
+	}
+	return sentences
+}
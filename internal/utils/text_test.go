@@ -0,0 +1,63 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestSplitSentences checks sentences are split on terminators and blank lines
+func TestSplitSentences(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		expected []string
+	}{
+		{
+			name:     "simple sentences",
+			text:     "TCP is reliable. TLS is secure! Is UDP either?",
+			expected: []string{"TCP is reliable.", "TLS is secure!", "Is UDP either?"},
+		},
+		{
+			name:     "decimal numbers are not boundaries",
+			text:     "Version 1.2 was released. It is stable.",
+			expected: []string{"Version 1.2 was released.", "It is stable."},
+		},
+		{
+			name:     "blank lines are boundaries",
+			text:     "Heading\n\nBody text without a full stop",
+			expected: []string{"Heading", "Body text without a full stop"},
+		},
+		{
+			name:     "no terminator",
+			text:     "just a fragment",
+			expected: []string{"just a fragment"},
+		},
+		{
+			name:     "empty",
+			text:     "",
+			expected: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, SplitSentences(tt.text))
+		})
+	}
+}
+
+// TestSentenceBoundariesPrefix checks every boundary yields a valid prefix of the text
+func TestSentenceBoundariesPrefix(t *testing.T) {
+	text := "Hello, 世界. Second sentence! Third"
+	boundaries := SentenceBoundaries(text)
+	assert.Equal(t, []int{len("Hello, 世界."), len("Hello, 世界. Second sentence!"), len(text)}, boundaries)
+}
+
+// TestSentenceBoundariesInvalidUTF8 checks invalid bytes count as one byte each, keeping
+// the boundaries within the text
+func TestSentenceBoundariesInvalidUTF8(t *testing.T) {
+	text := "Bad \xff\xfe bytes. More \xc3"
+	boundaries := SentenceBoundaries(text)
+	assert.Equal(t, []int{len("Bad \xff\xfe bytes."), len(text)}, boundaries)
+}
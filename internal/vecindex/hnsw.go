@@ -0,0 +1,377 @@
+package vecindex
+
+import (
+	"container/heap"
+	"math"
+	"math/rand"
+)
+
+const (
+	DefaultM              = 16
+	DefaultEfConstruction = 64
+	DefaultEfSearch       = 40
+)
+
+// HNSW is an approximate index based on Hierarchical Navigable Small World graphs
+// (Malkov & Yashunin, 2016). Removed vectors are kept in the graph as tombstones so
+// that it stays connected, and are never returned by a search
+type HNSW struct {
+	m              int
+	maxM0          int // connections per node on the bottom layer
+	efConstruction int
+	efSearch       int
+	levelMult      float64
+	rng            *rand.Rand
+
+	nodes    map[int64]*hnswNode
+	entry    int64
+	maxLevel int
+	live     int
+}
+
+type hnswNode struct {
+	vector    []float32
+	neighbors [][]int64 // per layer
+	deleted   bool
+}
+
+// HNSWOption configures an HNSW index
+type HNSWOption func(*HNSW)
+
+// WithM sets the number of connections per node and layer
+func WithM(m int) HNSWOption {
+	return func(h *HNSW) {
+		h.m = m
+	}
+}
+
+// WithEfConstruction sets the size of the candidate list while inserting
+func WithEfConstruction(ef int) HNSWOption {
+	return func(h *HNSW) {
+		h.efConstruction = ef
+	}
+}
+
+// WithEfSearch sets the size of the candidate list while searching
+func WithEfSearch(ef int) HNSWOption {
+	return func(h *HNSW) {
+		h.efSearch = ef
+	}
+}
+
+// WithSeed seeds the level generator, for reproducible graphs
+func WithSeed(seed int64) HNSWOption {
+	return func(h *HNSW) {
+		h.rng = rand.New(rand.NewSource(seed))
+	}
+}
+
+// NewHNSW creates an empty HNSW index
+func NewHNSW(opts ...HNSWOption) *HNSW {
+	h := &HNSW{
+		m:              DefaultM,
+		efConstruction: DefaultEfConstruction,
+		efSearch:       DefaultEfSearch,
+		rng:            rand.New(rand.NewSource(1)),
+		nodes:          make(map[int64]*hnswNode),
+		maxLevel:       -1,
+	}
+	for _, opt := range opts {
+		opt(h)
+	}
+	h.m = max(h.m, 2)
+	h.maxM0 = 2 * h.m
+	h.efConstruction = max(h.efConstruction, h.m)
+	h.levelMult = 1 / math.Log(float64(h.m))
+	return h
+}
+
+func (h *HNSW) Len() int {
+	return h.live
+}
+
+func (h *HNSW) randomLevel() int {
+	return int(math.Floor(-math.Log(1-h.rng.Float64()) * h.levelMult))
+}
+
+func (h *HNSW) Add(id int64, vector []float32) {
+	if existing, ok := h.nodes[id]; ok {
+		// replacing a vector in place would leave its edges pointing at the old position
+		h.Remove(id)
+		h.unlink(id, existing)
+		delete(h.nodes, id)
+	}
+
+	node := &hnswNode{vector: normalise(vector)}
+	level := h.randomLevel()
+	node.neighbors = make([][]int64, level+1)
+	h.nodes[id] = node
+	h.live++
+
+	if h.maxLevel < 0 {
+		h.entry = id
+		h.maxLevel = level
+		return
+	}
+
+	entry := h.entry
+	entryDistance := distance(node.vector, h.nodes[entry].vector)
+	for layer := h.maxLevel; layer > level; layer-- {
+		entry, entryDistance = h.greedy(node.vector, entry, entryDistance, layer)
+	}
+
+	for layer := min(level, h.maxLevel); layer >= 0; layer-- {
+		candidates := h.searchLayer(node.vector, []Result{{ID: entry, Distance: entryDistance}}, h.efConstruction, layer)
+		maxConnections := h.m
+		if layer == 0 {
+			maxConnections = h.maxM0
+		}
+		neighbors := h.selectNeighbors(candidates, h.m)
+		node.neighbors[layer] = neighbors
+		for _, neighbor := range neighbors {
+			h.connect(neighbor, id, layer, maxConnections)
+		}
+		entry, entryDistance = candidates[0].ID, candidates[0].Distance
+	}
+
+	if level > h.maxLevel {
+		h.entry = id
+		h.maxLevel = level
+	}
+}
+
+// unlink removes the edges pointing at id from its neighbours
+func (h *HNSW) unlink(id int64, node *hnswNode) {
+	for layer, neighbors := range node.neighbors {
+		for _, neighbor := range neighbors {
+			other := h.nodes[neighbor]
+			if other == nil || layer >= len(other.neighbors) {
+				continue
+			}
+			kept := other.neighbors[layer][:0]
+			for _, n := range other.neighbors[layer] {
+				if n != id {
+					kept = append(kept, n)
+				}
+			}
+			other.neighbors[layer] = kept
+		}
+	}
+	if h.entry == id {
+		h.resetEntry()
+	}
+}
+
+// resetEntry picks the node on the highest layer as the entry point
+func (h *HNSW) resetEntry() {
+	h.maxLevel = -1
+	for id, node := range h.nodes {
+		if node.neighbors == nil {
+			continue
+		}
+		if level := len(node.neighbors) - 1; level > h.maxLevel && id != h.entry {
+			h.maxLevel = level
+			h.entry = id
+		}
+	}
+}
+
+// connect adds an edge from node to target, pruning the node's edges back to the
+// closest maxConnections
+func (h *HNSW) connect(node int64, target int64, layer int, maxConnections int) {
+	n := h.nodes[node]
+	n.neighbors[layer] = append(n.neighbors[layer], target)
+	if len(n.neighbors[layer]) <= maxConnections {
+		return
+	}
+
+	candidates := make([]Result, len(n.neighbors[layer]))
+	for i, neighbor := range n.neighbors[layer] {
+		candidates[i] = Result{ID: neighbor, Distance: distance(n.vector, h.nodes[neighbor].vector)}
+	}
+	sortResults(candidates)
+	n.neighbors[layer] = h.selectNeighbors(candidates, maxConnections)
+}
+
+// selectNeighbors picks up to m of the candidates, nearest first, skipping those closer
+// to an already selected neighbour than to the query so that edges spread out. Skipped
+// candidates fill any remaining slots
+func (h *HNSW) selectNeighbors(candidates []Result, m int) []int64 {
+	selected := make([]int64, 0, m)
+	var skipped []int64
+	for _, candidate := range candidates {
+		if len(selected) == m {
+			break
+		}
+		vector := h.nodes[candidate.ID].vector
+		diverse := true
+		for _, s := range selected {
+			if distance(vector, h.nodes[s].vector) < candidate.Distance {
+				diverse = false
+				break
+			}
+		}
+		if diverse {
+			selected = append(selected, candidate.ID)
+		} else {
+			skipped = append(skipped, candidate.ID)
+		}
+	}
+	for _, id := range skipped {
+		if len(selected) == m {
+			break
+		}
+		selected = append(selected, id)
+	}
+	return selected
+}
+
+// greedy walks towards the query on a single layer until no neighbour is closer
+func (h *HNSW) greedy(query []float32, entry int64, entryDistance float64, layer int) (int64, float64) {
+	for changed := true; changed; {
+		changed = false
+		for _, neighbor := range h.nodes[entry].neighbors[layer] {
+			if d := distance(query, h.nodes[neighbor].vector); d < entryDistance {
+				entry, entryDistance, changed = neighbor, d, true
+			}
+		}
+	}
+	return entry, entryDistance
+}
+
+// searchLayer returns up to ef nodes of a layer nearest to the query, nearest first.
+// Tombstones are traversed and returned, callers filter them
+func (h *HNSW) searchLayer(query []float32, entries []Result, ef int, layer int) []Result {
+	visited := make(map[int64]bool, ef*4)
+	candidates := &resultHeap{}
+	nearest := &resultHeap{max: true}
+	for _, entry := range entries {
+		visited[entry.ID] = true
+		heap.Push(candidates, entry)
+		heap.Push(nearest, entry)
+	}
+
+	for candidates.Len() > 0 {
+		current := heap.Pop(candidates).(Result)
+		if nearest.Len() >= ef && current.Distance > nearest.results[0].Distance {
+			break
+		}
+		node := h.nodes[current.ID]
+		if layer >= len(node.neighbors) {
+			continue
+		}
+		for _, neighbor := range node.neighbors[layer] {
+			if visited[neighbor] {
+				continue
+			}
+			visited[neighbor] = true
+			d := distance(query, h.nodes[neighbor].vector)
+			if nearest.Len() < ef || d < nearest.results[0].Distance {
+				heap.Push(candidates, Result{ID: neighbor, Distance: d})
+				heap.Push(nearest, Result{ID: neighbor, Distance: d})
+				if nearest.Len() > ef {
+					heap.Pop(nearest)
+				}
+			}
+		}
+	}
+
+	results := append([]Result(nil), nearest.results...)
+	sortResults(results)
+	return results
+}
+
+func (h *HNSW) Remove(id int64) {
+	if node, ok := h.nodes[id]; ok && !node.deleted {
+		node.deleted = true
+		h.live--
+	}
+}
+
+func (h *HNSW) Search(query []float32, k int, filter Filter) []Result {
+	if k <= 0 || h.maxLevel < 0 {
+		return nil
+	}
+	query = normalise(query)
+
+	entry := h.entry
+	entryDistance := distance(query, h.nodes[entry].vector)
+	for layer := h.maxLevel; layer > 0; layer-- {
+		entry, entryDistance = h.greedy(query, entry, entryDistance, layer)
+	}
+
+	// widen the search when filtering or tombstones hide part of the neighbourhood, and
+	// keep doubling it while they hide so much that fewer than k results remain
+	ef := max(h.efSearch, k)
+	if filter != nil || h.live < len(h.nodes) {
+		ef = max(ef, 4*k)
+	}
+	for {
+		candidates := h.searchLayer(query, []Result{{ID: entry, Distance: entryDistance}}, ef, 0)
+		results := h.keep(candidates, k, filter)
+		if len(results) == k || len(candidates) < ef {
+			// fewer candidates than asked for means every node reachable was visited
+			if len(results) < k && len(candidates) < len(h.nodes) {
+				return h.exhaustive(query, k, filter)
+			}
+			return results
+		}
+		if ef >= len(h.nodes) {
+			return h.exhaustive(query, k, filter)
+		}
+		ef = min(2*ef, len(h.nodes))
+	}
+}
+
+// keep returns the first k candidates that are live and pass the filter
+func (h *HNSW) keep(candidates []Result, k int, filter Filter) []Result {
+	results := make([]Result, 0, k)
+	for _, candidate := range candidates {
+		if h.nodes[candidate.ID].deleted || (filter != nil && !filter(candidate.ID)) {
+			continue
+		}
+		results = append(results, candidate)
+		if len(results) == k {
+			break
+		}
+	}
+	return results
+}
+
+// exhaustive compares the query with every node, for filters so selective, or graphs so
+// disconnected by removals, that the graph search cannot find k results
+func (h *HNSW) exhaustive(query []float32, k int, filter Filter) []Result {
+	var results []Result
+	for id, node := range h.nodes {
+		if node.deleted || (filter != nil && !filter(id)) {
+			continue
+		}
+		results = append(results, Result{ID: id, Distance: distance(query, node.vector)})
+	}
+	sortResults(results)
+	if len(results) > k {
+		results = results[:k]
+	}
+	return results
+}
+
+// resultHeap is a min-heap of results by distance, or a max-heap if max is set
+type resultHeap struct {
+	results []Result
+	max     bool
+}
+
+func (r *resultHeap) Len() int { return len(r.results) }
+func (r *resultHeap) Less(i, j int) bool {
+	if r.max {
+		return r.results[i].Distance > r.results[j].Distance
+	}
+	return r.results[i].Distance < r.results[j].Distance
+}
+func (r *resultHeap) Swap(i, j int) { r.results[i], r.results[j] = r.results[j], r.results[i] }
+func (r *resultHeap) Push(x any)    { r.results = append(r.results, x.(Result)) }
+func (r *resultHeap) Pop() any {
+	last := r.results[len(r.results)-1]
+	r.results = r.results[:len(r.results)-1]
+	return last
+}
@@ -0,0 +1,113 @@
+// Package vecindex provides in-process nearest neighbour indexes over float32 vectors,
+// compared by cosine distance
+package vecindex
+
+import (
+	"math"
+	"sort"
+)
+
+// Result is a single neighbour of a query
+type Result struct {
+	ID       int64
+	Distance float64 // cosine distance, 1 - cosine similarity
+}
+
+// Filter reports whether an ID may be returned by a search. A nil Filter allows every ID
+type Filter func(id int64) bool
+
+// Index is a nearest neighbour index
+type Index interface {
+	// Add inserts or replaces the vector of id
+	Add(id int64, vector []float32)
+	// Remove deletes id from the index
+	Remove(id int64)
+	// Search returns up to k neighbours of query allowed by filter, nearest first
+	Search(query []float32, k int, filter Filter) []Result
+	// Len returns the number of vectors in the index
+	Len() int
+}
+
+// normalise returns a unit length copy of the vector, so that cosine distance reduces to
+// one minus the dot product. The zero vector is returned unchanged
+func normalise(vector []float32) []float32 {
+	var norm float64
+	for _, v := range vector {
+		norm += float64(v) * float64(v)
+	}
+	out := make([]float32, len(vector))
+	if norm == 0 {
+		copy(out, vector)
+		return out
+	}
+	scale := 1 / math.Sqrt(norm)
+	for i, v := range vector {
+		out[i] = float32(float64(v) * scale)
+	}
+	return out
+}
+
+// distance returns the cosine distance of two unit vectors
+func distance(a []float32, b []float32) float64 {
+	if len(a) != len(b) {
+		return 2
+	}
+	var dot float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+	}
+	return 1 - dot
+}
+
+// Flat is an exact index that compares the query with every vector
+type Flat struct {
+	vectors map[int64][]float32
+}
+
+// NewFlat creates an empty exact index
+func NewFlat() *Flat {
+	return &Flat{vectors: make(map[int64][]float32)}
+}
+
+func (f *Flat) Add(id int64, vector []float32) {
+	f.vectors[id] = normalise(vector)
+}
+
+func (f *Flat) Remove(id int64) {
+	delete(f.vectors, id)
+}
+
+func (f *Flat) Len() int {
+	return len(f.vectors)
+}
+
+func (f *Flat) Search(query []float32, k int, filter Filter) []Result {
+	if k <= 0 {
+		return nil
+	}
+	query = normalise(query)
+
+	results := make([]Result, 0, len(f.vectors))
+	for id, vector := range f.vectors {
+		if filter != nil && !filter(id) {
+			continue
+		}
+		results = append(results, Result{ID: id, Distance: distance(query, vector)})
+	}
+	sortResults(results)
+	if len(results) > k {
+		results = results[:k]
+	}
+	return results
+}
+
+// sortResults orders results nearest first, breaking ties by ID so that searches are
+// deterministic
+func sortResults(results []Result) {
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Distance != results[j].Distance {
+			return results[i].Distance < results[j].Distance
+		}
+		return results[i].ID < results[j].ID
+	})
+}
@@ -0,0 +1,140 @@
+package vecindex
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func randomVectors(n int, dims int, seed int64) [][]float32 {
+	rng := rand.New(rand.NewSource(seed))
+	vectors := make([][]float32, n)
+	for i := range vectors {
+		vectors[i] = make([]float32, dims)
+		for j := range vectors[i] {
+			vectors[i][j] = float32(rng.NormFloat64())
+		}
+	}
+	return vectors
+}
+
+func ids(results []Result) []int64 {
+	out := make([]int64, len(results))
+	for i, r := range results {
+		out[i] = r.ID
+	}
+	return out
+}
+
+func TestIndexes(t *testing.T) {
+	indexes := map[string]func() Index{
+		"flat": func() Index { return NewFlat() },
+		"hnsw": func() Index { return NewHNSW() },
+	}
+
+	for name, newIndex := range indexes {
+		t.Run(name, func(t *testing.T) {
+			t.Run("empty index", func(t *testing.T) {
+				assert.Empty(t, newIndex().Search([]float32{1, 0}, 3, nil))
+			})
+
+			t.Run("nearest first", func(t *testing.T) {
+				index := newIndex()
+				index.Add(1, []float32{1, 0})
+				index.Add(2, []float32{0, 1})
+				index.Add(3, []float32{1, 1})
+
+				results := index.Search([]float32{1, 0.1}, 2, nil)
+				assert.Equal(t, []int64{1, 3}, ids(results))
+				assert.InDelta(t, 0, results[0].Distance, 0.01)
+			})
+
+			t.Run("filter and remove", func(t *testing.T) {
+				index := newIndex()
+				index.Add(1, []float32{1, 0})
+				index.Add(2, []float32{0.9, 0.1})
+				index.Add(3, []float32{0, 1})
+
+				odd := func(id int64) bool { return id%2 == 1 }
+				assert.Equal(t, []int64{1, 3}, ids(index.Search([]float32{1, 0}, 3, odd)))
+
+				index.Remove(1)
+				assert.Equal(t, 2, index.Len())
+				assert.Equal(t, []int64{2, 3}, ids(index.Search([]float32{1, 0}, 3, nil)))
+			})
+
+			t.Run("replace", func(t *testing.T) {
+				index := newIndex()
+				index.Add(1, []float32{1, 0})
+				index.Add(2, []float32{0, 1})
+				index.Add(1, []float32{0, -1})
+
+				assert.Equal(t, 2, index.Len())
+				assert.Equal(t, []int64{1}, ids(index.Search([]float32{0, -1}, 1, nil)))
+			})
+		})
+	}
+}
+
+func TestHNSWRecall(t *testing.T) {
+	const (
+		n       = 2000
+		dims    = 32
+		k       = 10
+		queries = 50
+	)
+
+	vectors := randomVectors(n, dims, 1)
+	flat := NewFlat()
+	hnsw := NewHNSW(WithEfSearch(64))
+	for i, vector := range vectors {
+		flat.Add(int64(i), vector)
+		hnsw.Add(int64(i), vector)
+	}
+
+	hits := 0
+	for _, query := range randomVectors(queries, dims, 2) {
+		truth := make(map[int64]bool, k)
+		for _, r := range flat.Search(query, k, nil) {
+			truth[r.ID] = true
+		}
+		for _, r := range hnsw.Search(query, k, nil) {
+			if truth[r.ID] {
+				hits++
+			}
+		}
+	}
+
+	recall := float64(hits) / float64(queries*k)
+	assert.GreaterOrEqual(t, recall, 0.9, "recall@%d", k)
+}
+
+// TestHNSWSelectiveFilter checks a filter hiding nearly every node still leaves k results,
+// as the search widens until it finds them
+func TestHNSWSelectiveFilter(t *testing.T) {
+	const (
+		n    = 2000
+		dims = 32
+		k    = 10
+	)
+
+	vectors := randomVectors(n, dims, 3)
+	flat := NewFlat()
+	hnsw := NewHNSW()
+	for i, vector := range vectors {
+		flat.Add(int64(i), vector)
+		hnsw.Add(int64(i), vector)
+	}
+	rare := func(id int64) bool { return id%100 == 0 }
+
+	for _, query := range randomVectors(10, dims, 4) {
+		truth := ids(flat.Search(query, k, rare))
+		results := ids(hnsw.Search(query, k, rare))
+		assert.Len(t, results, k)
+		assert.Subset(t, truth, results[:k/2], "the nearest permitted nodes are found")
+
+		// asking for more than the filter permits returns every permitted node
+		assert.ElementsMatch(t, ids(flat.Search(query, 50, rare)), ids(hnsw.Search(query, 50, rare)))
+	}
+}
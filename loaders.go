@@ -0,0 +1,76 @@
+package dynarag
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/Predixus/DynaRAG/internal/splitter"
+	"github.com/Predixus/DynaRAG/loaders"
+	"github.com/Predixus/DynaRAG/types"
+)
+
+// ErrEncrypted is returned by IngestFile for documents that cannot be read without a
+// password
+var ErrEncrypted = loaders.ErrEncrypted
+
+// IngestFile reads a PDF, Word or plain text file, splits each of its pages or sections
+// into chunks, and stores them as a new version of the document at filePath, as Ingest
+// does. Each chunk carries the metadata of its page or section, such as {"page": 12},
+// along with the given metadata and the anchor under loaders.AnchorKey, so that retrieved
+// chunks are cited as report.pdf#page=12
+func (c *Client) IngestFile(
+	ctx context.Context,
+	filePath string,
+	metadata *types.JSONMap,
+	opts ...ChunkOption,
+) (*DocumentVersion, error) {
+	sections, err := loaders.Load(filePath)
+	if err != nil {
+		slog.Error("Could not load file", "file_path", filePath, "error", err)
+		return nil, err
+	}
+
+	split := splitter.ForPath(filePath)
+	var (
+		chunks    []string
+		metadatas []*types.JSONMap
+	)
+	for _, section := range sections {
+		chunkMetadata := sectionMetadata(metadata, section)
+		for _, chunk := range split(section.Text, splitter.DefaultChunkSize) {
+			chunks = append(chunks, chunk)
+			metadatas = append(metadatas, chunkMetadata)
+		}
+	}
+	return c.ingest(ctx, filePath, chunks, metadatas, opts)
+}
+
+// sectionMetadata merges the metadata of a section over the metadata given for the whole
+// file, returning the given metadata as it is if the section has none
+func sectionMetadata(metadata *types.JSONMap, section loaders.Section) *types.JSONMap {
+	if len(section.Metadata) == 0 && section.Anchor == "" {
+		return metadata
+	}
+	merged := types.JSONMap{}
+	if metadata != nil {
+		for key, value := range *metadata {
+			merged[key] = value
+		}
+	}
+	for key, value := range section.Metadata {
+		merged[key] = value
+	}
+	if section.Anchor != "" {
+		merged[loaders.AnchorKey] = section.Anchor
+	}
+	return &merged
+}
+
+// chunkSource returns the citation of a chunk: its file path, with the anchor of the page
+// or section it was taken from if it was stored by IngestFile
+func chunkSource(filePath string, metadata types.JSONMap) string {
+	if anchor, ok := metadata[loaders.AnchorKey].(string); ok && anchor != "" {
+		return filePath + "#" + anchor
+	}
+	return filePath
+}
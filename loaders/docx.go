@@ -0,0 +1,170 @@
+package loaders
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/Predixus/DynaRAG/types"
+)
+
+// wordNamespace is the namespace of the WordprocessingML elements of document.xml
+const wordNamespace = "http://schemas.openxmlformats.org/wordprocessingml/2006/main"
+
+// DOCX extracts the text of a Word document, an OOXML zip archive, split into sections at
+// its headings. A section is anchored by its number, as in report.docx#section=3, and its
+// heading is recorded in the metadata. Text before the first heading forms a section of
+// its own
+func DOCX(data []byte) ([]Section, error) {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open docx archive: %w", err)
+	}
+
+	var document *zip.File
+	for _, file := range archive.File {
+		if file.Name == "word/document.xml" {
+			document = file
+			break
+		}
+	}
+	if document == nil {
+		return nil, errors.New("docx archive has no word/document.xml")
+	}
+
+	r, err := document.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	paragraphs, err := docxParagraphs(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse docx document: %w", err)
+	}
+	return docxSections(paragraphs), nil
+}
+
+// docxParagraph is a paragraph of a Word document
+type docxParagraph struct {
+	text    string
+	heading bool
+}
+
+// docxParagraphs reads the paragraphs of document.xml in order. Tabs and breaks within a
+// paragraph are kept, and cells of tables read as paragraphs of their own
+func docxParagraphs(r io.Reader) ([]docxParagraph, error) {
+	decoder := xml.NewDecoder(r)
+
+	var (
+		paragraphs []docxParagraph
+		current    strings.Builder
+		heading    bool
+		inText     bool
+	)
+	for {
+		token, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			return paragraphs, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			if t.Name.Space != wordNamespace {
+				continue
+			}
+			switch t.Name.Local {
+			case "p":
+				current.Reset()
+				heading = false
+			case "pStyle":
+				heading = heading || isHeadingStyle(attr(t, "val"))
+			case "outlineLvl":
+				heading = true
+			case "t":
+				inText = true
+			case "tab":
+				current.WriteByte('\t')
+			case "br", "cr":
+				current.WriteByte('\n')
+			}
+		case xml.EndElement:
+			if t.Name.Space != wordNamespace {
+				continue
+			}
+			switch t.Name.Local {
+			case "t":
+				inText = false
+			case "p":
+				text := strings.TrimSpace(current.String())
+				if text != "" {
+					paragraphs = append(paragraphs, docxParagraph{text: text, heading: heading})
+				}
+			}
+		case xml.CharData:
+			if inText {
+				current.Write(t)
+			}
+		}
+	}
+}
+
+// isHeadingStyle reports whether a paragraph style is a title or heading. Built in styles
+// are named Title and Heading1 to Heading9 in English documents
+func isHeadingStyle(style string) bool {
+	style = strings.ToLower(style)
+	return style == "title" || strings.HasPrefix(style, "heading")
+}
+
+// attr returns the value of an attribute of a WordprocessingML element
+func attr(element xml.StartElement, local string) string {
+	for _, a := range element.Attr {
+		if a.Name.Local == local {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// docxSections groups paragraphs into sections, each starting at a heading
+func docxSections(paragraphs []docxParagraph) []Section {
+	var (
+		sections []Section
+		body     []string
+		title    string
+	)
+	flush := func() {
+		if len(body) == 0 {
+			return
+		}
+		number := len(sections) + 1
+		metadata := types.JSONMap{"section": number}
+		if title != "" {
+			metadata["heading"] = title
+		}
+		sections = append(sections, Section{
+			Text:     strings.Join(body, "\n\n"),
+			Anchor:   "section=" + strconv.Itoa(number),
+			Metadata: metadata,
+		})
+		body = nil
+	}
+
+	for _, paragraph := range paragraphs {
+		if paragraph.heading {
+			flush()
+			title = paragraph.text
+		}
+		body = append(body, paragraph.text)
+	}
+	flush()
+	return sections
+}
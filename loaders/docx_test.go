@@ -0,0 +1,60 @@
+package loaders
+
+import (
+	"archive/zip"
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Predixus/DynaRAG/types"
+)
+
+// buildDOCX returns a Word document whose body is the given WordprocessingML
+func buildDOCX(t *testing.T, body string) []byte {
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	w, err := archive.Create("word/document.xml")
+	require.NoError(t, err)
+	_, err = w.Write([]byte(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` +
+		`<w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main">` +
+		`<w:body>` + body + `</w:body></w:document>`))
+	require.NoError(t, err)
+	require.NoError(t, archive.Close())
+	return buf.Bytes()
+}
+
+// TestDOCX checks documents are split into sections at their headings
+func TestDOCX(t *testing.T) {
+	data := buildDOCX(t, ``+
+		`<w:p><w:r><w:t>Preface text.</w:t></w:r></w:p>`+
+		`<w:p><w:pPr><w:pStyle w:val="Heading1"/></w:pPr><w:r><w:t>Scope</w:t></w:r></w:p>`+
+		`<w:p><w:r><w:t xml:space="preserve">Applies to </w:t></w:r><w:r><w:t>all teams.</w:t></w:r></w:p>`+
+		`<w:p><w:r><w:t>Name</w:t><w:tab/><w:t>Role</w:t></w:r></w:p>`+
+		`<w:p><w:pPr><w:outlineLvl w:val="1"/></w:pPr><w:r><w:t>Contacts</w:t></w:r></w:p>`+
+		`<w:p><w:r><w:t>Ask</w:t><w:br/><w:t>the desk.</w:t></w:r></w:p>`+
+		`<w:p></w:p>`,
+	)
+
+	sections, err := DOCX(data)
+	require.NoError(t, err)
+	assert.Equal(t, []Section{
+		{
+			Text:     "Preface text.",
+			Anchor:   "section=1",
+			Metadata: types.JSONMap{"section": 1},
+		},
+		{
+			Text:     "Scope\n\nApplies to all teams.\n\nName\tRole",
+			Anchor:   "section=2",
+			Metadata: types.JSONMap{"section": 2, "heading": "Scope"},
+		},
+		{
+			Text:     "Contacts\n\nAsk\nthe desk.",
+			Anchor:   "section=3",
+			Metadata: types.JSONMap{"section": 3, "heading": "Contacts"},
+		},
+	}, sections)
+	assert.Equal(t, "handbook.docx#section=2", sections[1].Source("handbook.docx"))
+}
@@ -0,0 +1,61 @@
+// Package loaders extracts the text of PDF, Word and plain text files for chunking. Each
+// loader returns the sections of a document, such as the pages of a PDF, with metadata
+// describing them and an anchor that cites them, as in report.pdf#page=12
+package loaders
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Predixus/DynaRAG/types"
+)
+
+// AnchorKey is the chunk metadata key holding the anchor of the section a chunk was taken
+// from. Citations of the chunk append it to the file path after a #
+const AnchorKey = "source_anchor"
+
+// ErrEncrypted is returned for documents that cannot be read without a password
+var ErrEncrypted = errors.New("document is encrypted")
+
+// Section is a part of a document that can be cited on its own
+type Section struct {
+	Text     string
+	Anchor   string        // the fragment citing the section, such as "page=12". Empty for a whole document
+	Metadata types.JSONMap // describes the section, such as {"page": 12}
+}
+
+// Source returns the citation of the section within the file at filePath
+func (s Section) Source(filePath string) string {
+	if s.Anchor == "" {
+		return filePath
+	}
+	return filePath + "#" + s.Anchor
+}
+
+// Func extracts the sections of a document
+type Func func(data []byte) ([]Section, error)
+
+// ForPath returns the loader of a file by its extension: PDF, DOCX, or Text for everything
+// else
+func ForPath(filePath string) Func {
+	switch strings.ToLower(filepath.Ext(filePath)) {
+	case ".pdf":
+		return PDF
+	case ".docx":
+		return DOCX
+	default:
+		return Text
+	}
+}
+
+// Load reads the file at filePath and extracts its sections with the loader of its
+// extension
+func Load(filePath string) ([]Section, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	return ForPath(filePath)(data)
+}
@@ -0,0 +1,801 @@
+package loaders
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/zlib"
+	"encoding/ascii85"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Predixus/DynaRAG/types"
+)
+
+// PDF extracts the text of a PDF document page by page, skipping pages without text. A
+// page is anchored by its number, as in report.pdf#page=12, which is also recorded in the
+// metadata. Text is read from the content streams of the pages and the forms they draw,
+// mapped to Unicode through the fonts' ToUnicode maps or encodings. Scanned pages have no
+// text to extract
+func PDF(data []byte) ([]Section, error) {
+	doc, err := parsePDF(data)
+	if err != nil {
+		return nil, err
+	}
+
+	pages, err := doc.pages()
+	if err != nil {
+		return nil, err
+	}
+
+	var sections []Section
+	for i, page := range pages {
+		text := doc.pageText(page)
+		if text == "" {
+			continue
+		}
+		number := i + 1
+		sections = append(sections, Section{
+			Text:     text,
+			Anchor:   "page=" + strconv.Itoa(number),
+			Metadata: types.JSONMap{"page": number},
+		})
+	}
+	return sections, nil
+}
+
+// The values of PDF objects. Numbers are float64, booleans bool and null nil
+type (
+	pdfName    string // a name, without its leading slash
+	pdfKeyword string // an operator, or a delimiter such as [ or <<
+	pdfString  []byte // the raw bytes of a string, decoded by the font that shows it
+	pdfArray   []any
+	pdfDict    map[pdfName]any
+	pdfRef     int // a reference to an indirect object by number
+)
+
+// pdfStream is a stream object with its still encoded data
+type pdfStream struct {
+	dict pdfDict
+	raw  []byte
+}
+
+// maxStreamSize is the most a stream is inflated to, which keeps a small compressed
+// stream from taking all the memory there is
+const maxStreamSize = 64 << 20
+
+// pdfObjectHeader finds the indirect objects of a file, "12 0 obj"
+var pdfObjectHeader = regexp.MustCompile(`(\d+)\s+\d+\s+obj\b`)
+
+// pdfDocument holds the objects of a PDF. Objects are found by scanning the file rather
+// than through its cross reference table, which tolerates damaged tables, and later
+// definitions win as in incremental updates
+type pdfDocument struct {
+	data       []byte
+	offsets    map[int]int // object number to the offset after its header
+	compressed map[int]any // objects held in object streams
+	objects    map[int]any // parsed objects
+	resolving  map[int]bool
+	fonts      map[pdfRef]*pdfFont
+}
+
+func parsePDF(data []byte) (*pdfDocument, error) {
+	if !bytes.Contains(data[:min(len(data), 1024)], []byte("%PDF-")) {
+		return nil, errors.New("not a PDF document")
+	}
+
+	doc := &pdfDocument{
+		data:       data,
+		offsets:    make(map[int]int),
+		compressed: make(map[int]any),
+		objects:    make(map[int]any),
+		resolving:  make(map[int]bool),
+		fonts:      make(map[pdfRef]*pdfFont),
+	}
+	for _, match := range pdfObjectHeader.FindAllSubmatchIndex(data, -1) {
+		if match[0] > 0 && !isPDFWhite(data[match[0]-1]) && !isPDFDelimiter(data[match[0]-1]) {
+			continue
+		}
+		number, err := strconv.Atoi(string(data[match[2]:match[3]]))
+		if err != nil {
+			continue
+		}
+		doc.offsets[number] = match[1]
+	}
+	if len(doc.offsets) == 0 {
+		return nil, errors.New("PDF document has no objects")
+	}
+
+	for _, number := range doc.numbers() {
+		stream, ok := doc.object(number).(*pdfStream)
+		if ok && stream.dict["Type"] == pdfName("ObjStm") {
+			doc.loadObjectStream(stream)
+		}
+	}
+	return doc, nil
+}
+
+// numbers returns the numbers of the objects at the top level of the file, in file order
+func (d *pdfDocument) numbers() []int {
+	numbers := make([]int, 0, len(d.offsets))
+	for number := range d.offsets {
+		numbers = append(numbers, number)
+	}
+	sort.Slice(numbers, func(i, j int) bool {
+		return d.offsets[numbers[i]] < d.offsets[numbers[j]]
+	})
+	return numbers
+}
+
+// loadObjectStream parses the objects held in an object stream. Objects defined at the
+// top level of the file take precedence. Offsets outside the stream are skipped
+func (d *pdfDocument) loadObjectStream(stream *pdfStream) {
+	data, err := d.decode(stream)
+	if err != nil {
+		return
+	}
+	count, _ := d.resolve(stream.dict["N"]).(float64)
+	first, _ := d.resolve(stream.dict["First"]).(float64)
+	// compared as floats, as huge values do not convert to int
+	if !(first > 0) || first > float64(len(data)) || !(count > 0) {
+		return
+	}
+	start := int(first)
+	// every object takes two numbers of the header, so a count beyond its size is wrong
+	count = min(count, first/2)
+
+	header := &pdfLexer{data: data[:start]}
+	for i := 0; i < int(count); i++ {
+		number, err1 := header.token()
+		offset, err2 := header.token()
+		n, ok1 := number.(float64)
+		o, ok2 := offset.(float64)
+		if err1 != nil || err2 != nil || !ok1 || !ok2 {
+			return
+		}
+		if o < 0 || o >= float64(len(data)-start) {
+			continue
+		}
+		if _, defined := d.offsets[int(n)]; defined {
+			continue
+		}
+		body := &pdfLexer{data: data, pos: start + int(o)}
+		if value, err := body.object(); err == nil {
+			d.compressed[int(n)] = value
+		}
+	}
+}
+
+// object returns the indirect object with the given number, or nil if there is none
+func (d *pdfDocument) object(number int) any {
+	if value, ok := d.objects[number]; ok {
+		return value
+	}
+	if value, ok := d.compressed[number]; ok {
+		return value
+	}
+	offset, ok := d.offsets[number]
+	if !ok || d.resolving[number] {
+		return nil
+	}
+	d.resolving[number] = true
+	defer delete(d.resolving, number)
+
+	lexer := &pdfLexer{data: d.data, pos: offset}
+	value, err := lexer.object()
+	if err != nil {
+		d.objects[number] = nil
+		return nil
+	}
+	if dict, ok := value.(pdfDict); ok {
+		save := lexer.pos
+		if token, err := lexer.token(); err == nil && token == pdfKeyword("stream") {
+			value = &pdfStream{dict: dict, raw: d.streamData(dict, lexer.pos)}
+		} else {
+			lexer.pos = save
+		}
+	}
+	d.objects[number] = value
+	return value
+}
+
+// streamData returns the data of a stream starting after its stream keyword. The length
+// in the stream's dictionary is checked against the endstream keyword, which is searched
+// for if the length is wrong
+func (d *pdfDocument) streamData(dict pdfDict, pos int) []byte {
+	if pos < len(d.data) && d.data[pos] == '\r' {
+		pos++
+	}
+	if pos < len(d.data) && d.data[pos] == '\n' {
+		pos++
+	}
+
+	if length, ok := d.resolve(dict["Length"]).(float64); ok && length >= 0 {
+		if length <= float64(len(d.data)-pos) {
+			end := pos + int(length)
+			rest := bytes.TrimLeft(d.data[end:min(end+32, len(d.data))], "\r\n\t\f ")
+			if bytes.HasPrefix(rest, []byte("endstream")) {
+				return d.data[pos:end]
+			}
+		}
+	}
+
+	end := bytes.Index(d.data[pos:], []byte("endstream"))
+	if end < 0 {
+		return d.data[pos:]
+	}
+	return bytes.TrimRight(d.data[pos:pos+end], "\r\n")
+}
+
+// resolve follows a reference to the object it refers to. Other values are returned as
+// they are
+func (d *pdfDocument) resolve(value any) any {
+	for i := 0; i < 32; i++ {
+		ref, ok := value.(pdfRef)
+		if !ok {
+			return value
+		}
+		value = d.object(int(ref))
+	}
+	return nil
+}
+
+// dict resolves a value that should be a dictionary, or the dictionary of a stream
+func (d *pdfDocument) dict(value any) pdfDict {
+	switch v := d.resolve(value).(type) {
+	case pdfDict:
+		return v
+	case *pdfStream:
+		return v.dict
+	default:
+		return nil
+	}
+}
+
+// decode returns the data of a stream with its filters undone
+func (d *pdfDocument) decode(stream *pdfStream) ([]byte, error) {
+	var filters, params []any
+	switch f := d.resolve(stream.dict["Filter"]).(type) {
+	case pdfName:
+		filters = []any{f}
+	case pdfArray:
+		filters = f
+	}
+	switch p := d.resolve(stream.dict["DecodeParms"]).(type) {
+	case pdfDict:
+		params = []any{p}
+	case pdfArray:
+		params = p
+	}
+
+	data := stream.raw
+	for i, filter := range filters {
+		var err error
+		switch d.resolve(filter) {
+		case pdfName("FlateDecode"), pdfName("Fl"):
+			data, err = inflate(data)
+			if err == nil && i < len(params) {
+				data, err = unpredict(data, d.dict(params[i]), d)
+			}
+		case pdfName("ASCIIHexDecode"), pdfName("AHx"):
+			data, err = decodeASCIIHex(data)
+		case pdfName("ASCII85Decode"), pdfName("A85"):
+			data, err = decodeASCII85(data)
+		default:
+			err = fmt.Errorf("unsupported stream filter %v", filter)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+// inflate undoes FlateDecode, keeping what could be read of a truncated stream. Streams
+// inflating to more than maxStreamSize are refused
+func inflate(data []byte) ([]byte, error) {
+	var r io.ReadCloser
+	r, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		r = flate.NewReader(bytes.NewReader(data)) // a raw deflate stream without header
+	}
+	defer r.Close()
+
+	out, err := io.ReadAll(io.LimitReader(r, maxStreamSize+1))
+	if len(out) > maxStreamSize {
+		return nil, fmt.Errorf("stream inflates to more than %d bytes", maxStreamSize)
+	}
+	if err != nil && len(out) == 0 {
+		return nil, err
+	}
+	return out, nil
+}
+
+// unpredict undoes the PNG predictors of FlateDecode, used mainly by cross reference and
+// object streams
+func unpredict(data []byte, params pdfDict, d *pdfDocument) ([]byte, error) {
+	predictor, _ := d.resolve(params["Predictor"]).(float64)
+	if predictor < 10 {
+		return data, nil
+	}
+	columns := 1.0
+	if c, ok := d.resolve(params["Columns"]).(float64); ok && c > 0 {
+		columns = c
+	}
+	colors := 1.0
+	if c, ok := d.resolve(params["Colors"]).(float64); ok && c > 0 {
+		colors = c
+	}
+	bits := 8.0
+	if b, ok := d.resolve(params["BitsPerComponent"]).(float64); ok && b > 0 {
+		bits = b
+	}
+	// the size of a row is worked out in floats, as huge parameters overflow an int
+	rowBits := math.Floor(columns) * math.Floor(colors) * math.Floor(bits)
+	if !(rowBits > 0) || rowBits > maxStreamSize*8 {
+		return nil, fmt.Errorf("unsupported predictor row of %g bits", rowBits)
+	}
+	pixel := max(1, int(colors)*int(bits)/8)
+	row := (int(rowBits) + 7) / 8
+	if row > len(data) {
+		return nil, fmt.Errorf("predictor row of %d bytes is longer than the stream", row)
+	}
+
+	var out []byte
+	prev := make([]byte, row)
+	for start := 0; start+row+1 <= len(data); start += row + 1 {
+		kind, line := data[start], append([]byte(nil), data[start+1:start+1+row]...)
+		for i := range line {
+			var left, up, upLeft byte
+			if i >= pixel {
+				left, upLeft = line[i-pixel], prev[i-pixel]
+			}
+			up = prev[i]
+			switch kind {
+			case 1:
+				line[i] += left
+			case 2:
+				line[i] += up
+			case 3:
+				line[i] += byte((int(left) + int(up)) / 2)
+			case 4:
+				line[i] += paeth(left, up, upLeft)
+			}
+		}
+		out = append(out, line...)
+		prev = line
+	}
+	return out, nil
+}
+
+func paeth(a, b, c byte) byte {
+	p := int(a) + int(b) - int(c)
+	pa, pb, pc := abs(p-int(a)), abs(p-int(b)), abs(p-int(c))
+	switch {
+	case pa <= pb && pa <= pc:
+		return a
+	case pb <= pc:
+		return b
+	default:
+		return c
+	}
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+func decodeASCIIHex(data []byte) ([]byte, error) {
+	var digits []byte
+	for _, b := range data {
+		if b == '>' {
+			break
+		}
+		if !isPDFWhite(b) {
+			digits = append(digits, b)
+		}
+	}
+	if len(digits)%2 != 0 {
+		digits = append(digits, '0')
+	}
+	out := make([]byte, len(digits)/2)
+	_, err := hex.Decode(out, digits)
+	return out, err
+}
+
+func decodeASCII85(data []byte) ([]byte, error) {
+	data = bytes.TrimPrefix(bytes.TrimSpace(data), []byte("<~"))
+	if end := bytes.Index(data, []byte("~>")); end >= 0 {
+		data = data[:end]
+	}
+	out := make([]byte, len(data))
+	n, _, err := ascii85.Decode(out, data, true)
+	return out[:n], err
+}
+
+// pdfPage is a page of the document with the resources it inherits
+type pdfPage struct {
+	dict      pdfDict
+	resources pdfDict
+}
+
+// pages returns the pages of the document in order
+func (d *pdfDocument) pages() ([]pdfPage, error) {
+	catalog, err := d.catalog()
+	if err != nil {
+		return nil, err
+	}
+
+	var pages []pdfPage
+	visited := make(map[pdfRef]bool)
+	var walk func(node any, resources pdfDict)
+	walk = func(node any, resources pdfDict) {
+		if ref, ok := node.(pdfRef); ok {
+			if visited[ref] {
+				return
+			}
+			visited[ref] = true
+		}
+		dict := d.dict(node)
+		if dict == nil {
+			return
+		}
+		if own := d.dict(dict["Resources"]); own != nil {
+			resources = own
+		}
+		if kids, ok := d.resolve(dict["Kids"]).(pdfArray); ok {
+			for _, kid := range kids {
+				walk(kid, resources)
+			}
+			return
+		}
+		if dict["Type"] == pdfName("Page") || dict["Contents"] != nil {
+			pages = append(pages, pdfPage{dict: dict, resources: resources})
+		}
+	}
+	walk(catalog["Pages"], nil)
+
+	if len(pages) == 0 {
+		return nil, errors.New("PDF document has no pages")
+	}
+	return pages, nil
+}
+
+// catalog returns the root of the document, named by the last trailer or cross reference
+// stream of the file, or failing that the last catalog object
+func (d *pdfDocument) catalog() (pdfDict, error) {
+	var trailers []pdfDict
+	if at := bytes.LastIndex(d.data, []byte("trailer")); at >= 0 {
+		lexer := &pdfLexer{data: d.data, pos: at + len("trailer")}
+		if value, err := lexer.object(); err == nil {
+			if dict, ok := value.(pdfDict); ok {
+				trailers = append(trailers, dict)
+			}
+		}
+	}
+	numbers := d.numbers()
+	for i := len(numbers) - 1; i >= 0; i-- {
+		if stream, ok := d.object(numbers[i]).(*pdfStream); ok && stream.dict["Type"] == pdfName("XRef") {
+			trailers = append(trailers, stream.dict)
+		}
+	}
+
+	for _, trailer := range trailers {
+		if trailer["Encrypt"] != nil {
+			return nil, ErrEncrypted
+		}
+	}
+	for _, trailer := range trailers {
+		if root := d.dict(trailer["Root"]); root != nil {
+			return root, nil
+		}
+	}
+
+	var objects []any
+	for i := len(numbers) - 1; i >= 0; i-- {
+		objects = append(objects, d.object(numbers[i]))
+	}
+	for _, value := range d.compressed {
+		objects = append(objects, value)
+	}
+	for _, value := range objects {
+		if dict, ok := value.(pdfDict); ok && dict["Type"] == pdfName("Catalog") {
+			return dict, nil
+		}
+	}
+	return nil, errors.New("PDF document has no catalog")
+}
+
+// pageText returns the text of a page with its lines trimmed and blank lines dropped
+func (d *pdfDocument) pageText(page pdfPage) string {
+	extractor := &pdfTextExtractor{doc: d}
+	switch contents := d.resolve(page.dict["Contents"]).(type) {
+	case *pdfStream:
+		extractor.run(contents, page.resources)
+	case pdfArray:
+		// the streams of a page are one content stream split at token boundaries
+		var joined []byte
+		for _, part := range contents {
+			if stream, ok := d.resolve(part).(*pdfStream); ok {
+				if data, err := d.decode(stream); err == nil {
+					joined = append(append(joined, data...), '\n')
+				}
+			}
+		}
+		extractor.runContent(joined, page.resources)
+	}
+
+	var lines []string
+	for _, line := range strings.Split(extractor.out.String(), "\n") {
+		if line = strings.Join(strings.Fields(line), " "); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// pdfLexer reads the tokens and objects of PDF syntax
+type pdfLexer struct {
+	data []byte
+	pos  int
+}
+
+func isPDFWhite(b byte) bool {
+	return b == 0 || b == '\t' || b == '\n' || b == '\f' || b == '\r' || b == ' '
+}
+
+func isPDFDelimiter(b byte) bool {
+	return strings.IndexByte("()<>[]{}/%", b) >= 0
+}
+
+// skipSpace skips whitespace and comments
+func (l *pdfLexer) skipSpace() {
+	for l.pos < len(l.data) {
+		switch b := l.data[l.pos]; {
+		case isPDFWhite(b):
+			l.pos++
+		case b == '%':
+			for l.pos < len(l.data) && l.data[l.pos] != '\n' && l.data[l.pos] != '\r' {
+				l.pos++
+			}
+		default:
+			return
+		}
+	}
+}
+
+// token returns the next token: a number, name, string, boolean, null, or keyword for
+// operators and delimiters. It returns io.EOF at the end of the data
+func (l *pdfLexer) token() (any, error) {
+	l.skipSpace()
+	if l.pos >= len(l.data) {
+		return nil, io.EOF
+	}
+
+	switch b := l.data[l.pos]; b {
+	case '/':
+		l.pos++
+		return pdfName(l.regular()), nil
+	case '(':
+		l.pos++
+		return l.literalString(), nil
+	case '<':
+		if l.pos+1 < len(l.data) && l.data[l.pos+1] == '<' {
+			l.pos += 2
+			return pdfKeyword("<<"), nil
+		}
+		l.pos++
+		return l.hexString(), nil
+	case '>':
+		l.pos++
+		if l.pos < len(l.data) && l.data[l.pos] == '>' {
+			l.pos++
+			return pdfKeyword(">>"), nil
+		}
+		return pdfKeyword(">"), nil
+	case '[', ']', '{', '}', ')':
+		l.pos++
+		return pdfKeyword(string(b)), nil
+	}
+
+	word := l.regular()
+	if word == "" {
+		l.pos++ // a stray delimiter
+		return pdfKeyword(""), nil
+	}
+	switch word {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "null":
+		return nil, nil
+	}
+	if b := word[0]; b == '+' || b == '-' || b == '.' || (b >= '0' && b <= '9') {
+		if number, err := strconv.ParseFloat(word, 64); err == nil {
+			return number, nil
+		}
+	}
+	return pdfKeyword(word), nil
+}
+
+// regular reads a run of regular characters, decoding the #xx escapes of names
+func (l *pdfLexer) regular() string {
+	start := l.pos
+	for l.pos < len(l.data) && !isPDFWhite(l.data[l.pos]) && !isPDFDelimiter(l.data[l.pos]) {
+		l.pos++
+	}
+	word := string(l.data[start:l.pos])
+	if !strings.Contains(word, "#") {
+		return word
+	}
+
+	var decoded strings.Builder
+	for i := 0; i < len(word); i++ {
+		if word[i] == '#' && i+2 < len(word) {
+			if b, err := strconv.ParseUint(word[i+1:i+3], 16, 8); err == nil {
+				decoded.WriteByte(byte(b))
+				i += 2
+				continue
+			}
+		}
+		decoded.WriteByte(word[i])
+	}
+	return decoded.String()
+}
+
+// literalString reads a string in parentheses, after the opening one
+func (l *pdfLexer) literalString() pdfString {
+	var out []byte
+	depth := 1
+	for l.pos < len(l.data) {
+		b := l.data[l.pos]
+		l.pos++
+		switch b {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return out
+			}
+		case '\r':
+			if l.pos < len(l.data) && l.data[l.pos] == '\n' {
+				l.pos++
+			}
+			b = '\n'
+		case '\\':
+			if l.pos >= len(l.data) {
+				return out
+			}
+			e := l.data[l.pos]
+			l.pos++
+			switch e {
+			case 'n':
+				b = '\n'
+			case 'r':
+				b = '\r'
+			case 't':
+				b = '\t'
+			case 'b':
+				b = '\b'
+			case 'f':
+				b = '\f'
+			case '\r', '\n':
+				// a line continuation
+				if e == '\r' && l.pos < len(l.data) && l.data[l.pos] == '\n' {
+					l.pos++
+				}
+				continue
+			default:
+				if e >= '0' && e <= '7' {
+					value := int(e - '0')
+					for i := 0; i < 2 && l.pos < len(l.data) && l.data[l.pos] >= '0' && l.data[l.pos] <= '7'; i++ {
+						value = value*8 + int(l.data[l.pos]-'0')
+						l.pos++
+					}
+					b = byte(value)
+				} else {
+					b = e
+				}
+			}
+		}
+		out = append(out, b)
+	}
+	return out
+}
+
+// hexString reads a string in angle brackets, after the opening one
+func (l *pdfLexer) hexString() pdfString {
+	start := l.pos
+	for l.pos < len(l.data) && l.data[l.pos] != '>' {
+		l.pos++
+	}
+	out, _ := decodeASCIIHex(l.data[start:l.pos])
+	l.pos++
+	return out
+}
+
+// object reads a complete object, resolving "12 0 R" into a reference
+func (l *pdfLexer) object() (any, error) {
+	token, err := l.token()
+	if err != nil {
+		return nil, err
+	}
+	return l.objectFrom(token, true)
+}
+
+// objectFrom completes the object starting with token. References are only recognised
+// if refs is set, as content streams have none and are full of numbers
+func (l *pdfLexer) objectFrom(token any, refs bool) (any, error) {
+	switch t := token.(type) {
+	case float64:
+		if !refs || t != math.Trunc(t) || t < 0 {
+			return t, nil
+		}
+		save := l.pos
+		if generation, err := l.token(); err == nil {
+			if g, ok := generation.(float64); ok && g == math.Trunc(g) {
+				if r, err := l.token(); err == nil && r == pdfKeyword("R") {
+					return pdfRef(int(t)), nil
+				}
+			}
+		}
+		l.pos = save
+		return t, nil
+	case pdfKeyword:
+		switch t {
+		case "[":
+			array := pdfArray{}
+			for {
+				next, err := l.token()
+				if err != nil {
+					return array, err
+				}
+				if next == pdfKeyword("]") {
+					return array, nil
+				}
+				item, err := l.objectFrom(next, refs)
+				if err != nil {
+					return array, err
+				}
+				array = append(array, item)
+			}
+		case "<<":
+			dict := pdfDict{}
+			for {
+				next, err := l.token()
+				if err != nil {
+					return dict, err
+				}
+				if next == pdfKeyword(">>") {
+					return dict, nil
+				}
+				key, ok := next.(pdfName)
+				if !ok {
+					continue
+				}
+				value, err := l.token()
+				if err != nil {
+					return dict, err
+				}
+				if value == pdfKeyword(">>") {
+					return dict, nil
+				}
+				if dict[key], err = l.objectFrom(value, refs); err != nil {
+					return dict, err
+				}
+			}
+		}
+	}
+	return token, nil
+}
@@ -0,0 +1,184 @@
+package loaders
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Predixus/DynaRAG/types"
+)
+
+// buildPDF returns a PDF file of the given objects, numbered from 1, with object 1 as
+// its catalog
+func buildPDF(objects ...string) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.7\n%\xE2\xE3\xCF\xD3\n")
+	offsets := make([]int, len(objects))
+	for i, object := range objects {
+		offsets[i] = buf.Len()
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", i+1, object)
+	}
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	return buf.Bytes()
+}
+
+// stream returns a stream object holding data, compressed with FlateDecode if deflate
+// is set
+func stream(data string, deflate bool) string {
+	if !deflate {
+		return fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(data), data)
+	}
+	var buf bytes.Buffer
+	w := zlib.NewWriter(&buf)
+	w.Write([]byte(data))
+	w.Close()
+	return fmt.Sprintf("<< /Length %d /Filter /FlateDecode >>\nstream\n%s\nendstream", buf.Len(), buf.String())
+}
+
+// TestPDF checks text is extracted page by page through simple and composite fonts
+func TestPDF(t *testing.T) {
+	toUnicode := "/CIDInit /ProcSet findresource begin\n" +
+		"begincmap\n1 begincodespacerange\n<0000> <FFFF>\nendcodespacerange\n" +
+		"2 beginbfchar\n<0001> <0048>\n<0002> <00E9>\nendbfchar\n" +
+		"1 beginbfrange\n<0010> <0012> <0061>\nendbfrange\nendcmap\n"
+
+	data := buildPDF(
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R 4 0 R 5 0 R] /Count 3 /Resources << /Font << /F1 6 0 R >> >> >>",
+		"<< /Type /Page /Parent 2 0 R /Contents 7 0 R >>",
+		"<< /Type /Page /Parent 2 0 R /Contents 8 0 R >>",
+		"<< /Type /Page /Parent 2 0 R /Contents [9 0 R 10 0 R] /Resources << /Font << /F2 11 0 R >> >> >>",
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding << /Differences [39 /quoteright] >> >>",
+		stream("BT /F1 12 Tf 72 712 Td (Annual report) Tj 0 -14 Td (It\\222s \\(mostly\\) good) Tj "+
+			"[(Caf) 20 (\\351)] TJ ET", false),
+		stream("% a page without text\n0 0 m 100 100 l S", false),
+		stream("BT /F2 10 Tf 72 700 Td [<0001> -300 <0010> 10 <0011>] TJ", true),
+		stream("[<0012>] TJ T* <0002> Tj ET", true),
+		"<< /Type /Font /Subtype /Type0 /BaseFont /Custom /ToUnicode 12 0 R >>",
+		stream(toUnicode, true),
+	)
+
+	sections, err := PDF(data)
+	require.NoError(t, err)
+	assert.Equal(t, []Section{
+		{
+			Text:     "Annual report\nIt’s (mostly) goodCafé",
+			Anchor:   "page=1",
+			Metadata: types.JSONMap{"page": 1},
+		},
+		{
+			Text:     "H abc\né",
+			Anchor:   "page=3",
+			Metadata: types.JSONMap{"page": 3},
+		},
+	}, sections)
+	assert.Equal(t, "report.pdf#page=3", sections[1].Source("report.pdf"))
+}
+
+// TestPDFEncrypted checks encrypted documents are refused
+func TestPDFEncrypted(t *testing.T) {
+	data := bytes.Replace(
+		buildPDF("<< /Type /Catalog /Pages 2 0 R >>", "<< /Type /Pages /Kids [] /Count 0 >>"),
+		[]byte("/Root 1 0 R"),
+		[]byte("/Root 1 0 R /Encrypt << /Filter /Standard >>"),
+		1,
+	)
+	_, err := PDF(data)
+	assert.ErrorIs(t, err, ErrEncrypted)
+}
+
+// TestPDFObjectStreams checks objects are read from object streams, and that malformed
+// streams are skipped rather than read out of bounds
+func TestPDFObjectStreams(t *testing.T) {
+	// objectStream holds the pages of the document as objects 2 and 3 at the given
+	// offsets, with the given N and First
+	objectStream := func(n string, first string, offsets ...string) string {
+		header := fmt.Sprintf("2 %s 3 %s ", offsets[0], offsets[1])
+		body := "<< /Type /Pages /Kids [3 0 R] /Count 1 >> << /Type /Page /Parent 2 0 R /Contents 5 0 R >>"
+		if first == "" {
+			first = fmt.Sprint(len(header))
+		}
+		var buf bytes.Buffer
+		w := zlib.NewWriter(&buf)
+		w.Write([]byte(header + body))
+		w.Close()
+		return fmt.Sprintf(
+			"<< /Type /ObjStm /N %s /First %s /Length %d /Filter /FlateDecode >>\nstream\n%s\nendstream",
+			n, first, buf.Len(), buf.String(),
+		)
+	}
+	// objects 2 and 3 are only held by the object stream
+	document := func(objectStream string) []byte {
+		data := buildPDF(
+			"<< /Type /Catalog /Pages 2 0 R >>",
+			"null",
+			"null",
+			objectStream,
+			stream("BT (Packed) Tj ET", false),
+		)
+		data = bytes.Replace(data, []byte("2 0 obj\nnull"), []byte("% 0 obj\nnull"), 1)
+		return bytes.Replace(data, []byte("3 0 obj\nnull"), []byte("% 0 obj\nnull"), 1)
+	}
+
+	sections, err := PDF(document(objectStream("2", "", "0", "42")))
+	require.NoError(t, err)
+	require.Len(t, sections, 1)
+	assert.Equal(t, "Packed", sections[0].Text)
+
+	for name, stream := range map[string]string{
+		"negative offset": objectStream("2", "", "0", "-1000"),
+		"offset past end": objectStream("2", "", "0", "100000"),
+		"huge offset":     objectStream("2", "", "0", "1e30"),
+		"huge count":      objectStream("1e30", "", "0", "42"),
+		"negative count":  objectStream("-5", "", "0", "42"),
+		"huge first":      objectStream("2", "1e30", "0", "42"),
+		"negative first":  objectStream("2", "-8", "0", "42"),
+		"huge columns": strings.Replace(objectStream("2", "", "0", "42"),
+			"/FlateDecode", "/FlateDecode /DecodeParms << /Predictor 12 /Columns 1e11 >>", 1),
+		"overflowing columns": strings.Replace(objectStream("2", "", "0", "42"),
+			"/FlateDecode", "/FlateDecode /DecodeParms << /Predictor 12 /Columns 1e19 /Colors 4 >>", 1),
+	} {
+		t.Run(name, func(t *testing.T) {
+			assert.NotPanics(t, func() {
+				PDF(document(stream))
+			})
+		})
+	}
+}
+
+// TestPDFInflateLimit checks streams that inflate beyond maxStreamSize are refused
+func TestPDFInflateLimit(t *testing.T) {
+	var buf bytes.Buffer
+	w := zlib.NewWriter(&buf)
+	w.Write(make([]byte, maxStreamSize+1))
+	w.Close()
+
+	_, err := inflate(buf.Bytes())
+	assert.Error(t, err)
+}
+
+func FuzzPDF(f *testing.F) {
+	f.Add(buildPDF(
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /Contents 4 0 R >>",
+		stream("BT /F1 12 Tf (Hello) Tj ET", true),
+	))
+	f.Add(buildPDF(
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /ObjStm /N 1 /First 4 /Length 42 >>\nstream\n2 0 << /Type /Pages /Kids [] /Count 0 >>\nendstream",
+	))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		PDF(data)
+	})
+}
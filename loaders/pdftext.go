@@ -0,0 +1,474 @@
+package loaders
+
+import (
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// maxFormDepth bounds the nesting of forms drawn by forms
+const maxFormDepth = 8
+
+// pdfTextExtractor runs content streams, writing the text they show. Line breaks are
+// inferred from the text positioning operators
+type pdfTextExtractor struct {
+	doc   *pdfDocument
+	out   strings.Builder
+	depth int
+}
+
+func (x *pdfTextExtractor) run(stream *pdfStream, resources pdfDict) {
+	data, err := x.doc.decode(stream)
+	if err != nil {
+		return
+	}
+	x.runContent(data, resources)
+}
+
+func (x *pdfTextExtractor) runContent(data []byte, resources pdfDict) {
+	lexer := &pdfLexer{data: data}
+	var (
+		operands []any
+		font     *pdfFont
+		lineY    float64
+	)
+	for {
+		token, err := lexer.token()
+		if err != nil {
+			return
+		}
+		keyword, ok := token.(pdfKeyword)
+		if !ok || keyword == "[" || keyword == "<<" {
+			value, err := lexer.objectFrom(token, false)
+			if err != nil && !errors.Is(err, io.EOF) {
+				return
+			}
+			operands = append(operands, value)
+			continue
+		}
+
+		switch keyword {
+		case "BI":
+			skipInlineImage(lexer)
+		case "Tf":
+			if len(operands) >= 2 {
+				if name, ok := operands[len(operands)-2].(pdfName); ok {
+					font = x.font(resources, name)
+				}
+			}
+		case "Tj":
+			x.show(font, operands)
+		case "'", "\"":
+			x.newline()
+			x.show(font, operands)
+		case "TJ":
+			if len(operands) > 0 {
+				items, _ := operands[len(operands)-1].(pdfArray)
+				for _, item := range items {
+					switch v := item.(type) {
+					case pdfString:
+						x.write(font.decode(v))
+					case float64:
+						// a large negative adjustment moves the text on by about a space
+						if v < -200 {
+							x.space()
+						}
+					}
+				}
+			}
+		case "Td", "TD":
+			if len(operands) >= 2 {
+				tx, _ := operands[len(operands)-2].(float64)
+				ty, _ := operands[len(operands)-1].(float64)
+				if ty != 0 {
+					x.newline()
+				} else if tx > 0 {
+					x.space()
+				}
+			}
+		case "T*":
+			x.newline()
+		case "Tm":
+			if len(operands) >= 6 {
+				y, _ := operands[len(operands)-1].(float64)
+				if y != lineY {
+					x.newline()
+				} else {
+					x.space()
+				}
+				lineY = y
+			}
+		case "ET":
+			x.space()
+		case "Do":
+			if len(operands) > 0 {
+				if name, ok := operands[len(operands)-1].(pdfName); ok {
+					x.form(resources, name)
+				}
+			}
+		}
+		operands = operands[:0]
+	}
+}
+
+// skipInlineImage skips the data of an inline image, after its BI operator
+func skipInlineImage(lexer *pdfLexer) {
+	for {
+		token, err := lexer.token()
+		if err != nil {
+			return
+		}
+		if token == pdfKeyword("ID") {
+			break
+		}
+	}
+	for lexer.pos+2 < len(lexer.data) {
+		data := lexer.data
+		if data[lexer.pos] == 'E' && data[lexer.pos+1] == 'I' && isPDFWhite(data[lexer.pos-1]) &&
+			(isPDFWhite(data[lexer.pos+2]) || isPDFDelimiter(data[lexer.pos+2])) {
+			lexer.pos += 2
+			return
+		}
+		lexer.pos++
+	}
+	lexer.pos = len(lexer.data)
+}
+
+// form runs the content of a form XObject drawn by the Do operator
+func (x *pdfTextExtractor) form(resources pdfDict, name pdfName) {
+	if x.depth >= maxFormDepth {
+		return
+	}
+	xobjects := x.doc.dict(resources["XObject"])
+	stream, ok := x.doc.resolve(xobjects[name]).(*pdfStream)
+	if !ok || stream.dict["Subtype"] != pdfName("Form") {
+		return
+	}
+	if own := x.doc.dict(stream.dict["Resources"]); own != nil {
+		resources = own
+	}
+	x.depth++
+	x.run(stream, resources)
+	x.depth--
+}
+
+// show writes the string operand of a text showing operator
+func (x *pdfTextExtractor) show(font *pdfFont, operands []any) {
+	if len(operands) == 0 {
+		return
+	}
+	if s, ok := operands[len(operands)-1].(pdfString); ok {
+		x.write(font.decode(s))
+	}
+}
+
+func (x *pdfTextExtractor) write(text string) {
+	x.out.WriteString(text)
+}
+
+func (x *pdfTextExtractor) space() {
+	if s := x.out.String(); s != "" && !strings.HasSuffix(s, " ") && !strings.HasSuffix(s, "\n") {
+		x.out.WriteByte(' ')
+	}
+}
+
+func (x *pdfTextExtractor) newline() {
+	if s := x.out.String(); s != "" && !strings.HasSuffix(s, "\n") {
+		x.out.WriteByte('\n')
+	}
+}
+
+// font returns the font of a page's resources by name, or nil if it cannot be read
+func (x *pdfTextExtractor) font(resources pdfDict, name pdfName) *pdfFont {
+	fonts := x.doc.dict(resources["Font"])
+	ref, isRef := fonts[name].(pdfRef)
+	if isRef {
+		if font, ok := x.doc.fonts[ref]; ok {
+			return font
+		}
+	}
+	font := x.doc.loadFont(x.doc.dict(fonts[name]))
+	if isRef {
+		x.doc.fonts[ref] = font
+	}
+	return font
+}
+
+// pdfFont maps the character codes of strings shown in a font to text
+type pdfFont struct {
+	codeBytes int               // the bytes per character code, 2 for composite fonts
+	unicode   map[uint32]string // the ToUnicode map of the font
+	encoding  *[256]rune        // the encoding of a simple font
+}
+
+// loadFont reads the ToUnicode map and encoding of a font dictionary
+func (d *pdfDocument) loadFont(dict pdfDict) *pdfFont {
+	if dict == nil {
+		return nil
+	}
+	font := &pdfFont{codeBytes: 1}
+	composite := dict["Subtype"] == pdfName("Type0")
+	if composite {
+		font.codeBytes = 2
+	}
+
+	if stream, ok := d.resolve(dict["ToUnicode"]).(*pdfStream); ok {
+		if data, err := d.decode(stream); err == nil {
+			font.unicode, font.codeBytes = parseCMap(data, font.codeBytes)
+		}
+	}
+	if !composite {
+		font.encoding = d.simpleEncoding(dict["Encoding"])
+	}
+	return font
+}
+
+// decode maps a string shown in the font to text. Without a font, bytes are read as
+// WinAnsiEncoding
+func (f *pdfFont) decode(s pdfString) string {
+	if f == nil {
+		f = &pdfFont{codeBytes: 1}
+	}
+
+	var text strings.Builder
+	for i := 0; i < len(s); i += f.codeBytes {
+		var code uint32
+		for j := i; j < i+f.codeBytes && j < len(s); j++ {
+			code = code<<8 | uint32(s[j])
+		}
+		if mapped, ok := f.unicode[code]; ok {
+			text.WriteString(mapped)
+			continue
+		}
+		if f.codeBytes != 1 {
+			continue // a composite font without a ToUnicode entry for the code
+		}
+		encoding := f.encoding
+		if encoding == nil {
+			encoding = &winAnsiEncoding
+		}
+		if r := encoding[code]; r != 0 {
+			text.WriteRune(r)
+		}
+	}
+	return text.String()
+}
+
+// parseCMap reads the bfchar and bfrange mappings of a ToUnicode CMap, returning them with
+// the code width of its codespace ranges
+func parseCMap(data []byte, codeBytes int) (map[uint32]string, int) {
+	mapping := make(map[uint32]string)
+	lexer := &pdfLexer{data: data}
+	var operands []any
+	section := ""
+	for {
+		token, err := lexer.token()
+		if err != nil {
+			return mapping, codeBytes
+		}
+		if keyword, ok := token.(pdfKeyword); ok && keyword != "[" {
+			switch keyword {
+			case "begincodespacerange", "beginbfchar", "beginbfrange":
+				section = string(keyword)
+			case "endcodespacerange", "endbfchar", "endbfrange":
+				section = ""
+			}
+			operands = operands[:0]
+			continue
+		}
+		value, _ := lexer.objectFrom(token, false)
+		operands = append(operands, value)
+
+		switch section {
+		case "begincodespacerange":
+			if len(operands) == 2 {
+				if low, ok := operands[0].(pdfString); ok && len(low) > 0 {
+					codeBytes = len(low)
+				}
+				operands = operands[:0]
+			}
+		case "beginbfchar":
+			if len(operands) == 2 {
+				src, ok1 := operands[0].(pdfString)
+				dst, ok2 := operands[1].(pdfString)
+				if ok1 && ok2 {
+					mapping[cmapCode(src)] = utf16BE(dst)
+				}
+				operands = operands[:0]
+			}
+		case "beginbfrange":
+			if len(operands) == 3 {
+				mapCMapRange(mapping, operands)
+				operands = operands[:0]
+			}
+		default:
+			operands = operands[:0]
+		}
+	}
+}
+
+// mapCMapRange adds a bfrange to a ToUnicode map. The destination is either the text of
+// the first code, incremented for the following ones, or an array of texts
+func mapCMapRange(mapping map[uint32]string, operands []any) {
+	low, ok1 := operands[0].(pdfString)
+	high, ok2 := operands[1].(pdfString)
+	if !ok1 || !ok2 {
+		return
+	}
+	first, last := cmapCode(low), cmapCode(high)
+	if last < first || last-first > 0xFFFF {
+		return
+	}
+
+	switch dst := operands[2].(type) {
+	case pdfString:
+		if len(dst) < 2 {
+			return
+		}
+		for code := first; code <= last; code++ {
+			next := append([]byte(nil), dst...)
+			offset := int(code - first)
+			next[len(next)-1] += byte(offset)
+			next[len(next)-2] += byte(offset >> 8)
+			mapping[code] = utf16BE(next)
+		}
+	case pdfArray:
+		for i, item := range dst {
+			if text, ok := item.(pdfString); ok && first+uint32(i) <= last {
+				mapping[first+uint32(i)] = utf16BE(text)
+			}
+		}
+	}
+}
+
+func cmapCode(s pdfString) uint32 {
+	var code uint32
+	for _, b := range s {
+		code = code<<8 | uint32(b)
+	}
+	return code
+}
+
+// utf16BE decodes the UTF-16BE text of a ToUnicode mapping
+func utf16BE(s pdfString) string {
+	units := make([]uint16, len(s)/2)
+	for i := range units {
+		units[i] = uint16(s[2*i])<<8 | uint16(s[2*i+1])
+	}
+	return string(utf16.Decode(units))
+}
+
+// simpleEncoding returns the encoding of a simple font from its Encoding entry, a base
+// encoding name or a dictionary of differences from one
+func (d *pdfDocument) simpleEncoding(value any) *[256]rune {
+	base := winAnsiEncoding
+	var differences pdfArray
+	switch v := d.resolve(value).(type) {
+	case pdfName:
+		base = *baseEncoding(v)
+	case pdfDict:
+		if name, ok := d.resolve(v["BaseEncoding"]).(pdfName); ok {
+			base = *baseEncoding(name)
+		}
+		differences, _ = d.resolve(v["Differences"]).(pdfArray)
+	}
+
+	code := 0
+	for _, item := range differences {
+		switch v := d.resolve(item).(type) {
+		case float64:
+			code = int(v)
+		case pdfName:
+			if code >= 0 && code < 256 {
+				if r := glyphRune(string(v)); r != 0 {
+					base[code] = r
+				}
+			}
+			code++
+		}
+	}
+	return &base
+}
+
+func baseEncoding(name pdfName) *[256]rune {
+	if name == "MacRomanEncoding" {
+		return &macRomanEncoding
+	}
+	return &winAnsiEncoding
+}
+
+// glyphNames maps the glyph names of font encodings outside the letters and digits to
+// their runes
+var glyphNames = map[string]rune{
+	"space": ' ', "exclam": '!', "quotedbl": '"', "numbersign": '#', "dollar": '$',
+	"percent": '%', "ampersand": '&', "quotesingle": '\'', "parenleft": '(',
+	"parenright": ')', "asterisk": '*', "plus": '+', "comma": ',', "hyphen": '-',
+	"period": '.', "slash": '/', "zero": '0', "one": '1', "two": '2', "three": '3',
+	"four": '4', "five": '5', "six": '6', "seven": '7', "eight": '8', "nine": '9',
+	"colon": ':', "semicolon": ';', "less": '<', "equal": '=', "greater": '>',
+	"question": '?', "at": '@', "bracketleft": '[', "backslash": '\\', "bracketright": ']',
+	"asciicircum": '^', "underscore": '_', "grave": '`', "braceleft": '{', "bar": '|',
+	"braceright": '}', "asciitilde": '~', "quoteleft": '‘', "quoteright": '’',
+	"quotedblleft": '“', "quotedblright": '”', "quotesinglbase": '‚', "quotedblbase": '„',
+	"bullet": '•', "endash": '–', "emdash": '—', "ellipsis": '…', "dagger": '†',
+	"daggerdbl": '‡', "trademark": '™', "copyright": '©', "registered": '®',
+	"degree": '°', "section": '§', "paragraph": '¶', "Euro": '€', "sterling": '£',
+	"yen": '¥', "cent": '¢', "minus": '−', "multiply": '×', "divide": '÷',
+	"fi": 'ﬁ', "fl": 'ﬂ', "ff": 'ﬀ', "ffi": 'ﬃ', "ffl": 'ﬄ', "germandbls": 'ß',
+	"eacute": 'é', "egrave": 'è', "ecircumflex": 'ê', "aacute": 'á', "agrave": 'à',
+	"acircumflex": 'â', "adieresis": 'ä', "odieresis": 'ö', "udieresis": 'ü',
+	"Adieresis": 'Ä', "Odieresis": 'Ö', "Udieresis": 'Ü', "ccedilla": 'ç',
+	"ntilde": 'ñ', "oacute": 'ó', "uacute": 'ú', "iacute": 'í',
+}
+
+// glyphRune returns the rune of a glyph name, or 0 if it is unknown
+func glyphRune(name string) rune {
+	if r, ok := glyphNames[name]; ok {
+		return r
+	}
+	if len(name) == 1 && (name[0] >= 'a' && name[0] <= 'z' || name[0] >= 'A' && name[0] <= 'Z') {
+		return rune(name[0])
+	}
+	for _, prefix := range []string{"uni", "u"} {
+		if hexCode, ok := strings.CutPrefix(name, prefix); ok && len(hexCode) >= 4 && len(hexCode) <= 6 {
+			if code, err := strconv.ParseUint(hexCode, 16, 32); err == nil {
+				return rune(code)
+			}
+		}
+	}
+	return 0
+}
+
+// winAnsiEncoding is the WinAnsiEncoding of simple fonts, Windows-1252. It also stands in
+// for StandardEncoding, which differs mainly in its quotes
+var winAnsiEncoding = func() [256]rune {
+	var encoding [256]rune
+	for code := 0x20; code < 256; code++ {
+		encoding[code] = rune(code)
+	}
+	for code := 0x80; code <= 0x9F; code++ {
+		if r := windows1252[code-0x80]; r != '�' {
+			encoding[code] = r
+		} else {
+			encoding[code] = 0
+		}
+	}
+	encoding['\t'], encoding['\n'], encoding['\r'] = ' ', ' ', ' '
+	return encoding
+}()
+
+// macRomanEncoding is the MacRomanEncoding of simple fonts
+var macRomanEncoding = func() [256]rune {
+	var encoding [256]rune
+	for code := 0x20; code < 0x80; code++ {
+		encoding[code] = rune(code)
+	}
+	upper := []rune("ÄÅÇÉÑÖÜáàâäãåçéèêëíìîïñóòôöõúùûü†°¢£§•¶ß®©™´¨≠ÆØ∞±≤≥¥µ∂∑∏π∫ªºΩæø" +
+		"¿¡¬√ƒ≈∆«»… ÀÃÕŒœ–—“”‘’÷◊ÿŸ⁄€‹›ﬁﬂ‡·‚„‰ÂÊÁËÈÍÎÏÌÓÔÒÚÛÙıˆ˜¯˘˙˚¸˝˛ˇ")
+	for i, r := range upper {
+		encoding[0x80+i] = r
+	}
+	return encoding
+}()
@@ -0,0 +1,111 @@
+package loaders
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/Predixus/DynaRAG/types"
+)
+
+// windows1252 maps the bytes 0x80 to 0x9F of Windows-1252 to their runes. The other bytes
+// above 0x7F are the Latin-1 code points of the same value
+var windows1252 = [32]rune{
+	'€', '�', '‚', 'ƒ', '„', '…', '†', '‡', 'ˆ', '‰', 'Š', '‹', 'Œ', '�', 'Ž', '�',
+	'�', '‘', '’', '“', '”', '•', '–', '—', '˜', '™', 'š', '›', 'œ', '�', 'ž', 'Ÿ',
+}
+
+// Text decodes a plain text document as a single section, detecting its encoding from a
+// byte order mark, the pattern of NUL bytes of UTF-16, or the validity of UTF-8, falling
+// back to Windows-1252. The encoding is recorded in the metadata
+func Text(data []byte) ([]Section, error) {
+	text, encoding, err := decodeText(data)
+	if err != nil {
+		return nil, err
+	}
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	if strings.TrimSpace(text) == "" {
+		return nil, nil
+	}
+	return []Section{{Text: text, Metadata: types.JSONMap{"encoding": encoding}}}, nil
+}
+
+// decodeText returns the text of data and the name of the encoding it was decoded from
+func decodeText(data []byte) (string, string, error) {
+	switch {
+	case bytes.HasPrefix(data, []byte{0xEF, 0xBB, 0xBF}):
+		return string(data[3:]), "utf-8", nil
+	case bytes.HasPrefix(data, []byte{0xFF, 0xFE}):
+		text, err := decodeUTF16(data[2:], false)
+		return text, "utf-16le", err
+	case bytes.HasPrefix(data, []byte{0xFE, 0xFF}):
+		text, err := decodeUTF16(data[2:], true)
+		return text, "utf-16be", err
+	}
+
+	if bigEndian, ok := looksUTF16(data); ok {
+		text, err := decodeUTF16(data, bigEndian)
+		if bigEndian {
+			return text, "utf-16be", err
+		}
+		return text, "utf-16le", err
+	}
+	if utf8.Valid(data) {
+		return string(data), "utf-8", nil
+	}
+
+	var text strings.Builder
+	text.Grow(len(data))
+	for _, b := range data {
+		if b >= 0x80 && b <= 0x9F {
+			text.WriteRune(windows1252[b-0x80])
+		} else {
+			text.WriteRune(rune(b))
+		}
+	}
+	return text.String(), "windows-1252", nil
+}
+
+// looksUTF16 reports whether data without a byte order mark is UTF-16, as most text in
+// the Latin script has a NUL as every other byte, and whether it is big endian
+func looksUTF16(data []byte) (bool, bool) {
+	if len(data) < 4 || len(data)%2 != 0 {
+		return false, false
+	}
+	var even, odd int
+	for i := 0; i < len(data); i += 2 {
+		if data[i] == 0 {
+			even++
+		}
+		if data[i+1] == 0 {
+			odd++
+		}
+	}
+	pairs := len(data) / 2
+	switch {
+	case even > pairs*3/4 && odd == 0:
+		return true, true
+	case odd > pairs*3/4 && even == 0:
+		return false, true
+	default:
+		return false, false
+	}
+}
+
+// decodeUTF16 decodes UTF-16 text without its byte order mark
+func decodeUTF16(data []byte, bigEndian bool) (string, error) {
+	if len(data)%2 != 0 {
+		return "", errors.New("UTF-16 text has an odd number of bytes")
+	}
+	units := make([]uint16, len(data)/2)
+	for i := range units {
+		if bigEndian {
+			units[i] = uint16(data[2*i])<<8 | uint16(data[2*i+1])
+		} else {
+			units[i] = uint16(data[2*i+1])<<8 | uint16(data[2*i])
+		}
+	}
+	return string(utf16.Decode(units)), nil
+}
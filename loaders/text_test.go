@@ -0,0 +1,81 @@
+package loaders
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Predixus/DynaRAG/types"
+)
+
+// TestText checks the encoding of plain text is detected with and without a byte order mark
+func TestText(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     []byte
+		text     string
+		encoding string
+	}{
+		{
+			name:     "utf-8",
+			data:     []byte("Café\r\nnaïve"),
+			text:     "Café\nnaïve",
+			encoding: "utf-8",
+		},
+		{
+			name:     "utf-8 with byte order mark",
+			data:     []byte("\xEF\xBB\xBFCafé"),
+			text:     "Café",
+			encoding: "utf-8",
+		},
+		{
+			name:     "utf-16le with byte order mark",
+			data:     []byte{0xFF, 0xFE, 'H', 0, 'i', 0, 0xE9, 0},
+			text:     "Hié",
+			encoding: "utf-16le",
+		},
+		{
+			name:     "utf-16be without byte order mark",
+			data:     []byte{0, 'H', 0, 'e', 0, 'l', 0, 'l', 0, 'o'},
+			text:     "Hello",
+			encoding: "utf-16be",
+		},
+		{
+			name:     "windows-1252",
+			data:     []byte("\x93Caf\xE9\x94 \x80"),
+			text:     "“Café” €",
+			encoding: "windows-1252",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sections, err := Text(tt.data)
+			require.NoError(t, err)
+			require.Len(t, sections, 1)
+			assert.Equal(t, tt.text, sections[0].Text)
+			assert.Equal(t, types.JSONMap{"encoding": tt.encoding}, sections[0].Metadata)
+			assert.Equal(t, "notes.txt", sections[0].Source("notes.txt"))
+		})
+	}
+
+	sections, err := Text([]byte(" \n"))
+	require.NoError(t, err)
+	assert.Empty(t, sections)
+}
+
+// TestForPath checks loaders are chosen by extension
+func TestForPath(t *testing.T) {
+	data := []byte("plain text")
+	for _, filePath := range []string{"notes.txt", "README", "main.go"} {
+		sections, err := ForPath(filePath)(data)
+		require.NoError(t, err, filePath)
+		assert.Len(t, sections, 1, filePath)
+	}
+
+	_, err := ForPath("report.PDF")(data)
+	assert.ErrorContains(t, err, "not a PDF document")
+	_, err = ForPath("report.docx")(data)
+	assert.ErrorContains(t, err, "docx archive")
+}
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS query_usage_created_at_idx;
+DROP TABLE IF EXISTS query_usage;
@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS query_usage (
+    id BIGSERIAL PRIMARY KEY,
+    provider TEXT NOT NULL,
+    model TEXT NOT NULL,
+    prompt_tokens INTEGER NOT NULL DEFAULT 0,
+    completion_tokens INTEGER NOT NULL DEFAULT 0,
+    total_tokens INTEGER NOT NULL DEFAULT 0,
+    latency_ms BIGINT NOT NULL,
+    time_to_first_token_ms BIGINT NOT NULL,
+    finish_reason TEXT,
+    cost DOUBLE PRECISION, -- NULL when no price is configured for the model
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS query_usage_created_at_idx ON query_usage(created_at);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS messages_session_id_idx;
+DROP TABLE IF EXISTS messages;
+DROP TABLE IF EXISTS sessions;
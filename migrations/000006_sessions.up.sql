@@ -0,0 +1,19 @@
+CREATE TABLE IF NOT EXISTS sessions (
+    id BIGSERIAL PRIMARY KEY,
+    title TEXT,
+    summary TEXT, -- rolling summary of the messages up to summarised_until
+    summarised_until BIGINT NOT NULL DEFAULT 0, -- id of the last message folded into the summary
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS messages (
+    id BIGSERIAL PRIMARY KEY,
+    session_id BIGINT NOT NULL REFERENCES sessions(id) ON DELETE CASCADE,
+    role TEXT NOT NULL CHECK (role IN ('user', 'assistant')),
+    content TEXT NOT NULL,
+    chunk_ids BIGINT[] NOT NULL DEFAULT '{}', -- chunks retrieved to answer the turn
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS messages_session_id_idx ON messages(session_id, id);
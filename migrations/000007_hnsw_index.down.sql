@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS embeddings_embedding_idx;
+CREATE INDEX embeddings_embedding_idx ON embeddings USING ivfflat (embedding vector_cosine_ops);
@@ -0,0 +1,5 @@
+-- the ivfflat index was built on an empty table, so its lists were trained on no data.
+-- HNSW needs no training step and keeps its recall as rows are added
+DROP INDEX IF EXISTS embeddings_embedding_idx;
+CREATE INDEX embeddings_embedding_idx ON embeddings
+USING hnsw (embedding vector_cosine_ops) WITH (m = 16, ef_construction = 64);
@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS embeddings_embedding_all_minilm_l6_v2_idx;
+CREATE INDEX IF NOT EXISTS embeddings_embedding_idx ON embeddings
+USING hnsw (embedding vector_cosine_ops) WITH (m = 16, ef_construction = 64);
+
+DROP TABLE IF EXISTS model_registrations;
+DROP TYPE IF EXISTS distance_metric;
@@ -0,0 +1,26 @@
+CREATE TYPE distance_metric AS ENUM (
+    'cosine',
+    'inner_product',
+    'l2'
+);
+
+-- registered embedding models and the distance metric their vectors are compared with
+CREATE TABLE IF NOT EXISTS model_registrations (
+    model_name embedding_model PRIMARY KEY,
+    dimensions INTEGER NOT NULL,
+    metric distance_metric NOT NULL DEFAULT 'cosine',
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+INSERT INTO model_registrations (model_name, dimensions, metric) VALUES
+    ('all-MiniLM-L6-v2', 384, 'cosine'),
+    ('all-mpnet-base-v2', 768, 'cosine'),
+    ('multi-CAUTION-MiniLM-L6-cos-v1', 384, 'cosine')
+ON CONFLICT (model_name) DO NOTHING;
+
+-- vector indexes are partial per model, so each can use the operator class of its metric
+DROP INDEX IF EXISTS embeddings_embedding_idx;
+CREATE INDEX IF NOT EXISTS embeddings_embedding_all_minilm_l6_v2_idx ON embeddings
+USING hnsw (embedding vector_cosine_ops) WITH (m = 16, ef_construction = 64)
+WHERE model_name = 'all-MiniLM-L6-v2';
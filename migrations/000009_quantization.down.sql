@@ -0,0 +1,2 @@
+ALTER TABLE model_registrations DROP COLUMN IF EXISTS quantization;
+DROP TYPE IF EXISTS quantization;
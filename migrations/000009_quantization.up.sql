@@ -0,0 +1,10 @@
+CREATE TYPE quantization AS ENUM (
+    'none',
+    'halfvec',
+    'binary'
+);
+
+-- the representation the vector index of a model is built over. Full precision vectors
+-- are kept in the table to re-rank the candidates of quantised indexes
+ALTER TABLE model_registrations
+ADD COLUMN IF NOT EXISTS quantization quantization NOT NULL DEFAULT 'none';
@@ -0,0 +1,9 @@
+-- only the default collection survives, as file paths must be unique again
+DELETE FROM documents
+WHERE collection_id <> (SELECT id FROM collections WHERE name = 'default');
+
+DROP INDEX IF EXISTS documents_collection_file_path_idx;
+CREATE UNIQUE INDEX IF NOT EXISTS documents_file_path_idx ON documents(file_path);
+
+ALTER TABLE documents DROP COLUMN IF EXISTS collection_id;
+DROP TABLE IF EXISTS collections;
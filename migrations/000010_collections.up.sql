@@ -0,0 +1,23 @@
+-- collections isolate independent corpora stored in the same database
+CREATE TABLE IF NOT EXISTS collections (
+    id BIGSERIAL PRIMARY KEY,
+    name TEXT NOT NULL UNIQUE,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+-- existing documents belong to the default collection
+INSERT INTO collections (name) VALUES ('default') ON CONFLICT (name) DO NOTHING;
+
+ALTER TABLE documents
+ADD COLUMN IF NOT EXISTS collection_id BIGINT REFERENCES collections(id) ON DELETE CASCADE;
+
+UPDATE documents
+SET collection_id = (SELECT id FROM collections WHERE name = 'default')
+WHERE collection_id IS NULL;
+
+ALTER TABLE documents ALTER COLUMN collection_id SET NOT NULL;
+
+-- file paths are unique per collection rather than per database
+DROP INDEX IF EXISTS documents_file_path_idx;
+CREATE UNIQUE INDEX documents_collection_file_path_idx ON documents(collection_id, file_path);
@@ -0,0 +1,36 @@
+DROP POLICY IF EXISTS tenant_isolation ON messages;
+DROP POLICY IF EXISTS tenant_isolation ON sessions;
+DROP POLICY IF EXISTS tenant_isolation ON embeddings;
+DROP POLICY IF EXISTS tenant_isolation ON documents;
+DROP POLICY IF EXISTS tenant_isolation ON collections;
+
+ALTER TABLE messages NO FORCE ROW LEVEL SECURITY;
+ALTER TABLE messages DISABLE ROW LEVEL SECURITY;
+ALTER TABLE sessions NO FORCE ROW LEVEL SECURITY;
+ALTER TABLE sessions DISABLE ROW LEVEL SECURITY;
+ALTER TABLE embeddings NO FORCE ROW LEVEL SECURITY;
+ALTER TABLE embeddings DISABLE ROW LEVEL SECURITY;
+ALTER TABLE documents NO FORCE ROW LEVEL SECURITY;
+ALTER TABLE documents DISABLE ROW LEVEL SECURITY;
+ALTER TABLE collections NO FORCE ROW LEVEL SECURITY;
+ALTER TABLE collections DISABLE ROW LEVEL SECURITY;
+
+-- only the default tenant survives, as collection names must be unique again
+DELETE FROM messages WHERE tenant_id <> 'default';
+DELETE FROM sessions WHERE tenant_id <> 'default';
+DELETE FROM collections WHERE tenant_id <> 'default';
+
+DROP INDEX IF EXISTS sessions_tenant_id_idx;
+DROP INDEX IF EXISTS embeddings_tenant_id_idx;
+DROP INDEX IF EXISTS documents_tenant_id_idx;
+
+ALTER TABLE collections DROP CONSTRAINT IF EXISTS collections_tenant_id_name_key;
+ALTER TABLE collections ADD CONSTRAINT collections_name_key UNIQUE (name);
+
+ALTER TABLE messages DROP COLUMN IF EXISTS tenant_id;
+ALTER TABLE sessions DROP COLUMN IF EXISTS tenant_id;
+ALTER TABLE embeddings DROP COLUMN IF EXISTS tenant_id;
+ALTER TABLE documents DROP COLUMN IF EXISTS tenant_id;
+ALTER TABLE collections DROP COLUMN IF EXISTS tenant_id;
+
+DROP FUNCTION IF EXISTS dynarag_tenant();
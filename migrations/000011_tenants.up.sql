@@ -0,0 +1,53 @@
+-- the tenant a transaction acts for, set with set_config('app.tenant_id', ..., true).
+-- Transactions that set none act for the default tenant
+CREATE OR REPLACE FUNCTION dynarag_tenant()
+RETURNS TEXT AS $$
+    SELECT COALESCE(NULLIF(current_setting('app.tenant_id', true), ''), 'default')
+$$ LANGUAGE sql STABLE;
+
+-- existing rows belong to the default tenant, new rows to the tenant of the transaction
+ALTER TABLE collections ADD COLUMN IF NOT EXISTS tenant_id TEXT NOT NULL DEFAULT dynarag_tenant();
+ALTER TABLE documents ADD COLUMN IF NOT EXISTS tenant_id TEXT NOT NULL DEFAULT dynarag_tenant();
+ALTER TABLE embeddings ADD COLUMN IF NOT EXISTS tenant_id TEXT NOT NULL DEFAULT dynarag_tenant();
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS tenant_id TEXT NOT NULL DEFAULT dynarag_tenant();
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS tenant_id TEXT NOT NULL DEFAULT dynarag_tenant();
+
+-- collection names are unique per tenant, and every tenant has its own default collection
+ALTER TABLE collections DROP CONSTRAINT IF EXISTS collections_name_key;
+ALTER TABLE collections ADD CONSTRAINT collections_tenant_id_name_key UNIQUE (tenant_id, name);
+
+CREATE INDEX IF NOT EXISTS documents_tenant_id_idx ON documents(tenant_id);
+CREATE INDEX IF NOT EXISTS embeddings_tenant_id_idx ON embeddings(tenant_id);
+CREATE INDEX IF NOT EXISTS sessions_tenant_id_idx ON sessions(tenant_id);
+
+-- rows are only visible to, and can only be written by, their own tenant. FORCE applies
+-- the policies to the table owner too; only superusers and BYPASSRLS roles skip them
+ALTER TABLE collections ENABLE ROW LEVEL SECURITY;
+ALTER TABLE collections FORCE ROW LEVEL SECURITY;
+CREATE POLICY tenant_isolation ON collections
+    USING (tenant_id = dynarag_tenant())
+    WITH CHECK (tenant_id = dynarag_tenant());
+
+ALTER TABLE documents ENABLE ROW LEVEL SECURITY;
+ALTER TABLE documents FORCE ROW LEVEL SECURITY;
+CREATE POLICY tenant_isolation ON documents
+    USING (tenant_id = dynarag_tenant())
+    WITH CHECK (tenant_id = dynarag_tenant());
+
+ALTER TABLE embeddings ENABLE ROW LEVEL SECURITY;
+ALTER TABLE embeddings FORCE ROW LEVEL SECURITY;
+CREATE POLICY tenant_isolation ON embeddings
+    USING (tenant_id = dynarag_tenant())
+    WITH CHECK (tenant_id = dynarag_tenant());
+
+ALTER TABLE sessions ENABLE ROW LEVEL SECURITY;
+ALTER TABLE sessions FORCE ROW LEVEL SECURITY;
+CREATE POLICY tenant_isolation ON sessions
+    USING (tenant_id = dynarag_tenant())
+    WITH CHECK (tenant_id = dynarag_tenant());
+
+ALTER TABLE messages ENABLE ROW LEVEL SECURITY;
+ALTER TABLE messages FORCE ROW LEVEL SECURITY;
+CREATE POLICY tenant_isolation ON messages
+    USING (tenant_id = dynarag_tenant())
+    WITH CHECK (tenant_id = dynarag_tenant());
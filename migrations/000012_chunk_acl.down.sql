@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS embeddings_allowed_principals_idx;
+ALTER TABLE embeddings DROP COLUMN IF EXISTS allowed_principals;
@@ -0,0 +1,6 @@
+-- principals (users or groups) allowed to retrieve a chunk. NULL leaves the chunk open to
+-- every caller of its tenant
+ALTER TABLE embeddings ADD COLUMN IF NOT EXISTS allowed_principals TEXT[];
+
+CREATE INDEX IF NOT EXISTS embeddings_allowed_principals_idx
+ON embeddings USING gin (allowed_principals);
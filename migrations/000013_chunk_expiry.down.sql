@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS embeddings_expires_at_idx;
+ALTER TABLE embeddings DROP COLUMN IF EXISTS expires_at;
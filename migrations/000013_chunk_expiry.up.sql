@@ -0,0 +1,6 @@
+-- chunks past expires_at are left out of searches and listings, and removed by Vacuum.
+-- NULL never expires
+ALTER TABLE embeddings ADD COLUMN IF NOT EXISTS expires_at TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS embeddings_expires_at_idx
+ON embeddings(expires_at) WHERE expires_at IS NOT NULL;
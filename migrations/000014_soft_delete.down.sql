@@ -0,0 +1,7 @@
+-- trashed rows would become visible again, so they are removed for good
+DELETE FROM embeddings WHERE deleted_at IS NOT NULL;
+DELETE FROM documents WHERE deleted_at IS NOT NULL;
+
+DROP INDEX IF EXISTS embeddings_deleted_at_idx;
+ALTER TABLE documents DROP COLUMN IF EXISTS deleted_at;
+ALTER TABLE embeddings DROP COLUMN IF EXISTS deleted_at;
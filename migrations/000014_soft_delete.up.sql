@@ -0,0 +1,7 @@
+-- purged chunks and documents are moved to the trash by setting deleted_at, which hides
+-- them from every query until they are restored or the trash is emptied
+ALTER TABLE embeddings ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+ALTER TABLE documents ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS embeddings_deleted_at_idx
+ON embeddings(deleted_at) WHERE deleted_at IS NOT NULL;
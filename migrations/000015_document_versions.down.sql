@@ -0,0 +1,16 @@
+-- chunks of superseded versions would reappear as current, so they are removed first
+ALTER TABLE documents NO FORCE ROW LEVEL SECURITY;
+ALTER TABLE embeddings NO FORCE ROW LEVEL SECURITY;
+
+DELETE FROM embeddings e
+USING document_versions v
+WHERE v.id = e.version_id
+  AND v.valid_to IS NOT NULL;
+
+ALTER TABLE documents FORCE ROW LEVEL SECURITY;
+ALTER TABLE embeddings FORCE ROW LEVEL SECURITY;
+
+DROP INDEX IF EXISTS embeddings_version_id_idx;
+ALTER TABLE embeddings DROP COLUMN IF EXISTS version_id;
+
+DROP TABLE IF EXISTS document_versions;
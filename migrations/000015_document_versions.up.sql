@@ -0,0 +1,43 @@
+-- every ingest of a file path opens a new version of its document and closes the one
+-- before. Chunks belong to the version they were stored in, and old versions are kept so
+-- that searches can look at the corpus as it was at any moment
+CREATE TABLE IF NOT EXISTS document_versions (
+    id BIGSERIAL PRIMARY KEY,
+    document_id BIGINT NOT NULL REFERENCES documents(id) ON DELETE CASCADE,
+    version INTEGER NOT NULL,
+    valid_from TIMESTAMPTZ NOT NULL DEFAULT now(),
+    valid_to TIMESTAMPTZ, -- NULL while the version is current
+    tenant_id TEXT NOT NULL DEFAULT dynarag_tenant(),
+    UNIQUE (document_id, version)
+);
+
+-- a document has at most one current version
+CREATE UNIQUE INDEX IF NOT EXISTS document_versions_current_idx
+ON document_versions(document_id) WHERE valid_to IS NULL;
+
+ALTER TABLE embeddings ADD COLUMN IF NOT EXISTS version_id BIGINT
+REFERENCES document_versions(id) ON DELETE CASCADE;
+
+CREATE INDEX IF NOT EXISTS embeddings_version_id_idx ON embeddings(version_id);
+
+-- existing documents become their first version, valid since they were created. The
+-- backfill spans every tenant, so the policies are lifted from the owner while it runs
+ALTER TABLE documents NO FORCE ROW LEVEL SECURITY;
+ALTER TABLE embeddings NO FORCE ROW LEVEL SECURITY;
+
+INSERT INTO document_versions (document_id, version, valid_from, tenant_id)
+SELECT id, 1, COALESCE(created_at, now()), tenant_id FROM documents;
+
+UPDATE embeddings e
+SET version_id = v.id
+FROM document_versions v
+WHERE v.document_id = e.document_id;
+
+ALTER TABLE documents FORCE ROW LEVEL SECURITY;
+ALTER TABLE embeddings FORCE ROW LEVEL SECURITY;
+
+ALTER TABLE document_versions ENABLE ROW LEVEL SECURITY;
+ALTER TABLE document_versions FORCE ROW LEVEL SECURITY;
+CREATE POLICY tenant_isolation ON document_versions
+    USING (tenant_id = dynarag_tenant())
+    WITH CHECK (tenant_id = dynarag_tenant());
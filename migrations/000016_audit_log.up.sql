@@ -0,0 +1,44 @@
+-- who added, deleted or retrieved what. Entries are only ever appended; with hash
+-- chaining on, each entry also carries the hash of the one before so that edits made
+-- around the triggers below can be detected
+CREATE TABLE IF NOT EXISTS audit_log (
+    id BIGSERIAL PRIMARY KEY,
+    occurred_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    operation TEXT NOT NULL,
+    principal TEXT NOT NULL DEFAULT '',
+    groups TEXT[],
+    collection TEXT NOT NULL DEFAULT '',
+    file_paths TEXT[],
+    chunk_ids BIGINT[],
+    query TEXT NOT NULL DEFAULT '',
+    filter JSONB NOT NULL DEFAULT '{}',
+    prev_hash TEXT,
+    hash TEXT,
+    tenant_id TEXT NOT NULL DEFAULT dynarag_tenant()
+);
+
+CREATE INDEX IF NOT EXISTS audit_log_tenant_id_occurred_at_idx ON audit_log(tenant_id, occurred_at);
+CREATE INDEX IF NOT EXISTS audit_log_file_paths_idx ON audit_log USING GIN (file_paths);
+
+CREATE OR REPLACE FUNCTION audit_log_append_only()
+RETURNS TRIGGER AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_log is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_log_append_only
+BEFORE UPDATE OR DELETE ON audit_log
+FOR EACH ROW
+EXECUTE FUNCTION audit_log_append_only();
+
+CREATE TRIGGER audit_log_no_truncate
+BEFORE TRUNCATE ON audit_log
+FOR EACH STATEMENT
+EXECUTE FUNCTION audit_log_append_only();
+
+ALTER TABLE audit_log ENABLE ROW LEVEL SECURITY;
+ALTER TABLE audit_log FORCE ROW LEVEL SECURITY;
+CREATE POLICY tenant_isolation ON audit_log
+    USING (tenant_id = dynarag_tenant())
+    WITH CHECK (tenant_id = dynarag_tenant());
@@ -0,0 +1,4 @@
+DROP TRIGGER IF EXISTS notify_embedding_insert ON embeddings;
+DROP TRIGGER IF EXISTS notify_embedding_delete ON embeddings;
+DROP TRIGGER IF EXISTS notify_embedding_trash ON embeddings;
+DROP FUNCTION IF EXISTS notify_embedding_change();
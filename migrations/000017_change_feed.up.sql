@@ -0,0 +1,67 @@
+-- publish every change to the chunks of the corpus on the dynarag_changes channel, so
+-- that other services can follow the corpus without polling. Payloads are JSON; trashing
+-- and restoring are published as their own operations. Notifications are only delivered
+-- once the transaction commits
+CREATE OR REPLACE FUNCTION notify_embedding_change()
+RETURNS TRIGGER AS $$
+DECLARE
+    changed embeddings;
+    operation TEXT;
+    path TEXT;
+    collection TEXT;
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        changed := NEW;
+        operation := 'insert';
+    ELSIF TG_OP = 'DELETE' THEN
+        changed := OLD;
+        operation := 'delete';
+    ELSIF NEW.deleted_at IS NOT NULL AND OLD.deleted_at IS NULL THEN
+        changed := NEW;
+        operation := 'trash';
+    ELSIF NEW.deleted_at IS NULL AND OLD.deleted_at IS NOT NULL THEN
+        changed := NEW;
+        operation := 'restore';
+    ELSE
+        RETURN NULL;
+    END IF;
+
+    -- the document is already gone when its chunks are deleted along with it, as when a
+    -- collection is dropped, leaving the path and collection empty
+    SELECT d.file_path, c.name INTO path, collection
+    FROM documents d
+    JOIN collections c ON c.id = d.collection_id
+    WHERE d.id = changed.document_id;
+
+    PERFORM pg_notify('dynarag_changes', json_build_object(
+        'operation', operation,
+        'chunk_id', changed.id,
+        'document_id', changed.document_id,
+        'file_path', COALESCE(path, ''),
+        'collection', COALESCE(collection, ''),
+        'tenant_id', changed.tenant_id
+    )::text);
+
+    IF TG_OP = 'DELETE' THEN
+        RETURN OLD;
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER notify_embedding_insert
+AFTER INSERT ON embeddings
+FOR EACH ROW
+EXECUTE FUNCTION notify_embedding_change();
+
+-- before the delete, while the document that delete_empty_documents removes along with
+-- its last chunk can still be read
+CREATE TRIGGER notify_embedding_delete
+BEFORE DELETE ON embeddings
+FOR EACH ROW
+EXECUTE FUNCTION notify_embedding_change();
+
+CREATE TRIGGER notify_embedding_trash
+AFTER UPDATE OF deleted_at ON embeddings
+FOR EACH ROW
+EXECUTE FUNCTION notify_embedding_change();
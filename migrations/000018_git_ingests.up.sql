@@ -0,0 +1,17 @@
+-- the commit each git repository was last ingested at, so that the next ingest only
+-- processes the files changed since
+CREATE TABLE IF NOT EXISTS git_ingests (
+    id BIGSERIAL PRIMARY KEY,
+    collection_id BIGINT NOT NULL REFERENCES collections(id) ON DELETE CASCADE,
+    repository TEXT NOT NULL,
+    commit_sha TEXT NOT NULL,
+    ingested_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    tenant_id TEXT NOT NULL DEFAULT dynarag_tenant(),
+    UNIQUE (collection_id, repository)
+);
+
+ALTER TABLE git_ingests ENABLE ROW LEVEL SECURITY;
+ALTER TABLE git_ingests FORCE ROW LEVEL SECURITY;
+CREATE POLICY tenant_isolation ON git_ingests
+    USING (tenant_id = dynarag_tenant())
+    WITH CHECK (tenant_id = dynarag_tenant());
@@ -0,0 +1,3 @@
+INSERT INTO model_registrations (model_name, dimensions, metric) VALUES
+    ('all-mpnet-base-v2', 768, 'cosine')
+ON CONFLICT (model_name) DO NOTHING;
@@ -0,0 +1,4 @@
+-- all-mpnet-base-v2 was registered with 768 dimensions, which vector(384) embeddings
+-- cannot hold, so every insert, cast and index build for it failed
+DELETE FROM model_registrations
+WHERE model_name = 'all-mpnet-base-v2' AND dimensions = 768;
@@ -0,0 +1,53 @@
+DROP TRIGGER IF EXISTS notify_version_close ON document_versions;
+DROP FUNCTION IF EXISTS notify_version_close();
+
+-- back to publishing every tenant on the dynarag_changes channel
+CREATE OR REPLACE FUNCTION notify_embedding_change()
+RETURNS TRIGGER AS $$
+DECLARE
+    changed embeddings;
+    operation TEXT;
+    path TEXT;
+    collection TEXT;
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        changed := NEW;
+        operation := 'insert';
+    ELSIF TG_OP = 'DELETE' THEN
+        changed := OLD;
+        operation := 'delete';
+    ELSIF NEW.deleted_at IS NOT NULL AND OLD.deleted_at IS NULL THEN
+        changed := NEW;
+        operation := 'trash';
+    ELSIF NEW.deleted_at IS NULL AND OLD.deleted_at IS NOT NULL THEN
+        changed := NEW;
+        operation := 'restore';
+    ELSE
+        RETURN NULL;
+    END IF;
+
+    -- the document is already gone when its chunks are deleted along with it, as when a
+    -- collection is dropped, leaving the path and collection empty
+    SELECT d.file_path, c.name INTO path, collection
+    FROM documents d
+    JOIN collections c ON c.id = d.collection_id
+    WHERE d.id = changed.document_id;
+
+    PERFORM pg_notify('dynarag_changes', json_build_object(
+        'operation', operation,
+        'chunk_id', changed.id,
+        'document_id', changed.document_id,
+        'file_path', COALESCE(path, ''),
+        'collection', COALESCE(collection, ''),
+        'tenant_id', changed.tenant_id
+    )::text);
+
+    IF TG_OP = 'DELETE' THEN
+        RETURN OLD;
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP FUNCTION IF EXISTS publish_embedding_change(TEXT, embeddings);
+DROP FUNCTION IF EXISTS dynarag_changes_channel(TEXT);
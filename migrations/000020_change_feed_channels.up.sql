@@ -0,0 +1,71 @@
+-- every tenant publishes its changes on a channel of its own, so that a listener only
+-- hears the tenant it follows. The channel is named after a hash of the tenant, which
+-- keeps it a valid identifier whatever the tenant is called
+CREATE OR REPLACE FUNCTION dynarag_changes_channel(tenant TEXT)
+RETURNS TEXT AS $$
+    SELECT 'dynarag_changes_' || md5(tenant)
+$$ LANGUAGE sql IMMUTABLE;
+
+-- publish_embedding_change publishes a change to a chunk on the channel of its tenant
+CREATE OR REPLACE FUNCTION publish_embedding_change(operation TEXT, changed embeddings)
+RETURNS VOID AS $$
+DECLARE
+    path TEXT;
+    collection TEXT;
+BEGIN
+    -- the document is already gone when its chunks are deleted along with it, as when a
+    -- collection is dropped, leaving the path and collection empty
+    SELECT d.file_path, c.name INTO path, collection
+    FROM documents d
+    JOIN collections c ON c.id = d.collection_id
+    WHERE d.id = changed.document_id;
+
+    PERFORM pg_notify(dynarag_changes_channel(changed.tenant_id), json_build_object(
+        'operation', operation,
+        'chunk_id', changed.id,
+        'document_id', changed.document_id,
+        'file_path', COALESCE(path, ''),
+        'collection', COALESCE(collection, ''),
+        'tenant_id', changed.tenant_id
+    )::text);
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION notify_embedding_change()
+RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        PERFORM publish_embedding_change('insert', NEW);
+    ELSIF TG_OP = 'DELETE' THEN
+        PERFORM publish_embedding_change('delete', OLD);
+        RETURN OLD;
+    ELSIF NEW.deleted_at IS NOT NULL AND OLD.deleted_at IS NULL THEN
+        PERFORM publish_embedding_change('trash', NEW);
+    ELSIF NEW.deleted_at IS NULL AND OLD.deleted_at IS NOT NULL THEN
+        PERFORM publish_embedding_change('restore', NEW);
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+-- the chunks of a version closed by an ingest leave the current corpus, though they stay
+-- in the table for searches of the past, so each is published as superseded
+CREATE OR REPLACE FUNCTION notify_version_close()
+RETURNS TRIGGER AS $$
+DECLARE
+    changed embeddings;
+BEGIN
+    FOR changed IN
+        SELECT * FROM embeddings WHERE version_id = NEW.id AND deleted_at IS NULL
+    LOOP
+        PERFORM publish_embedding_change('supersede', changed);
+    END LOOP;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER notify_version_close
+AFTER UPDATE OF valid_to ON document_versions
+FOR EACH ROW
+WHEN (OLD.valid_to IS NULL AND NEW.valid_to IS NOT NULL)
+EXECUTE FUNCTION notify_version_close();
@@ -0,0 +1,5 @@
+DROP POLICY IF EXISTS tenant_isolation ON query_usage;
+ALTER TABLE query_usage NO FORCE ROW LEVEL SECURITY;
+ALTER TABLE query_usage DISABLE ROW LEVEL SECURITY;
+DROP INDEX IF EXISTS query_usage_tenant_id_idx;
+ALTER TABLE query_usage DROP COLUMN IF EXISTS tenant_id;
@@ -0,0 +1,11 @@
+-- query usage belongs to the tenant whose query it records, and is only visible to it,
+-- as the chunk and session tables are since 000011
+ALTER TABLE query_usage ADD COLUMN IF NOT EXISTS tenant_id TEXT NOT NULL DEFAULT dynarag_tenant();
+
+CREATE INDEX IF NOT EXISTS query_usage_tenant_id_idx ON query_usage(tenant_id, created_at);
+
+ALTER TABLE query_usage ENABLE ROW LEVEL SECURITY;
+ALTER TABLE query_usage FORCE ROW LEVEL SECURITY;
+CREATE POLICY tenant_isolation ON query_usage
+    USING (tenant_id = dynarag_tenant())
+    WITH CHECK (tenant_id = dynarag_tenant());
@@ -0,0 +1,241 @@
+package dynarag
+
+import (
+	"time"
+
+	"github.com/Predixus/DynaRAG/internal/llm"
+	"github.com/Predixus/DynaRAG/internal/rag"
+	"github.com/Predixus/DynaRAG/internal/store"
+	"github.com/Predixus/DynaRAG/types"
+)
+
+// QueryOption configures a single call to Query or Similar
+type QueryOption func(*queryConfig)
+
+// queryConfig holds the per call settings of a Query
+type queryConfig struct {
+	template      string
+	vars          map[string]any
+	responseStyle string
+	temperature   *float32
+	grounding     *float64 // support threshold of the grounding check, if enabled
+	rewriter      QueryRewriter
+	rewrites      *[]string     // receives the rewritten queries of a call to Similar
+	history       []llm.Message // earlier turns of the session, set by Ask
+	probes        int
+	efSearch      int
+	oversample    int
+	identity      *types.Identity // caller that restricted chunks are checked against
+	access        *AccessReport   // receives how many chunks access control withheld
+	asOf          *time.Time      // moment whose document versions are searched
+
+	// onRetrieval is called once the chunks have been retrieved and packed, before
+	// generation starts
+	onRetrieval func(RetrievalEvent) error
+}
+
+// WithTemplate renders the prompt with a template registered on the Client
+func WithTemplate(name string) QueryOption {
+	return func(c *queryConfig) {
+		c.template = name
+	}
+}
+
+// WithTemplateVars makes extra variables available to the template as .Vars
+func WithTemplateVars(vars map[string]any) QueryOption {
+	return func(c *queryConfig) {
+		c.vars = vars
+	}
+}
+
+// WithResponseStyle sets the style the LLM is asked to respond in, e.g. "concise and factual"
+func WithResponseStyle(style string) QueryOption {
+	return func(c *queryConfig) {
+		c.responseStyle = style
+	}
+}
+
+// WithTemperature sets the sampling temperature of the LLM
+func WithTemperature(temp float32) QueryOption {
+	return func(c *queryConfig) {
+		c.temperature = &temp
+	}
+}
+
+// WithGroundingCheck verifies after generation that each sentence of the answer is
+// supported by the retrieved chunks, and reports the outcome in QueryResult.Grounding.
+// A sentence is supported when its similarity to a chunk, or its entailment probability
+// if Config.EntailmentModel is set, reaches threshold. Zero uses the default threshold
+func WithGroundingCheck(threshold float64) QueryOption {
+	return func(c *queryConfig) {
+		c.grounding = &threshold
+	}
+}
+
+// WithRewriter rewrites the query before retrieval, e.g. with MultiQuery or HyDE. The
+// texts retrieved with are returned in QueryResult.Rewrites
+func WithRewriter(rewriter QueryRewriter) QueryOption {
+	return func(c *queryConfig) {
+		c.rewriter = rewriter
+	}
+}
+
+// WithRewrites stores the texts retrieved with in dst, for inspecting the rewrites of a
+// call to Similar
+func WithRewrites(dst *[]string) QueryOption {
+	return func(c *queryConfig) {
+		c.rewrites = dst
+	}
+}
+
+// WithProbes sets the number of IVFFlat lists probed by the search, trading speed for
+// recall. Only applies when the index was built with IndexIVFFlat
+func WithProbes(probes int) QueryOption {
+	return func(c *queryConfig) {
+		c.probes = probes
+	}
+}
+
+// WithEfSearch sets the size of the HNSW candidate list of the search, trading speed for
+// recall. It also bounds the number of results an HNSW search can return
+func WithEfSearch(efSearch int) QueryOption {
+	return func(c *queryConfig) {
+		c.efSearch = efSearch
+	}
+}
+
+// WithOversample sets how many candidates per result a search over a quantised index
+// re-ranks on full precision vectors. Defaults to 2 for halfvec and 10 for binary
+func WithOversample(oversample int) QueryOption {
+	return func(c *queryConfig) {
+		c.oversample = oversample
+	}
+}
+
+// WithIdentity retrieves on behalf of a caller. Chunks restricted with
+// WithAllowedPrincipals are only considered if they allow the caller's principal or one of
+// its groups. Without an identity only unrestricted chunks are retrieved
+func WithIdentity(identity types.Identity) QueryOption {
+	return func(c *queryConfig) {
+		c.identity = &identity
+	}
+}
+
+// WithAccessReport fills dst with how many of the nearest chunks access control withheld
+// from the caller. Counting costs a second search
+func WithAccessReport(dst *AccessReport) QueryOption {
+	return func(c *queryConfig) {
+		c.access = dst
+	}
+}
+
+// AsOf retrieves from the corpus as it was at t: the document versions current at that
+// moment and the chunks they held then. Versions are created by Ingest
+func AsOf(t time.Time) QueryOption {
+	return func(c *queryConfig) {
+		c.asOf = &t
+	}
+}
+
+// principals returns the principals of the caller, nil if the call has no identity
+func (q *queryConfig) principals() []string {
+	if q.identity == nil {
+		return nil
+	}
+	return q.identity.Principals()
+}
+
+func newQueryConfig(opts []QueryOption) *queryConfig {
+	config := &queryConfig{}
+	for _, opt := range opts {
+		opt(config)
+	}
+	return config
+}
+
+// ragOptions returns the prompt options of the query
+func (q *queryConfig) ragOptions() []rag.Option {
+	var opts []rag.Option
+	if q.template != "" {
+		opts = append(opts, rag.WithTemplate(q.template))
+	}
+	if q.vars != nil {
+		opts = append(opts, rag.WithVars(q.vars))
+	}
+	if q.responseStyle != "" {
+		opts = append(opts, rag.WithResponseStyle(q.responseStyle))
+	}
+	if q.temperature != nil {
+		opts = append(opts, rag.WithTemperature(*q.temperature))
+	}
+	if q.history != nil {
+		opts = append(opts, rag.WithHistory(q.history))
+	}
+	return opts
+}
+
+// searchParams returns the recall knobs of the query, falling back to the client defaults
+func (q *queryConfig) searchParams(defaults store.SearchParams) store.SearchParams {
+	params := defaults
+	if q.probes > 0 {
+		params.Probes = q.probes
+	}
+	if q.efSearch > 0 {
+		params.EfSearch = q.efSearch
+	}
+	if q.oversample > 0 {
+		params.Oversample = q.oversample
+	}
+	return params
+}
+
+// llmOptions returns the generation options of the query
+func (q *queryConfig) llmOptions() []llm.Option {
+	var opts []llm.Option
+	if q.temperature != nil {
+		opts = append(opts, llm.WithTemperature(*q.temperature))
+	}
+	return opts
+}
+
+// ChunkOption configures a single call to Chunk
+type ChunkOption func(*chunkConfig)
+
+// chunkConfig holds the per call settings of a Chunk
+type chunkConfig struct {
+	allowedPrincipals []string
+	expiresAt         *time.Time
+}
+
+// WithAllowedPrincipals restricts the chunk to callers whose identity holds one of the
+// principals, as a user or a group. Restricted chunks are withheld from every other caller
+// by the search itself, so the top k is made up of permitted chunks only
+func WithAllowedPrincipals(principals ...string) ChunkOption {
+	return func(c *chunkConfig) {
+		c.allowedPrincipals = append(c.allowedPrincipals, principals...)
+	}
+}
+
+// WithExpiresAt expires the chunk at t. Expired chunks are left out of searches and
+// listings straight away, and removed for good by Vacuum
+func WithExpiresAt(t time.Time) ChunkOption {
+	return func(c *chunkConfig) {
+		c.expiresAt = &t
+	}
+}
+
+// WithTTL expires the chunk once ttl has passed since it was stored, see WithExpiresAt
+func WithTTL(ttl time.Duration) ChunkOption {
+	return func(c *chunkConfig) {
+		expiresAt := time.Now().Add(ttl)
+		c.expiresAt = &expiresAt
+	}
+}
+
+func newChunkConfig(opts []ChunkOption) *chunkConfig {
+	config := &chunkConfig{}
+	for _, opt := range opts {
+		opt(config)
+	}
+	return config
+}
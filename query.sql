@@ -1,20 +1,55 @@
 -- name: CreateDocument :one
-INSERT INTO documents (file_path)
-VALUES ($1)
-ON CONFLICT (file_path) DO UPDATE 
-SET updated_at = CURRENT_TIMESTAMP
+INSERT INTO documents (collection_id, file_path)
+VALUES ($1, $2)
+ON CONFLICT (collection_id, file_path) DO UPDATE 
+SET updated_at = CURRENT_TIMESTAMP,
+    deleted_at = NULL
 RETURNING *;
 
 -- name: GetDocument :one
-SELECT * FROM documents WHERE id = $1 LIMIT 1;
+SELECT * FROM documents WHERE id = $1 AND deleted_at IS NULL LIMIT 1;
 
 -- name: ListDocuments :many
-SELECT * FROM documents ORDER BY created_at DESC;
+SELECT * FROM documents
+WHERE collection_id = $1
+  AND deleted_at IS NULL
+ORDER BY created_at DESC;
 
 -- name: DeleteDocument :exec
 DELETE FROM documents
 WHERE id = $1;
 
+-- name: RenameDocument :execrows
+UPDATE documents
+SET file_path = sqlc.arg(new_file_path),
+    updated_at = CURRENT_TIMESTAMP
+WHERE collection_id = sqlc.arg(collection_id)
+  AND file_path = sqlc.arg(file_path)
+  AND deleted_at IS NULL;
+
+-- name: TrashDocument :one
+-- TrashDocument moves the chunks of one document, of every version, to the trash
+WITH trashed AS (
+    UPDATE embeddings e
+    SET deleted_at = now()
+    FROM documents d
+    WHERE d.id = e.document_id
+      AND d.collection_id = $1
+      AND d.file_path = $2
+      AND e.deleted_at IS NULL
+    RETURNING e.document_id, e.chunk_size
+), trashed_documents AS (
+    UPDATE documents
+    SET deleted_at = now()
+    WHERE id IN (SELECT document_id FROM trashed)
+      AND deleted_at IS NULL
+    RETURNING id
+)
+SELECT
+    (SELECT COUNT(*) FROM trashed) AS embedding_count,
+    (SELECT COALESCE(SUM(chunk_size), 0) FROM trashed)::bigint AS total_bytes,
+    (SELECT COUNT(*) FROM trashed_documents) AS document_count;
+
 -- name: CreateEmbedding :one
 INSERT INTO embeddings (
     document_id,
@@ -25,24 +60,42 @@ INSERT INTO embeddings (
     created_at,
     metadata,
     metadata_hash,
-    embedding_text
+    embedding_text,
+    allowed_principals,
+    expires_at,
+    version_id
 ) VALUES (
-    $1, $2, $3, $4, length($4), DEFAULT, $5, $6, $7
+    $1, $2, $3, $4, length($4), DEFAULT, $5, $6, $7, $8, $9, $10
 )
-RETURNING id, document_id, model_name, embedding, chunk_text, chunk_size, created_at, metadata, metadata_hash, embedding_text;
+RETURNING id, document_id, model_name, embedding, chunk_text, chunk_size, created_at, metadata, metadata_hash, embedding_text, tenant_id, allowed_principals, expires_at, deleted_at, version_id;
 
 -- name: GetEmbedding :one
 SELECT e.* FROM embeddings e
 JOIN documents d ON d.id = e.document_id
-WHERE e.id = $1 LIMIT 1;
+WHERE e.id = $1
+  AND e.deleted_at IS NULL
+LIMIT 1;
 
--- name: DeleteEmbeddings :exec
-DELETE FROM embeddings;
+-- name: TrashEmbeddings :exec
+WITH trashed AS (
+    UPDATE embeddings e
+    SET deleted_at = now()
+    FROM documents d
+    WHERE d.id = e.document_id
+      AND d.collection_id = $1
+      AND e.deleted_at IS NULL
+    RETURNING e.document_id
+)
+UPDATE documents
+SET deleted_at = now()
+WHERE id IN (SELECT document_id FROM trashed)
+  AND deleted_at IS NULL;
 
 -- name: ListDocumentEmbeddings :many
 SELECT e.* FROM embeddings e
 JOIN documents d ON d.id = e.document_id
 WHERE e.document_id = $1
+  AND e.deleted_at IS NULL
   AND (sqlc.narg(metadata_hash)::text IS NULL OR sqlc.narg(metadata_hash)::text = e.metadata_hash);
 
 -- name: GetStorageStats :one
@@ -51,24 +104,12 @@ SELECT
     SUM(e.chunk_size) as total_bytes,
     COUNT(DISTINCT d.id) as document_count
 FROM embeddings e
-LEFT JOIN documents d ON e.document_id = d.id;
-
--- name: FindTopKNNEmbeddings :many
-SELECT 
-    e.id,
-    e.document_id,
-    e.chunk_text,
-    e.chunk_size,
-    d.file_path,
-    e.metadata,
-    (e.embedding <=> sqlc.arg(query_embedding)::vector)::float8 as distance,
-    (1 - (e.embedding <=> sqlc.arg(query_embedding)::vector))::float8 as similarity
-FROM embeddings e
-JOIN documents d ON d.id = e.document_id
-WHERE e.model_name = sqlc.arg(model_name)
-  AND (sqlc.narg(metadata_hash)::text IS NULL OR sqlc.narg(metadata_hash)::text = e.metadata_hash)
-ORDER BY e.embedding <=> sqlc.arg(query_embedding)::vector ASC
-LIMIT sqlc.arg(k);
+JOIN documents d ON e.document_id = d.id
+JOIN document_versions v ON v.id = e.version_id
+WHERE d.collection_id = $1
+  AND e.deleted_at IS NULL
+  AND (e.expires_at IS NULL OR e.expires_at > now())
+  AND v.valid_to IS NULL;
 
 -- name: FindSimilarEmbeddingsInDocument :many
 WITH similarity_scores AS (
@@ -86,6 +127,7 @@ WITH similarity_scores AS (
       AND e.model_name = sqlc.arg(model_name)
       AND 1 - (e.embedding <=> sqlc.arg(query_embedding)::vector) > sqlc.arg(similarity_threshold)
       AND (sqlc.narg(metadata_hash)::text IS NULL OR sqlc.narg(metadata_hash)::text = e.metadata_hash)
+      AND e.deleted_at IS NULL
 )
 SELECT *
 FROM similarity_scores
@@ -98,7 +140,13 @@ SELECT
     COUNT(e.id) as chunk_count,
     COALESCE(SUM(e.chunk_size), 0) as total_bytes
 FROM documents d
-LEFT JOIN embeddings e ON e.document_id = d.id;
+LEFT JOIN (
+    embeddings e JOIN document_versions v ON v.id = e.version_id AND v.valid_to IS NULL
+) ON e.document_id = d.id
+    AND e.deleted_at IS NULL
+    AND (e.expires_at IS NULL OR e.expires_at > now())
+WHERE d.collection_id = $1
+  AND d.deleted_at IS NULL;
 
 -- name: ListChunks :many
 SELECT 
@@ -109,9 +157,306 @@ SELECT
     e.model_name,
     e.created_at,
     d.file_path,
-    d.id as document_id
+    d.id as document_id,
+    e.allowed_principals,
+    e.expires_at
 FROM embeddings e
 JOIN documents d ON d.id = e.document_id
-WHERE (sqlc.narg(metadata_hash)::text IS NULL OR e.metadata_hash = sqlc.narg(metadata_hash)::text)
+JOIN document_versions v ON v.id = e.version_id
+WHERE d.collection_id = sqlc.arg(collection_id)
+  AND (sqlc.narg(metadata_hash)::text IS NULL OR e.metadata_hash = sqlc.narg(metadata_hash)::text)
+  AND (e.allowed_principals IS NULL OR e.allowed_principals && sqlc.arg(principals)::text[])
+  AND (e.expires_at IS NULL OR e.expires_at > now())
+  AND e.deleted_at IS NULL
+  AND v.valid_to IS NULL
 ORDER BY e.created_at DESC;
 
+
+-- name: CreateQueryUsage :one
+INSERT INTO query_usage (
+    provider,
+    model,
+    prompt_tokens,
+    completion_tokens,
+    total_tokens,
+    latency_ms,
+    time_to_first_token_ms,
+    finish_reason,
+    cost
+) VALUES (
+    $1, $2, $3, $4, $5, $6, $7, $8, $9
+)
+RETURNING *;
+
+-- name: GetUsageSummary :many
+SELECT 
+    provider,
+    model,
+    COUNT(id) as query_count,
+    COALESCE(SUM(prompt_tokens), 0)::bigint as prompt_tokens,
+    COALESCE(SUM(completion_tokens), 0)::bigint as completion_tokens,
+    COALESCE(SUM(total_tokens), 0)::bigint as total_tokens,
+    COALESCE(AVG(latency_ms), 0)::float8 as avg_latency_ms,
+    COALESCE(AVG(time_to_first_token_ms), 0)::float8 as avg_time_to_first_token_ms,
+    COALESCE(SUM(cost), 0)::float8 as total_cost
+FROM query_usage
+WHERE created_at >= sqlc.arg(since)
+  AND tenant_id = dynarag_tenant()
+GROUP BY provider, model
+ORDER BY provider, model;
+
+-- name: GetEmbeddingVectors :many
+SELECT id, embedding FROM embeddings
+WHERE id = ANY(sqlc.arg(ids)::bigint[])
+  AND deleted_at IS NULL;
+
+-- name: CreateSession :one
+INSERT INTO sessions (title) VALUES ($1)
+RETURNING *;
+
+-- name: GetSession :one
+SELECT * FROM sessions WHERE id = $1 LIMIT 1;
+
+-- name: CreateMessage :one
+INSERT INTO messages (
+    session_id,
+    role,
+    content,
+    chunk_ids
+) VALUES (
+    $1, $2, $3, $4
+)
+RETURNING *;
+
+-- name: ListSessionMessages :many
+SELECT * FROM messages
+WHERE session_id = sqlc.arg(session_id)
+  AND id > sqlc.arg(after_id)
+ORDER BY id ASC;
+
+-- name: UpdateSessionSummary :exec
+UPDATE sessions
+SET summary = $2,
+    summarised_until = $3,
+    updated_at = CURRENT_TIMESTAMP
+WHERE id = $1;
+
+-- name: TouchSession :exec
+UPDATE sessions
+SET updated_at = CURRENT_TIMESTAMP
+WHERE id = $1;
+
+-- name: GetModelRegistration :one
+SELECT * FROM model_registrations WHERE model_name = $1 LIMIT 1;
+
+-- name: GetEmbeddingDimensions :one
+SELECT atttypmod::integer AS dimensions
+FROM pg_attribute
+WHERE attrelid = 'embeddings'::regclass AND attname = 'embedding';
+
+-- name: ListModelRegistrations :many
+SELECT * FROM model_registrations ORDER BY model_name;
+
+-- name: UpsertModelRegistration :one
+INSERT INTO model_registrations (
+    model_name,
+    dimensions,
+    metric
+) VALUES (
+    $1, $2, $3
+)
+ON CONFLICT (model_name) DO UPDATE
+SET dimensions = EXCLUDED.dimensions,
+    metric = EXCLUDED.metric,
+    updated_at = CURRENT_TIMESTAMP
+RETURNING *;
+
+-- name: UpdateModelQuantization :one
+UPDATE model_registrations
+SET quantization = $2,
+    updated_at = CURRENT_TIMESTAMP
+WHERE model_name = $1
+RETURNING *;
+
+-- name: CreateCollection :one
+INSERT INTO collections (name) VALUES ($1)
+RETURNING *;
+
+-- name: EnsureCollection :one
+INSERT INTO collections (name) VALUES ($1)
+ON CONFLICT (tenant_id, name) DO UPDATE
+SET updated_at = collections.updated_at
+RETURNING *;
+
+-- name: GetCollectionByName :one
+SELECT * FROM collections WHERE name = $1 AND tenant_id = dynarag_tenant() LIMIT 1;
+
+-- name: ListCollections :many
+SELECT 
+    c.id,
+    c.name,
+    c.created_at,
+    COUNT(DISTINCT d.id) as document_count,
+    COUNT(e.id) as chunk_count
+FROM collections c
+LEFT JOIN documents d ON d.collection_id = c.id AND d.deleted_at IS NULL
+LEFT JOIN (
+    embeddings e JOIN document_versions v ON v.id = e.version_id AND v.valid_to IS NULL
+) ON e.document_id = d.id
+    AND e.deleted_at IS NULL
+    AND (e.expires_at IS NULL OR e.expires_at > now())
+WHERE c.tenant_id = dynarag_tenant()
+GROUP BY c.id
+ORDER BY c.name;
+
+-- name: RenameCollection :one
+UPDATE collections
+SET name = sqlc.arg(new_name),
+    updated_at = CURRENT_TIMESTAMP
+WHERE name = sqlc.arg(name)
+  AND tenant_id = dynarag_tenant()
+RETURNING *;
+
+-- name: DeleteCollection :execrows
+DELETE FROM collections WHERE name = $1 AND tenant_id = dynarag_tenant();
+
+-- name: DeleteCollectionEmbeddings :many
+DELETE FROM embeddings e
+USING documents d
+WHERE d.id = e.document_id
+  AND d.collection_id = $1
+RETURNING e.document_id, e.chunk_size, d.file_path;
+
+-- name: DeleteExpiredEmbeddings :many
+DELETE FROM embeddings e
+USING documents d
+WHERE d.id = e.document_id
+  AND e.id IN (
+    SELECT x.id FROM embeddings x
+    WHERE x.expires_at <= now()
+    ORDER BY x.expires_at
+    LIMIT sqlc.arg(batch_size)
+    FOR UPDATE SKIP LOCKED
+  )
+RETURNING e.id, e.document_id, e.chunk_size, d.file_path;
+
+-- name: CountExistingDocuments :one
+SELECT COUNT(*) FROM documents
+WHERE id = ANY(sqlc.arg(ids)::bigint[]);
+
+-- name: GetTrashStats :one
+SELECT 
+    COUNT(e.id) as embedding_count,
+    COALESCE(SUM(e.chunk_size), 0)::bigint as total_bytes,
+    COUNT(DISTINCT d.id) as document_count
+FROM embeddings e
+JOIN documents d ON e.document_id = d.id
+WHERE d.collection_id = sqlc.arg(collection_id)
+  AND e.deleted_at IS NOT NULL
+  AND (sqlc.narg(within)::interval IS NULL OR e.deleted_at >= now() - sqlc.narg(within)::interval)
+  AND (sqlc.narg(older_than)::interval IS NULL OR e.deleted_at <= now() - sqlc.narg(older_than)::interval);
+
+-- name: ListTrashedFilePaths :many
+SELECT DISTINCT d.file_path
+FROM embeddings e
+JOIN documents d ON e.document_id = d.id
+WHERE d.collection_id = sqlc.arg(collection_id)
+  AND e.deleted_at IS NOT NULL
+  AND (sqlc.narg(within)::interval IS NULL OR e.deleted_at >= now() - sqlc.narg(within)::interval)
+  AND (sqlc.narg(older_than)::interval IS NULL OR e.deleted_at <= now() - sqlc.narg(older_than)::interval)
+ORDER BY d.file_path;
+
+-- name: RestoreEmbeddings :exec
+WITH restored AS (
+    UPDATE embeddings e
+    SET deleted_at = NULL
+    FROM documents d
+    WHERE d.id = e.document_id
+      AND d.collection_id = sqlc.arg(collection_id)
+      AND e.deleted_at IS NOT NULL
+      AND (sqlc.narg(within)::interval IS NULL OR e.deleted_at >= now() - sqlc.narg(within)::interval)
+      AND (sqlc.narg(older_than)::interval IS NULL OR e.deleted_at <= now() - sqlc.narg(older_than)::interval)
+    RETURNING e.document_id
+)
+UPDATE documents
+SET deleted_at = NULL
+WHERE id IN (SELECT document_id FROM restored);
+
+-- name: PurgeTrash :exec
+DELETE FROM embeddings e
+USING documents d
+WHERE d.id = e.document_id
+  AND d.collection_id = sqlc.arg(collection_id)
+  AND e.deleted_at IS NOT NULL
+  AND (sqlc.narg(within)::interval IS NULL OR e.deleted_at >= now() - sqlc.narg(within)::interval)
+  AND (sqlc.narg(older_than)::interval IS NULL OR e.deleted_at <= now() - sqlc.narg(older_than)::interval);
+
+-- name: CloseDocumentVersion :exec
+UPDATE document_versions
+SET valid_to = now()
+WHERE document_id = $1
+  AND valid_to IS NULL;
+
+-- name: OpenDocumentVersion :one
+-- OpenDocumentVersion returns the current version of a document, opening the next one if
+-- it has none
+INSERT INTO document_versions (document_id, version)
+VALUES (
+    $1,
+    (SELECT COALESCE(MAX(version), 0) + 1 FROM document_versions WHERE document_id = $1)
+)
+ON CONFLICT (document_id) WHERE valid_to IS NULL DO UPDATE
+SET valid_to = NULL
+RETURNING *;
+
+-- name: CreateAuditEntry :one
+INSERT INTO audit_log (
+    occurred_at,
+    operation,
+    principal,
+    groups,
+    collection,
+    file_paths,
+    chunk_ids,
+    query,
+    filter,
+    prev_hash,
+    hash
+) VALUES (
+    $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11
+)
+RETURNING *;
+
+-- name: GetLastAuditHash :one
+SELECT hash FROM audit_log
+WHERE hash IS NOT NULL
+ORDER BY id DESC
+LIMIT 1;
+
+-- name: ListAuditLog :many
+SELECT * FROM audit_log
+WHERE (sqlc.narg(operation)::text IS NULL OR operation = sqlc.narg(operation)::text)
+  AND (sqlc.narg(principal)::text IS NULL OR principal = sqlc.narg(principal)::text)
+  AND (sqlc.narg(file_path)::text IS NULL OR sqlc.narg(file_path)::text = ANY(file_paths))
+  AND (sqlc.narg(since)::timestamptz IS NULL OR occurred_at >= sqlc.narg(since)::timestamptz)
+  AND (sqlc.narg(until)::timestamptz IS NULL OR occurred_at < sqlc.narg(until)::timestamptz)
+ORDER BY id
+LIMIT sqlc.arg(max_entries);
+
+-- name: ListAuditChain :many
+SELECT * FROM audit_log
+WHERE hash IS NOT NULL
+ORDER BY id;
+
+-- name: GetGitIngest :one
+SELECT * FROM git_ingests
+WHERE collection_id = $1
+  AND repository = $2;
+
+-- name: UpsertGitIngest :one
+INSERT INTO git_ingests (collection_id, repository, commit_sha)
+VALUES ($1, $2, $3)
+ON CONFLICT (collection_id, repository) DO UPDATE
+SET commit_sha = EXCLUDED.commit_sha,
+    ingested_at = now()
+RETURNING *;
@@ -0,0 +1,194 @@
+package dynarag
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/Predixus/DynaRAG/internal/llm"
+	"github.com/Predixus/DynaRAG/internal/rag"
+	"github.com/Predixus/DynaRAG/internal/store"
+	"github.com/Predixus/DynaRAG/types"
+)
+
+// Completer returns the LLM's reply to prompt under the given system instructions
+type Completer func(ctx context.Context, system string, prompt string) (string, error)
+
+// QueryRewriter turns a query into the texts that are embedded to retrieve chunks before
+// generation. When several texts are returned, their results are fused with Reciprocal
+// Rank Fusion
+type QueryRewriter interface {
+	Rewrite(ctx context.Context, query string, complete Completer) ([]string, error)
+}
+
+// QueryRewriterFunc adapts a function to a QueryRewriter
+type QueryRewriterFunc func(ctx context.Context, query string, complete Completer) ([]string, error)
+
+func (f QueryRewriterFunc) Rewrite(
+	ctx context.Context,
+	query string,
+	complete Completer,
+) ([]string, error) {
+	return f(ctx, query, complete)
+}
+
+// MultiQuery asks the LLM for n paraphrases of the query and retrieves with the query and
+// each paraphrase
+func MultiQuery(n int) QueryRewriter {
+	return QueryRewriterFunc(func(ctx context.Context, query string, complete Completer) ([]string, error) {
+		if n <= 0 {
+			return nil, errors.New("multi-query expansion needs at least one paraphrase")
+		}
+		reply, err := complete(ctx, rag.MultiQueryPrompt(n), query)
+		if err != nil {
+			return nil, err
+		}
+		return append([]string{query}, rag.ParseQueries(reply, n)...), nil
+	})
+}
+
+// HyDE asks the LLM for a hypothetical answer to the query and retrieves with the answer
+// in place of the query (Hypothetical Document Embeddings)
+func HyDE() QueryRewriter {
+	return QueryRewriterFunc(func(ctx context.Context, query string, complete Completer) ([]string, error) {
+		reply, err := complete(ctx, rag.HyDEPrompt(), query)
+		if err != nil {
+			return nil, err
+		}
+		reply = strings.TrimSpace(reply)
+		if reply == "" {
+			return nil, errors.New("LLM returned an empty hypothetical document")
+		}
+		return []string{reply}, nil
+	})
+}
+
+// retrieve returns the k chunks most similar to the query that the caller may see,
+// rewriting the query first if the call asks for it. The texts that were retrieved with are
+// returned alongside. Access control is reported for the first text searched
+func (c *Client) retrieve(
+	ctx context.Context,
+	query string,
+	k int8,
+	metadata *types.JSONMap,
+	queryCfg *queryConfig,
+) ([]store.FindTopKNNEmbeddingsRow, []string, error) {
+	if k <= 0 {
+		return nil, nil, fmt.Errorf("number of chunks to retrieve must be positive, got %d", k)
+	}
+	res, texts, err := c.searchChunks(ctx, query, k, metadata, queryCfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	c.auditRetrieval(ctx, query, metadata, queryCfg, res)
+	return res, texts, nil
+}
+
+// searchChunks runs the searches of retrieve
+func (c *Client) searchChunks(
+	ctx context.Context,
+	query string,
+	k int8,
+	metadata *types.JSONMap,
+	queryCfg *queryConfig,
+) ([]store.FindTopKNNEmbeddingsRow, []string, error) {
+	search := queryCfg.searchParams(c.config.Search)
+	principals := queryCfg.principals()
+
+	var withheld *int
+	if queryCfg.access != nil {
+		withheld = new(int)
+	}
+
+	if queryCfg.rewriter == nil {
+		embedding, err := store.GetSingleEmbedding(ctx, query)
+		if err != nil {
+			return nil, nil, err
+		}
+		res, err := c.store.Search(ctx, store.SearchRequest{
+			Embedding:  embedding,
+			K:          k,
+			Metadata:   metadata,
+			Params:     search,
+			Principals: principals,
+			AsOf:       queryCfg.asOf,
+			Withheld:   withheld,
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		if withheld != nil {
+			reportAccess(queryCfg, int(k), *withheld)
+		}
+		return res, nil, nil
+	}
+
+	texts, err := queryCfg.rewriter.Rewrite(ctx, query, c.complete)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to rewrite query: %w", err)
+	}
+	if len(texts) == 0 {
+		texts = []string{query}
+	}
+	slog.Debug("Rewrote query", "query", query, "rewrites", texts)
+
+	lists := make([][]store.FindTopKNNEmbeddingsRow, 0, len(texts))
+	for i, text := range texts {
+		embedding, err := store.GetSingleEmbedding(ctx, text)
+		if err != nil {
+			return nil, nil, err
+		}
+		request := store.SearchRequest{
+			Embedding:  embedding,
+			K:          k,
+			Metadata:   metadata,
+			Params:     search,
+			Principals: principals,
+			AsOf:       queryCfg.asOf,
+		}
+		if i == 0 {
+			request.Withheld = withheld
+		}
+		res, err := c.store.Search(ctx, request)
+		if err != nil {
+			return nil, nil, err
+		}
+		lists = append(lists, res)
+	}
+	if withheld != nil {
+		reportAccess(queryCfg, int(k), *withheld)
+	}
+
+	fused := rag.ReciprocalRankFusion(lists, func(row store.FindTopKNNEmbeddingsRow) int64 {
+		return row.ID
+	}, int(k))
+	return fused, texts, nil
+}
+
+// complete is the Completer handed to query rewriters
+func (c *Client) complete(ctx context.Context, system string, prompt string) (string, error) {
+	llmClient, err := llm.NewClient(
+		c.config.LLMProvider,
+		c.config.LLMToken,
+		llm.WithPrices(c.config.Prices),
+	)
+	if err != nil {
+		return "", fmt.Errorf("failed to create LLM client: %w", err)
+	}
+
+	var reply strings.Builder
+	result, err := llmClient.Generate(ctx, []llm.Message{
+		{Role: llm.RoleSystem, Content: system},
+		{Role: llm.RoleUser, Content: prompt},
+	}, &reply)
+	if err != nil {
+		return "", err
+	}
+
+	if c.config.TrackUsage {
+		c.recordUsage(ctx, result)
+	}
+	return reply.String(), nil
+}
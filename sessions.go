@@ -0,0 +1,184 @@
+package dynarag
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strconv"
+
+	"github.com/Predixus/DynaRAG/internal/llm"
+	"github.com/Predixus/DynaRAG/internal/rag"
+	"github.com/Predixus/DynaRAG/internal/store"
+	"github.com/Predixus/DynaRAG/types"
+)
+
+const defaultMaxHistoryTokens = 1024
+
+// CreateSession starts a conversation that can be continued with Ask
+func (c *Client) CreateSession(ctx context.Context, title string) (*store.Session, error) {
+	if err := c.requirePostgres("sessions"); err != nil {
+		return nil, err
+	}
+
+	session, err := store.CreateSession(ctx, c.config.PostgresConnStr, c.tenant, title)
+	if err != nil {
+		slog.Error("Failed to create session", "error", err)
+		return nil, err
+	}
+	return session, nil
+}
+
+// SessionMessages returns every message of a session, oldest first, including those that
+// have since been folded into its summary
+func (c *Client) SessionMessages(ctx context.Context, sessionID int64) ([]store.Message, error) {
+	if err := c.requirePostgres("sessions"); err != nil {
+		return nil, err
+	}
+
+	messages, err := store.ListSessionMessages(
+		ctx,
+		c.config.PostgresConnStr,
+		c.tenant,
+		sessionID,
+		0,
+	)
+	if err != nil {
+		slog.Error("Failed to list session messages", "error", err)
+		return nil, err
+	}
+	return messages, nil
+}
+
+// Ask answers a question within a session like Query, with the earlier turns of the
+// session as context. The question, the answer and the IDs of the chunks placed in the
+// prompt are persisted to the session. History beyond Config.MaxHistoryTokens is folded
+// into a running summary by the LLM
+func (c *Client) Ask(
+	ctx context.Context,
+	sessionID int64,
+	question string,
+	k *int8,
+	metadata *types.JSONMap,
+	writer io.Writer,
+	opts ...QueryOption,
+) (*QueryResult, error) {
+	if err := c.requirePostgres("sessions"); err != nil {
+		return nil, err
+	}
+
+	session, err := store.GetSession(ctx, c.config.PostgresConnStr, c.tenant, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get session %d: %w", sessionID, err)
+	}
+
+	history, err := c.sessionHistory(ctx, session)
+	if err != nil {
+		return nil, err
+	}
+
+	queryCfg := newQueryConfig(opts)
+	queryCfg.history = history
+
+	result, err := c.query(ctx, question, k, metadata, writer, queryCfg)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = store.AddSessionTurn(
+		ctx,
+		c.config.PostgresConnStr,
+		c.tenant,
+		sessionID,
+		question,
+		result.Answer,
+		usedChunkIDs(result),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to persist session turn: %w", err)
+	}
+
+	return result, nil
+}
+
+// sessionHistory loads the messages of the session that are not yet summarised. Messages
+// that do not fit the history budget are folded into the summary of the session; if that
+// fails they are left out of the prompt
+func (c *Client) sessionHistory(
+	ctx context.Context,
+	session *store.Session,
+) ([]llm.Message, error) {
+	stored, err := store.ListSessionMessages(
+		ctx,
+		c.config.PostgresConnStr,
+		c.tenant,
+		session.ID,
+		session.SummarisedUntil,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load session history: %w", err)
+	}
+
+	messages := make([]llm.Message, len(stored))
+	for i, message := range stored {
+		messages[i] = llm.Message{Role: llm.Role(message.Role), Content: message.Content}
+	}
+
+	counter, err := c.tokenCounter()
+	if err != nil {
+		return nil, err
+	}
+
+	older, recent, err := rag.SplitHistory(messages, c.config.MaxHistoryTokens, counter)
+	if err != nil {
+		return nil, err
+	}
+
+	summary := session.Summary.String
+	if len(older) > 0 {
+		system, prompt := rag.SummaryPrompt(summary, older)
+		folded, err := c.complete(ctx, system, prompt)
+		if err != nil {
+			slog.Warn(
+				"Failed to summarise session history, truncating",
+				"session", session.ID,
+				"error", err,
+			)
+		} else {
+			summary = folded
+			err = store.UpdateSessionSummary(
+				ctx,
+				c.config.PostgresConnStr,
+				c.tenant,
+				session.ID,
+				summary,
+				stored[len(older)-1].ID,
+			)
+			if err != nil {
+				slog.Error("Failed to store session summary", "session", session.ID, "error", err)
+			}
+		}
+	}
+
+	history := make([]llm.Message, 0, len(recent)+1)
+	if summary != "" {
+		history = append(history, rag.SummaryMessage(summary))
+	}
+	return append(history, recent...), nil
+}
+
+// usedChunkIDs returns the IDs of the retrieved chunks that made it into the prompt
+func usedChunkIDs(result *QueryResult) []int64 {
+	dropped := make(map[string]bool, len(result.Dropped))
+	for _, doc := range result.Dropped {
+		dropped[doc.Index] = true
+	}
+
+	ids := make([]int64, 0, len(result.Chunks))
+	for i, chunk := range result.Chunks {
+		if !dropped[strconv.Itoa(i)] {
+			ids = append(ids, chunk.ID)
+		}
+	}
+	return ids
+}
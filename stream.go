@@ -0,0 +1,154 @@
+package dynarag
+
+import (
+	"context"
+	"errors"
+	"io"
+	"iter"
+
+	"github.com/Predixus/DynaRAG/internal/llm"
+	"github.com/Predixus/DynaRAG/internal/rag"
+	"github.com/Predixus/DynaRAG/internal/store"
+	"github.com/Predixus/DynaRAG/types"
+)
+
+// Event is a typed event emitted by QueryStream. It is one of RetrievalEvent, TokenEvent,
+// CitationEvent, UsageEvent or DoneEvent
+type Event interface {
+	isEvent()
+}
+
+// RetrievalEvent is emitted once the chunks for the query have been retrieved
+type RetrievalEvent struct {
+	Chunks    []store.FindTopKNNEmbeddingsRow
+	Rewrites  []string // texts retrieved with in place of the query, if rewritten
+	Truncated []rag.Document
+	Dropped   []rag.Document
+}
+
+// TokenEvent carries a piece of the answer as it is streamed from the LLM
+type TokenEvent struct {
+	Content string
+}
+
+// CitationEvent is emitted as soon as a complete in-line citation appears in the answer
+type CitationEvent struct {
+	Citation Citation
+}
+
+// UsageEvent is emitted when generation completes, with the token usage and timings
+type UsageEvent struct {
+	*llm.GenerationResult
+}
+
+// DoneEvent is the final event of a successful stream
+type DoneEvent struct {
+	Result *QueryResult
+}
+
+func (RetrievalEvent) isEvent() {}
+func (TokenEvent) isEvent()     {}
+func (CitationEvent) isEvent()  {}
+func (UsageEvent) isEvent()     {}
+func (DoneEvent) isEvent()      {}
+
+// errStreamStopped aborts generation when the consumer stops iterating
+var errStreamStopped = errors.New("stream stopped by consumer")
+
+// QueryStream answers the query like Query, but returns the answer as a sequence of typed
+// events. An error ends the sequence; breaking out of the loop stops generation.
+//
+//	for event, err := range client.QueryStream(ctx, "What is TCP?", nil, nil) {
+//		if err != nil {
+//			return err
+//		}
+//		switch e := event.(type) {
+//		case dynarag.TokenEvent:
+//			fmt.Print(e.Content)
+//		case dynarag.DoneEvent:
+//			fmt.Println(e.Result.Citations)
+//		}
+//	}
+func (c *Client) QueryStream(
+	ctx context.Context,
+	query string,
+	k *int8,
+	metadata *types.JSONMap,
+	opts ...QueryOption,
+) iter.Seq2[Event, error] {
+	return streamEvents(ctx, opts, func(answer io.Writer, queryCfg *queryConfig) (*QueryResult, error) {
+		return c.query(ctx, query, k, metadata, answer, queryCfg)
+	})
+}
+
+// streamEvents runs a query that reports its retrieval through the query config and
+// streams its answer to the writer, yielding what it does as events
+func streamEvents(
+	ctx context.Context,
+	opts []QueryOption,
+	run func(answer io.Writer, queryCfg *queryConfig) (*QueryResult, error),
+) iter.Seq2[Event, error] {
+	return func(yield func(Event, error) bool) {
+		stream := &eventStream{ctx: ctx, yield: yield}
+
+		queryCfg := newQueryConfig(opts)
+		queryCfg.onRetrieval = func(event RetrievalEvent) error {
+			stream.chunks = event.Chunks
+			return stream.emit(event)
+		}
+
+		result, err := run(stream, queryCfg)
+		if stream.stopped {
+			return
+		}
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+
+		if stream.emit(UsageEvent{result.GenerationResult}) != nil {
+			return
+		}
+		_ = stream.emit(DoneEvent{Result: result})
+	}
+}
+
+// eventStream adapts the io.Writer the LLM streams into to a sequence of events
+type eventStream struct {
+	ctx       context.Context
+	yield     func(Event, error) bool
+	stopped   bool
+	chunks    []store.FindTopKNNEmbeddingsRow
+	citations rag.CitationScanner
+}
+
+func (s *eventStream) emit(event Event) error {
+	if s.stopped {
+		return errStreamStopped
+	}
+	if !s.yield(event, nil) {
+		s.stopped = true
+		return errStreamStopped
+	}
+	return nil
+}
+
+func (s *eventStream) Write(p []byte) (int, error) {
+	if err := s.ctx.Err(); err != nil {
+		return 0, err
+	}
+	if err := s.emit(TokenEvent{Content: string(p)}); err != nil {
+		return 0, err
+	}
+
+	for _, citation := range s.citations.Write(p) {
+		resolved, ok := resolveCitation(citation, s.chunks)
+		if !ok {
+			continue
+		}
+		if err := s.emit(CitationEvent{Citation: resolved}); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
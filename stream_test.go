@@ -0,0 +1,152 @@
+package dynarag
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Predixus/DynaRAG/internal/llm"
+	"github.com/Predixus/DynaRAG/internal/store"
+	"github.com/Predixus/DynaRAG/loaders"
+	"github.com/Predixus/DynaRAG/types"
+)
+
+// sseServer streams the tokens as an OpenAI compatible chat completion
+func sseServer(t *testing.T, tokens []string) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, token := range tokens {
+			content, err := json.Marshal(token)
+			require.NoError(t, err)
+			fmt.Fprintf(w, `data: {"id":"1","choices":[{"index":0,"delta":{"content":%s}}]}`+"\n\n", content)
+			w.(http.Flusher).Flush()
+		}
+		fmt.Fprint(w, `data: {"id":"1","choices":[],"usage":{"prompt_tokens":5,"completion_tokens":3,"total_tokens":8}}`+"\n\n")
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// fakeQuery retrieves the chunks and generates the answer from the server, as query does
+func fakeQuery(
+	t *testing.T,
+	server *httptest.Server,
+	chunks []store.FindTopKNNEmbeddingsRow,
+) func(io.Writer, *queryConfig) (*QueryResult, error) {
+	return func(answer io.Writer, queryCfg *queryConfig) (*QueryResult, error) {
+		if err := queryCfg.onRetrieval(RetrievalEvent{Chunks: chunks}); err != nil {
+			return nil, err
+		}
+		client, err := llm.NewClient("groq", "test-token", llm.WithEndpoint(server.URL))
+		require.NoError(t, err)
+		result, err := client.Generate(
+			context.Background(),
+			[]llm.Message{{Role: llm.RoleUser, Content: "What is TCP?"}},
+			answer,
+		)
+		if err != nil {
+			return nil, err
+		}
+		return &QueryResult{GenerationResult: result, Chunks: chunks}, nil
+	}
+}
+
+// TestQueryStream checks the events of a streamed answer arrive in order, with each
+// citation as soon as it is complete, and that stopping or cancelling ends generation
+func TestQueryStream(t *testing.T) {
+	chunks := []store.FindTopKNNEmbeddingsRow{
+		{ID: 10, FilePath: "tcp.md", ChunkText: "TCP is reliable."},
+		{ID: 11, FilePath: "rfc.pdf", ChunkText: "TCP retransmits.", Metadata: types.JSONMap{loaders.AnchorKey: "page=3"}},
+	}
+	tokens := []string{"TCP is [reli", "able][#re", "f-0]. It [retransmits][#ref-1", "] lost [data][#ref-7]."}
+
+	t.Run("events in order", func(t *testing.T) {
+		server := sseServer(t, tokens)
+
+		var events []string
+		var citations []Citation
+		for event, err := range streamEvents(context.Background(), nil, fakeQuery(t, server, chunks)) {
+			require.NoError(t, err)
+			switch e := event.(type) {
+			case RetrievalEvent:
+				events = append(events, "retrieval")
+			case TokenEvent:
+				events = append(events, "token:"+e.Content)
+			case CitationEvent:
+				events = append(events, "citation:"+e.Citation.Ref)
+				citations = append(citations, e.Citation)
+			case UsageEvent:
+				events = append(events, "usage")
+				require.NotNil(t, e.Usage)
+				assert.Equal(t, 8, e.Usage.TotalTokens)
+			case DoneEvent:
+				events = append(events, "done")
+			}
+		}
+
+		assert.Equal(t, []string{
+			"retrieval",
+			"token:" + tokens[0],
+			"token:" + tokens[1],
+			"token:" + tokens[2],
+			"citation:ref-0",
+			"token:" + tokens[3],
+			"citation:ref-1",
+			"usage",
+			"done",
+		}, events)
+		require.Len(t, citations, 2)
+		assert.Equal(t, Citation{Text: "reliable", Ref: "ref-0", ChunkID: 10, FilePath: "tcp.md", Source: "tcp.md"}, citations[0])
+		assert.Equal(t, "rfc.pdf#page=3", citations[1].Source)
+	})
+
+	t.Run("stopping ends generation", func(t *testing.T) {
+		server := sseServer(t, tokens)
+
+		var received int
+		var runErr error
+		run := fakeQuery(t, server, chunks)
+		stream := streamEvents(context.Background(), nil, func(answer io.Writer, queryCfg *queryConfig) (*QueryResult, error) {
+			result, err := run(answer, queryCfg)
+			runErr = err
+			return result, err
+		})
+		for event, err := range stream {
+			require.NoError(t, err)
+			received++
+			if _, ok := event.(TokenEvent); ok {
+				break
+			}
+		}
+		assert.Equal(t, 2, received)
+		assert.ErrorIs(t, runErr, errStreamStopped)
+	})
+
+	t.Run("cancelling ends the stream with the error", func(t *testing.T) {
+		server := sseServer(t, tokens)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		var tokenEvents int
+		var streamErr error
+		for event, err := range streamEvents(ctx, nil, fakeQuery(t, server, chunks)) {
+			if err != nil {
+				streamErr = err
+				continue
+			}
+			if _, ok := event.(TokenEvent); ok {
+				tokenEvents++
+				cancel()
+			}
+		}
+		assert.Equal(t, 1, tokenEvents)
+		assert.ErrorIs(t, streamErr, context.Canceled)
+	})
+}
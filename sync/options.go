@@ -0,0 +1,82 @@
+package sync
+
+import (
+	"time"
+
+	"github.com/Predixus/DynaRAG/internal/splitter"
+)
+
+const (
+	// DefaultInterval is how often the directory is scanned for changes
+	DefaultInterval = 2 * time.Second
+	// DefaultDebounce is how long a file must stay unchanged before it is synced
+	DefaultDebounce = time.Second
+)
+
+// Option configures a Watcher
+type Option func(*config)
+
+type config struct {
+	include   []string
+	exclude   []string
+	interval  time.Duration
+	debounce  time.Duration
+	chunkSize int
+}
+
+func newConfig(opts []Option) config {
+	cfg := config{
+		interval:  DefaultInterval,
+		debounce:  DefaultDebounce,
+		chunkSize: splitter.DefaultChunkSize,
+	}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return cfg
+}
+
+// WithInclude only syncs the files matching one of the glob patterns. A pattern with a
+// slash matches the path relative to the directory, one without matches the file name.
+// Every file is synced if no pattern is given
+func WithInclude(patterns ...string) Option {
+	return func(c *config) {
+		c.include = append(c.include, patterns...)
+	}
+}
+
+// WithExclude skips the files and directories matching one of the glob patterns, matched
+// as for WithInclude. Exclusion wins over inclusion
+func WithExclude(patterns ...string) Option {
+	return func(c *config) {
+		c.exclude = append(c.exclude, patterns...)
+	}
+}
+
+// WithInterval sets how often the directory is scanned for changes
+func WithInterval(interval time.Duration) Option {
+	return func(c *config) {
+		if interval > 0 {
+			c.interval = interval
+		}
+	}
+}
+
+// WithDebounce sets how long a file must stay unchanged before it is synced, so that a
+// file being written is only chunked once it is complete
+func WithDebounce(debounce time.Duration) Option {
+	return func(c *config) {
+		if debounce >= 0 {
+			c.debounce = debounce
+		}
+	}
+}
+
+// WithChunkSize sets the number of runes a chunk holds at most
+func WithChunkSize(size int) Option {
+	return func(c *config) {
+		if size > 0 {
+			c.chunkSize = size
+		}
+	}
+}
@@ -0,0 +1,340 @@
+// Package sync keeps a directory synced into a DynaRAG collection. A Watcher scans the
+// directory, then polls it for changes: changed files are split by type and ingested as a
+// new version of their document, removed files are deleted and moved files renamed
+package sync
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	dynarag "github.com/Predixus/DynaRAG"
+	"github.com/Predixus/DynaRAG/internal/splitter"
+	"github.com/Predixus/DynaRAG/internal/store"
+	"github.com/Predixus/DynaRAG/types"
+)
+
+// HashKey is the chunk metadata key holding the SHA-256 of the file a chunk was synced
+// from. It marks the documents a Watcher owns
+const HashKey = "sync_sha256"
+
+// Target is where a directory is synced to. *dynarag.Client is a Target
+type Target interface {
+	Ingest(
+		ctx context.Context,
+		filePath string,
+		chunks []string,
+		metadata *types.JSONMap,
+		opts ...dynarag.ChunkOption,
+	) (*dynarag.DocumentVersion, error)
+	DeleteDocument(ctx context.Context, filePath string) (*store.DeletionStats, error)
+	RenameDocument(ctx context.Context, filePath string, newFilePath string) error
+	ListChunks(
+		ctx context.Context,
+		metadata *types.JSONMap,
+		opts ...dynarag.QueryOption,
+	) ([]store.ListChunksRow, error)
+}
+
+// Stats counts the documents a sync changed
+type Stats struct {
+	Ingested int
+	Deleted  int
+	Renamed  int
+}
+
+// fileState is what the watcher knows of a file, keyed by its slash separated path
+// relative to the directory, which is also its document's file path
+type fileState struct {
+	size      int64
+	modTime   time.Time
+	changedAt time.Time // when the size or modification time was last seen to change
+	pending   bool      // changed since it was last synced
+	hash      string    // SHA-256 of the content last synced, empty if never synced
+}
+
+// Watcher keeps a directory synced into a collection. A collection should be synced from
+// a single directory, as the documents a Watcher stored that are missing from its
+// directory are deleted
+type Watcher struct {
+	target Target
+	root   string
+	config config
+	files  map[string]*fileState // nil until the stored documents are loaded
+}
+
+// NewWatcher creates a Watcher syncing the directory at root into target
+func NewWatcher(target Target, root string, opts ...Option) (*Watcher, error) {
+	info, err := os.Stat(root)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", root)
+	}
+
+	cfg := newConfig(opts)
+	for _, pattern := range append(cfg.include, cfg.exclude...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+	}
+	return &Watcher{target: target, root: root, config: cfg}, nil
+}
+
+// Run syncs the directory, then polls it and syncs the changes until ctx is done. Files
+// that fail to sync are logged and retried on the next poll
+func (w *Watcher) Run(ctx context.Context) error {
+	stats, err := w.Sync(ctx)
+	if err != nil {
+		return err
+	}
+	slog.Info(
+		"Synced directory",
+		"root", w.root,
+		"ingested", stats.Ingested,
+		"deleted", stats.Deleted,
+		"renamed", stats.Renamed,
+	)
+
+	ticker := time.NewTicker(w.config.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			if _, err := w.Sync(ctx); err != nil && ctx.Err() == nil {
+				slog.Error("Failed to sync directory", "root", w.root, "error", err)
+			}
+		}
+	}
+}
+
+// Sync scans the directory once and syncs what changed since the last scan. The first
+// scan compares the directory with the documents stored by earlier runs and syncs every
+// difference at once; later scans leave files alone until they have been unchanged for
+// the debounce period. Removals wait while files are settling, so that a file moved
+// during a scan is renamed rather than deleted and ingested again
+func (w *Watcher) Sync(ctx context.Context) (*Stats, error) {
+	initial := w.files == nil
+	if initial {
+		if err := w.load(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	present, err := w.scan()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	settling := false
+	var ready []string
+	for filePath, info := range present {
+		state, ok := w.files[filePath]
+		if !ok {
+			state = &fileState{}
+			w.files[filePath] = state
+		}
+		if state.size != info.Size() || !state.modTime.Equal(info.ModTime()) {
+			state.size, state.modTime = info.Size(), info.ModTime()
+			state.changedAt = now
+			state.pending = true
+		}
+		if !state.pending {
+			continue
+		}
+		if !initial && now.Sub(state.changedAt) < w.config.debounce {
+			settling = true
+			continue
+		}
+		ready = append(ready, filePath)
+	}
+	sort.Strings(ready)
+
+	var removed []string
+	if !settling {
+		for filePath := range w.files {
+			if _, ok := present[filePath]; !ok {
+				removed = append(removed, filePath)
+			}
+		}
+		sort.Strings(removed)
+	}
+
+	// a removed file whose content turns up under a new path was moved
+	moved := make(map[string]string, len(removed))
+	for _, filePath := range removed {
+		if hash := w.files[filePath].hash; hash != "" {
+			moved[hash] = filePath
+		}
+	}
+
+	stats := &Stats{}
+	for _, filePath := range ready {
+		if err := ctx.Err(); err != nil {
+			return stats, err
+		}
+		w.syncFile(ctx, filePath, moved, stats)
+	}
+
+	for _, filePath := range removed {
+		state, ok := w.files[filePath]
+		if !ok {
+			continue // renamed
+		}
+		if state.hash != "" {
+			if _, err := w.target.DeleteDocument(ctx, filePath); err != nil {
+				slog.Error("Failed to delete document", "file_path", filePath, "error", err)
+				continue
+			}
+			slog.Info("Deleted document", "file_path", filePath)
+			stats.Deleted++
+		}
+		delete(w.files, filePath)
+	}
+	return stats, nil
+}
+
+// syncFile renames the document of a moved file, or chunks and ingests a changed one.
+// Files that fail stay pending, to be retried by the next scan
+func (w *Watcher) syncFile(
+	ctx context.Context,
+	filePath string,
+	moved map[string]string,
+	stats *Stats,
+) {
+	state := w.files[filePath]
+
+	content, err := os.ReadFile(filepath.Join(w.root, filepath.FromSlash(filePath)))
+	if err != nil {
+		slog.Warn("Failed to read file", "file_path", filePath, "error", err)
+		return
+	}
+	sum := sha256.Sum256(content)
+	hash := hex.EncodeToString(sum[:])
+	if hash == state.hash {
+		state.pending = false
+		return
+	}
+
+	if from, ok := moved[hash]; ok && state.hash == "" {
+		err := w.target.RenameDocument(ctx, from, filePath)
+		if err == nil {
+			slog.Info("Renamed document", "file_path", from, "new_file_path", filePath)
+			state.hash, state.pending = hash, false
+			delete(w.files, from)
+			delete(moved, hash)
+			stats.Renamed++
+			return
+		}
+		slog.Warn("Failed to rename document, ingesting it instead", "file_path", from, "error", err)
+	}
+
+	if !utf8.Valid(content) {
+		slog.Debug("Skipping file that is not UTF-8 text", "file_path", filePath)
+		state.pending = false
+		return
+	}
+
+	chunks := splitter.ForPath(filePath)(string(content), w.config.chunkSize)
+	metadata := types.JSONMap{HashKey: hash}
+	if _, err := w.target.Ingest(ctx, filePath, chunks, &metadata); err != nil {
+		slog.Error("Failed to ingest file", "file_path", filePath, "error", err)
+		return
+	}
+	slog.Info("Ingested document", "file_path", filePath, "chunks", len(chunks))
+	state.hash, state.pending = hash, false
+	stats.Ingested++
+}
+
+// load reads the documents stored by earlier runs, with the hash of their content
+func (w *Watcher) load(ctx context.Context) error {
+	rows, err := w.target.ListChunks(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to list synced documents: %w", err)
+	}
+
+	w.files = make(map[string]*fileState)
+	for _, row := range rows {
+		if hash, ok := row.Metadata[HashKey].(string); ok {
+			w.files[row.FilePath] = &fileState{hash: hash}
+		}
+	}
+	return nil
+}
+
+// scan returns the regular files of the directory to sync, keyed by their slash separated
+// relative path
+func (w *Watcher) scan() (map[string]fs.FileInfo, error) {
+	present := make(map[string]fs.FileInfo)
+	err := filepath.WalkDir(w.root, func(name string, entry fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil // removed while scanning
+		}
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(w.root, name)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if rel == "." {
+			return nil
+		}
+
+		if entry.IsDir() {
+			if matches(w.config.exclude, rel) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !entry.Type().IsRegular() || matches(w.config.exclude, rel) {
+			return nil
+		}
+		if len(w.config.include) > 0 && !matches(w.config.include, rel) {
+			return nil
+		}
+
+		info, err := entry.Info()
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		present[rel] = info
+		return nil
+	})
+	return present, err
+}
+
+// matches reports whether a relative path matches one of the patterns. Patterns with a
+// slash match the whole path, others the last element
+func matches(patterns []string, rel string) bool {
+	for _, pattern := range patterns {
+		name := path.Base(rel)
+		if strings.Contains(pattern, "/") {
+			name = rel
+		}
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
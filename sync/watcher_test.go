@@ -0,0 +1,166 @@
+package sync
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	dynarag "github.com/Predixus/DynaRAG"
+	"github.com/Predixus/DynaRAG/internal/store"
+	"github.com/Predixus/DynaRAG/types"
+)
+
+// fakeTarget keeps the chunks of each document in memory
+type fakeTarget struct {
+	documents map[string][]string
+	metadata  map[string]types.JSONMap
+	ingested  []string
+}
+
+func newFakeTarget() *fakeTarget {
+	return &fakeTarget{documents: map[string][]string{}, metadata: map[string]types.JSONMap{}}
+}
+
+func (f *fakeTarget) Ingest(
+	ctx context.Context,
+	filePath string,
+	chunks []string,
+	metadata *types.JSONMap,
+	opts ...dynarag.ChunkOption,
+) (*dynarag.DocumentVersion, error) {
+	f.documents[filePath] = chunks
+	f.metadata[filePath] = *metadata
+	f.ingested = append(f.ingested, filePath)
+	return &dynarag.DocumentVersion{FilePath: filePath}, nil
+}
+
+func (f *fakeTarget) DeleteDocument(ctx context.Context, filePath string) (*store.DeletionStats, error) {
+	delete(f.documents, filePath)
+	delete(f.metadata, filePath)
+	return &store.DeletionStats{FilePaths: []string{filePath}}, nil
+}
+
+func (f *fakeTarget) RenameDocument(ctx context.Context, filePath string, newFilePath string) error {
+	f.documents[newFilePath], f.metadata[newFilePath] = f.documents[filePath], f.metadata[filePath]
+	delete(f.documents, filePath)
+	delete(f.metadata, filePath)
+	return nil
+}
+
+func (f *fakeTarget) ListChunks(
+	ctx context.Context,
+	metadata *types.JSONMap,
+	opts ...dynarag.QueryOption,
+) ([]store.ListChunksRow, error) {
+	var rows []store.ListChunksRow
+	for filePath, chunks := range f.documents {
+		for _, chunk := range chunks {
+			rows = append(rows, store.ListChunksRow{
+				FilePath:  filePath,
+				ChunkText: chunk,
+				Metadata:  f.metadata[filePath],
+			})
+		}
+	}
+	return rows, nil
+}
+
+func writeFile(t *testing.T, root string, name string, content string) {
+	t.Helper()
+	path := filepath.Join(root, filepath.FromSlash(name))
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+}
+
+func TestWatcherSync(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+	target := newFakeTarget()
+
+	writeFile(t, root, "guide.md", "How to sync.")
+	writeFile(t, root, "notes/todo.txt", "Write tests.")
+	writeFile(t, root, "notes/draft.tmp", "Not yet.")
+	writeFile(t, root, "build/out.md", "Generated.")
+
+	watcher, err := NewWatcher(target, root, WithExclude("*.tmp", "build"), WithDebounce(0))
+	require.NoError(t, err)
+
+	stats, err := watcher.Sync(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, &Stats{Ingested: 2}, stats)
+	assert.Equal(t, []string{"How to sync."}, target.documents["guide.md"])
+	assert.Contains(t, target.documents, "notes/todo.txt")
+
+	// an unchanged directory syncs nothing
+	stats, err = watcher.Sync(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, &Stats{}, stats)
+
+	writeFile(t, root, "guide.md", "How to sync, revised.")
+	require.NoError(t, os.Chtimes(filepath.Join(root, "guide.md"), time.Now(), time.Now().Add(time.Minute)))
+	require.NoError(t, os.Rename(filepath.Join(root, "notes/todo.txt"), filepath.Join(root, "todo.txt")))
+
+	stats, err = watcher.Sync(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, &Stats{Ingested: 1, Renamed: 1}, stats)
+	assert.Equal(t, []string{"How to sync, revised."}, target.documents["guide.md"])
+	assert.Contains(t, target.documents, "todo.txt")
+	assert.NotContains(t, target.documents, "notes/todo.txt")
+
+	require.NoError(t, os.Remove(filepath.Join(root, "todo.txt")))
+	stats, err = watcher.Sync(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, &Stats{Deleted: 1}, stats)
+	assert.NotContains(t, target.documents, "todo.txt")
+
+	// a new watcher picks up where the last one left off
+	writeFile(t, root, "extra.txt", "Added while stopped.")
+	restarted, err := NewWatcher(target, root, WithExclude("*.tmp", "build"))
+	require.NoError(t, err)
+	target.ingested = nil
+	stats, err = restarted.Sync(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, &Stats{Ingested: 1}, stats)
+	assert.Equal(t, []string{"extra.txt"}, target.ingested)
+}
+
+func TestWatcherDebounce(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+	target := newFakeTarget()
+
+	watcher, err := NewWatcher(target, root, WithDebounce(time.Hour))
+	require.NoError(t, err)
+	_, err = watcher.Sync(ctx)
+	require.NoError(t, err)
+
+	writeFile(t, root, "late.txt", "Still being written")
+	stats, err := watcher.Sync(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, &Stats{}, stats)
+	assert.Empty(t, target.documents)
+}
+
+func TestMatches(t *testing.T) {
+	tests := []struct {
+		pattern string
+		rel     string
+		want    bool
+	}{
+		{pattern: "*.md", rel: "docs/guide.md", want: true},
+		{pattern: "*.md", rel: "docs/guide.txt", want: false},
+		{pattern: "docs/*.md", rel: "docs/guide.md", want: true},
+		{pattern: "docs/*.md", rel: "other/docs/guide.md", want: false},
+		{pattern: "node_modules", rel: "web/node_modules", want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pattern+" "+tt.rel, func(t *testing.T) {
+			assert.Equal(t, tt.want, matches([]string{tt.pattern}, tt.rel))
+		})
+	}
+}
@@ -0,0 +1,41 @@
+package dynarag
+
+import (
+	"context"
+
+	"github.com/Predixus/DynaRAG/internal/store"
+)
+
+// DefaultTenant is the tenant a Client acts for unless scoped with ForTenant. It owns every
+// row stored before tenants were introduced
+const DefaultTenant = store.DefaultTenant
+
+// ErrRowSecurityBypassed is returned by ForTenant when the database role is a superuser or
+// has BYPASSRLS, which row level security does not apply to
+var ErrRowSecurityBypassed = store.ErrRowSecurityBypassed
+
+// ForTenant returns a handle that acts for a tenant, on the tenant's default collection.
+// Every store transaction of the handle sets app.tenant_id, and row level security on the
+// chunk, collection, session and usage tables only admits rows of that tenant, so no query
+// can reach the data of another. Collection, CreateCollection and the other collection
+// operations of the handle work within the tenant.
+//
+// Row level security does not apply to superusers or roles with BYPASSRLS, so ForTenant
+// fails with ErrRowSecurityBypassed unless the client connects as an ordinary role
+func (c *Client) ForTenant(id string) (*Client, error) {
+	if c.config.Backend == BackendPostgres {
+		if err := store.CheckRowSecurity(context.Background(), c.config.PostgresConnStr); err != nil {
+			return nil, err
+		}
+	}
+
+	scoped, err := c.store.Tenant(id)
+	if err != nil {
+		return nil, err
+	}
+
+	handle := *c
+	handle.store = scoped
+	handle.tenant = id
+	return &handle, nil
+}
@@ -1,3 +1,28 @@
 package types
 
 type JSONMap map[string]interface{}
+
+// ModelPrice is the price of an LLM model in currency units per million tokens
+type ModelPrice struct {
+	PromptPerMillion     float64
+	CompletionPerMillion float64
+}
+
+// PriceTable maps an LLM model name to its price
+type PriceTable map[string]ModelPrice
+
+// Identity is the caller of a retrieval. Chunks restricted to a set of principals are only
+// retrieved for callers whose principal or one of whose groups is in the set
+type Identity struct {
+	Principal string   // the user, e.g. "user:ada"
+	Groups    []string // the groups of the user, e.g. "group:hr"
+}
+
+// Principals returns the principal and groups of the identity
+func (i Identity) Principals() []string {
+	principals := make([]string, 0, len(i.Groups)+1)
+	if i.Principal != "" {
+		principals = append(principals, i.Principal)
+	}
+	return append(principals, i.Groups...)
+}
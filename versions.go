@@ -0,0 +1,82 @@
+package dynarag
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/Predixus/DynaRAG/internal/store"
+	"github.com/Predixus/DynaRAG/types"
+)
+
+// DocumentVersion identifies a version of a document, as created by Ingest
+type DocumentVersion struct {
+	FilePath  string
+	Version   int
+	ValidFrom time.Time
+}
+
+// Ingest stores the chunks of a file as a new version of its document. The previous
+// version stops being current, so Similar and Query only see the new chunks, but its
+// chunks are kept and remain searchable with AsOf a moment when it was current. Chunk adds
+// to the current version instead. The chunk options apply to every chunk
+func (c *Client) Ingest(
+	ctx context.Context,
+	filePath string,
+	chunks []string,
+	metadata *types.JSONMap,
+	opts ...ChunkOption,
+) (*DocumentVersion, error) {
+	metadatas := make([]*types.JSONMap, len(chunks))
+	for i := range metadatas {
+		metadatas[i] = metadata
+	}
+	return c.ingest(ctx, filePath, chunks, metadatas, opts)
+}
+
+// ingest stores the chunks of a file as a new version of its document, each with its own
+// metadata
+func (c *Client) ingest(
+	ctx context.Context,
+	filePath string,
+	chunks []string,
+	metadatas []*types.JSONMap,
+	opts []ChunkOption,
+) (*DocumentVersion, error) {
+	chunkCfg := newChunkConfig(opts)
+
+	params := make([]store.AddParams, len(chunks))
+	if len(chunks) > 0 {
+		embedder, err := store.Embedder()
+		if err != nil {
+			return nil, err
+		}
+		embeddings, err := embedder.GetEmbeddings(chunks)
+		if err != nil {
+			slog.Error("Could not embed chunks", "file_path", filePath, "error", err)
+			return nil, err
+		}
+		for i, chunk := range chunks {
+			params[i] = store.AddParams{
+				ChunkText: chunk,
+				Metadata:  metadatas[i],
+				Embedding: embeddings[i],
+
+				AllowedPrincipals: chunkCfg.allowedPrincipals,
+				ExpiresAt:         chunkCfg.expiresAt,
+			}
+		}
+	}
+
+	version, err := c.store.Ingest(ctx, filePath, params)
+	if err != nil {
+		slog.Error("Could not ingest document", "file_path", filePath, "error", err)
+		return nil, err
+	}
+	c.audit(ctx, AuditEntry{Operation: AuditIngest, FilePaths: []string{filePath}})
+	return &DocumentVersion{
+		FilePath:  filePath,
+		Version:   int(version.Version),
+		ValidFrom: version.ValidFrom.Time,
+	}, nil
+}